@@ -0,0 +1,70 @@
+package auth
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHasScope(t *testing.T) {
+	tests := []struct {
+		granted  []string
+		required string
+		want     bool
+	}{
+		{[]string{ScopeRepoRead}, ScopeRepoRead, true},
+		{[]string{ScopeRepoWrite}, ScopeRepoRead, true},
+		{[]string{ScopeRepoWrite}, ScopeRepoWrite, true},
+		{[]string{ScopeRepoRead}, ScopeRepoWrite, false},
+		{[]string{ScopeIssues}, ScopeRepoRead, false},
+		{[]string{ScopeIssues, ScopeAdminKeys}, ScopeAdminKeys, true},
+		{[]string{ScopeAdminKeys}, ScopeIssues, false},
+		{nil, ScopeRepoRead, false},
+		{[]string{}, ScopeIssues, false},
+	}
+
+	for _, tt := range tests {
+		if got := HasScope(tt.granted, tt.required); got != tt.want {
+			t.Errorf("HasScope(%v, %q) = %v, want %v", tt.granted, tt.required, got, tt.want)
+		}
+	}
+}
+
+func TestRequestHasScope(t *testing.T) {
+	session := httptest.NewRequest("GET", "/", nil)
+	session = session.WithContext(WithAuthentication(context.Background(), "1", nil))
+	if !RequestHasScope(session, ScopeAdminKeys) {
+		t.Error("session tokens should not be restricted by scopes")
+	}
+	if IsAccessTokenRequest(session) {
+		t.Error("session request reported as an access token request")
+	}
+
+	token := httptest.NewRequest("GET", "/", nil)
+	token = token.WithContext(WithAuthentication(context.Background(), "1", []string{ScopeIssues}))
+	if !IsAccessTokenRequest(token) {
+		t.Error("access token request not recognised")
+	}
+	if !RequestHasScope(token, ScopeIssues) {
+		t.Error("issues token rejected for the issues scope")
+	}
+	if RequestHasScope(token, ScopeRepoRead) {
+		t.Error("issues token accepted for repo:read")
+	}
+}
+
+func TestAccessTokenFormat(t *testing.T) {
+	token, hash, err := GenerateAccessToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsAccessToken(token) {
+		t.Errorf("generated token %q does not have the %q prefix", token, AccessTokenPrefix)
+	}
+	if hash != HashAccessToken(token) {
+		t.Error("returned hash does not match HashAccessToken")
+	}
+	if IsAccessToken("eyJhbGciOiJIUzI1NiJ9.e30.sig") {
+		t.Error("JWT reported as an access token")
+	}
+}
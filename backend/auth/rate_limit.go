@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"sync"
+	"time"
+)
+
+// FailureLimiter counts failed authentication attempts per key (for example a client IP)
+// and blocks the key for the rest of the window once too many attempts failed.
+type FailureLimiter struct {
+	mu          sync.Mutex
+	maxFailures int
+	window      time.Duration
+	attempts    map[string]*failedAttempts
+}
+
+type failedAttempts struct {
+	count       int
+	windowStart time.Time
+}
+
+// NewFailureLimiter creates a limiter allowing maxFailures failed attempts per window
+func NewFailureLimiter(maxFailures int, window time.Duration) *FailureLimiter {
+	return &FailureLimiter{
+		maxFailures: maxFailures,
+		window:      window,
+		attempts:    make(map[string]*failedAttempts),
+	}
+}
+
+// Blocked reports whether the key has used up its failed attempts, and if so how long until it may retry
+func (l *FailureLimiter) Blocked(key string) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry, ok := l.attempts[key]
+	if !ok {
+		return 0, false
+	}
+
+	remaining := l.window - time.Since(entry.windowStart)
+	if remaining <= 0 {
+		delete(l.attempts, key)
+		return 0, false
+	}
+
+	if entry.count < l.maxFailures {
+		return 0, false
+	}
+
+	return remaining, true
+}
+
+// Fail records a failed attempt for the key
+func (l *FailureLimiter) Fail(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	entry, ok := l.attempts[key]
+	if !ok || now.Sub(entry.windowStart) >= l.window {
+		entry = &failedAttempts{windowStart: now}
+		l.attempts[key] = entry
+	}
+	entry.count++
+
+	// Drop expired entries now and then so the map does not grow without bound
+	if len(l.attempts) > 10000 {
+		for k, e := range l.attempts {
+			if now.Sub(e.windowStart) >= l.window {
+				delete(l.attempts, k)
+			}
+		}
+	}
+}
+
+// Reset forgets the failed attempts of a key after a successful login
+func (l *FailureLimiter) Reset(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.attempts, key)
+}
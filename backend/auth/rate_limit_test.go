@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFailureLimiter(t *testing.T) {
+	l := NewFailureLimiter(3, time.Hour)
+
+	for i := 0; i < 2; i++ {
+		l.Fail("a")
+	}
+	if _, blocked := l.Blocked("a"); blocked {
+		t.Fatal("blocked before reaching the limit")
+	}
+
+	l.Fail("a")
+	retryAfter, blocked := l.Blocked("a")
+	if !blocked {
+		t.Fatal("not blocked after reaching the limit")
+	}
+	if retryAfter <= 0 || retryAfter > time.Hour {
+		t.Errorf("retry after %s, want within the window", retryAfter)
+	}
+
+	if _, blocked := l.Blocked("b"); blocked {
+		t.Error("failures of one key block another")
+	}
+
+	l.Reset("a")
+	if _, blocked := l.Blocked("a"); blocked {
+		t.Error("still blocked after Reset")
+	}
+}
+
+func TestFailureLimiterWindow(t *testing.T) {
+	l := NewFailureLimiter(2, 50*time.Millisecond)
+
+	l.Fail("a")
+	l.Fail("a")
+	if _, blocked := l.Blocked("a"); !blocked {
+		t.Fatal("not blocked after reaching the limit")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if _, blocked := l.Blocked("a"); blocked {
+		t.Error("still blocked after the window ended")
+	}
+
+	// A new window starts from the first failure after the last one ended
+	l.Fail("a")
+	if _, blocked := l.Blocked("a"); blocked {
+		t.Error("failures of an ended window were counted")
+	}
+}
@@ -32,9 +32,11 @@ func ConnectDB() error {
 
 	log.Printf("Connecting to SQLite database at: %s", dbPath)
 
-	// Open the SQLite database
+	// Open the SQLite database. Foreign keys are enabled in the connection string rather than
+	// with a PRAGMA, since a PRAGMA only applies to the one pooled connection it runs on and
+	// the cascades of the other connections would silently not run.
 	var err error
-	DB, err = sql.Open("sqlite3", dbPath)
+	DB, err = sql.Open("sqlite3", dbPath+"?_foreign_keys=on")
 	if err != nil {
 		return fmt.Errorf("error opening database connection: %w", err)
 	}
@@ -46,12 +48,6 @@ func ConnectDB() error {
 
 	log.Println("Successfully connected to SQLite database")
 
-	// Enable foreign keys in SQLite
-	_, err = DB.Exec("PRAGMA foreign_keys = ON")
-	if err != nil {
-		return fmt.Errorf("error enabling foreign keys: %w", err)
-	}
-
 	// Create the users table if it doesn't exist
 	_, err = DB.Exec(`
 		CREATE TABLE IF NOT EXISTS users (
@@ -59,6 +55,7 @@ func ConnectDB() error {
 			username TEXT UNIQUE NOT NULL,
 			email TEXT UNIQUE NOT NULL,
 			password TEXT NOT NULL,
+			type TEXT NOT NULL DEFAULT 'user', -- 'user' or 'organization'
 			created_at TIMESTAMP NOT NULL,
 			updated_at TIMESTAMP NOT NULL
 		)
@@ -66,6 +63,11 @@ func ConnectDB() error {
 	if err != nil {
 		return fmt.Errorf("error creating users table: %w", err)
 	}
+
+	// Databases created before organizations existed lack the account type column
+	if err := addColumnIfMissing("users", "type", "TEXT NOT NULL DEFAULT 'user'"); err != nil {
+		return err
+	}
 	
 	// Create the repositories table if it doesn't exist
 	_, err = DB.Exec(`
@@ -84,6 +86,11 @@ func ConnectDB() error {
 	if err != nil {
 		return fmt.Errorf("error creating repositories table: %w", err)
 	}
+
+	// Forks point at the repository they were forked from
+	if err := addColumnIfMissing("repositories", "parent_id", "TEXT REFERENCES repositories(id) ON DELETE SET NULL"); err != nil {
+		return err
+	}
 	
 	// Create the collaborators table for repository access management
 	_, err = DB.Exec(`
@@ -117,6 +124,35 @@ func ConnectDB() error {
 		return fmt.Errorf("error creating ssh_keys table: %w", err)
 	}
 
+	// Track when and from where each SSH key was last used
+	if err := addColumnIfMissing("ssh_keys", "last_used_at", "TIMESTAMP"); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing("ssh_keys", "last_used_ip", "TEXT"); err != nil {
+		return err
+	}
+
+	// Deploy keys grant SSH access to a single repository instead of a user account
+	_, err = DB.Exec(`
+		CREATE TABLE IF NOT EXISTS deploy_keys (
+			id TEXT PRIMARY KEY,
+			repository_id TEXT NOT NULL,
+			title TEXT NOT NULL,
+			public_key TEXT NOT NULL,
+			fingerprint TEXT UNIQUE NOT NULL,
+			read_only BOOLEAN NOT NULL DEFAULT 1,
+			created_by TEXT,
+			created_at TIMESTAMP NOT NULL,
+			last_used_at TIMESTAMP,
+			last_used_ip TEXT,
+			FOREIGN KEY(repository_id) REFERENCES repositories(id) ON DELETE CASCADE,
+			FOREIGN KEY(created_by) REFERENCES users(id) ON DELETE SET NULL
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating deploy_keys table: %w", err)
+	}
+
 	// Issues table 
 	_, err = DB.Exec(`
 		CREATE TABLE IF NOT EXISTS issues (
@@ -153,6 +189,378 @@ func ConnectDB() error {
 	if err != nil {
 		return fmt.Errorf("error creating issue_votes table: %w", err)
 	}
-	
+
+	// Pull requests propose merging a head branch into a base branch of the repository.
+	// The head branch may live in another repository (a fork) given by head_repository_id.
+	_, err = DB.Exec(`
+		CREATE TABLE IF NOT EXISTS pull_requests (
+			id TEXT PRIMARY KEY,
+			repository_id TEXT NOT NULL,
+			head_repository_id TEXT,
+			title TEXT NOT NULL,
+			description TEXT,
+			head_ref TEXT NOT NULL,
+			base_ref TEXT NOT NULL,
+			head_sha TEXT NOT NULL,
+			base_sha TEXT,
+			state TEXT NOT NULL DEFAULT 'open', -- 'open', 'closed', 'merged'
+			created_by TEXT NOT NULL,
+			created_at TIMESTAMP NOT NULL,
+			updated_at TIMESTAMP NOT NULL,
+			closed_at TIMESTAMP,
+			merged_at TIMESTAMP,
+			merged_by TEXT,
+			merge_method TEXT,
+			merge_commit_sha TEXT,
+			FOREIGN KEY(repository_id) REFERENCES repositories(id) ON DELETE CASCADE,
+			FOREIGN KEY(head_repository_id) REFERENCES repositories(id) ON DELETE SET NULL
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating pull_requests table: %w", err)
+	}
+
+	// Reviews are submitted on a pull request at a specific head commit
+	_, err = DB.Exec(`
+		CREATE TABLE IF NOT EXISTS pull_request_reviews (
+			id TEXT PRIMARY KEY,
+			pull_request_id TEXT NOT NULL,
+			state TEXT NOT NULL, -- 'approved', 'changes_requested', 'commented'
+			body TEXT,
+			commit_sha TEXT NOT NULL,
+			created_by TEXT NOT NULL,
+			submitted_at TIMESTAMP NOT NULL,
+			FOREIGN KEY(pull_request_id) REFERENCES pull_requests(id) ON DELETE CASCADE
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating pull_request_reviews table: %w", err)
+	}
+
+	// Review comments are anchored to a line of a file at a commit. side is 'RIGHT' for lines
+	// of the new version of the file and 'LEFT' for lines of the old version.
+	_, err = DB.Exec(`
+		CREATE TABLE IF NOT EXISTS pull_request_comments (
+			id TEXT PRIMARY KEY,
+			pull_request_id TEXT NOT NULL,
+			review_id TEXT,
+			in_reply_to TEXT,
+			path TEXT NOT NULL,
+			commit_sha TEXT NOT NULL,
+			line INTEGER NOT NULL,
+			side TEXT NOT NULL DEFAULT 'RIGHT',
+			body TEXT NOT NULL,
+			created_by TEXT NOT NULL,
+			created_at TIMESTAMP NOT NULL,
+			updated_at TIMESTAMP NOT NULL,
+			FOREIGN KEY(pull_request_id) REFERENCES pull_requests(id) ON DELETE CASCADE,
+			FOREIGN KEY(review_id) REFERENCES pull_request_reviews(id) ON DELETE CASCADE,
+			FOREIGN KEY(in_reply_to) REFERENCES pull_request_comments(id) ON DELETE CASCADE
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating pull_request_comments table: %w", err)
+	}
+
+	// Webhooks notify external services about events in a repository.
+	// events is a comma separated list of event names, or "*" for all events.
+	_, err = DB.Exec(`
+		CREATE TABLE IF NOT EXISTS webhooks (
+			id TEXT PRIMARY KEY,
+			repository_id TEXT NOT NULL,
+			url TEXT NOT NULL,
+			secret TEXT,
+			events TEXT NOT NULL,
+			active BOOLEAN NOT NULL DEFAULT 1,
+			created_by TEXT,
+			created_at TIMESTAMP NOT NULL,
+			updated_at TIMESTAMP NOT NULL,
+			FOREIGN KEY(repository_id) REFERENCES repositories(id) ON DELETE CASCADE,
+			FOREIGN KEY(created_by) REFERENCES users(id) ON DELETE SET NULL
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating webhooks table: %w", err)
+	}
+
+	// Webhook deliveries are the persistent queue and history of webhook requests. A delivery
+	// keeps its own URL and signature so it can still be sent after its repository is deleted.
+	_, err = DB.Exec(`
+		CREATE TABLE IF NOT EXISTS webhook_deliveries (
+			id TEXT PRIMARY KEY,
+			webhook_id TEXT,
+			event TEXT NOT NULL,
+			url TEXT NOT NULL,
+			payload TEXT NOT NULL,
+			signature TEXT,
+			status TEXT NOT NULL DEFAULT 'pending', -- 'pending', 'delivered', 'failed'
+			attempts INTEGER NOT NULL DEFAULT 0,
+			next_attempt_at TIMESTAMP,
+			last_attempt_at TIMESTAMP,
+			response_status INTEGER,
+			response_body TEXT,
+			error TEXT,
+			duration_ms INTEGER,
+			redelivery_of TEXT,
+			created_at TIMESTAMP NOT NULL,
+			FOREIGN KEY(webhook_id) REFERENCES webhooks(id) ON DELETE SET NULL
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating webhook_deliveries table: %w", err)
+	}
+
+	_, err = DB.Exec(`CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(status, next_attempt_at)`)
+	if err != nil {
+		return fmt.Errorf("error creating webhook_deliveries index: %w", err)
+	}
+
+	// Branch protection rules apply to every branch whose name matches the pattern
+	_, err = DB.Exec(`
+		CREATE TABLE IF NOT EXISTS branch_protections (
+			id TEXT PRIMARY KEY,
+			repository_id TEXT NOT NULL,
+			pattern TEXT NOT NULL,
+			allow_force_pushes BOOLEAN NOT NULL DEFAULT 0,
+			allow_deletions BOOLEAN NOT NULL DEFAULT 0,
+			restrict_pushes BOOLEAN NOT NULL DEFAULT 0,
+			require_pull_request BOOLEAN NOT NULL DEFAULT 0,
+			created_by TEXT,
+			created_at TIMESTAMP NOT NULL,
+			updated_at TIMESTAMP NOT NULL,
+			UNIQUE(repository_id, pattern),
+			FOREIGN KEY(repository_id) REFERENCES repositories(id) ON DELETE CASCADE,
+			FOREIGN KEY(created_by) REFERENCES users(id) ON DELETE SET NULL
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating branch_protections table: %w", err)
+	}
+
+	// Users allowed to push to branches of a rule that restricts pushes
+	_, err = DB.Exec(`
+		CREATE TABLE IF NOT EXISTS branch_protection_pushers (
+			protection_id TEXT NOT NULL,
+			user_id TEXT NOT NULL,
+			PRIMARY KEY(protection_id, user_id),
+			FOREIGN KEY(protection_id) REFERENCES branch_protections(id) ON DELETE CASCADE,
+			FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating branch_protection_pushers table: %w", err)
+	}
+
+	// Releases are published on tags; the tag is created when a release is published
+	_, err = DB.Exec(`
+		CREATE TABLE IF NOT EXISTS releases (
+			id TEXT PRIMARY KEY,
+			repository_id TEXT NOT NULL,
+			tag_name TEXT NOT NULL,
+			target_commitish TEXT NOT NULL,
+			name TEXT,
+			body TEXT,
+			draft BOOLEAN NOT NULL DEFAULT 0,
+			prerelease BOOLEAN NOT NULL DEFAULT 0,
+			author_id TEXT,
+			created_at TIMESTAMP NOT NULL,
+			updated_at TIMESTAMP NOT NULL,
+			published_at TIMESTAMP,
+			UNIQUE(repository_id, tag_name),
+			FOREIGN KEY(repository_id) REFERENCES repositories(id) ON DELETE CASCADE,
+			FOREIGN KEY(author_id) REFERENCES users(id) ON DELETE SET NULL
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating releases table: %w", err)
+	}
+
+	// Release assets are files uploaded to a release; their content is stored on disk
+	_, err = DB.Exec(`
+		CREATE TABLE IF NOT EXISTS release_assets (
+			id TEXT PRIMARY KEY,
+			release_id TEXT NOT NULL,
+			name TEXT NOT NULL,
+			content_type TEXT NOT NULL,
+			size INTEGER NOT NULL,
+			download_count INTEGER NOT NULL DEFAULT 0,
+			uploader_id TEXT,
+			created_at TIMESTAMP NOT NULL,
+			UNIQUE(release_id, name),
+			FOREIGN KEY(release_id) REFERENCES releases(id) ON DELETE CASCADE,
+			FOREIGN KEY(uploader_id) REFERENCES users(id) ON DELETE SET NULL
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating release_assets table: %w", err)
+	}
+
+	// Git LFS objects a repository holds. The content is stored once per object ID on disk;
+	// a repository can only download the objects uploaded to it.
+	_, err = DB.Exec(`
+		CREATE TABLE IF NOT EXISTS lfs_objects (
+			repository_id TEXT NOT NULL,
+			oid TEXT NOT NULL,
+			size INTEGER NOT NULL,
+			created_at TIMESTAMP NOT NULL,
+			PRIMARY KEY(repository_id, oid),
+			FOREIGN KEY(repository_id) REFERENCES repositories(id) ON DELETE CASCADE
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating lfs_objects table: %w", err)
+	}
+
+	// Git LFS file locks, at most one per path
+	_, err = DB.Exec(`
+		CREATE TABLE IF NOT EXISTS lfs_locks (
+			id TEXT PRIMARY KEY,
+			repository_id TEXT NOT NULL,
+			path TEXT NOT NULL,
+			ref TEXT,
+			owner_id TEXT NOT NULL,
+			locked_at TIMESTAMP NOT NULL,
+			UNIQUE(repository_id, path),
+			FOREIGN KEY(repository_id) REFERENCES repositories(id) ON DELETE CASCADE,
+			FOREIGN KEY(owner_id) REFERENCES users(id) ON DELETE CASCADE
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating lfs_locks table: %w", err)
+	}
+
+	// Organizations share the users namespace so they can own repositories;
+	// this table holds the organization-only profile data
+	_, err = DB.Exec(`
+		CREATE TABLE IF NOT EXISTS organizations (
+			id TEXT PRIMARY KEY,
+			display_name TEXT,
+			description TEXT,
+			created_at TIMESTAMP NOT NULL,
+			updated_at TIMESTAMP NOT NULL,
+			FOREIGN KEY(id) REFERENCES users(id) ON DELETE CASCADE
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating organizations table: %w", err)
+	}
+
+	// Create organization members table
+	_, err = DB.Exec(`
+		CREATE TABLE IF NOT EXISTS organization_members (
+			organization_id TEXT NOT NULL,
+			user_id TEXT NOT NULL,
+			role TEXT NOT NULL, -- 'owner' or 'member'
+			created_at TIMESTAMP NOT NULL,
+			PRIMARY KEY (organization_id, user_id),
+			FOREIGN KEY(organization_id) REFERENCES organizations(id) ON DELETE CASCADE,
+			FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating organization_members table: %w", err)
+	}
+
+	// Create teams table
+	_, err = DB.Exec(`
+		CREATE TABLE IF NOT EXISTS teams (
+			id TEXT PRIMARY KEY,
+			organization_id TEXT NOT NULL,
+			name TEXT NOT NULL,
+			description TEXT,
+			created_at TIMESTAMP NOT NULL,
+			updated_at TIMESTAMP NOT NULL,
+			UNIQUE(organization_id, name),
+			FOREIGN KEY(organization_id) REFERENCES organizations(id) ON DELETE CASCADE
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating teams table: %w", err)
+	}
+
+	// Create team members table
+	_, err = DB.Exec(`
+		CREATE TABLE IF NOT EXISTS team_members (
+			team_id TEXT NOT NULL,
+			user_id TEXT NOT NULL,
+			created_at TIMESTAMP NOT NULL,
+			PRIMARY KEY (team_id, user_id),
+			FOREIGN KEY(team_id) REFERENCES teams(id) ON DELETE CASCADE,
+			FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating team_members table: %w", err)
+	}
+
+	// Create team repositories table for team access grants
+	_, err = DB.Exec(`
+		CREATE TABLE IF NOT EXISTS team_repositories (
+			team_id TEXT NOT NULL,
+			repository_id TEXT NOT NULL,
+			permission TEXT NOT NULL, -- 'read', 'write', 'admin'
+			created_at TIMESTAMP NOT NULL,
+			PRIMARY KEY (team_id, repository_id),
+			FOREIGN KEY(team_id) REFERENCES teams(id) ON DELETE CASCADE,
+			FOREIGN KEY(repository_id) REFERENCES repositories(id) ON DELETE CASCADE
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating team_repositories table: %w", err)
+	}
+
+	// Create personal access tokens table; only a hash of each token is stored
+	_, err = DB.Exec(`
+		CREATE TABLE IF NOT EXISTS personal_access_tokens (
+			id TEXT PRIMARY KEY,
+			user_id TEXT NOT NULL,
+			name TEXT NOT NULL,
+			token_hash TEXT UNIQUE NOT NULL,
+			token_prefix TEXT NOT NULL,
+			scopes TEXT NOT NULL, -- comma separated, e.g. 'repo:read,issues'
+			expires_at TIMESTAMP,
+			last_used_at TIMESTAMP,
+			created_at TIMESTAMP NOT NULL,
+			FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating personal_access_tokens table: %w", err)
+	}
+
+	return nil
+}
+
+// addColumnIfMissing adds a column to an existing table so databases created
+// by older versions of the server pick up new columns
+func addColumnIfMissing(table, column, definition string) error {
+	rows, err := DB.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return fmt.Errorf("error reading %s table info: %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, columnType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &columnType, &notNull, &defaultValue, &pk); err != nil {
+			return fmt.Errorf("error reading %s table info: %w", table, err)
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error reading %s table info: %w", table, err)
+	}
+	rows.Close()
+
+	_, err = DB.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	if err != nil {
+		return fmt.Errorf("error adding %s column to %s table: %w", column, table, err)
+	}
+
+	log.Printf("Added column %s to table %s", column, table)
 	return nil
 }
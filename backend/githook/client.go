@@ -0,0 +1,141 @@
+package githook
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// requestTimeout limits how long a hook waits for the server
+const requestTimeout = 60 * time.Second
+
+// Run implements the "hook" subcommand that Git runs from the scripts installed by
+// utils.CreateRepositoryHooks, e.g. "server hook update <ref> <old> <new>". It forwards the
+// ref updates to the server and returns the exit code for Git: anything but 0 from
+// pre-receive or update rejects the push.
+func Run(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: hook <pre-receive|update|post-receive> [args]")
+		return 2
+	}
+
+	hook := args[0]
+	serverURL := os.Getenv(EnvURL)
+	if serverURL == "" || os.Getenv(EnvToken) == "" {
+		// Pushes that did not come through the server (e.g. on the server's own disk) cannot
+		// be checked, so they are refused; after a push was accepted there is nothing to refuse
+		if hook == PostReceive {
+			return 0
+		}
+		fmt.Fprintln(os.Stderr, "hook: this push cannot be checked by the server and is refused")
+		return 1
+	}
+
+	repoPath, err := os.Getwd()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "hook: cannot determine repository path: %v\n", err)
+		return 1
+	}
+
+	req := Request{
+		Hook:                       hook,
+		RepositoryID:               os.Getenv(EnvRepository),
+		RepoPath:                   repoPath,
+		UserID:                     os.Getenv(EnvUserID),
+		Username:                   os.Getenv(EnvUsername),
+		DeployKeyID:                os.Getenv(EnvDeployKeyID),
+		Protocol:                   os.Getenv(EnvProtocol),
+		ObjectDirectory:            os.Getenv("GIT_OBJECT_DIRECTORY"),
+		AlternateObjectDirectories: os.Getenv("GIT_ALTERNATE_OBJECT_DIRECTORIES"),
+	}
+
+	switch hook {
+	case PreReceive, PostReceive:
+		// Git writes one "<old> <new> <ref>" line per updated ref
+		req.Updates, err = readRefUpdates(os.Stdin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "hook: cannot read ref updates: %v\n", err)
+			return 1
+		}
+	case Update:
+		if len(args) != 4 {
+			fmt.Fprintln(os.Stderr, "usage: hook update <ref> <old> <new>")
+			return 2
+		}
+		req.Updates = []RefUpdate{{Ref: args[1], OldSHA: args[2], NewSHA: args[3]}}
+	default:
+		fmt.Fprintf(os.Stderr, "hook: unknown hook %q\n", hook)
+		return 2
+	}
+
+	resp, err := post(serverURL+"/"+hook, req)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "hook: %v\n", err)
+		// A push is refused when it cannot be checked; after it was accepted there is nothing to refuse
+		if hook == PostReceive {
+			return 0
+		}
+		return 1
+	}
+
+	if resp.Message != "" {
+		fmt.Fprintln(os.Stderr, resp.Message)
+	}
+	if !resp.Allowed {
+		return 1
+	}
+	return 0
+}
+
+// readRefUpdates parses the ref updates Git passes to pre-receive and post-receive
+func readRefUpdates(r io.Reader) ([]RefUpdate, error) {
+	updates := []RefUpdate{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 {
+			continue
+		}
+		updates = append(updates, RefUpdate{OldSHA: fields[0], NewSHA: fields[1], Ref: fields[2]})
+	}
+	return updates, scanner.Err()
+}
+
+// post sends a hook request to the server
+func post(endpoint string, req Request) (*Response, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set(TokenHeader, os.Getenv(EnvToken))
+
+	client := &http.Client{Timeout: requestTimeout}
+	httpResp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("cannot reach the server: %w", err)
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(httpResp.Body, 1024))
+		return nil, fmt.Errorf("server refused hook request (%d): %s", httpResp.StatusCode, strings.TrimSpace(string(message)))
+	}
+
+	var resp Response
+	if err := json.NewDecoder(httpResp.Body).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("invalid response from server: %w", err)
+	}
+	return &resp, nil
+}
@@ -0,0 +1,29 @@
+package githook
+
+import "testing"
+
+func TestRunRefusesUncheckedPushes(t *testing.T) {
+	tests := []struct {
+		name     string
+		url      string
+		token    string
+		args     []string
+		wantCode int
+	}{
+		{"pre-receive without server", "", "", []string{PreReceive}, 1},
+		{"update without server", "", "", []string{Update, "refs/heads/main", ZeroSHA, ZeroSHA}, 1},
+		{"update without secret", "http://127.0.0.1:1/internal/hooks", "", []string{Update, "refs/heads/main", ZeroSHA, ZeroSHA}, 1},
+		{"post-receive without server", "", "", []string{PostReceive}, 0},
+		{"post-receive without secret", "http://127.0.0.1:1/internal/hooks", "", []string{PostReceive}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(EnvURL, tt.url)
+			t.Setenv(EnvToken, tt.token)
+			if code := Run(tt.args); code != tt.wantCode {
+				t.Errorf("Run(%v) = %d, want %d", tt.args, code, tt.wantCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package githook
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"log"
+	"os"
+	"strings"
+)
+
+// Names of the server-side hooks installed in every repository
+const (
+	PreReceive  = "pre-receive"
+	Update      = "update"
+	PostReceive = "post-receive"
+)
+
+// Hooks lists the hooks that call back into the application
+var Hooks = []string{PreReceive, Update, PostReceive}
+
+// Environment variables passed from the server to Git, and from Git on to the hooks
+const (
+	EnvURL         = "NGH_HOOK_URL"
+	EnvToken       = "NGH_HOOK_TOKEN"
+	EnvRepository  = "NGH_REPOSITORY_ID"
+	EnvUserID      = "NGH_USER_ID"
+	EnvUsername    = "NGH_USERNAME"
+	EnvDeployKeyID = "NGH_DEPLOY_KEY_ID"
+	EnvProtocol    = "NGH_PROTOCOL"
+)
+
+// ZeroSHA is the old SHA of a ref being created, or the new SHA of a ref being deleted
+const ZeroSHA = "0000000000000000000000000000000000000000"
+
+// TokenHeader carries the shared secret that authenticates hook requests
+const TokenHeader = "X-Hook-Token"
+
+// binary, url and token are set by Configure when the server starts
+var (
+	binary string
+	url    string
+	token  string
+)
+
+// Pusher identifies who is pushing to a repository and how
+type Pusher struct {
+	RepositoryID string
+	UserID       string
+	Username     string
+	DeployKeyID  string
+	Protocol     string // "http" or "ssh"
+}
+
+// RefUpdate is a single ref changed by a push. A zero SHA means the ref is created or deleted.
+type RefUpdate struct {
+	Ref    string `json:"ref"`
+	OldSHA string `json:"old_sha"`
+	NewSHA string `json:"new_sha"`
+}
+
+// Request is sent by the hook subcommand to the internal hook endpoint
+type Request struct {
+	Hook         string      `json:"hook"`
+	RepositoryID string      `json:"repository_id"`
+	RepoPath     string      `json:"repo_path"`
+	UserID       string      `json:"user_id,omitempty"`
+	Username     string      `json:"username,omitempty"`
+	DeployKeyID  string      `json:"deploy_key_id,omitempty"`
+	Protocol     string      `json:"protocol"`
+	Updates      []RefUpdate `json:"updates"`
+
+	// Objects received by a push are quarantined until pre-receive and update accept it.
+	// Git commands run for those hooks need these to see the new objects.
+	ObjectDirectory            string `json:"object_directory,omitempty"`
+	AlternateObjectDirectories string `json:"alternate_object_directories,omitempty"`
+}
+
+// Response tells the hook whether to accept the push, with a message shown to the client
+type Response struct {
+	Allowed bool   `json:"allowed"`
+	Message string `json:"message,omitempty"`
+}
+
+// Configure sets where the hooks find the server. The secret comes from HOOK_SECRET, or is
+// generated for the lifetime of the process when it is not set.
+func Configure(serverURL string) {
+	url = strings.TrimSuffix(serverURL, "/")
+
+	var err error
+	binary, err = os.Executable()
+	if err != nil {
+		log.Printf("Failed to locate the server binary for Git hooks: %v", err)
+	}
+
+	token = os.Getenv("HOOK_SECRET")
+	if token == "" {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			log.Fatalf("Failed to generate Git hook secret: %v", err)
+		}
+		token = hex.EncodeToString(secret)
+	}
+}
+
+// Environ returns the environment variables to add to a Git process serving a push, so its
+// hooks can call back into the server on behalf of the pusher
+func Environ(pusher Pusher) []string {
+	if binary == "" || url == "" {
+		return nil
+	}
+
+	return []string{
+		EnvURL + "=" + url,
+		EnvToken + "=" + token,
+		EnvRepository + "=" + pusher.RepositoryID,
+		EnvUserID + "=" + pusher.UserID,
+		EnvUsername + "=" + pusher.Username,
+		EnvDeployKeyID + "=" + pusher.DeployKeyID,
+		EnvProtocol + "=" + pusher.Protocol,
+	}
+}
+
+// Binary returns the absolute path of the server binary the hooks run, or "" if it is unknown
+func Binary() string {
+	return binary
+}
+
+// ValidToken reports whether a hook request carries the secret of this server
+func ValidToken(candidate string) bool {
+	return token != "" && subtle.ConstantTimeCompare([]byte(candidate), []byte(token)) == 1
+}
+
+// GitEnv returns the environment Git commands need to see the objects of a push that has
+// not been accepted yet
+func (req *Request) GitEnv() []string {
+	env := []string{}
+	if req.ObjectDirectory != "" {
+		env = append(env, "GIT_OBJECT_DIRECTORY="+req.ObjectDirectory)
+	}
+	if req.AlternateObjectDirectories != "" {
+		env = append(env, "GIT_ALTERNATE_OBJECT_DIRECTORIES="+req.AlternateObjectDirectories)
+	}
+	return env
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github-clone/auth"
+	"github-clone/models"
+
+	"github.com/gorilla/mux"
+)
+
+// CreateAccessTokenResponse is returned once when a personal access token is created.
+// The token value cannot be retrieved again afterwards.
+type CreateAccessTokenResponse struct {
+	*models.AccessToken
+	Token string `json:"token"`
+}
+
+// AuthenticateToken validates a bearer credential and returns the user it belongs to.
+// Personal access tokens also return their scopes; session JWTs return nil scopes
+// because they are not restricted.
+func AuthenticateToken(tokenString string) (string, []string, error) {
+	if auth.IsAccessToken(tokenString) {
+		token, err := models.AuthenticateAccessToken(tokenString)
+		if err != nil {
+			return "", nil, err
+		}
+		return token.UserID, token.Scopes, nil
+	}
+
+	claims, err := auth.ValidateToken(tokenString)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return claims.UserID, nil, nil
+}
+
+// CreateAccessToken handles POST /api/user/tokens
+func CreateAccessToken(w http.ResponseWriter, r *http.Request) {
+	// Get the authenticated user ID from the token
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Tokens can only be managed from a login session, so a leaked token cannot mint new ones
+	if auth.IsAccessTokenRequest(r) {
+		http.Error(w, "Personal access tokens cannot manage tokens", http.StatusForbidden)
+		return
+	}
+
+	// Parse the request body
+	var input models.AccessTokenInput
+	err = json.NewDecoder(r.Body).Decode(&input)
+	if err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	// Validate input
+	if input.Name == "" {
+		http.Error(w, "Token name is required", http.StatusBadRequest)
+		return
+	}
+
+	token, plainToken, err := models.CreateAccessToken(userID, input)
+	if err != nil {
+		http.Error(w, "Failed to create access token: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Return success response
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(CreateAccessTokenResponse{AccessToken: token, Token: plainToken})
+}
+
+// GetAccessTokens handles GET /api/user/tokens
+func GetAccessTokens(w http.ResponseWriter, r *http.Request) {
+	// Get the authenticated user ID from the token
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if auth.IsAccessTokenRequest(r) {
+		http.Error(w, "Personal access tokens cannot manage tokens", http.StatusForbidden)
+		return
+	}
+
+	tokens, err := models.GetAccessTokensByUserID(userID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve access tokens", http.StatusInternalServerError)
+		return
+	}
+
+	// Return success response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tokens)
+}
+
+// DeleteAccessToken handles DELETE /api/user/tokens/{id}
+func DeleteAccessToken(w http.ResponseWriter, r *http.Request) {
+	// Get the authenticated user ID from the token
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if auth.IsAccessTokenRequest(r) {
+		http.Error(w, "Personal access tokens cannot manage tokens", http.StatusForbidden)
+		return
+	}
+
+	token, err := models.GetAccessTokenByID(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Error retrieving access token", http.StatusInternalServerError)
+		return
+	}
+
+	// Tokens of other users are reported as missing
+	if token == nil || token.UserID != userID {
+		http.Error(w, "Access token not found", http.StatusNotFound)
+		return
+	}
+
+	if err := models.DeleteAccessToken(token.ID); err != nil {
+		http.Error(w, "Failed to revoke access token", http.StatusInternalServerError)
+		return
+	}
+
+	// Return success response
+	w.WriteHeader(http.StatusNoContent)
+}
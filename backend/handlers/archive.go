@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github-clone/utils"
+
+	"github.com/gorilla/mux"
+)
+
+// archiveContentTypes are the content types of the archive formats
+var archiveContentTypes = map[string]string{
+	"tar.gz": "application/gzip",
+	"zip":    "application/zip",
+}
+
+// GetArchive handles GET /api/{username}/{reponame}/archive/{ref}.tar.gz and .zip
+// The archive holds the files of the repository at any branch, tag or commit, under a
+// top-level directory named <repository>-<ref>. Archives are cached, so repeated downloads
+// are served from disk.
+func GetArchive(w http.ResponseWriter, r *http.Request) {
+	repo, ok := loadRepositoryForViewer(w, r, getUserIDOptional(r))
+	if !ok {
+		return
+	}
+
+	// Split the ref from the extension of the archive format
+	ref, format := "", ""
+	for extension, archiveFormat := range utils.ArchiveFormats {
+		if name, found := strings.CutSuffix(mux.Vars(r)["archive"], extension); found && name != "" {
+			ref, format = name, archiveFormat
+		}
+	}
+	if format == "" {
+		http.Error(w, "Expected archive/{ref}.tar.gz or archive/{ref}.zip", http.StatusNotFound)
+		return
+	}
+
+	repoPath := utils.RepositoryDiskPath(repo.Owner.Username, repo.Name)
+	archive, err := utils.NewArchive(r.Context(), repoPath, repo.Name, ref, format)
+	if err == utils.ErrRefNotFound {
+		http.Error(w, "Ref not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error preparing archive of %s in %s: %v", ref, repoPath, err)
+		http.Error(w, "Error creating archive", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", archiveContentTypes[format])
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": archive.FileName()}))
+	w.Header().Set("ETag", `"`+archive.Tree+"-"+format+`"`)
+	w.Header().Set("Cache-Control", "private, no-cache")
+	if etagMatches(r.Header.Get("If-None-Match"), w.Header().Get("ETag")) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	// Cached archives are files, which also gives byte ranges and conditional requests
+	cached, err := utils.OpenCachedArchive(archive)
+	if err != nil {
+		log.Printf("Error opening cached archive %s: %v", archive.CachePath(), err)
+	}
+	if cached != nil {
+		defer cached.Close()
+		if info, err := cached.Stat(); err == nil {
+			http.ServeContent(w, r, archive.FileName(), info.ModTime(), cached)
+			return
+		}
+	}
+
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	// The first download streams the archive while it is being generated
+	if err := utils.WriteArchive(r.Context(), repoPath, archive, w); err != nil {
+		// The status has been sent with the first bytes, so the client sees a truncated archive
+		log.Printf("Error creating archive of %s in %s: %v", ref, repoPath, err)
+	}
+}
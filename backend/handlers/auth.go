@@ -119,8 +119,8 @@ func Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// password matching
-	if user == nil || !utils.CheckPasswordHash(req.Password, user.Password) {
+	// password matching (organizations have no password and can never log in)
+	if user == nil || user.IsOrganization() || !utils.CheckPasswordHash(req.Password, user.Password) {
 		http.Error(w, "Invalid email or password", http.StatusUnauthorized)
 		return
 	}
@@ -141,7 +141,8 @@ func Login(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(resp)
 }
 
-// GenerateGitAccessTokenHandler creates a new long-lived token for Git access
+// GenerateGitAccessTokenHandler creates a personal access token for Git access.
+// The token can push and pull, expires after a year and shows up in /api/user/tokens so it can be revoked.
 func GenerateGitAccessTokenHandler(w http.ResponseWriter, r *http.Request) {
 	log.Println("GenerateGitAccessTokenHandler: Entered handler")
 	// Assume userID is set in the request context by an auth middleware
@@ -155,17 +156,24 @@ func GenerateGitAccessTokenHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	log.Printf("GenerateGitAccessTokenHandler: UserID '%s' successfully retrieved from context", userID)
 
-	// Generate a long-lived token (e.g., 1 year)
-	// The actual expiration duration (e.g., 1 year) is set within GenerateLongLivedToken
-	log.Printf("GenerateGitAccessTokenHandler: Attempting to generate long-lived token for UserID: %s", userID)
-	longLivedToken, err := auth.GenerateLongLivedToken(userID, 1) // 1 for 1 year
+	if auth.IsAccessTokenRequest(r) {
+		http.Error(w, "Personal access tokens cannot manage tokens", http.StatusForbidden)
+		return
+	}
+
+	log.Printf("GenerateGitAccessTokenHandler: Attempting to generate Git access token for UserID: %s", userID)
+	_, gitAccessToken, err := models.CreateAccessToken(userID, models.AccessTokenInput{
+		Name:          "Git access token",
+		Scopes:        []string{auth.ScopeRepoRead, auth.ScopeRepoWrite},
+		ExpiresInDays: 365,
+	})
 	if err != nil {
 		http.Error(w, "Failed to generate Git access token", http.StatusInternalServerError)
 		return
 	}
 
 	resp := GitAccessTokenResponse{
-		GitAccessToken: longLivedToken,
+		GitAccessToken: gitAccessToken,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
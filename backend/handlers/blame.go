@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github-clone/utils"
+)
+
+// GetBlame handles GET /api/{username}/{reponame}/blame?path=&ref=
+// Every line of the file is attributed to the commit that last changed it, grouped into
+// ranges of consecutive lines. ref defaults to HEAD.
+func GetBlame(w http.ResponseWriter, r *http.Request) {
+	repo, ok := loadRepositoryForViewer(w, r, getUserIDOptional(r))
+	if !ok {
+		return
+	}
+
+	// Get the file path from query parameters
+	filePath := strings.Trim(r.URL.Query().Get("path"), "/")
+	if filePath == "" {
+		http.Error(w, "File path is required", http.StatusBadRequest)
+		return
+	}
+
+	repoPath := utils.RepositoryDiskPath(repo.Owner.Username, repo.Name)
+	blame, err := utils.GetBlame(r.Context(), repoPath, filePath, r.URL.Query().Get("ref"))
+	switch {
+	case err == utils.ErrRefNotFound:
+		http.Error(w, "Ref not found", http.StatusNotFound)
+		return
+	case err == utils.ErrPathNotFound:
+		http.Error(w, "File not found", http.StatusNotFound)
+		return
+	case err != nil:
+		log.Printf("Error blaming %s in %s: %v", filePath, repoPath, err)
+		http.Error(w, "Error retrieving blame", http.StatusInternalServerError)
+		return
+	}
+
+	// Return success response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(blame)
+}
@@ -0,0 +1,523 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github-clone/githook"
+	"github-clone/models"
+	"github-clone/utils"
+	"github-clone/webhook"
+
+	"github.com/gorilla/mux"
+)
+
+// BranchInput is used for creating branches
+type BranchInput struct {
+	Name string `json:"name"`
+	From string `json:"from"` // Branch, tag or commit to start from; defaults to the default branch
+}
+
+// TagInput is used for creating tags
+type TagInput struct {
+	Name    string `json:"name"`
+	Target  string `json:"target"`  // Branch, tag or commit to tag; defaults to the default branch
+	Message string `json:"message"` // Creates an annotated tag when set
+}
+
+// DefaultBranchInput is used for changing the default branch
+type DefaultBranchInput struct {
+	Branch string `json:"branch"`
+}
+
+// GetBranches handles GET /api/{username}/{reponame}/branches
+func GetBranches(w http.ResponseWriter, r *http.Request) {
+	repo, ok := loadRepositoryForViewer(w, r, getUserIDOptional(r))
+	if !ok {
+		return
+	}
+
+	repoPath := utils.RepositoryDiskPath(repo.Owner.Username, repo.Name)
+	branches, err := utils.ListBranches(r.Context(), repoPath)
+	if err != nil {
+		log.Printf("Error listing branches of %s: %v", repoPath, err)
+		http.Error(w, "Error retrieving branches", http.StatusInternalServerError)
+		return
+	}
+
+	if !markProtectedBranches(w, repo, branches) {
+		return
+	}
+
+	// Return success response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(branches)
+}
+
+// GetBranch handles GET /api/{username}/{reponame}/branches/{branch}
+func GetBranch(w http.ResponseWriter, r *http.Request) {
+	repo, ok := loadRepositoryForViewer(w, r, getUserIDOptional(r))
+	if !ok {
+		return
+	}
+
+	repoPath := utils.RepositoryDiskPath(repo.Owner.Username, repo.Name)
+	branch, err := utils.GetBranch(r.Context(), repoPath, mux.Vars(r)["branch"])
+	if err != nil {
+		http.Error(w, "Error retrieving branch", http.StatusInternalServerError)
+		return
+	}
+	if branch == nil {
+		http.Error(w, "Branch not found", http.StatusNotFound)
+		return
+	}
+
+	if !markProtectedBranches(w, repo, []*utils.Branch{branch}) {
+		return
+	}
+
+	// Return success response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(branch)
+}
+
+// CreateBranch handles POST /api/{username}/{reponame}/branches
+func CreateBranch(w http.ResponseWriter, r *http.Request) {
+	// Get the authenticated user ID from the token
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	repo, ok := loadRepositoryForPush(w, r, userID)
+	if !ok {
+		return
+	}
+
+	// Parse the request body
+	var input BranchInput
+	err = json.NewDecoder(r.Body).Decode(&input)
+	if err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	input.Name = strings.TrimPrefix(input.Name, "refs/heads/")
+	if !utils.IsValidRefName(input.Name) {
+		http.Error(w, "Invalid branch name", http.StatusBadRequest)
+		return
+	}
+
+	refusal, err := checkProtectedBranchChange(repo, input.Name, userID, false)
+	if err != nil {
+		http.Error(w, "Error checking branch protection", http.StatusInternalServerError)
+		return
+	}
+	if refusal != "" {
+		http.Error(w, refusal, http.StatusForbidden)
+		return
+	}
+
+	repoPath := utils.RepositoryDiskPath(repo.Owner.Username, repo.Name)
+	commitSHA, ok := resolveStartPoint(w, r, repoPath, input.From)
+	if !ok {
+		return
+	}
+
+	existing, err := utils.GetBranch(r.Context(), repoPath, input.Name)
+	if err != nil {
+		http.Error(w, "Error retrieving branch", http.StatusInternalServerError)
+		return
+	}
+	if existing != nil {
+		http.Error(w, "Branch already exists", http.StatusConflict)
+		return
+	}
+
+	refsBefore, _ := utils.ListRefs(r.Context(), repoPath)
+	if err := utils.CreateBranch(r.Context(), repoPath, input.Name, commitSHA); err != nil {
+		log.Printf("Error creating branch %s in %s: %v", input.Name, repoPath, err)
+		http.Error(w, "Failed to create branch", http.StatusInternalServerError)
+		return
+	}
+	notifyRefChange(r, repo, repoPath, userID, refsBefore)
+
+	branch, err := utils.GetBranch(r.Context(), repoPath, input.Name)
+	if err != nil || branch == nil {
+		http.Error(w, "Error retrieving branch", http.StatusInternalServerError)
+		return
+	}
+	if !markProtectedBranches(w, repo, []*utils.Branch{branch}) {
+		return
+	}
+
+	// Return success response
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(branch)
+}
+
+// DeleteBranch handles DELETE /api/{username}/{reponame}/branches/{branch}
+func DeleteBranch(w http.ResponseWriter, r *http.Request) {
+	// Get the authenticated user ID from the token
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	repo, ok := loadRepositoryForPush(w, r, userID)
+	if !ok {
+		return
+	}
+
+	name := mux.Vars(r)["branch"]
+	repoPath := utils.RepositoryDiskPath(repo.Owner.Username, repo.Name)
+
+	branch, err := utils.GetBranch(r.Context(), repoPath, name)
+	if err != nil {
+		http.Error(w, "Error retrieving branch", http.StatusInternalServerError)
+		return
+	}
+	if branch == nil {
+		http.Error(w, "Branch not found", http.StatusNotFound)
+		return
+	}
+
+	if branch.IsDefault {
+		http.Error(w, "The default branch cannot be deleted", http.StatusUnprocessableEntity)
+		return
+	}
+
+	refusal, err := checkProtectedBranchChange(repo, name, userID, true)
+	if err != nil {
+		http.Error(w, "Error checking branch protection", http.StatusInternalServerError)
+		return
+	}
+	if refusal != "" {
+		http.Error(w, refusal, http.StatusForbidden)
+		return
+	}
+
+	refsBefore, _ := utils.ListRefs(r.Context(), repoPath)
+	if err := utils.UpdateRef(r.Context(), repoPath, "refs/heads/"+name, githook.ZeroSHA, branch.Commit.SHA); err != nil {
+		log.Printf("Error deleting branch %s in %s: %v", name, repoPath, err)
+		http.Error(w, "Branch was modified, try again", http.StatusConflict)
+		return
+	}
+	notifyRefChange(r, repo, repoPath, userID, refsBefore)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetTags handles GET /api/{username}/{reponame}/tags
+func GetTags(w http.ResponseWriter, r *http.Request) {
+	repo, ok := loadRepositoryForViewer(w, r, getUserIDOptional(r))
+	if !ok {
+		return
+	}
+
+	repoPath := utils.RepositoryDiskPath(repo.Owner.Username, repo.Name)
+	tags, err := utils.ListTags(r.Context(), repoPath)
+	if err != nil {
+		log.Printf("Error listing tags of %s: %v", repoPath, err)
+		http.Error(w, "Error retrieving tags", http.StatusInternalServerError)
+		return
+	}
+
+	// Return success response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tags)
+}
+
+// GetTag handles GET /api/{username}/{reponame}/tags/{tag}
+func GetTag(w http.ResponseWriter, r *http.Request) {
+	repo, ok := loadRepositoryForViewer(w, r, getUserIDOptional(r))
+	if !ok {
+		return
+	}
+
+	repoPath := utils.RepositoryDiskPath(repo.Owner.Username, repo.Name)
+	tag, err := utils.GetTag(r.Context(), repoPath, mux.Vars(r)["tag"])
+	if err != nil {
+		http.Error(w, "Error retrieving tag", http.StatusInternalServerError)
+		return
+	}
+	if tag == nil {
+		http.Error(w, "Tag not found", http.StatusNotFound)
+		return
+	}
+
+	// Return success response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tag)
+}
+
+// CreateTag handles POST /api/{username}/{reponame}/tags
+func CreateTag(w http.ResponseWriter, r *http.Request) {
+	// Get the authenticated user ID from the token
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	repo, ok := loadRepositoryForPush(w, r, userID)
+	if !ok {
+		return
+	}
+
+	// Parse the request body
+	var input TagInput
+	err = json.NewDecoder(r.Body).Decode(&input)
+	if err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	input.Name = strings.TrimPrefix(input.Name, "refs/tags/")
+	if !utils.IsValidRefName(input.Name) {
+		http.Error(w, "Invalid tag name", http.StatusBadRequest)
+		return
+	}
+
+	repoPath := utils.RepositoryDiskPath(repo.Owner.Username, repo.Name)
+	commitSHA, ok := resolveStartPoint(w, r, repoPath, input.Target)
+	if !ok {
+		return
+	}
+
+	existing, err := utils.GetTag(r.Context(), repoPath, input.Name)
+	if err != nil {
+		http.Error(w, "Error retrieving tag", http.StatusInternalServerError)
+		return
+	}
+	if existing != nil {
+		http.Error(w, "Tag already exists", http.StatusConflict)
+		return
+	}
+
+	tagger, err := models.GetUserByID(userID)
+	if err != nil || tagger == nil {
+		http.Error(w, "Error retrieving user", http.StatusInternalServerError)
+		return
+	}
+
+	refsBefore, _ := utils.ListRefs(r.Context(), repoPath)
+	err = utils.CreateTag(r.Context(), repoPath, input.Name, commitSHA, input.Message, utils.GitSignature{Name: tagger.Username, Email: tagger.Email})
+	if err != nil {
+		log.Printf("Error creating tag %s in %s: %v", input.Name, repoPath, err)
+		http.Error(w, "Failed to create tag", http.StatusInternalServerError)
+		return
+	}
+	notifyRefChange(r, repo, repoPath, userID, refsBefore)
+
+	tag, err := utils.GetTag(r.Context(), repoPath, input.Name)
+	if err != nil || tag == nil {
+		http.Error(w, "Error retrieving tag", http.StatusInternalServerError)
+		return
+	}
+
+	// Return success response
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(tag)
+}
+
+// DeleteTag handles DELETE /api/{username}/{reponame}/tags/{tag}
+func DeleteTag(w http.ResponseWriter, r *http.Request) {
+	// Get the authenticated user ID from the token
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	repo, ok := loadRepositoryForPush(w, r, userID)
+	if !ok {
+		return
+	}
+
+	name := mux.Vars(r)["tag"]
+	repoPath := utils.RepositoryDiskPath(repo.Owner.Username, repo.Name)
+
+	tag, err := utils.GetTag(r.Context(), repoPath, name)
+	if err != nil {
+		http.Error(w, "Error retrieving tag", http.StatusInternalServerError)
+		return
+	}
+	if tag == nil {
+		http.Error(w, "Tag not found", http.StatusNotFound)
+		return
+	}
+
+	refsBefore, _ := utils.ListRefs(r.Context(), repoPath)
+	if err := utils.UpdateRef(r.Context(), repoPath, "refs/tags/"+name, githook.ZeroSHA, tag.SHA); err != nil {
+		log.Printf("Error deleting tag %s in %s: %v", name, repoPath, err)
+		http.Error(w, "Tag was modified, try again", http.StatusConflict)
+		return
+	}
+	notifyRefChange(r, repo, repoPath, userID, refsBefore)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetDefaultBranch handles GET /api/{username}/{reponame}/default-branch
+func GetDefaultBranch(w http.ResponseWriter, r *http.Request) {
+	repo, ok := loadRepositoryForViewer(w, r, getUserIDOptional(r))
+	if !ok {
+		return
+	}
+
+	repoPath := utils.RepositoryDiskPath(repo.Owner.Username, repo.Name)
+	defaultBranch, err := utils.GetDefaultBranch(r.Context(), repoPath)
+	if err != nil {
+		http.Error(w, "Error retrieving default branch", http.StatusInternalServerError)
+		return
+	}
+
+	// Return success response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"default_branch": defaultBranch})
+}
+
+// SetDefaultBranch handles PUT /api/{username}/{reponame}/default-branch
+func SetDefaultBranch(w http.ResponseWriter, r *http.Request) {
+	// Get the authenticated user ID from the token
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Only repository admins can change the default branch
+	repo, ok := loadRepositoryForAdmin(w, r, userID)
+	if !ok {
+		return
+	}
+
+	// Parse the request body
+	var input DefaultBranchInput
+	err = json.NewDecoder(r.Body).Decode(&input)
+	if err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	input.Branch = strings.TrimPrefix(input.Branch, "refs/heads/")
+	repoPath := utils.RepositoryDiskPath(repo.Owner.Username, repo.Name)
+
+	// The default branch must exist, unless the repository has no branches yet
+	branches, err := utils.ListBranches(r.Context(), repoPath)
+	if err != nil {
+		http.Error(w, "Error retrieving branches", http.StatusInternalServerError)
+		return
+	}
+	found := false
+	for _, branch := range branches {
+		if branch.Name == input.Branch {
+			found = true
+			break
+		}
+	}
+	if !found && (len(branches) > 0 || !utils.IsValidRefName(input.Branch)) {
+		http.Error(w, "Branch not found: "+input.Branch, http.StatusUnprocessableEntity)
+		return
+	}
+
+	if err := utils.SetDefaultBranch(r.Context(), repoPath, input.Branch); err != nil {
+		log.Printf("Error setting default branch of %s: %v", repoPath, err)
+		http.Error(w, "Failed to set default branch", http.StatusInternalServerError)
+		return
+	}
+
+	// Return success response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"default_branch": input.Branch})
+}
+
+// loadRepositoryForViewer looks up the repository named in the URL for a user who can view it
+func loadRepositoryForViewer(w http.ResponseWriter, r *http.Request, userID string) (*models.Repository, bool) {
+	vars := mux.Vars(r)
+
+	repo, err := models.GetRepositoryByUsernameAndName(vars["username"], vars["reponame"])
+	if err != nil {
+		http.Error(w, "Error retrieving repository", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	if repo == nil || !repoAccess.CanViewRepository(repo.ID, repo.OwnerID, repo.IsPublic, userID) {
+		http.Error(w, "Repository not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	return repo, true
+}
+
+// loadRepositoryForPush looks up the repository named in the URL for a user who can push to it
+func loadRepositoryForPush(w http.ResponseWriter, r *http.Request, userID string) (*models.Repository, bool) {
+	repo, ok := loadRepositoryForViewer(w, r, userID)
+	if !ok {
+		return nil, false
+	}
+
+	if !repoAccess.CanPushToRepository(repo.ID, repo.OwnerID, userID) {
+		http.Error(w, "You don't have permission to push to this repository", http.StatusForbidden)
+		return nil, false
+	}
+
+	return repo, true
+}
+
+// resolveStartPoint resolves the commit a new branch or tag points to, writing a 422 if the
+// ref does not exist
+func resolveStartPoint(w http.ResponseWriter, r *http.Request, repoPath, ref string) (string, bool) {
+	if ref == "" {
+		ref = "HEAD"
+	}
+
+	commitSHA, err := utils.ResolveCommit(r.Context(), repoPath, ref)
+	if err != nil {
+		http.Error(w, "Ref not found: "+ref, http.StatusUnprocessableEntity)
+		return "", false
+	}
+	return commitSHA, true
+}
+
+// markProtectedBranches flags the branches matched by a branch protection rule
+func markProtectedBranches(w http.ResponseWriter, repo *models.Repository, branches []*utils.Branch) bool {
+	protections, err := models.GetRepositoryBranchProtections(repo.ID)
+	if err != nil {
+		http.Error(w, "Error retrieving branch protections", http.StatusInternalServerError)
+		return false
+	}
+
+	for _, branch := range branches {
+		for _, p := range protections {
+			if p.Matches(branch.Name) {
+				branch.Protected = true
+				break
+			}
+		}
+	}
+	return true
+}
+
+// notifyRefChange sends push webhooks for branches and tags changed through the API, given
+// the refs of the repository before the change
+func notifyRefChange(r *http.Request, repo *models.Repository, repoPath, userID string, refsBefore map[string]string) {
+	if refsBefore == nil {
+		return
+	}
+
+	refsAfter, err := utils.ListRefs(r.Context(), repoPath)
+	if err != nil {
+		log.Printf("Error listing refs of %s: %v", repoPath, err)
+		return
+	}
+
+	webhook.Push(repo, repoPath, webhookSender(r, userID), refsBefore, refsAfter)
+}
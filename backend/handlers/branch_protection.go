@@ -0,0 +1,344 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github-clone/githook"
+	"github-clone/models"
+	"github-clone/utils"
+
+	"github.com/gorilla/mux"
+)
+
+// GetBranchProtections handles GET /api/{username}/{reponame}/branch-protections
+func GetBranchProtections(w http.ResponseWriter, r *http.Request) {
+	// Get the authenticated user ID from the token
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Only repository admins can manage branch protection
+	repo, ok := loadRepositoryForAdmin(w, r, userID)
+	if !ok {
+		return
+	}
+
+	protections, err := models.GetRepositoryBranchProtections(repo.ID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve branch protections", http.StatusInternalServerError)
+		return
+	}
+
+	// Return success response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(protections)
+}
+
+// CreateBranchProtection handles POST /api/{username}/{reponame}/branch-protections
+func CreateBranchProtection(w http.ResponseWriter, r *http.Request) {
+	// Get the authenticated user ID from the token
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Only repository admins can manage branch protection
+	repo, ok := loadRepositoryForAdmin(w, r, userID)
+	if !ok {
+		return
+	}
+
+	// Parse the request body
+	var input models.BranchProtectionInput
+	err = json.NewDecoder(r.Body).Decode(&input)
+	if err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if input.Pattern == nil {
+		http.Error(w, "Branch pattern is required", http.StatusBadRequest)
+		return
+	}
+
+	// New rules protect against force-pushes and deletion unless told otherwise
+	protection := &models.BranchProtection{
+		RepositoryID: repo.ID,
+		CreatedBy:    userID,
+		Pushers:      []*models.BranchProtectionPusher{},
+	}
+	if !applyBranchProtectionInput(w, protection, input) {
+		return
+	}
+
+	if !branchPatternAvailable(w, repo.ID, protection) {
+		return
+	}
+
+	if err := models.CreateBranchProtection(protection); err != nil {
+		http.Error(w, "Failed to create branch protection: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return success response
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(protection)
+}
+
+// GetBranchProtection handles GET /api/{username}/{reponame}/branch-protections/{id}
+func GetBranchProtection(w http.ResponseWriter, r *http.Request) {
+	// Get the authenticated user ID from the token
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	_, protection, ok := loadBranchProtection(w, r, userID)
+	if !ok {
+		return
+	}
+
+	// Return success response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(protection)
+}
+
+// UpdateBranchProtection handles PATCH /api/{username}/{reponame}/branch-protections/{id}
+func UpdateBranchProtection(w http.ResponseWriter, r *http.Request) {
+	// Get the authenticated user ID from the token
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	repo, protection, ok := loadBranchProtection(w, r, userID)
+	if !ok {
+		return
+	}
+
+	// Parse the request body
+	var input models.BranchProtectionInput
+	err = json.NewDecoder(r.Body).Decode(&input)
+	if err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if !applyBranchProtectionInput(w, protection, input) {
+		return
+	}
+
+	if !branchPatternAvailable(w, repo.ID, protection) {
+		return
+	}
+
+	if err := models.UpdateBranchProtection(protection); err != nil {
+		http.Error(w, "Failed to update branch protection: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return success response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(protection)
+}
+
+// DeleteBranchProtection handles DELETE /api/{username}/{reponame}/branch-protections/{id}
+func DeleteBranchProtection(w http.ResponseWriter, r *http.Request) {
+	// Get the authenticated user ID from the token
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	_, protection, ok := loadBranchProtection(w, r, userID)
+	if !ok {
+		return
+	}
+
+	if err := models.DeleteBranchProtection(protection.ID); err != nil {
+		http.Error(w, "Failed to delete branch protection", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// loadBranchProtection looks up the branch protection rule named in the URL for a repository admin
+func loadBranchProtection(w http.ResponseWriter, r *http.Request, userID string) (*models.Repository, *models.BranchProtection, bool) {
+	// Only repository admins can manage branch protection
+	repo, ok := loadRepositoryForAdmin(w, r, userID)
+	if !ok {
+		return nil, nil, false
+	}
+
+	protection, err := models.GetBranchProtectionByID(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Error retrieving branch protection", http.StatusInternalServerError)
+		return nil, nil, false
+	}
+
+	if protection == nil || protection.RepositoryID != repo.ID {
+		http.Error(w, "Branch protection not found", http.StatusNotFound)
+		return nil, nil, false
+	}
+
+	return repo, protection, true
+}
+
+// applyBranchProtectionInput copies the fields set in the input onto a rule, writing a 400
+// if the pattern is invalid or a pusher is not a user
+func applyBranchProtectionInput(w http.ResponseWriter, protection *models.BranchProtection, input models.BranchProtectionInput) bool {
+	if input.Pattern != nil {
+		pattern := strings.TrimPrefix(strings.TrimSpace(*input.Pattern), "refs/heads/")
+		if !models.IsValidBranchPattern(pattern) {
+			http.Error(w, "Invalid branch pattern", http.StatusBadRequest)
+			return false
+		}
+		protection.Pattern = pattern
+	}
+
+	if input.AllowForcePushes != nil {
+		protection.AllowForcePushes = *input.AllowForcePushes
+	}
+	if input.AllowDeletions != nil {
+		protection.AllowDeletions = *input.AllowDeletions
+	}
+	if input.RestrictPushes != nil {
+		protection.RestrictPushes = *input.RestrictPushes
+	}
+	if input.RequirePullRequest != nil {
+		protection.RequirePullRequest = *input.RequirePullRequest
+	}
+
+	if input.Pushers != nil {
+		pushers := []*models.BranchProtectionPusher{}
+		for _, username := range input.Pushers {
+			user, err := models.GetUserByUsername(username)
+			if err != nil {
+				http.Error(w, "Error retrieving user", http.StatusInternalServerError)
+				return false
+			}
+			if user == nil || user.IsOrganization() {
+				http.Error(w, "User not found: "+username, http.StatusBadRequest)
+				return false
+			}
+			pushers = append(pushers, &models.BranchProtectionPusher{ID: user.ID, Username: user.Username})
+		}
+		protection.Pushers = pushers
+	}
+
+	return true
+}
+
+// branchPatternAvailable writes a 409 if another rule of the repository has the same pattern
+func branchPatternAvailable(w http.ResponseWriter, repositoryID string, protection *models.BranchProtection) bool {
+	protections, err := models.GetRepositoryBranchProtections(repositoryID)
+	if err != nil {
+		http.Error(w, "Error retrieving branch protections", http.StatusInternalServerError)
+		return false
+	}
+
+	for _, existing := range protections {
+		if existing.Pattern == protection.Pattern && existing.ID != protection.ID {
+			http.Error(w, "A rule for this branch pattern already exists", http.StatusConflict)
+			return false
+		}
+	}
+	return true
+}
+
+// checkProtectedBranchPush decides whether a pushed ref update is allowed by the branch
+// protection rules of the repository. It returns the reason shown to the Git client when
+// the update is refused, or "" when it is allowed.
+func checkProtectedBranchPush(ctx context.Context, repo *models.Repository, req *githook.Request, update githook.RefUpdate) string {
+	if !strings.HasPrefix(update.Ref, "refs/heads/") {
+		return ""
+	}
+	branch := strings.TrimPrefix(update.Ref, "refs/heads/")
+
+	protections, err := models.GetBranchProtectionsForBranch(repo.ID, branch)
+	if err != nil {
+		log.Printf("Error retrieving branch protections of repository %s: %v", repo.ID, err)
+		return "Could not check the protection rules of branch " + branch
+	}
+	if len(protections) == 0 {
+		return ""
+	}
+
+	created := update.OldSHA == githook.ZeroSHA
+	deleted := update.NewSHA == githook.ZeroSHA
+
+	// Only non-fast-forward updates of existing branches are force-pushes
+	forced := false
+	if !created && !deleted {
+		isAncestor, err := utils.IsAncestorEnv(ctx, req.RepoPath, req.GitEnv(), update.OldSHA, update.NewSHA)
+		if err != nil {
+			log.Printf("Error checking for force-push to %s: %v", update.Ref, err)
+			return "Could not check the protection rules of branch " + branch
+		}
+		forced = !isAncestor
+	}
+
+	for _, p := range protections {
+		switch {
+		case deleted && !p.AllowDeletions:
+			return fmt.Sprintf("Branch %s is protected and cannot be deleted", branch)
+		case forced && !p.AllowForcePushes:
+			return fmt.Sprintf("Branch %s is protected and cannot be force-pushed", branch)
+		case !p.CanPush(req.UserID):
+			return fmt.Sprintf("Branch %s is protected and you are not allowed to push to it", branch)
+		case !created && !deleted && p.RequirePullRequest:
+			// Creating the branch is allowed, as there is nothing to review before it exists
+			return fmt.Sprintf("Branch %s is protected: changes must be made through a pull request", branch)
+		}
+	}
+
+	return ""
+}
+
+// checkProtectedBranchMerge decides whether a user may merge a pull request into a branch.
+// It returns the reason the merge is refused, or "" when it is allowed.
+func checkProtectedBranchMerge(repo *models.Repository, branch, userID string) (string, error) {
+	protections, err := models.GetBranchProtectionsForBranch(repo.ID, branch)
+	if err != nil {
+		return "", err
+	}
+
+	for _, p := range protections {
+		if !p.CanPush(userID) {
+			return fmt.Sprintf("Branch %s is protected and you are not allowed to merge into it", branch), nil
+		}
+	}
+	return "", nil
+}
+
+// checkProtectedBranchChange decides whether a user may create or delete a branch through
+// the API. It returns the reason the change is refused, or "" when it is allowed.
+func checkProtectedBranchChange(repo *models.Repository, branch, userID string, deleting bool) (string, error) {
+	protections, err := models.GetBranchProtectionsForBranch(repo.ID, branch)
+	if err != nil {
+		return "", err
+	}
+
+	for _, p := range protections {
+		if deleting && !p.AllowDeletions {
+			return fmt.Sprintf("Branch %s is protected and cannot be deleted", branch), nil
+		}
+		if !p.CanPush(userID) {
+			return fmt.Sprintf("Branch %s is protected and you are not allowed to push to it", branch), nil
+		}
+	}
+	return "", nil
+}
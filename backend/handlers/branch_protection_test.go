@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github-clone/githook"
+	"github-clone/models"
+	"github-clone/utils"
+)
+
+func TestCheckRefUpdatesBranchProtection(t *testing.T) {
+	owner, err := models.CreateUser("protectowner", "protectowner@example.com", "x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := models.CreateUser("protectother", "protectother@example.com", "x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err := models.CreateRepository(owner.ID, models.RepositoryInput{Name: "protected"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo.Owner = owner
+	repoPath := utils.RepositoryDiskPath(owner.Username, repo.Name)
+
+	// base is followed by next; rewritten shares only base with next, so moving a branch
+	// from next to rewritten is a force-push
+	base := writeTestCommit(t, repoPath, "", "a.txt", "one\n")
+	next := writeTestCommit(t, repoPath, base, "a.txt", "two\n")
+	rewritten := writeTestCommit(t, repoPath, base, "a.txt", "other\n")
+
+	rules := []*models.BranchProtection{
+		{Pattern: "main"},
+		{Pattern: "loose", AllowForcePushes: true, AllowDeletions: true},
+		{Pattern: "release/*", RestrictPushes: true, Pushers: []*models.BranchProtectionPusher{{ID: owner.ID}}},
+		{Pattern: "reviewed", RequirePullRequest: true},
+	}
+	for _, rule := range rules {
+		rule.RepositoryID = repo.ID
+		if err := models.CreateBranchProtection(rule); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	zero := githook.ZeroSHA
+	tests := []struct {
+		name        string
+		userID      string
+		deployKeyID string
+		ref         string
+		oldSHA      string
+		newSHA      string
+		refusal     string // Part of the message of a refused update, "" if it is allowed
+	}{
+		{"fast-forward", owner.ID, "", "refs/heads/main", base, next, ""},
+		{"force-push", owner.ID, "", "refs/heads/main", next, rewritten, "cannot be force-pushed"},
+		{"deletion", owner.ID, "", "refs/heads/main", next, zero, "cannot be deleted"},
+		{"creation", owner.ID, "", "refs/heads/main", zero, next, ""},
+		{"allowed force-push", owner.ID, "", "refs/heads/loose", next, rewritten, ""},
+		{"allowed deletion", owner.ID, "", "refs/heads/loose", next, zero, ""},
+		{"listed pusher", owner.ID, "", "refs/heads/release/1.0", base, next, ""},
+		{"unlisted pusher", other.ID, "", "refs/heads/release/1.0", base, next, "not allowed to push"},
+		{"deploy key on restricted branch", "", "key", "refs/heads/release/1.0", base, next, "not allowed to push"},
+		{"deploy key on unrestricted branch", "", "key", "refs/heads/main", base, next, ""},
+		{"update requiring a pull request", owner.ID, "", "refs/heads/reviewed", base, next, "through a pull request"},
+		{"creation requiring a pull request", owner.ID, "", "refs/heads/reviewed", zero, next, ""},
+		{"unprotected branch", other.ID, "", "refs/heads/feature", next, rewritten, ""},
+		{"tag", other.ID, "", "refs/tags/main", next, zero, ""},
+		{"reserved ref", owner.ID, "", "refs/pull/1/head", zero, next, "managed by the server"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &githook.Request{
+				Hook:         githook.Update,
+				RepositoryID: repo.ID,
+				RepoPath:     repoPath,
+				UserID:       tt.userID,
+				DeployKeyID:  tt.deployKeyID,
+				Updates:      []githook.RefUpdate{{Ref: tt.ref, OldSHA: tt.oldSHA, NewSHA: tt.newSHA}},
+			}
+			resp := checkRefUpdates(context.Background(), repo, req)
+
+			if tt.refusal == "" {
+				if !resp.Allowed {
+					t.Errorf("refused: %s", resp.Message)
+				}
+				return
+			}
+			if resp.Allowed {
+				t.Errorf("allowed, want refused with %q", tt.refusal)
+			} else if !strings.Contains(resp.Message, tt.refusal) {
+				t.Errorf("refused with %q, want %q", resp.Message, tt.refusal)
+			}
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github-clone/models"
+
+	"github.com/gorilla/mux"
+)
+
+// GetRepositoryCollaborators handles GET /api/{username}/{reponame}/collaborators
+func GetRepositoryCollaborators(w http.ResponseWriter, r *http.Request) {
+	// Get the authenticated user ID from the token
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	username := vars["username"]
+	repoName := vars["reponame"]
+
+	// Get the repository
+	repo, err := models.GetRepositoryByUsernameAndName(username, repoName)
+	if err != nil {
+		http.Error(w, "Error retrieving repository", http.StatusInternalServerError)
+		return
+	}
+
+	if repo == nil {
+		http.Error(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	// Hide private repositories from users without access
+	if !repoAccess.CanViewRepository(repo.ID, repo.OwnerID, repo.IsPublic, userID) {
+		http.Error(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	// Only users with push access can see who else has access
+	if !repoAccess.CanPushToRepository(repo.ID, repo.OwnerID, userID) {
+		http.Error(w, "You don't have permission to view collaborators of this repository", http.StatusForbidden)
+		return
+	}
+
+	collaborators, err := models.GetRepositoryCollaborators(repo.ID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve collaborators", http.StatusInternalServerError)
+		return
+	}
+
+	// Return success response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(collaborators)
+}
+
+// AddRepositoryCollaborator handles PUT /api/{username}/{reponame}/collaborators/{collaborator}
+// It invites a user or changes the permission of an existing collaborator
+func AddRepositoryCollaborator(w http.ResponseWriter, r *http.Request) {
+	// Get the authenticated user ID from the token
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	username := vars["username"]
+	repoName := vars["reponame"]
+	collaboratorName := vars["collaborator"]
+
+	// Get the repository
+	repo, err := models.GetRepositoryByUsernameAndName(username, repoName)
+	if err != nil {
+		http.Error(w, "Error retrieving repository", http.StatusInternalServerError)
+		return
+	}
+
+	if repo == nil {
+		http.Error(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	// Only repository admins can manage collaborators
+	if !repoAccess.CanAdminRepository(repo.ID, repo.OwnerID, userID) {
+		http.Error(w, "You don't have permission to manage collaborators of this repository", http.StatusForbidden)
+		return
+	}
+
+	// Look up the user being invited
+	collaborator, err := models.GetUserByUsername(collaboratorName)
+	if err != nil {
+		http.Error(w, "Error retrieving user", http.StatusInternalServerError)
+		return
+	}
+
+	if collaborator == nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	if collaborator.ID == repo.OwnerID {
+		http.Error(w, "The repository owner cannot be added as a collaborator", http.StatusBadRequest)
+		return
+	}
+
+	// Parse the request body
+	var input models.CollaboratorInput
+	err = json.NewDecoder(r.Body).Decode(&input)
+	if err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	result, err := models.AddCollaborator(repo.ID, collaborator.ID, input)
+	if err != nil {
+		http.Error(w, "Failed to add collaborator: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("User %s granted %s access on %s/%s to %s", userID, result.Permission, username, repoName, collaborator.Username)
+
+	// Return success response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// RemoveRepositoryCollaborator handles DELETE /api/{username}/{reponame}/collaborators/{collaborator}
+// Admins can remove anyone, and collaborators can remove themselves
+func RemoveRepositoryCollaborator(w http.ResponseWriter, r *http.Request) {
+	// Get the authenticated user ID from the token
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	username := vars["username"]
+	repoName := vars["reponame"]
+	collaboratorName := vars["collaborator"]
+
+	// Get the repository
+	repo, err := models.GetRepositoryByUsernameAndName(username, repoName)
+	if err != nil {
+		http.Error(w, "Error retrieving repository", http.StatusInternalServerError)
+		return
+	}
+
+	if repo == nil {
+		http.Error(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	// Look up the collaborator being removed
+	collaborator, err := models.GetUserByUsername(collaboratorName)
+	if err != nil {
+		http.Error(w, "Error retrieving user", http.StatusInternalServerError)
+		return
+	}
+
+	if collaborator == nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	if collaborator.ID != userID && !repoAccess.CanAdminRepository(repo.ID, repo.OwnerID, userID) {
+		http.Error(w, "You don't have permission to manage collaborators of this repository", http.StatusForbidden)
+		return
+	}
+
+	err = models.RemoveCollaborator(repo.ID, collaborator.ID)
+	if err != nil {
+		http.Error(w, "Failed to remove collaborator: "+err.Error(), http.StatusNotFound)
+		return
+	}
+
+	// Return success response
+	w.WriteHeader(http.StatusNoContent)
+}
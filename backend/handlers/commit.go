@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github-clone/utils"
+
+	"github.com/gorilla/mux"
+)
+
+// GetCommit handles GET /api/{username}/{reponame}/commits/{sha}
+// The sha may also be a branch or tag name. The response includes the full message, the
+// parents and the changed files with their patches.
+func GetCommit(w http.ResponseWriter, r *http.Request) {
+	repo, ok := loadRepositoryForViewer(w, r, getUserIDOptional(r))
+	if !ok {
+		return
+	}
+
+	repoPath := utils.RepositoryDiskPath(repo.Owner.Username, repo.Name)
+	commit, err := utils.GetCommitDetail(r.Context(), repoPath, mux.Vars(r)["sha"])
+	if err == utils.ErrRefNotFound {
+		http.Error(w, "Commit not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error retrieving commit from %s: %v", repoPath, err)
+		http.Error(w, "Error retrieving commit", http.StatusInternalServerError)
+		return
+	}
+
+	// Return success response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(commit)
+}
+
+// commitQueryFromRequest reads the commit history parameters: ref, path, follow (true unless
+// set to false), author, since, until, limit and cursor. Dates are RFC 3339 timestamps or
+// plain dates; a plain until date includes the whole day. Writes a 400 for invalid dates.
+func commitQueryFromRequest(w http.ResponseWriter, r *http.Request) (utils.CommitQuery, bool) {
+	params := r.URL.Query()
+
+	query := utils.CommitQuery{
+		Ref:    params.Get("ref"),
+		Path:   strings.Trim(params.Get("path"), "/"),
+		Follow: params.Get("follow") != "false",
+		Author: params.Get("author"),
+		Cursor: params.Get("cursor"),
+	}
+
+	if limit, err := strconv.Atoi(params.Get("limit")); err == nil {
+		query.Limit = limit
+	}
+
+	for _, param := range []string{"since", "until"} {
+		value := params.Get(param)
+		if value == "" {
+			continue
+		}
+
+		date, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			date, err = time.Parse("2006-01-02", value)
+			if err == nil && param == "until" {
+				date = date.Add(24*time.Hour - time.Second)
+			}
+		}
+		if err != nil {
+			http.Error(w, "Invalid "+param+" date, expected YYYY-MM-DD or an RFC 3339 timestamp", http.StatusBadRequest)
+			return query, false
+		}
+
+		if param == "since" {
+			query.Since = date
+		} else {
+			query.Until = date
+		}
+	}
+
+	return query, true
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github-clone/utils"
+
+	"github.com/gorilla/mux"
+)
+
+// CompareRefs handles GET /api/{username}/{reponame}/compare/{base}...{head}
+// base and head are branches, tags or commits. The result lists the commits head has since
+// it split off from base and the changes they make, like a pull request between the two.
+func CompareRefs(w http.ResponseWriter, r *http.Request) {
+	repo, ok := loadRepositoryForViewer(w, r, getUserIDOptional(r))
+	if !ok {
+		return
+	}
+
+	// Ref names cannot contain "..", so the separator is unambiguous
+	base, head, found := strings.Cut(mux.Vars(r)["basehead"], "...")
+	if !found || base == "" || head == "" {
+		http.Error(w, "Expected compare/{base}...{head}", http.StatusBadRequest)
+		return
+	}
+
+	repoPath := utils.RepositoryDiskPath(repo.Owner.Username, repo.Name)
+	comparison, err := utils.CompareRefs(r.Context(), repoPath, base, head)
+	switch {
+	case err == utils.ErrRefNotFound:
+		http.Error(w, "Ref not found", http.StatusNotFound)
+		return
+	case err == utils.ErrNoCommonHistory:
+		http.Error(w, base+" and "+head+" have no common history", http.StatusUnprocessableEntity)
+		return
+	case err != nil:
+		log.Printf("Error comparing %s...%s in %s: %v", base, head, repoPath, err)
+		http.Error(w, "Error comparing refs", http.StatusInternalServerError)
+		return
+	}
+
+	// Return success response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(comparison)
+}
@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github-clone/models"
+	"github-clone/ssh"
+
+	"github.com/gorilla/mux"
+)
+
+// GetDeployKeys handles GET /api/{username}/{reponame}/keys
+func GetDeployKeys(w http.ResponseWriter, r *http.Request) {
+	// Get the authenticated user ID from the token
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	repo, ok := loadRepositoryForAdmin(w, r, userID)
+	if !ok {
+		return
+	}
+
+	keys, err := models.GetRepositoryDeployKeys(repo.ID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve deploy keys", http.StatusInternalServerError)
+		return
+	}
+
+	// Return success response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(keys)
+}
+
+// AddDeployKey handles POST /api/{username}/{reponame}/keys
+func AddDeployKey(w http.ResponseWriter, r *http.Request) {
+	// Get the authenticated user ID from the token
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	repo, ok := loadRepositoryForAdmin(w, r, userID)
+	if !ok {
+		return
+	}
+
+	// Parse the request body
+	var input models.DeployKeyInput
+	err = json.NewDecoder(r.Body).Decode(&input)
+	if err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	// Validate input
+	if input.Title == "" || input.PublicKey == "" {
+		http.Error(w, "Title and public key are required", http.StatusBadRequest)
+		return
+	}
+
+	fingerprint, err := ssh.ParsePublicKey(input.PublicKey)
+	if err != nil {
+		http.Error(w, "Invalid SSH public key: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// A key identifies exactly one user or one repository, never both
+	if !sshKeyFingerprintAvailable(w, fingerprint) {
+		return
+	}
+
+	key, err := models.CreateDeployKey(repo.ID, userID, input, fingerprint)
+	if err != nil {
+		http.Error(w, "Failed to add deploy key: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Deploy key %s (read only: %t) added to repository %s", key.ID, key.ReadOnly, repo.ID)
+
+	// Return success response
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(key)
+}
+
+// DeleteDeployKey handles DELETE /api/{username}/{reponame}/keys/{id}
+func DeleteDeployKey(w http.ResponseWriter, r *http.Request) {
+	// Get the authenticated user ID from the token
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	repo, ok := loadRepositoryForAdmin(w, r, userID)
+	if !ok {
+		return
+	}
+
+	key, err := models.GetDeployKeyByID(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Error retrieving deploy key", http.StatusInternalServerError)
+		return
+	}
+
+	if key == nil || key.RepositoryID != repo.ID {
+		http.Error(w, "Deploy key not found", http.StatusNotFound)
+		return
+	}
+
+	if err := models.DeleteDeployKey(key.ID); err != nil {
+		http.Error(w, "Failed to delete deploy key", http.StatusInternalServerError)
+		return
+	}
+
+	// Return success response
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// loadRepositoryForAdmin looks up the repository named in the URL and writes an error
+// unless the user can administer it. Repositories the user cannot see are reported as missing.
+func loadRepositoryForAdmin(w http.ResponseWriter, r *http.Request, userID string) (*models.Repository, bool) {
+	vars := mux.Vars(r)
+
+	repo, err := models.GetRepositoryByUsernameAndName(vars["username"], vars["reponame"])
+	if err != nil {
+		http.Error(w, "Error retrieving repository", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	if repo == nil || !repoAccess.CanViewRepository(repo.ID, repo.OwnerID, repo.IsPublic, userID) {
+		http.Error(w, "Repository not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	if !repoAccess.CanAdminRepository(repo.ID, repo.OwnerID, userID) {
+		http.Error(w, "You don't have permission to manage this repository", http.StatusForbidden)
+		return nil, false
+	}
+
+	return repo, true
+}
+
+// sshKeyFingerprintAvailable writes a 409 if a user key or deploy key with the fingerprint already exists
+func sshKeyFingerprintAvailable(w http.ResponseWriter, fingerprint string) bool {
+	userKey, err := models.GetSSHKeyByFingerprint(fingerprint)
+	if err != nil {
+		http.Error(w, "Error checking SSH key", http.StatusInternalServerError)
+		return false
+	}
+
+	deployKey, err := models.GetDeployKeyByFingerprint(fingerprint)
+	if err != nil {
+		http.Error(w, "Error checking SSH key", http.StatusInternalServerError)
+		return false
+	}
+
+	if userKey != nil || deployKey != nil {
+		http.Error(w, "This SSH key is already in use", http.StatusConflict)
+		return false
+	}
+
+	return true
+}
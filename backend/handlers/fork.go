@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github-clone/models"
+
+	"github.com/gorilla/mux"
+)
+
+// ForkInput is the optional body of a fork request
+type ForkInput struct {
+	Name         string `json:"name"`         // Defaults to the name of the forked repository
+	Organization string `json:"organization"` // Fork into an organization the user owns instead of the user's account
+}
+
+// CreateFork handles POST /api/{username}/{reponame}/forks
+func CreateFork(w http.ResponseWriter, r *http.Request) {
+	// Get the authenticated user ID from the token
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+
+	// Get the repository to fork
+	parent, err := models.GetRepositoryByUsernameAndName(vars["username"], vars["reponame"])
+	if err != nil {
+		http.Error(w, "Error retrieving repository", http.StatusInternalServerError)
+		return
+	}
+
+	// Anyone who can view a repository can fork it
+	if parent == nil || !repoAccess.CanViewRepository(parent.ID, parent.OwnerID, parent.IsPublic, userID) {
+		http.Error(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	// Parse the request body; an empty body forks into the user's account
+	var input ForkInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	name := input.Name
+	if name == "" {
+		name = parent.Name
+	}
+	if name == "." || name == ".." || strings.ContainsAny(name, "/\\") {
+		http.Error(w, "Invalid repository name", http.StatusBadRequest)
+		return
+	}
+
+	ownerID := userID
+	if input.Organization != "" {
+		org, ok := loadOrganization(w, input.Organization)
+		if !ok {
+			return
+		}
+
+		// Only organization owners can create repositories
+		if !requireOrganizationOwner(w, org, userID) {
+			return
+		}
+		ownerID = org.ID
+	}
+
+	existingRepo, err := models.GetRepositoryByOwnerAndName(ownerID, name)
+	if err != nil {
+		http.Error(w, "Server error checking repository existence", http.StatusInternalServerError)
+		return
+	}
+	if existingRepo != nil {
+		http.Error(w, "A repository with this name already exists", http.StatusConflict)
+		return
+	}
+
+	fork, err := models.CreateFork(parent, ownerID, name)
+	if err != nil {
+		log.Printf("Failed to fork %s/%s: %v", parent.Owner.Username, parent.Name, err)
+		http.Error(w, "Failed to fork repository: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Repository %s/%s forked to %s/%s", parent.Owner.Username, parent.Name, fork.Owner.Username, fork.Name)
+
+	// Return success response
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(fork)
+}
+
+// GetRepositoryForks handles GET /api/{username}/{reponame}/forks
+// Only forks the user can view are listed
+func GetRepositoryForks(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDOptional(r)
+	vars := mux.Vars(r)
+
+	repo, err := models.GetRepositoryByUsernameAndName(vars["username"], vars["reponame"])
+	if err != nil {
+		http.Error(w, "Error retrieving repository", http.StatusInternalServerError)
+		return
+	}
+
+	if repo == nil || !repoAccess.CanViewRepository(repo.ID, repo.OwnerID, repo.IsPublic, userID) {
+		http.Error(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	forks, err := models.GetRepositoryForks(repo.ID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve forks", http.StatusInternalServerError)
+		return
+	}
+
+	visible := []*models.Repository{}
+	for _, fork := range forks {
+		if repoAccess.CanViewRepository(fork.ID, fork.OwnerID, fork.IsPublic, userID) {
+			visible = append(visible, fork)
+		}
+	}
+
+	// Return success response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(visible)
+}
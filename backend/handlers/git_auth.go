@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github-clone/auth"
+	"github-clone/models"
+	"github-clone/utils"
+)
+
+// GitAuthRealm is the realm announced to Git clients in the Basic authentication challenge
+const GitAuthRealm = "NotGitHub"
+
+// gitAuthLimiter slows down password guessing against the Git HTTP endpoints. Failures are
+// counted per username and client IP, so guessing from one address cannot lock the owner of
+// the account out from another.
+var gitAuthLimiter = auth.NewFailureLimiter(10, 15*time.Minute)
+
+// gitAuthIPLimiter limits the failures of a client IP across all usernames, so one address
+// cannot try a few passwords for many accounts
+var gitAuthIPLimiter = auth.NewFailureLimiter(50, 15*time.Minute)
+
+// RequestGitAuthentication answers with 401 and a Basic challenge, so Git clients
+// and credential helpers prompt for a username and password or token
+func RequestGitAuthentication(w http.ResponseWriter, message string) {
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q", GitAuthRealm))
+	http.Error(w, message, http.StatusUnauthorized)
+}
+
+// AuthenticateGitRequest reads optional credentials from a Git HTTP request.
+// Git clients send HTTP Basic credentials, where the password may be the account
+// password, a personal access token or a session token; Bearer tokens are accepted too.
+// Requests without credentials pass through anonymously and HandleGitHTTP decides whether
+// they may proceed. Invalid credentials are rejected with a new challenge, and clients
+// that fail too often are refused with 429 until the limit window ends. Tokens cannot be
+// guessed, so they are accepted even then.
+func AuthenticateGitRequest(w http.ResponseWriter, r *http.Request) (*http.Request, bool) {
+	var username, secret string
+
+	if user, password, ok := r.BasicAuth(); ok {
+		username, secret = user, password
+	} else if authHeader := r.Header.Get("Authorization"); strings.HasPrefix(authHeader, "Bearer ") {
+		secret = strings.TrimPrefix(authHeader, "Bearer ")
+	}
+
+	if secret == "" {
+		return r, true
+	}
+
+	// Tokens identify their user themselves, so the username is not checked.
+	// Git requires one to be entered, and people commonly type anything there.
+	if userID, scopes, err := AuthenticateToken(secret); err == nil {
+		return r.WithContext(auth.WithAuthentication(r.Context(), userID, scopes)), true
+	}
+
+	ip := clientIP(r)
+	ipKey := "ip:" + ip
+	userKey := "user:" + strings.ToLower(username) + "@" + ip
+
+	retryAfter, blocked := gitAuthIPLimiter.Blocked(ipKey)
+	if !blocked {
+		retryAfter, blocked = gitAuthLimiter.Blocked(userKey)
+	}
+	if blocked {
+		log.Printf("Git authentication rate limited for user %q from %s", username, ip)
+		w.Header().Set("Retry-After", fmt.Sprintf("%d", int(retryAfter.Seconds())+1))
+		http.Error(w, "Too many failed authentication attempts, try again later", http.StatusTooManyRequests)
+		return r, false
+	}
+
+	userID, err := authenticateGitPassword(username, secret)
+	if err != nil {
+		log.Printf("Git authentication failed for user %q from %s: %v", username, ip, err)
+		gitAuthIPLimiter.Fail(ipKey)
+		gitAuthLimiter.Fail(userKey)
+		RequestGitAuthentication(w, "Invalid username, password or token")
+		return r, false
+	}
+
+	// The failures of the address are kept, so logging in to an account of one's own does
+	// not allow more guesses against others
+	gitAuthLimiter.Reset(userKey)
+
+	return r.WithContext(auth.WithAuthentication(r.Context(), userID, nil)), true
+}
+
+// authenticateGitPassword checks a username, or email address, and the account password
+func authenticateGitPassword(username, password string) (string, error) {
+	if username == "" {
+		return "", auth.ErrInvalidToken
+	}
+
+	user, err := models.GetUserByUsername(username)
+	if err == nil && user == nil {
+		user, err = models.GetUserByEmail(username)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if user == nil || user.IsOrganization() || !utils.CheckPasswordHash(password, user.Password) {
+		return "", fmt.Errorf("invalid username or password")
+	}
+
+	return user.ID, nil
+}
+
+// clientIP returns the IP address of the client that sent the request
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
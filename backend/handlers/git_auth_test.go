@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github-clone/auth"
+	"github-clone/models"
+	"github-clone/utils"
+)
+
+// gitAuthRequest sends Basic credentials from a client IP through AuthenticateGitRequest and
+// returns the status written, or 200 with the authenticated user if the request may proceed
+func gitAuthRequest(ip, username, secret string) (int, string) {
+	r := httptest.NewRequest("GET", "/git/owner/repo/info/refs", nil)
+	r.RemoteAddr = ip + ":40000"
+	r.SetBasicAuth(username, secret)
+	w := httptest.NewRecorder()
+
+	r, ok := AuthenticateGitRequest(w, r)
+	if !ok {
+		return w.Code, ""
+	}
+	userID, _ := r.Context().Value(auth.UserIDKey).(string)
+	return http.StatusOK, userID
+}
+
+// createPasswordUser creates a user whose password is "correct-password"
+func createPasswordUser(t *testing.T, username string) *models.User {
+	t.Helper()
+	hash, err := utils.HashPassword("correct-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := models.CreateUser(username, username+"@example.com", hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func TestGitAuthLockout(t *testing.T) {
+	victim := createPasswordUser(t, "lockvictim")
+	_, token, err := models.CreateAccessToken(victim.ID, models.AccessTokenInput{Name: "git", Scopes: []string{auth.ScopeRepoRead}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const attacker = "198.51.100.1"
+	for i := 0; i < 10; i++ {
+		if code, _ := gitAuthRequest(attacker, "lockvictim", "wrong"); code != http.StatusUnauthorized {
+			t.Fatalf("failed attempt %d: status %d, want 401", i+1, code)
+		}
+	}
+	if code, _ := gitAuthRequest(attacker, "lockvictim", "correct-password"); code != http.StatusTooManyRequests {
+		t.Errorf("attempt after the limit: status %d, want 429", code)
+	}
+
+	// The owner of the account is not locked out from elsewhere
+	if code, userID := gitAuthRequest("198.51.100.2", "lockvictim", "correct-password"); code != http.StatusOK || userID != victim.ID {
+		t.Errorf("login from another address: status %d, user %q", code, userID)
+	}
+
+	// Tokens are accepted even from the blocked address
+	if code, userID := gitAuthRequest(attacker, "anything", token); code != http.StatusOK || userID != victim.ID {
+		t.Errorf("token login from the blocked address: status %d, user %q", code, userID)
+	}
+}
+
+func TestGitAuthLockoutReset(t *testing.T) {
+	user := createPasswordUser(t, "lockreset")
+
+	const ip = "198.51.100.3"
+	for i := 0; i < 9; i++ {
+		gitAuthRequest(ip, "lockreset", "wrong")
+	}
+	if code, userID := gitAuthRequest(ip, "lockreset", "correct-password"); code != http.StatusOK || userID != user.ID {
+		t.Fatalf("login: status %d, user %q", code, userID)
+	}
+
+	// The successful login started the count again
+	for i := 0; i < 9; i++ {
+		gitAuthRequest(ip, "lockreset", "wrong")
+	}
+	if code, _ := gitAuthRequest(ip, "lockreset", "correct-password"); code != http.StatusOK {
+		t.Errorf("login after the count was reset: status %d, want 200", code)
+	}
+}
+
+func TestGitAuthIPLimit(t *testing.T) {
+	const ip = "198.51.100.4"
+	for i := 0; i < 50; i++ {
+		gitAuthRequest(ip, "nosuchuser"+string(rune('a'+i%26))+string(rune('a'+i/26)), "wrong")
+	}
+	if code, _ := gitAuthRequest(ip, "someoneelse", "wrong"); code != http.StatusTooManyRequests {
+		t.Errorf("attempt after the address limit: status %d, want 429", code)
+	}
+}
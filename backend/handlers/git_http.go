@@ -2,14 +2,21 @@ package handlers
 
 import (
 	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/textproto"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 
+	"github-clone/auth"
+	"github-clone/githook"
 	"github-clone/models"
 	"github-clone/utils"
 
@@ -29,6 +36,11 @@ func HandleGitHTTP(w http.ResponseWriter, r *http.Request) {
 
 	userID := getUserIDOptional(r)
 
+	// A personal access token without repo:read only reaches what anonymous users can see
+	if userID != "" && !auth.RequestHasScope(r, auth.ScopeRepoRead) {
+		userID = ""
+	}
+
 	// Check repository visibility to see what user has access
 	repo, err := models.GetRepositoryByUsernameAndName(username, reponame)
 	if err != nil {
@@ -36,7 +48,12 @@ func HandleGitHTTP(w http.ResponseWriter, r *http.Request) {
 	} else if repo != nil {
 		// repository exists in db, check if the user has access
 		repoAccessChecker := utils.NewRepoAccess()
-		if !repoAccessChecker.CanCloneRepository(repo.OwnerID, repo.IsPublic, userID) {
+		if !repoAccessChecker.CanCloneRepository(repo.ID, repo.OwnerID, repo.IsPublic, userID) {
+			// Anonymous clients get a challenge so Git asks for credentials
+			if userID == "" {
+				RequestGitAuthentication(w, "Authentication required")
+				return
+			}
 			http.Error(w, "You don't have access to this repository", http.StatusForbidden)
 			return
 		}
@@ -104,7 +121,7 @@ func HandleGitHTTP(w http.ResponseWriter, r *http.Request) {
 	// Authorize 'git-receive-pack' (push) operations
 	if service == "git-receive-pack" {
 		if userID == "" { // userID is from getUserIDOptional(r) called earlier
-			http.Error(w, "Authentication required: A valid token is needed to push.", http.StatusUnauthorized)
+			RequestGitAuthentication(w, "Authentication required: A valid password or token is needed to push.")
 			return
 		}
 		// Ensure repo object is available (fetched earlier)
@@ -113,8 +130,12 @@ func HandleGitHTTP(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "Repository not found or access denied.", http.StatusNotFound)
 			return
 		}
+		if !auth.RequestHasScope(r, auth.ScopeRepoWrite) {
+			http.Error(w, "Forbidden: This token does not have the repo:write scope.", http.StatusForbidden)
+			return
+		}
 		repoAccessChecker := utils.NewRepoAccess()
-		if !repoAccessChecker.CanPushToRepository(repo.OwnerID, userID) {
+		if !repoAccessChecker.CanPushToRepository(repo.ID, repo.OwnerID, userID) {
 			log.Printf("User %s (ID: %s) DENIED push to repo %s (OwnerID: %s)", username, userID, reponame, repo.OwnerID)
 			http.Error(w, "Forbidden: You do not have permission to push to this repository.", http.StatusForbidden)
 			return
@@ -122,8 +143,12 @@ func HandleGitHTTP(w http.ResponseWriter, r *http.Request) {
 		log.Printf("User %s (ID: %s) ALLOWED push to repo %s (OwnerID: %s)", username, userID, reponame, repo.OwnerID)
 	}
 
-	// Execute git-http-backend as a subprocess
-	cmd := exec.Command("git", "http-backend")
+	// Execute git-http-backend as a subprocess. It is stopped, together with the upload-pack
+	// or receive-pack it runs, when the client goes away or the transfer takes too long.
+	ctx, cancel := utils.WithGitTimeout(r.Context(), utils.GitTransportTimeout())
+	defer cancel()
+	cmd := utils.GitCommand(ctx, utils.GitServeArgs("http-backend")...)
+	gitOperation := operation + " of " + username + "/" + reponame
 
 	repoBase := filepath.Dir(filepath.Dir(repoPath))
 	log.Printf("Repository base path: %s", repoBase)
@@ -156,25 +181,60 @@ func HandleGitHTTP(w http.ResponseWriter, r *http.Request) {
 	// Always export repositories when accessed via this handler, as our app handles auth.
 	baseEnvVars["GIT_HTTP_EXPORT_ALL"] = "true"
 
+	// Clients ask for protocol v2 with the Git-Protocol header. git http-backend reads it from
+	// HTTP_GIT_PROTOCOL, as CGI servers pass request headers; without it Git falls back to v0.
+	if gitProtocol := r.Header.Get("Git-Protocol"); gitProtocol != "" {
+		if utils.IsValidGitProtocol(gitProtocol) {
+			baseEnvVars["HTTP_GIT_PROTOCOL"] = gitProtocol
+		} else {
+			log.Printf("Ignoring invalid Git-Protocol header: %q", gitProtocol)
+		}
+	}
+
+	var hookEnv []string
 	if service == "git-receive-pack" {
-		// For pushes, explicitly enable receive-pack service.
-		baseEnvVars["GIT_HTTP_RECEIVE_PACK"] = "true"
+		// git http-backend only enables receive-pack for authenticated requests, which it
+		// recognises by REMOTE_USER. The push was authorized above.
+		baseEnvVars["REMOTE_USER"] = userID
+		pusherName := ""
+		if pusher, err := models.GetUserByID(userID); err == nil && pusher != nil {
+			baseEnvVars["REMOTE_USER"] = pusher.Username
+			pusherName = pusher.Username
+		}
+
+		// The repository's hooks call back into the server on behalf of the pusher
+		hookEnv = githook.Environ(githook.Pusher{
+			RepositoryID: repo.ID,
+			UserID:       userID,
+			Username:     pusherName,
+			Protocol:     "http",
+		})
 	} else if service == "git-upload-pack" {
 		// For fetches/clones, explicitly enable upload-pack service.
 		baseEnvVars["GIT_HTTP_UPLOAD_PACK"] = "true"
 	}
 	// If service is empty (e.g. initial info/refs for clone), GIT_HTTP_EXPORT_ALL should be enough
 
+	// Git clients compress large upload-pack requests. The body is inflated here, so git
+	// http-backend reads plain data and its length is no longer known in advance.
+	body, err := gitRequestBody(r)
+	if err != nil {
+		log.Printf("Error reading Git request body: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer body.Close()
+	if r.Header.Get("Content-Encoding") == "" && r.ContentLength >= 0 {
+		baseEnvVars["CONTENT_LENGTH"] = strconv.FormatInt(r.ContentLength, 10)
+	}
+
 	finalEnv := os.Environ()
 	for k, v := range baseEnvVars {
 		finalEnv = append(finalEnv, k+"="+v)
 	}
+	finalEnv = append(finalEnv, hookEnv...)
 	cmd.Env = finalEnv
 
-	if r.Header.Get("Content-Length") != "" {
-		cmd.Env = append(cmd.Env, "CONTENT_LENGTH="+r.Header.Get("Content-Length"))
-	}
-
 	// Create pipes for stdin, stdout, stderr
 	stdin, err := cmd.StdinPipe()
 	if err != nil {
@@ -190,12 +250,9 @@ func HandleGitHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	stderr, err := cmd.StderrPipe()
-	if err != nil {
-		log.Printf("Error creating stderr pipe: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
-	}
+	// Errors are kept to report them to the client, progress output is not needed
+	stderr := &limitedBuffer{limit: maxGitStderr}
+	cmd.Stderr = stderr
 
 	// Start the command
 	if err := cmd.Start(); err != nil {
@@ -204,41 +261,47 @@ func HandleGitHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if r.Body != nil {
-		defer r.Body.Close()
-		_, err := io.Copy(stdin, r.Body)
-		if err != nil {
-			log.Printf("Error copying request body to stdin: %v", err)
-		}
+	// The request body is fed to git while its output is sent back, as git starts answering
+	// large pushes and fetches before it has read the whole request. HTTP/1 connections only
+	// allow this once full duplex is enabled.
+	controller := http.NewResponseController(w)
+	if err := controller.EnableFullDuplex(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		log.Printf("Error enabling full duplex: %v", err)
 	}
-	stdin.Close()
 
-	// Read and parse headers from stdout
-	bufReader := bufio.NewReader(stdout)
-	headerEnded := false
-	headers := make(map[string]string)
-
-	for !headerEnded {
-		line, err := bufReader.ReadString('\n')
-		if err != nil || line == "\r\n" || line == "\n" {
-			headerEnded = true
-			if err != nil && err != io.EOF {
-				log.Printf("Error reading headers: %v", err)
-				http.Error(w, "Internal server error", http.StatusInternalServerError)
-				return
-			}
-			continue
+	stdinDone := make(chan struct{})
+	go func() {
+		defer close(stdinDone)
+		if _, err := io.Copy(stdin, body); err != nil {
+			log.Printf("Error copying request body to stdin: %v", err)
 		}
+		stdin.Close()
+	}()
 
-		parts := strings.SplitN(strings.TrimSpace(line), ":", 2)
-		if len(parts) == 2 {
-			headers[parts[0]] = strings.TrimSpace(parts[1])
+	// git http-backend answers as a CGI script: headers, a blank line, then the body
+	bufReader := bufio.NewReader(stdout)
+	headers, headerErr := textproto.NewReader(bufReader).ReadMIMEHeader()
+	if headerErr != nil && len(headers) == 0 {
+		// git exited without answering, so its error output says what went wrong
+		io.Copy(io.Discard, bufReader)
+		<-stdinDone
+		waitErr := cmd.Wait()
+		if utils.LogGitAborted(ctx, gitOperation) {
+			return
 		}
+		log.Printf("git-http-backend failed before answering: %v (exit: %v), stderr: %s", headerErr, waitErr, stderr.String())
+		http.Error(w, gitErrorMessage(stderr.String(), repoBase), http.StatusInternalServerError)
+		return
 	}
 
-	// Set headers
-	for key, value := range headers {
-		w.Header().Set(key, value)
+	status := http.StatusOK
+	for key, values := range headers {
+		// The Status header sets the response status, e.g. "Status: 403 Forbidden"
+		if key == "Status" {
+			status = cgiStatus(values[0])
+			continue
+		}
+		w.Header()[key] = values
 	}
 
 	// use a default content type if none was set
@@ -255,17 +318,100 @@ func HandleGitHTTP(w http.ResponseWriter, r *http.Request) {
 			w.Header().Set("Content-Type", "application/x-git-receive-pack-result")
 		}
 	}
+	w.WriteHeader(status)
 
-	// Copy remaining stdout to response
-	_, err = io.Copy(w, bufReader)
-	if err != nil {
+	// Stream the rest of stdout, flushing as it comes so clients see progress of long operations
+	if _, err := io.Copy(&flushWriter{w: w, controller: controller}, bufReader); err != nil {
 		log.Printf("Error copying stdout to response: %v", err)
+		// Stop git if the client went away, rather than letting it write into a full pipe
+		cancel()
+	}
+
+	<-stdinDone
+	err = cmd.Wait()
+	if utils.LogGitAborted(ctx, gitOperation) {
+		return
+	}
+	if err != nil {
+		// The response has been sent by now, so the failure can only be logged
+		log.Printf("git-http-backend exited with error: %v, stderr: %s", err, stderr.String())
+	} else if stderr.Len() > 0 {
+		log.Printf("git-http-backend stderr: %s", stderr.String())
 	}
+}
 
-	defer cmd.Wait()
+// maxGitStderr is how much of git's error output is kept for logs and error responses
+const maxGitStderr = 64 << 10
+
+// gitRequestBody returns the body of a Git HTTP request, inflating it if the client
+// compressed it
+func gitRequestBody(r *http.Request) (io.ReadCloser, error) {
+	switch r.Header.Get("Content-Encoding") {
+	case "":
+		return r.Body, nil
+	case "gzip", "x-gzip":
+		body, err := gzip.NewReader(r.Body)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gzip request body: %w", err)
+		}
+		return body, nil
+	default:
+		return nil, fmt.Errorf("unsupported Content-Encoding: %s", r.Header.Get("Content-Encoding"))
+	}
+}
 
-	errOutput, _ := io.ReadAll(stderr)
-	if len(errOutput) > 0 {
-		log.Printf("git-http-backend stderr: %s", string(errOutput))
+// gitErrorMessage turns git's error output into a message for the client, without the
+// location of the repositories on disk
+func gitErrorMessage(stderr, repoBase string) string {
+	message := strings.TrimSpace(strings.ReplaceAll(stderr, repoBase, ""))
+	if message == "" {
+		return "Git request failed"
+	}
+	return message
+}
+
+// cgiStatus returns the code of a CGI Status header, e.g. "403 Forbidden", or 200 if the
+// header does not start with a valid code
+func cgiStatus(value string) int {
+	fields := strings.Fields(value)
+	if len(fields) > 0 {
+		if code, err := strconv.Atoi(fields[0]); err == nil && code >= 100 && code <= 999 {
+			return code
+		}
+	}
+	return http.StatusOK
+}
+
+// flushWriter flushes every write to the client, so output is not held back in buffers
+type flushWriter struct {
+	w          io.Writer
+	controller *http.ResponseController
+}
+
+func (fw *flushWriter) Write(p []byte) (int, error) {
+	n, err := fw.w.Write(p)
+	if err != nil {
+		return n, err
+	}
+	if err := fw.controller.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return n, err
+	}
+	return n, nil
+}
+
+// limitedBuffer keeps the first limit bytes written to it and discards the rest
+type limitedBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.Len(); room > 0 {
+		if len(p) > room {
+			b.Buffer.Write(p[:room])
+		} else {
+			b.Buffer.Write(p)
+		}
 	}
+	return len(p), nil
 }
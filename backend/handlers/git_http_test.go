@@ -0,0 +1,26 @@
+package handlers
+
+import "testing"
+
+func TestCGIStatus(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int
+	}{
+		{"403 Forbidden", 403},
+		{"415 Unsupported Media Type", 415},
+		{"  500  ", 500},
+		{"404", 404},
+		{"", 200},
+		{"   ", 200},
+		{"Forbidden", 200},
+		{"99 Too Low", 200},
+		{"1000 Too High", 200},
+	}
+
+	for _, tt := range tests {
+		if got := cgiStatus(tt.value); got != tt.want {
+			t.Errorf("cgiStatus(%q) = %d, want %d", tt.value, got, tt.want)
+		}
+	}
+}
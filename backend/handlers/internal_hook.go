@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+
+	"github-clone/githook"
+	"github-clone/models"
+	"github-clone/utils"
+	"github-clone/webhook"
+
+	"github.com/gorilla/mux"
+)
+
+// reservedRefPrefixes are namespaces the server writes itself and clients may not push to
+var reservedRefPrefixes = []string{"refs/pull/", "refs/tmp/"}
+
+// HandleInternalHook handles POST /internal/hooks/{hook}, called by the Git hooks of a
+// repository while a push is being received. Only the server's own hooks may call it: the
+// request must come from the loopback interface and carry the hook secret.
+func HandleInternalHook(w http.ResponseWriter, r *http.Request) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if ip := net.ParseIP(host); err != nil || ip == nil || !ip.IsLoopback() {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	if !githook.ValidToken(r.Header.Get(githook.TokenHeader)) {
+		http.Error(w, "Invalid hook token", http.StatusUnauthorized)
+		return
+	}
+
+	// Parse the request body
+	var req githook.Request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	req.Hook = mux.Vars(r)["hook"]
+
+	repo, err := models.GetRepositoryByID(req.RepositoryID)
+	if err != nil {
+		log.Printf("Error retrieving repository %s for %s hook: %v", req.RepositoryID, req.Hook, err)
+		http.Error(w, "Error retrieving repository", http.StatusInternalServerError)
+		return
+	}
+
+	var resp githook.Response
+	switch {
+	case repo == nil:
+		resp = githook.Response{Allowed: false, Message: "Repository not found"}
+	case req.Hook == githook.PreReceive:
+		resp = checkPush(repo, &req)
+	case req.Hook == githook.Update:
+		resp = checkRefUpdates(r.Context(), repo, &req)
+	case req.Hook == githook.PostReceive:
+		resp = afterPush(r.Context(), repo, &req)
+	default:
+		http.Error(w, "Unknown hook", http.StatusNotFound)
+		return
+	}
+
+	if !resp.Allowed {
+		log.Printf("%s hook rejected push by %s to repository %s: %s", req.Hook, hookPusherName(&req), req.RepositoryID, resp.Message)
+	}
+
+	// Return success response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// checkPush runs before any ref is updated and decides whether the push as a whole is
+// accepted. Access is checked again because it may have been revoked since the push started.
+func checkPush(repo *models.Repository, req *githook.Request) githook.Response {
+	if req.DeployKeyID != "" {
+		key, err := models.GetDeployKeyByID(req.DeployKeyID)
+		if err != nil {
+			return githook.Response{Allowed: false, Message: "Could not verify deploy key"}
+		}
+		if key == nil || key.RepositoryID != repo.ID || key.ReadOnly {
+			return githook.Response{Allowed: false, Message: "This deploy key cannot push to this repository"}
+		}
+		return githook.Response{Allowed: true}
+	}
+
+	if req.UserID == "" || !utils.NewRepoAccess().CanPushToRepository(repo.ID, repo.OwnerID, req.UserID) {
+		return githook.Response{Allowed: false, Message: "You do not have permission to push to this repository"}
+	}
+
+	return githook.Response{Allowed: true}
+}
+
+// checkRefUpdates decides whether each ref of a push may be updated. Git calls the update
+// hook once per ref, so a rejection only refuses that ref.
+func checkRefUpdates(ctx context.Context, repo *models.Repository, req *githook.Request) githook.Response {
+	for _, update := range req.Updates {
+		for _, prefix := range reservedRefPrefixes {
+			if strings.HasPrefix(update.Ref, prefix) {
+				return githook.Response{Allowed: false, Message: update.Ref + " is managed by the server and cannot be pushed to"}
+			}
+		}
+
+		if message := checkProtectedBranchPush(ctx, repo, req, update); message != "" {
+			return githook.Response{Allowed: false, Message: message}
+		}
+	}
+
+	return githook.Response{Allowed: true}
+}
+
+// afterPush reacts to the refs updated by an accepted push
+func afterPush(ctx context.Context, repo *models.Repository, req *githook.Request) githook.Response {
+	refsAfter, err := utils.ListRefs(ctx, req.RepoPath)
+	if err != nil {
+		log.Printf("Error listing refs after push to %s: %v", req.RepoPath, err)
+		return githook.Response{Allowed: true}
+	}
+
+	// The refs before the push are the current ones with the updates undone
+	refsBefore := make(map[string]string, len(refsAfter))
+	for ref, sha := range refsAfter {
+		refsBefore[ref] = sha
+	}
+	for _, update := range req.Updates {
+		if !strings.HasPrefix(update.Ref, "refs/heads/") && !strings.HasPrefix(update.Ref, "refs/tags/") {
+			continue
+		}
+		if update.OldSHA == githook.ZeroSHA {
+			delete(refsBefore, update.Ref)
+		} else {
+			refsBefore[update.Ref] = update.OldSHA
+		}
+	}
+
+	pusher := webhook.User{ID: req.UserID, Username: req.Username, DeployKeyID: req.DeployKeyID}
+	webhook.Push(repo, req.RepoPath, pusher, refsBefore, refsAfter)
+
+	return githook.Response{Allowed: true}
+}
+
+// hookPusherName describes the pusher of a hook request in log messages
+func hookPusherName(req *githook.Request) string {
+	if req.DeployKeyID != "" {
+		return "deploy key " + req.DeployKeyID
+	}
+	if req.Username != "" {
+		return req.Username
+	}
+	return "user " + req.UserID
+}
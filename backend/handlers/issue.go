@@ -8,6 +8,7 @@ import (
 	
 	"github-clone/models"
 	"github-clone/utils"
+	"github-clone/webhook"
 )
 
 // CreateIssue handles POST /api/repos/:owner/:repo/issues
@@ -37,14 +38,14 @@ func CreateIssue(w http.ResponseWriter, r *http.Request) {
 	
 	// First, check if the repository exists and if the user has access to it
 	repository, err := models.GetRepositoryByName(owner, repo)
-	if err != nil {
+	if err != nil || repository == nil {
 		http.Error(w, "Repository not found", http.StatusNotFound)
 		return
 	}
 	
 	// Check if user has permission to create issues
-	// Users can create issues if they own the repo or if the repo is public
-	hasPermission := repository.OwnerID == currentUser.ID || repository.IsPublic
+	// Users can create issues in any repository they can view
+	hasPermission := repoAccess.CanViewRepository(repository.ID, repository.OwnerID, repository.IsPublic, currentUser.ID)
 	if !hasPermission {
 		http.Error(w, "Unauthorized to create issues in this repository", http.StatusForbidden)
 		return
@@ -71,6 +72,8 @@ func CreateIssue(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
+	webhook.Issue(repository, webhook.User{ID: currentUser.ID, Username: currentUser.Username}, "opened", issue)
+	
 	// Return the created issue as JSON
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
@@ -104,13 +107,17 @@ func GetRepositoryIssues(w http.ResponseWriter, r *http.Request) {
 	
 	// Get repository
 	repository, err := models.GetRepositoryByName(owner, repo)
-	if err != nil {
+	if err != nil || repository == nil {
 		http.Error(w, "Repository not found", http.StatusNotFound)
 		return
 	}
 	
 	// Check if the repository is public or if the user has access to it
-	if !repository.IsPublic && (currentUser == nil || repository.OwnerID != currentUser.ID) {
+	currentUserID := ""
+	if currentUser != nil {
+		currentUserID = currentUser.ID
+	}
+	if !repoAccess.CanViewRepository(repository.ID, repository.OwnerID, repository.IsPublic, currentUserID) {
 		http.Error(w, "Unauthorized to view issues in this repository", http.StatusForbidden)
 		return
 	}
@@ -183,13 +190,17 @@ func GetIssue(w http.ResponseWriter, r *http.Request) {
 	
 	// Get repository
 	repository, err := models.GetRepositoryByName(owner, repoName)
-	if err != nil {
+	if err != nil || repository == nil {
 		http.Error(w, "Repository not found", http.StatusNotFound)
 		return
 	}
 	
 	// Check if the repository is public or if the user has access to it
-	if !repository.IsPublic && (currentUser == nil || repository.OwnerID != currentUser.ID) {
+	currentUserID := ""
+	if currentUser != nil {
+		currentUserID = currentUser.ID
+	}
+	if !repoAccess.CanViewRepository(repository.ID, repository.OwnerID, repository.IsPublic, currentUserID) {
 		http.Error(w, "Unauthorized to view issues in this repository", http.StatusForbidden)
 		return
 	}
@@ -240,13 +251,13 @@ func UpdateIssueStatus(w http.ResponseWriter, r *http.Request) {
 	
 	// Get repository
 	repository, err := models.GetRepositoryByName(owner, repoName)
-	if err != nil {
+	if err != nil || repository == nil {
 		http.Error(w, "Repository not found", http.StatusNotFound)
 		return
 	}
 	
-	// Check if user has permission to update issues (only repo owner can update issues)
-	if repository.OwnerID != currentUser.ID {
+	// Check if user has permission to update issues (only users with write access can update issues)
+	if !repoAccess.CanEditRepository(repository.ID, repository.OwnerID, currentUser.ID) {
 		http.Error(w, "Unauthorized to update issues in this repository", http.StatusForbidden)
 		return
 	}
@@ -293,6 +304,15 @@ func UpdateIssueStatus(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
+	// Notify webhooks when the issue was actually closed or reopened
+	if issue.IsOpen != updatedIssue.IsOpen {
+		action := "closed"
+		if updatedIssue.IsOpen {
+			action = "reopened"
+		}
+		webhook.Issue(repository, webhook.User{ID: currentUser.ID, Username: currentUser.Username}, action, updatedIssue)
+	}
+	
 	// Return the updated issue as JSON
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(updatedIssue)
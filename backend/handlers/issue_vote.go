@@ -7,6 +7,7 @@ import (
 	
 	"github-clone/models"
 	"github-clone/utils"
+	"github-clone/webhook"
 )
 
 // VoteOnIssue handles POST /api/repos/:owner/:repo/issues/:id/vote
@@ -37,13 +38,13 @@ func VoteOnIssue(w http.ResponseWriter, r *http.Request) {
 	
 	// Get repository
 	repository, err := models.GetRepositoryByName(owner, repoName)
-	if err != nil {
+	if err != nil || repository == nil {
 		http.Error(w, "Repository not found", http.StatusNotFound)
 		return
 	}
 	
 	// Check if the repository is public or if the user has access to it
-	if !repository.IsPublic && repository.OwnerID != currentUser.ID {
+	if !repoAccess.CanViewRepository(repository.ID, repository.OwnerID, repository.IsPublic, currentUser.ID) {
 		http.Error(w, "Unauthorized to vote on issues in this repository", http.StatusForbidden)
 		return
 	}
@@ -76,6 +77,8 @@ func VoteOnIssue(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
+	webhook.IssueVote(repository, webhook.User{ID: currentUser.ID, Username: currentUser.Username}, "voted", input.Vote, issue)
+	
 	// Return the vote as JSON
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(vote)
@@ -109,13 +112,13 @@ func RemoveVoteFromIssue(w http.ResponseWriter, r *http.Request) {
 	
 	// Get repository
 	repository, err := models.GetRepositoryByName(owner, repoName)
-	if err != nil {
+	if err != nil || repository == nil {
 		http.Error(w, "Repository not found", http.StatusNotFound)
 		return
 	}
 	
 	// Check if the repository is public or if the user has access to it
-	if !repository.IsPublic && repository.OwnerID != currentUser.ID {
+	if !repoAccess.CanViewRepository(repository.ID, repository.OwnerID, repository.IsPublic, currentUser.ID) {
 		http.Error(w, "Unauthorized to remove vote from issues in this repository", http.StatusForbidden)
 		return
 	}
@@ -140,6 +143,8 @@ func RemoveVoteFromIssue(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
+	webhook.IssueVote(repository, webhook.User{ID: currentUser.ID, Username: currentUser.Username}, "removed", 0, issue)
+	
 	// Return success
 	w.WriteHeader(http.StatusNoContent)
 }
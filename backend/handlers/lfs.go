@@ -0,0 +1,594 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github-clone/auth"
+	"github-clone/models"
+	"github-clone/utils"
+
+	"github.com/gorilla/mux"
+)
+
+// lfsMediaType is the content type of Git LFS API requests and responses
+const lfsMediaType = "application/vnd.git-lfs+json"
+
+// lfsActionExpiry is how long the links handed out by the batch API are advertised as valid
+const lfsActionExpiry = time.Hour
+
+// maxLFSLocksPage is the largest number of locks returned at once
+const maxLFSLocksPage = 100
+
+// lfsBatchRequest is the body of a Git LFS batch request
+type lfsBatchRequest struct {
+	Operation string           `json:"operation"` // "download" or "upload"
+	Transfers []string         `json:"transfers"`
+	Ref       *lfsRef          `json:"ref"`
+	Objects   []lfsBatchObject `json:"objects"`
+	HashAlgo  string           `json:"hash_algo"`
+}
+
+// lfsRef names the ref a Git LFS client is working on
+type lfsRef struct {
+	Name string `json:"name"`
+}
+
+// lfsBatchObject is an object in a batch request or response
+type lfsBatchObject struct {
+	OID           string                `json:"oid"`
+	Size          int64                 `json:"size"`
+	Authenticated bool                  `json:"authenticated,omitempty"`
+	Actions       map[string]*lfsAction `json:"actions,omitempty"`
+	Error         *lfsObjectError       `json:"error,omitempty"`
+}
+
+// lfsAction tells the client where to transfer an object
+type lfsAction struct {
+	Href      string            `json:"href"`
+	Header    map[string]string `json:"header,omitempty"`
+	ExpiresIn int               `json:"expires_in"`
+}
+
+// lfsObjectError reports why a single object of a batch cannot be transferred
+type lfsObjectError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// LFSBatch handles POST /git/{username}/{reponame}/info/lfs/objects/batch
+// Clients ask where to download or upload a set of objects. Only the basic transfer adapter is
+// supported, so objects are transferred by the endpoints below. Downloads are limited to
+// objects that were uploaded to the repository, or to the repository it was forked from.
+func LFSBatch(w http.ResponseWriter, r *http.Request) {
+	var req lfsBatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		lfsError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.Operation != "download" && req.Operation != "upload" {
+		lfsError(w, http.StatusUnprocessableEntity, "Operation must be download or upload")
+		return
+	}
+
+	repo, _, ok := lfsRepository(w, r, req.Operation == "upload")
+	if !ok {
+		return
+	}
+
+	if req.HashAlgo != "" && req.HashAlgo != "sha256" {
+		lfsError(w, http.StatusConflict, "Only the sha256 hash algorithm is supported")
+		return
+	}
+	if len(req.Transfers) > 0 && !containsString(req.Transfers, "basic") {
+		lfsError(w, http.StatusUnprocessableEntity, "Only the basic transfer adapter is supported")
+		return
+	}
+
+	objectsURL := lfsBaseURL(r) + "/objects/"
+	header := map[string]string{}
+	if authorization := r.Header.Get("Authorization"); authorization != "" {
+		header["Authorization"] = authorization
+	}
+	action := func(href string) *lfsAction {
+		return &lfsAction{Href: href, Header: header, ExpiresIn: int(lfsActionExpiry.Seconds())}
+	}
+
+	objects := make([]lfsBatchObject, 0, len(req.Objects))
+	for _, requested := range req.Objects {
+		object := lfsBatchObject{OID: requested.OID, Size: requested.Size, Authenticated: len(header) > 0}
+
+		if !utils.IsValidLFSOID(requested.OID) {
+			object.Error = &lfsObjectError{Code: http.StatusUnprocessableEntity, Message: "Invalid object ID"}
+			objects = append(objects, object)
+			continue
+		}
+		if requested.Size < 0 {
+			object.Error = &lfsObjectError{Code: http.StatusUnprocessableEntity, Message: "Invalid object size"}
+			objects = append(objects, object)
+			continue
+		}
+
+		stored, err := models.GetLFSObject(repo.ID, requested.OID)
+		if err != nil {
+			log.Printf("Error retrieving LFS object %s: %v", requested.OID, err)
+			object.Error = &lfsObjectError{Code: http.StatusInternalServerError, Message: "Error retrieving object"}
+			objects = append(objects, object)
+			continue
+		}
+
+		if req.Operation == "download" {
+			if stored == nil {
+				object.Error = &lfsObjectError{Code: http.StatusNotFound, Message: "Object does not exist"}
+			} else {
+				object.Size = stored.Size
+				object.Actions = map[string]*lfsAction{"download": action(objectsURL + requested.OID)}
+			}
+		} else if stored == nil {
+			// Objects the repository already holds need no actions, so the client skips them
+			object.Actions = map[string]*lfsAction{
+				"upload": action(objectsURL + requested.OID),
+				"verify": action(objectsURL + "verify"),
+			}
+		}
+
+		objects = append(objects, object)
+	}
+
+	writeLFSJSON(w, http.StatusOK, map[string]interface{}{
+		"transfer":  "basic",
+		"objects":   objects,
+		"hash_algo": "sha256",
+	})
+}
+
+// LFSDownloadObject handles GET /git/{username}/{reponame}/info/lfs/objects/{oid}
+func LFSDownloadObject(w http.ResponseWriter, r *http.Request) {
+	repo, _, ok := lfsRepository(w, r, false)
+	if !ok {
+		return
+	}
+
+	oid := mux.Vars(r)["oid"]
+	object, ok := loadLFSObject(w, repo, oid)
+	if !ok {
+		return
+	}
+
+	file, err := os.Open(utils.LFSObjectPath(oid))
+	if err != nil {
+		log.Printf("LFS object %s of repository %s is missing from storage: %v", oid, repo.ID, err)
+		lfsError(w, http.StatusNotFound, "Object does not exist")
+		return
+	}
+	defer file.Close()
+
+	// Objects never change, so their ID is a strong validator
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("ETag", `"`+object.OID+`"`)
+	http.ServeContent(w, r, "", object.CreatedAt, file)
+}
+
+// LFSUploadObject handles PUT /git/{username}/{reponame}/info/lfs/objects/{oid}
+// The content is only stored if it hashes to the object ID.
+func LFSUploadObject(w http.ResponseWriter, r *http.Request) {
+	repo, _, ok := lfsRepository(w, r, true)
+	if !ok {
+		return
+	}
+
+	oid := mux.Vars(r)["oid"]
+	if !utils.IsValidLFSOID(oid) {
+		lfsError(w, http.StatusUnprocessableEntity, "Invalid object ID")
+		return
+	}
+
+	size, err := utils.StoreLFSObject(oid, r.Body)
+	if errors.Is(err, utils.ErrLFSObjectMismatch) {
+		lfsError(w, http.StatusUnprocessableEntity, "Content does not match the object ID")
+		return
+	}
+	if err != nil {
+		log.Printf("Error storing LFS object %s: %v", oid, err)
+		lfsError(w, http.StatusInternalServerError, "Error storing object")
+		return
+	}
+
+	if err := models.CreateLFSObject(repo.ID, oid, size); err != nil {
+		log.Printf("Error recording LFS object %s: %v", oid, err)
+		lfsError(w, http.StatusInternalServerError, "Error storing object")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// LFSVerifyObject handles POST /git/{username}/{reponame}/info/lfs/objects/verify
+// Clients call it after an upload to confirm the server holds the object.
+func LFSVerifyObject(w http.ResponseWriter, r *http.Request) {
+	repo, _, ok := lfsRepository(w, r, true)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		OID  string `json:"oid"`
+		Size int64  `json:"size"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		lfsError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	object, ok := loadLFSObject(w, repo, req.OID)
+	if !ok {
+		return
+	}
+	if object.Size != req.Size {
+		lfsError(w, http.StatusUnprocessableEntity, "Object size does not match")
+		return
+	}
+
+	writeLFSJSON(w, http.StatusOK, map[string]string{"message": "Object verified"})
+}
+
+// LFSCreateLock handles POST /git/{username}/{reponame}/info/lfs/locks
+func LFSCreateLock(w http.ResponseWriter, r *http.Request) {
+	repo, userID, ok := lfsRepository(w, r, true)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Path string  `json:"path"`
+		Ref  *lfsRef `json:"ref"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		lfsError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Path == "" {
+		lfsError(w, http.StatusUnprocessableEntity, "Path is required")
+		return
+	}
+
+	ref := ""
+	if req.Ref != nil {
+		ref = req.Ref.Name
+	}
+
+	lock, err := models.CreateLFSLock(repo.ID, req.Path, ref, userID)
+	if err != nil {
+		// The path is most likely locked already; report the existing lock if so
+		existing, lookupErr := models.GetLFSLockByPath(repo.ID, req.Path)
+		if lookupErr == nil && existing != nil {
+			writeLFSJSON(w, http.StatusConflict, map[string]interface{}{
+				"lock":    existing,
+				"message": "Path is already locked",
+			})
+			return
+		}
+		log.Printf("Error creating LFS lock on %s: %v", req.Path, err)
+		lfsError(w, http.StatusInternalServerError, "Error creating lock")
+		return
+	}
+
+	writeLFSJSON(w, http.StatusCreated, map[string]interface{}{"lock": lock})
+}
+
+// LFSListLocks handles GET /git/{username}/{reponame}/info/lfs/locks
+// Locks can be filtered by path or ID, and are paged with the cursor and limit parameters.
+func LFSListLocks(w http.ResponseWriter, r *http.Request) {
+	repo, _, ok := lfsRepository(w, r, false)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	offset, limit, ok := lfsLocksPage(w, query.Get("cursor"), query.Get("limit"))
+	if !ok {
+		return
+	}
+
+	locks, nextCursor, err := listLFSLocks(repo.ID, query.Get("path"), query.Get("id"), offset, limit)
+	if err != nil {
+		log.Printf("Error retrieving LFS locks: %v", err)
+		lfsError(w, http.StatusInternalServerError, "Error retrieving locks")
+		return
+	}
+
+	writeLFSJSON(w, http.StatusOK, map[string]interface{}{
+		"locks":       locks,
+		"next_cursor": nextCursor,
+	})
+}
+
+// LFSVerifyLocks handles POST /git/{username}/{reponame}/info/lfs/locks/verify
+// Clients call it before pushing, to learn which locks are theirs and which belong to others.
+func LFSVerifyLocks(w http.ResponseWriter, r *http.Request) {
+	repo, userID, ok := lfsRepository(w, r, true)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Cursor string  `json:"cursor"`
+		Limit  int     `json:"limit"`
+		Ref    *lfsRef `json:"ref"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		lfsError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	limit := ""
+	if req.Limit > 0 {
+		limit = strconv.Itoa(req.Limit)
+	}
+	offset, pageSize, ok := lfsLocksPage(w, req.Cursor, limit)
+	if !ok {
+		return
+	}
+
+	locks, nextCursor, err := listLFSLocks(repo.ID, "", "", offset, pageSize)
+	if err != nil {
+		log.Printf("Error retrieving LFS locks: %v", err)
+		lfsError(w, http.StatusInternalServerError, "Error retrieving locks")
+		return
+	}
+
+	ours := []*models.LFSLock{}
+	theirs := []*models.LFSLock{}
+	for _, lock := range locks {
+		if lock.OwnerID == userID {
+			ours = append(ours, lock)
+		} else {
+			theirs = append(theirs, lock)
+		}
+	}
+
+	writeLFSJSON(w, http.StatusOK, map[string]interface{}{
+		"ours":        ours,
+		"theirs":      theirs,
+		"next_cursor": nextCursor,
+	})
+}
+
+// LFSUnlock handles POST /git/{username}/{reponame}/info/lfs/locks/{id}/unlock
+// Only the owner of a lock can remove it, unless a repository admin forces it.
+func LFSUnlock(w http.ResponseWriter, r *http.Request) {
+	repo, userID, ok := lfsRepository(w, r, true)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Force bool `json:"force"`
+	}
+	// The body is optional
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		lfsError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	lock, err := models.GetLFSLockByID(mux.Vars(r)["id"])
+	if err != nil {
+		log.Printf("Error retrieving LFS lock: %v", err)
+		lfsError(w, http.StatusInternalServerError, "Error retrieving lock")
+		return
+	}
+	if lock == nil || lock.RepositoryID != repo.ID {
+		lfsError(w, http.StatusNotFound, "Lock not found")
+		return
+	}
+
+	if lock.OwnerID != userID {
+		if !req.Force {
+			lfsError(w, http.StatusForbidden, "Lock is owned by "+lock.Owner.Name+"; use force to remove it")
+			return
+		}
+		if !repoAccess.CanAdminRepository(repo.ID, repo.OwnerID, userID) {
+			lfsError(w, http.StatusForbidden, "Only repository admins can remove the locks of others")
+			return
+		}
+	}
+
+	if err := models.DeleteLFSLock(lock.ID); err != nil {
+		log.Printf("Error deleting LFS lock %s: %v", lock.ID, err)
+		lfsError(w, http.StatusInternalServerError, "Error deleting lock")
+		return
+	}
+
+	writeLFSJSON(w, http.StatusOK, map[string]interface{}{"lock": lock})
+}
+
+// GetLFSUsage handles GET /api/{username}/{reponame}/lfs
+// Reports how many LFS objects the repository holds and their total size.
+func GetLFSUsage(w http.ResponseWriter, r *http.Request) {
+	repo, ok := loadRepositoryForViewer(w, r, getUserIDOptional(r))
+	if !ok {
+		return
+	}
+
+	usage, err := models.GetLFSUsage(repo.ID)
+	if err != nil {
+		http.Error(w, "Error retrieving LFS usage", http.StatusInternalServerError)
+		return
+	}
+
+	// Return success response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(usage)
+}
+
+// lfsRepository looks up the repository of a Git LFS request and checks access the same way
+// HandleGitHTTP does: reading needs clone access, writing needs push access and a token with
+// the repo:write scope. Anonymous clients are challenged for credentials.
+func lfsRepository(w http.ResponseWriter, r *http.Request, write bool) (*models.Repository, string, bool) {
+	vars := mux.Vars(r)
+	// Git LFS appends .git to remote URLs that do not end with it
+	reponame := strings.TrimSuffix(vars["reponame"], ".git")
+
+	userID := getUserIDOptional(r)
+
+	// A personal access token without repo:read only reaches what anonymous users can see
+	if userID != "" && !auth.RequestHasScope(r, auth.ScopeRepoRead) {
+		userID = ""
+	}
+
+	repo, err := models.GetRepositoryByUsernameAndName(vars["username"], reponame)
+	if err != nil {
+		log.Printf("Error retrieving repository information: %v", err)
+		lfsError(w, http.StatusInternalServerError, "Error retrieving repository")
+		return nil, "", false
+	}
+
+	if repo == nil || !repoAccess.CanCloneRepository(repo.ID, repo.OwnerID, repo.IsPublic, userID) {
+		if userID == "" {
+			lfsAuthenticate(w, "Authentication required")
+			return nil, "", false
+		}
+		if repo == nil {
+			lfsError(w, http.StatusNotFound, "Repository not found")
+		} else {
+			lfsError(w, http.StatusForbidden, "You don't have access to this repository")
+		}
+		return nil, "", false
+	}
+
+	if write {
+		if userID == "" {
+			lfsAuthenticate(w, "Authentication required: A valid password or token is needed to push.")
+			return nil, "", false
+		}
+		if !auth.RequestHasScope(r, auth.ScopeRepoWrite) {
+			lfsError(w, http.StatusForbidden, "Forbidden: This token does not have the repo:write scope.")
+			return nil, "", false
+		}
+		if !repoAccess.CanPushToRepository(repo.ID, repo.OwnerID, userID) {
+			lfsError(w, http.StatusForbidden, "Forbidden: You do not have permission to push to this repository.")
+			return nil, "", false
+		}
+	}
+
+	return repo, userID, true
+}
+
+// loadLFSObject looks up an object of a repository, answering 404 if it does not hold it
+func loadLFSObject(w http.ResponseWriter, repo *models.Repository, oid string) (*models.LFSObject, bool) {
+	if !utils.IsValidLFSOID(oid) {
+		lfsError(w, http.StatusNotFound, "Object does not exist")
+		return nil, false
+	}
+
+	object, err := models.GetLFSObject(repo.ID, oid)
+	if err != nil {
+		log.Printf("Error retrieving LFS object %s: %v", oid, err)
+		lfsError(w, http.StatusInternalServerError, "Error retrieving object")
+		return nil, false
+	}
+	if object == nil {
+		lfsError(w, http.StatusNotFound, "Object does not exist")
+		return nil, false
+	}
+
+	return object, true
+}
+
+// lfsLocksPage reads the cursor and limit of a lock listing. The cursor is the offset of
+// the next page.
+func lfsLocksPage(w http.ResponseWriter, cursor, limit string) (int, int, bool) {
+	offset := 0
+	if cursor != "" {
+		n, err := strconv.Atoi(cursor)
+		if err != nil || n < 0 {
+			lfsError(w, http.StatusBadRequest, "Invalid cursor")
+			return 0, 0, false
+		}
+		offset = n
+	}
+
+	pageSize := maxLFSLocksPage
+	if limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			lfsError(w, http.StatusBadRequest, "Invalid limit")
+			return 0, 0, false
+		}
+		if n < pageSize {
+			pageSize = n
+		}
+	}
+
+	return offset, pageSize, true
+}
+
+// listLFSLocks retrieves a page of locks, with the cursor of the next page if there is one
+func listLFSLocks(repositoryID, path, id string, offset, limit int) ([]*models.LFSLock, string, error) {
+	// Fetch one extra lock to learn whether another page follows
+	locks, err := models.GetLFSLocks(repositoryID, path, id, limit+1, offset)
+	if err != nil {
+		return nil, "", err
+	}
+
+	nextCursor := ""
+	if len(locks) > limit {
+		locks = locks[:limit]
+		nextCursor = strconv.Itoa(offset + limit)
+	}
+
+	return locks, nextCursor, nil
+}
+
+// lfsBaseURL returns the URL of the Git LFS API of the requested repository, as seen by the client
+func lfsBaseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+
+	vars := mux.Vars(r)
+	return scheme + "://" + r.Host + "/git/" + vars["username"] + "/" + vars["reponame"] + "/info/lfs"
+}
+
+// lfsAuthenticate asks the client for credentials in a Git LFS error response
+func lfsAuthenticate(w http.ResponseWriter, message string) {
+	challenge := fmt.Sprintf("Basic realm=%q", GitAuthRealm)
+	w.Header().Set("LFS-Authenticate", challenge)
+	w.Header().Set("WWW-Authenticate", challenge)
+	lfsError(w, http.StatusUnauthorized, message)
+}
+
+// lfsError writes an error in the format Git LFS clients display
+func lfsError(w http.ResponseWriter, status int, message string) {
+	writeLFSJSON(w, status, map[string]string{"message": message})
+}
+
+// writeLFSJSON writes a Git LFS API response
+func writeLFSJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", lfsMediaType)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// containsString reports whether a list contains a value
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
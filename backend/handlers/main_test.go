@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github-clone/config"
+)
+
+// TestMain runs the tests against a database and repository directory of their own
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "ngh-handlers-test-*")
+	if err != nil {
+		log.Fatal(err)
+	}
+	os.Setenv("DB_PATH", filepath.Join(dir, "test.db"))
+	os.Setenv("REPOSITORIES_PATH", filepath.Join(dir, "repositories"))
+	os.Setenv("ARCHIVE_CACHE_PATH", filepath.Join(dir, "archive-cache"))
+	os.Setenv("JWT_SECRET", "test-secret")
+	log.SetOutput(io.Discard)
+
+	if err := config.ConnectDB(); err != nil {
+		log.Fatal(err)
+	}
+
+	code := m.Run()
+	config.DB.Close()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// writeTestCommit writes a commit holding a single file into a bare repository and returns
+// its SHA. The objects are written directly, so no ref changes and no hook runs.
+func writeTestCommit(t *testing.T, repoPath, parent, name, content string) string {
+	t.Helper()
+	git := func(stdin string, args ...string) string {
+		cmd := exec.Command("git", append([]string{"-C", repoPath}, args...)...)
+		cmd.Stdin = strings.NewReader(stdin)
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=Test", "GIT_AUTHOR_EMAIL=test@example.com",
+			"GIT_COMMITTER_NAME=Test", "GIT_COMMITTER_EMAIL=test@example.com")
+		out, err := cmd.Output()
+		if err != nil {
+			t.Fatalf("git %v: %v", args, err)
+		}
+		return strings.TrimSpace(string(out))
+	}
+
+	blob := git(content, "hash-object", "-w", "--stdin")
+	tree := git("100644 blob "+blob+"\t"+name+"\n", "mktree")
+	args := []string{"commit-tree", tree, "-m", "Change " + name}
+	if parent != "" {
+		args = append(args, "-p", parent)
+	}
+	return git("", args...)
+}
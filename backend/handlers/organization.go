@@ -0,0 +1,354 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github-clone/models"
+
+	"github.com/gorilla/mux"
+)
+
+// validAccountName matches names usable as a user or organization namespace
+var validAccountName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,38}$`)
+
+// reservedAccountNames collide with top-level API and Git routes
+var reservedAccountNames = map[string]bool{
+	"api": true, "auth": true, "git": true, "health": true, "orgs": true, "public": true,
+	"repos": true, "repositories": true, "ssh-keys": true, "user": true, "users": true,
+}
+
+// CreateOrganization handles POST /api/orgs
+func CreateOrganization(w http.ResponseWriter, r *http.Request) {
+	// Get the authenticated user ID from the token
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Parse the request body
+	var input models.OrganizationInput
+	err = json.NewDecoder(r.Body).Decode(&input)
+	if err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	// Validate input
+	if !validAccountName.MatchString(input.Name) || reservedAccountNames[strings.ToLower(input.Name)] {
+		http.Error(w, "Invalid organization name", http.StatusBadRequest)
+		return
+	}
+
+	// Organizations and users share one namespace
+	existing, err := models.GetUserByUsername(input.Name)
+	if err != nil {
+		http.Error(w, "Server error checking name availability", http.StatusInternalServerError)
+		return
+	}
+	if existing != nil {
+		http.Error(w, "Name already taken", http.StatusConflict)
+		return
+	}
+
+	org, err := models.CreateOrganization(userID, input)
+	if err != nil {
+		http.Error(w, "Failed to create organization: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return success response
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(org)
+}
+
+// GetUserOrganizations handles GET /api/user/orgs
+func GetUserOrganizations(w http.ResponseWriter, r *http.Request) {
+	// Get the authenticated user ID from the token
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	orgs, err := models.GetUserOrganizations(userID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve organizations", http.StatusInternalServerError)
+		return
+	}
+
+	// Return success response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(orgs)
+}
+
+// GetOrganization handles GET /api/orgs/{org}
+func GetOrganization(w http.ResponseWriter, r *http.Request) {
+	org, ok := loadOrganization(w, mux.Vars(r)["org"])
+	if !ok {
+		return
+	}
+
+	// Return success response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(org)
+}
+
+// GetOrganizationRepositories handles GET /api/orgs/{org}/repos
+// Only repositories the current user can view are listed
+func GetOrganizationRepositories(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDOptional(r)
+
+	org, ok := loadOrganization(w, mux.Vars(r)["org"])
+	if !ok {
+		return
+	}
+
+	repos, err := models.GetUserRepositories(org.ID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve repositories", http.StatusInternalServerError)
+		return
+	}
+
+	visible := []*models.Repository{}
+	for _, repo := range repos {
+		if repoAccess.CanViewRepository(repo.ID, repo.OwnerID, repo.IsPublic, userID) {
+			visible = append(visible, repo)
+		}
+	}
+
+	// Return success response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(visible)
+}
+
+// CreateOrganizationRepository handles POST /api/orgs/{org}/repos
+func CreateOrganizationRepository(w http.ResponseWriter, r *http.Request) {
+	// Get the authenticated user ID from the token
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	org, ok := loadOrganization(w, mux.Vars(r)["org"])
+	if !ok {
+		return
+	}
+
+	// Only organization owners can create repositories
+	if !requireOrganizationOwner(w, org, userID) {
+		return
+	}
+
+	// Parse the request body
+	var input models.RepositoryInput
+	err = json.NewDecoder(r.Body).Decode(&input)
+	if err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	// Validate input
+	if input.Name == "" {
+		http.Error(w, "Repository name is required", http.StatusBadRequest)
+		return
+	}
+
+	existingRepo, err := models.GetRepositoryByOwnerAndName(org.ID, input.Name)
+	if err != nil {
+		http.Error(w, "Server error checking repository existence", http.StatusInternalServerError)
+		return
+	}
+	if existingRepo != nil {
+		http.Error(w, "The organization already has a repository with this name", http.StatusConflict)
+		return
+	}
+
+	repo, err := models.CreateRepository(org.ID, input)
+	if err != nil {
+		http.Error(w, "Failed to create repository: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return success response
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(repo)
+}
+
+// GetOrganizationMembers handles GET /api/orgs/{org}/members
+func GetOrganizationMembers(w http.ResponseWriter, r *http.Request) {
+	// Get the authenticated user ID from the token
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	org, ok := loadOrganization(w, mux.Vars(r)["org"])
+	if !ok {
+		return
+	}
+
+	if !requireOrganizationMember(w, org, userID) {
+		return
+	}
+
+	members, err := models.GetOrganizationMembers(org.ID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve members", http.StatusInternalServerError)
+		return
+	}
+
+	// Return success response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(members)
+}
+
+// SetOrganizationMember handles PUT /api/orgs/{org}/members/{username}
+func SetOrganizationMember(w http.ResponseWriter, r *http.Request) {
+	// Get the authenticated user ID from the token
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	org, ok := loadOrganization(w, vars["org"])
+	if !ok {
+		return
+	}
+
+	if !requireOrganizationOwner(w, org, userID) {
+		return
+	}
+
+	member, ok := loadPersonalAccount(w, vars["username"])
+	if !ok {
+		return
+	}
+
+	// Parse the request body
+	var input models.OrganizationMemberInput
+	err = json.NewDecoder(r.Body).Decode(&input)
+	if err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if input.Role == "" {
+		input.Role = models.OrganizationRoleMember
+	}
+
+	if err := models.SetOrganizationMember(org.ID, member.ID, input); err != nil {
+		http.Error(w, "Failed to update membership: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Return success response
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RemoveOrganizationMember handles DELETE /api/orgs/{org}/members/{username}
+// Owners can remove anyone, and members can leave on their own
+func RemoveOrganizationMember(w http.ResponseWriter, r *http.Request) {
+	// Get the authenticated user ID from the token
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	org, ok := loadOrganization(w, vars["org"])
+	if !ok {
+		return
+	}
+
+	member, ok := loadPersonalAccount(w, vars["username"])
+	if !ok {
+		return
+	}
+
+	if member.ID != userID && !requireOrganizationOwner(w, org, userID) {
+		return
+	}
+
+	if err := models.RemoveOrganizationMember(org.ID, member.ID); err != nil {
+		http.Error(w, "Failed to remove member: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Return success response
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// loadOrganization looks up an organization by name and writes a 404 if it does not exist
+func loadOrganization(w http.ResponseWriter, name string) (*models.Organization, bool) {
+	org, err := models.GetOrganizationByName(name)
+	if err != nil {
+		http.Error(w, "Error retrieving organization", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	if org == nil {
+		http.Error(w, "Organization not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	return org, true
+}
+
+// loadPersonalAccount looks up a user (not an organization) by username and writes a 404 if it does not exist
+func loadPersonalAccount(w http.ResponseWriter, username string) (*models.User, bool) {
+	user, err := models.GetUserByUsername(username)
+	if err != nil {
+		http.Error(w, "Error retrieving user", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	if user == nil || user.IsOrganization() {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	return user, true
+}
+
+// requireOrganizationMember writes a 403 unless the user belongs to the organization
+func requireOrganizationMember(w http.ResponseWriter, org *models.Organization, userID string) bool {
+	role, err := models.GetOrganizationMemberRole(org.ID, userID)
+	if err != nil {
+		http.Error(w, "Error checking organization membership", http.StatusInternalServerError)
+		return false
+	}
+
+	if role == "" {
+		http.Error(w, "You are not a member of this organization", http.StatusForbidden)
+		return false
+	}
+
+	return true
+}
+
+// requireOrganizationOwner writes a 403 unless the user is an owner of the organization
+func requireOrganizationOwner(w http.ResponseWriter, org *models.Organization, userID string) bool {
+	role, err := models.GetOrganizationMemberRole(org.ID, userID)
+	if err != nil {
+		http.Error(w, "Error checking organization membership", http.StatusInternalServerError)
+		return false
+	}
+
+	if role != models.OrganizationRoleOwner {
+		http.Error(w, "Only organization owners can perform this action", http.StatusForbidden)
+		return false
+	}
+
+	return true
+}
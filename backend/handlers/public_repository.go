@@ -75,7 +75,7 @@ func GetPublicRepositoryContents(w http.ResponseWriter, r *http.Request) {
 	repoPath := filepath.Join(baseRepoPath, username, gitRepoName)
 
 	// Get the contents
-	contents, err := utils.GetRepositoryContents(repoPath, path, ref)
+	contents, err := utils.GetRepositoryContents(r.Context(), repoPath, path, ref)
 	if err != nil {
 		http.Error(w, "Error retrieving repository contents: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -148,7 +148,7 @@ func GetPublicFileContent(w http.ResponseWriter, r *http.Request) {
 	repoPath := filepath.Join(baseRepoPath, username, gitRepoName)
 
 	// Get the file content
-	fileEntry, err := utils.GetFileContent(repoPath, filePath, ref)
+	fileEntry, err := utils.GetFileContent(r.Context(), repoPath, filePath, ref)
 	if err != nil {
 		http.Error(w, "Error retrieving file content: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -0,0 +1,617 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github-clone/models"
+	"github-clone/utils"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// CreatePullRequest handles POST /api/repos/{owner}/{repo}/pulls
+func CreatePullRequest(w http.ResponseWriter, r *http.Request) {
+	// Get current user from context
+	currentUser, err := utils.GetUserFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Anyone who can view a repository can propose changes to it
+	repo, ok := loadPullRequestRepository(w, r, currentUser.ID)
+	if !ok {
+		return
+	}
+
+	// Parse the request body
+	var input models.PullRequestInput
+	err = json.NewDecoder(r.Body).Decode(&input)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Validate required fields
+	if input.Title == "" || input.Head == "" || input.Base == "" {
+		http.Error(w, "Title, head and base are required", http.StatusBadRequest)
+		return
+	}
+
+	// The head is either a branch of this repository or "owner:branch" for a branch of a fork
+	headRepo, ok := pullRequestHeadRepository(w, repo, &input, currentUser.ID)
+	if !ok {
+		return
+	}
+
+	if input.Head == input.Base && headRepo.ID == repo.ID {
+		http.Error(w, "Head and base must be different branches", http.StatusUnprocessableEntity)
+		return
+	}
+
+	repoPath := utils.RepositoryDiskPath(repo.Owner.Username, repo.Name)
+	headRepoPath := utils.RepositoryDiskPath(headRepo.Owner.Username, headRepo.Name)
+
+	baseSHA, err := utils.ResolveBranch(r.Context(), repoPath, input.Base)
+	if err != nil {
+		http.Error(w, "Base branch not found: "+input.Base, http.StatusUnprocessableEntity)
+		return
+	}
+
+	headSHA, err := utils.ResolveBranch(r.Context(), headRepoPath, input.Head)
+	if err != nil {
+		http.Error(w, "Head branch not found: "+input.Head, http.StatusUnprocessableEntity)
+		return
+	}
+
+	// Commits of a fork have to be copied into this repository before they can be compared
+	if headRepo.ID != repo.ID {
+		headRef := "refs/tmp/pull-" + uuid.New().String()
+		if err := utils.FetchIntoRef(r.Context(), repoPath, headRepoPath, "refs/heads/"+input.Head, headRef); err != nil {
+			log.Printf("Failed to fetch %s from %s/%s: %v", input.Head, headRepo.Owner.Username, headRepo.Name, err)
+			http.Error(w, "Error retrieving head branch", http.StatusInternalServerError)
+			return
+		}
+		defer utils.DeleteRef(r.Context(), repoPath, headRef)
+
+		// The branch may have moved between resolving and fetching it
+		headSHA, err = utils.ResolveCommit(r.Context(), repoPath, headRef)
+		if err != nil {
+			http.Error(w, "Error retrieving head branch", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	existing, err := models.FindOpenPullRequest(repo.ID, headRepo.ID, input.Head, input.Base)
+	if err != nil {
+		http.Error(w, "Error checking existing pull requests", http.StatusInternalServerError)
+		return
+	}
+	if existing != nil {
+		http.Error(w, "A pull request for these branches is already open: "+existing.ID, http.StatusConflict)
+		return
+	}
+
+	mergeBase, err := utils.MergeBase(r.Context(), repoPath, baseSHA, headSHA)
+	if err != nil {
+		http.Error(w, "Error comparing branches", http.StatusInternalServerError)
+		return
+	}
+	if mergeBase == "" {
+		http.Error(w, "The branches have no history in common", http.StatusUnprocessableEntity)
+		return
+	}
+	if mergeBase == headSHA {
+		http.Error(w, "No commits between "+input.Base+" and "+input.Head, http.StatusUnprocessableEntity)
+		return
+	}
+
+	pr, err := models.CreatePullRequest(repo.ID, headRepo.ID, currentUser.Username, headSHA, input)
+	if err != nil {
+		http.Error(w, "Failed to create pull request: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Keep the proposed commits reachable even if the head branch is deleted later
+	if err := utils.UpdateRef(r.Context(), repoPath, pullRequestRef(pr.ID), headSHA, ""); err != nil {
+		log.Printf("Failed to store head of pull request %s: %v", pr.ID, err)
+	}
+
+	// Return the created pull request as JSON
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(pr)
+}
+
+// GetRepositoryPullRequests handles GET /api/repos/{owner}/{repo}/pulls
+// The state query parameter may be "open" (default), "closed", "merged" or "all"
+func GetRepositoryPullRequests(w http.ResponseWriter, r *http.Request) {
+	repo, ok := loadPullRequestRepository(w, r, getUserIDOptional(r))
+	if !ok {
+		return
+	}
+
+	state := r.URL.Query().Get("state")
+	if state == "" {
+		state = models.PullRequestOpen
+	}
+	if state != models.PullRequestOpen && state != models.PullRequestClosed && state != models.PullRequestMerged && state != "all" {
+		http.Error(w, "Invalid state", http.StatusBadRequest)
+		return
+	}
+
+	// Get pagination parameters
+	limit := 10 // Default limit
+	offset := 0 // Default offset
+
+	if parsedLimit, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && parsedLimit > 0 {
+		limit = parsedLimit
+	}
+	if parsedOffset, err := strconv.Atoi(r.URL.Query().Get("offset")); err == nil && parsedOffset >= 0 {
+		offset = parsedOffset
+	}
+
+	prs, err := models.GetRepositoryPullRequests(repo.ID, state, limit, offset)
+	if err != nil {
+		http.Error(w, "Failed to get pull requests: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the pull requests as JSON
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(prs)
+}
+
+// GetPullRequest handles GET /api/repos/{owner}/{repo}/pulls/{id}
+func GetPullRequest(w http.ResponseWriter, r *http.Request) {
+	repo, ok := loadPullRequestRepository(w, r, getUserIDOptional(r))
+	if !ok {
+		return
+	}
+
+	pr, ok := loadPullRequest(w, r, repo)
+	if !ok {
+		return
+	}
+
+	// Report whether an open pull request can be merged without conflicts
+	if pr.State == models.PullRequestOpen {
+		repoPath := utils.RepositoryDiskPath(repo.Owner.Username, repo.Name)
+		if baseSHA, err := utils.ResolveBranch(r.Context(), repoPath, pr.BaseRef); err == nil {
+			if mergeable, err := utils.CanMergeCleanly(r.Context(), repoPath, baseSHA, pr.HeadSHA); err == nil {
+				pr.Mergeable = &mergeable
+			}
+		}
+	}
+
+	// Return the pull request as JSON
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(pr)
+}
+
+// UpdatePullRequest handles PATCH /api/repos/{owner}/{repo}/pulls/{id}
+// The author and users with write access can edit the title, description and base branch, and close or reopen it
+func UpdatePullRequest(w http.ResponseWriter, r *http.Request) {
+	// Get current user from context
+	currentUser, err := utils.GetUserFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	repo, ok := loadPullRequestRepository(w, r, currentUser.ID)
+	if !ok {
+		return
+	}
+
+	pr, ok := loadPullRequest(w, r, repo)
+	if !ok {
+		return
+	}
+
+	if pr.CreatedBy != currentUser.Username && !repoAccess.CanEditRepository(repo.ID, repo.OwnerID, currentUser.ID) {
+		http.Error(w, "Unauthorized to update this pull request", http.StatusForbidden)
+		return
+	}
+
+	if pr.State == models.PullRequestMerged {
+		http.Error(w, "Merged pull requests cannot be changed", http.StatusUnprocessableEntity)
+		return
+	}
+
+	// Parse the request body
+	var input models.PullRequestUpdateInput
+	err = json.NewDecoder(r.Body).Decode(&input)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if input.Title != nil {
+		if *input.Title == "" {
+			http.Error(w, "Title cannot be empty", http.StatusBadRequest)
+			return
+		}
+		pr.Title = *input.Title
+	}
+
+	if input.Description != nil {
+		pr.Description = *input.Description
+	}
+
+	if input.Base != nil && *input.Base != pr.BaseRef {
+		repoPath := utils.RepositoryDiskPath(repo.Owner.Username, repo.Name)
+		if _, err := utils.ResolveBranch(r.Context(), repoPath, *input.Base); err != nil {
+			http.Error(w, "Base branch not found: "+*input.Base, http.StatusUnprocessableEntity)
+			return
+		}
+		if *input.Base == pr.HeadRef && pr.HeadRepositoryID == repo.ID {
+			http.Error(w, "Head and base must be different branches", http.StatusUnprocessableEntity)
+			return
+		}
+		pr.BaseRef = *input.Base
+	}
+
+	if input.State != nil {
+		switch *input.State {
+		case models.PullRequestOpen:
+			pr.State = models.PullRequestOpen
+			pr.ClosedAt = nil
+		case models.PullRequestClosed:
+			pr.State = models.PullRequestClosed
+		default:
+			http.Error(w, "State must be open or closed", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := models.UpdatePullRequest(pr); err != nil {
+		http.Error(w, "Failed to update pull request: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the updated pull request as JSON
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(pr)
+}
+
+// GetPullRequestCommits handles GET /api/repos/{owner}/{repo}/pulls/{id}/commits
+func GetPullRequestCommits(w http.ResponseWriter, r *http.Request) {
+	repo, ok := loadPullRequestRepository(w, r, getUserIDOptional(r))
+	if !ok {
+		return
+	}
+
+	pr, ok := loadPullRequest(w, r, repo)
+	if !ok {
+		return
+	}
+
+	repoPath := utils.RepositoryDiskPath(repo.Owner.Username, repo.Name)
+	base, ok := pullRequestBase(w, r, repoPath, pr)
+	if !ok {
+		return
+	}
+
+	commits, err := utils.GetCommitsBetween(r.Context(), repoPath, base, pr.HeadSHA)
+	if err != nil {
+		http.Error(w, "Error retrieving commits: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the commits as JSON
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(commits)
+}
+
+// GetPullRequestFiles handles GET /api/repos/{owner}/{repo}/pulls/{id}/files
+func GetPullRequestFiles(w http.ResponseWriter, r *http.Request) {
+	repo, ok := loadPullRequestRepository(w, r, getUserIDOptional(r))
+	if !ok {
+		return
+	}
+
+	pr, ok := loadPullRequest(w, r, repo)
+	if !ok {
+		return
+	}
+
+	repoPath := utils.RepositoryDiskPath(repo.Owner.Username, repo.Name)
+	base, ok := pullRequestBase(w, r, repoPath, pr)
+	if !ok {
+		return
+	}
+
+	files, err := utils.GetDiffBetween(r.Context(), repoPath, base, pr.HeadSHA)
+	if err != nil {
+		http.Error(w, "Error retrieving changes: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the changed files as JSON
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(files)
+}
+
+// MergePullRequest handles PUT /api/repos/{owner}/{repo}/pulls/{id}/merge
+func MergePullRequest(w http.ResponseWriter, r *http.Request) {
+	// Get current user from context
+	currentUser, err := utils.GetUserFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	repo, ok := loadPullRequestRepository(w, r, currentUser.ID)
+	if !ok {
+		return
+	}
+
+	// Merging writes to the base branch
+	if !repoAccess.CanPushToRepository(repo.ID, repo.OwnerID, currentUser.ID) {
+		http.Error(w, "Unauthorized to merge pull requests in this repository", http.StatusForbidden)
+		return
+	}
+
+	pr, ok := loadPullRequest(w, r, repo)
+	if !ok {
+		return
+	}
+
+	if pr.State != models.PullRequestOpen {
+		http.Error(w, "Only open pull requests can be merged", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Parse the request body; an empty body merges with a merge commit
+	var input models.MergePullRequestInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if input.MergeMethod == "" {
+		input.MergeMethod = utils.MergeMethodMerge
+	}
+	if !utils.IsValidMergeMethod(input.MergeMethod) {
+		http.Error(w, "merge_method must be merge, squash or rebase", http.StatusBadRequest)
+		return
+	}
+
+	if input.SHA != "" && input.SHA != pr.HeadSHA {
+		http.Error(w, "Head branch was modified. Review and try the merge again.", http.StatusConflict)
+		return
+	}
+
+	// Protected branches may restrict who can merge into them
+	refusal, err := checkProtectedBranchMerge(repo, pr.BaseRef, currentUser.ID)
+	if err != nil {
+		http.Error(w, "Error checking branch protection", http.StatusInternalServerError)
+		return
+	}
+	if refusal != "" {
+		http.Error(w, refusal, http.StatusForbidden)
+		return
+	}
+
+	repoPath := utils.RepositoryDiskPath(repo.Owner.Username, repo.Name)
+	baseSHA, err := utils.ResolveBranch(r.Context(), repoPath, pr.BaseRef)
+	if err != nil {
+		http.Error(w, "Base branch not found: "+pr.BaseRef, http.StatusUnprocessableEntity)
+		return
+	}
+
+	merger, err := models.GetUserByID(currentUser.ID)
+	if err != nil || merger == nil {
+		http.Error(w, "Error retrieving user", http.StatusInternalServerError)
+		return
+	}
+	committer := utils.GitSignature{Name: merger.Username, Email: merger.Email}
+
+	// Squashed commits are credited to the author of the pull request
+	author := committer
+	if input.MergeMethod == utils.MergeMethodSquash {
+		if creator, err := models.GetUserByUsername(pr.CreatedBy); err == nil && creator != nil {
+			author = utils.GitSignature{Name: creator.Username, Email: creator.Email}
+		}
+	}
+
+	message := pullRequestMergeMessage(pr, input)
+
+	resultSHA, err := utils.CreateMergeCommits(r.Context(), repoPath, input.MergeMethod, baseSHA, pr.HeadSHA, message, author, committer)
+	if err == utils.ErrMergeConflict {
+		http.Error(w, "Pull request cannot be merged because of conflicts", http.StatusConflict)
+		return
+	}
+	if err == utils.ErrRebaseMergeCommits {
+		http.Error(w, "Pull requests containing merge commits cannot be rebased", http.StatusUnprocessableEntity)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to merge pull request %s: %v", pr.ID, err)
+		http.Error(w, "Failed to merge pull request", http.StatusInternalServerError)
+		return
+	}
+
+	// Move the base branch, unless someone pushed to it in the meantime
+	refsBefore, _ := utils.ListRefs(r.Context(), repoPath)
+	if err := utils.UpdateRef(r.Context(), repoPath, "refs/heads/"+pr.BaseRef, resultSHA, baseSHA); err != nil {
+		log.Printf("Failed to update base branch of pull request %s: %v", pr.ID, err)
+		http.Error(w, "Base branch was modified. Try the merge again.", http.StatusConflict)
+		return
+	}
+
+	// The base branch moved as it would with a push, so push webhooks are sent for it
+	notifyRefChange(r, repo, repoPath, currentUser.ID, refsBefore)
+
+	if err := models.MarkPullRequestMerged(pr, currentUser.Username, input.MergeMethod, baseSHA, resultSHA); err != nil {
+		http.Error(w, "Failed to record merge: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Pull request %s merged into %s by %s (%s): %s", pr.ID, pr.BaseRef, currentUser.Username, input.MergeMethod, resultSHA)
+
+	// Return the merged pull request as JSON
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(pr)
+}
+
+// pullRequestHeadRepository finds the repository holding the head branch of a new pull request.
+// A head of the form "owner:branch" names a fork of the repository owned by owner; input.Head
+// is replaced by the branch name.
+func pullRequestHeadRepository(w http.ResponseWriter, repo *models.Repository, input *models.PullRequestInput, userID string) (*models.Repository, bool) {
+	owner, branch, found := strings.Cut(input.Head, ":")
+	if !found {
+		return repo, true
+	}
+	input.Head = branch
+
+	if owner == repo.Owner.Username {
+		return repo, true
+	}
+
+	forks, err := models.GetRepositoryForks(repo.ID)
+	if err != nil {
+		http.Error(w, "Error retrieving forks", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	for _, fork := range forks {
+		if fork.Owner.Username == owner && repoAccess.CanViewRepository(fork.ID, fork.OwnerID, fork.IsPublic, userID) {
+			return fork, true
+		}
+	}
+
+	http.Error(w, "No fork of this repository owned by "+owner, http.StatusUnprocessableEntity)
+	return nil, false
+}
+
+// pullRequestRef is the reference in the base repository that keeps the head commits of a pull request
+func pullRequestRef(id string) string {
+	return "refs/pull/" + id + "/head"
+}
+
+// pullRequestMergeMessage builds the commit message for merging a pull request
+func pullRequestMergeMessage(pr *models.PullRequest, input models.MergePullRequestInput) string {
+	title := input.CommitTitle
+	if title == "" {
+		if input.MergeMethod == utils.MergeMethodSquash {
+			title = pr.Title
+		} else {
+			title = "Merge pull request " + pr.ID + " from " + pr.HeadRef
+		}
+	}
+
+	body := input.CommitMessage
+	if body == "" && input.MergeMethod != utils.MergeMethodSquash {
+		body = pr.Title
+	}
+
+	return strings.TrimSpace(title + "\n\n" + body)
+}
+
+// pullRequestBase returns the commit the changes of a pull request are compared against.
+// Merged pull requests keep comparing against the base as it was when they were merged.
+func pullRequestBase(w http.ResponseWriter, r *http.Request, repoPath string, pr *models.PullRequest) (string, bool) {
+	if pr.State == models.PullRequestMerged && pr.BaseSHA != "" {
+		return pr.BaseSHA, true
+	}
+
+	baseSHA, err := utils.ResolveBranch(r.Context(), repoPath, pr.BaseRef)
+	if err != nil {
+		http.Error(w, "Base branch not found: "+pr.BaseRef, http.StatusUnprocessableEntity)
+		return "", false
+	}
+
+	return baseSHA, true
+}
+
+// loadPullRequestRepository looks up the repository named in the URL and writes a 404
+// unless the user can view it
+func loadPullRequestRepository(w http.ResponseWriter, r *http.Request, userID string) (*models.Repository, bool) {
+	vars := mux.Vars(r)
+
+	repo, err := models.GetRepositoryByName(vars["owner"], vars["repo"])
+	if err != nil {
+		http.Error(w, "Error retrieving repository", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	if repo == nil || !repoAccess.CanViewRepository(repo.ID, repo.OwnerID, repo.IsPublic, userID) {
+		http.Error(w, "Repository not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	return repo, true
+}
+
+// loadPullRequest looks up the pull request named in the URL and brings its head up to date
+// with the head branch, so pushes to the branch show up in the pull request
+func loadPullRequest(w http.ResponseWriter, r *http.Request, repo *models.Repository) (*models.PullRequest, bool) {
+	pr, err := models.GetPullRequest(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Error retrieving pull request", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	if pr == nil || pr.RepositoryID != repo.ID {
+		http.Error(w, "Pull request not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	if pr.State == models.PullRequestOpen {
+		syncPullRequestHead(r.Context(), repo, pr)
+	}
+
+	return pr, true
+}
+
+// syncPullRequestHead records the current tip of an open pull request's head branch.
+// If the branch was deleted the last known head is kept.
+func syncPullRequestHead(ctx context.Context, repo *models.Repository, pr *models.PullRequest) {
+	if pr.HeadRepositoryID == "" {
+		return
+	}
+
+	headRepo := repo
+	if pr.HeadRepositoryID != repo.ID {
+		var err error
+		headRepo, err = models.GetRepositoryByID(pr.HeadRepositoryID)
+		if err != nil || headRepo == nil {
+			return
+		}
+	}
+
+	repoPath := utils.RepositoryDiskPath(repo.Owner.Username, repo.Name)
+	headRepoPath := utils.RepositoryDiskPath(headRepo.Owner.Username, headRepo.Name)
+
+	headSHA, err := utils.ResolveBranch(ctx, headRepoPath, pr.HeadRef)
+	if err != nil || headSHA == pr.HeadSHA {
+		return
+	}
+
+	// Bring the commits into the base repository before recording them
+	if headRepo.ID == repo.ID {
+		err = utils.UpdateRef(ctx, repoPath, pullRequestRef(pr.ID), headSHA, "")
+	} else {
+		err = utils.FetchIntoRef(ctx, repoPath, headRepoPath, "refs/heads/"+pr.HeadRef, pullRequestRef(pr.ID))
+	}
+	if err != nil {
+		log.Printf("Failed to update head of pull request %s: %v", pr.ID, err)
+		return
+	}
+
+	if err := models.UpdatePullRequestHead(pr.ID, headSHA); err != nil {
+		log.Printf("Failed to record head of pull request %s: %v", pr.ID, err)
+		return
+	}
+	pr.HeadSHA = headSHA
+}
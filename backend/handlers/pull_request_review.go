@@ -0,0 +1,466 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github-clone/models"
+	"github-clone/utils"
+
+	"github.com/gorilla/mux"
+)
+
+// reviewEventStates maps the events accepted when submitting a review to the stored review state
+var reviewEventStates = map[string]string{
+	"APPROVE":         models.ReviewApproved,
+	"REQUEST_CHANGES": models.ReviewChangesRequested,
+	"COMMENT":         models.ReviewCommented,
+}
+
+// SubmitReview handles POST /api/repos/{owner}/{repo}/pulls/{id}/reviews
+func SubmitReview(w http.ResponseWriter, r *http.Request) {
+	// Get current user from context
+	currentUser, err := utils.GetUserFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	repo, ok := loadPullRequestRepository(w, r, currentUser.ID)
+	if !ok {
+		return
+	}
+
+	pr, ok := loadPullRequest(w, r, repo)
+	if !ok {
+		return
+	}
+
+	// Parse the request body
+	var input models.ReviewInput
+	err = json.NewDecoder(r.Body).Decode(&input)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	state, ok := reviewEventStates[strings.ToUpper(input.Event)]
+	if !ok {
+		http.Error(w, "event must be APPROVE, REQUEST_CHANGES or COMMENT", http.StatusBadRequest)
+		return
+	}
+
+	if state != models.ReviewCommented {
+		if pr.State != models.PullRequestOpen {
+			http.Error(w, "Only open pull requests can be approved or have changes requested", http.StatusUnprocessableEntity)
+			return
+		}
+		if pr.CreatedBy == currentUser.Username {
+			http.Error(w, "You cannot approve or request changes on your own pull request", http.StatusUnprocessableEntity)
+			return
+		}
+	}
+
+	if state == models.ReviewChangesRequested && input.Body == "" {
+		http.Error(w, "A body is required when requesting changes", http.StatusUnprocessableEntity)
+		return
+	}
+	if state == models.ReviewCommented && input.Body == "" && len(input.Comments) == 0 {
+		http.Error(w, "A body or comments are required", http.StatusUnprocessableEntity)
+		return
+	}
+
+	repoPath := utils.RepositoryDiskPath(repo.Owner.Username, repo.Name)
+	commitSHA, ok := reviewCommit(w, r, repoPath, pr, input.CommitSHA)
+	if !ok {
+		return
+	}
+
+	// Comments of a review are anchored to the commit the review is for
+	comments := []*models.ReviewComment{}
+	for _, commentInput := range input.Comments {
+		if commentInput.CommitSHA == "" {
+			commentInput.CommitSHA = commitSHA
+		}
+		comment, ok := anchorReviewComment(w, r, repoPath, pr, commentInput)
+		if !ok {
+			return
+		}
+		comments = append(comments, comment)
+	}
+
+	review, err := models.CreateReview(pr.ID, currentUser.Username, state, input.Body, commitSHA, comments)
+	if err != nil {
+		http.Error(w, "Failed to submit review: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	markOutdatedComments(r.Context(), repoPath, pr, review.Comments)
+
+	// Return the created review as JSON
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(review)
+}
+
+// GetPullRequestReviews handles GET /api/repos/{owner}/{repo}/pulls/{id}/reviews
+func GetPullRequestReviews(w http.ResponseWriter, r *http.Request) {
+	repo, ok := loadPullRequestRepository(w, r, getUserIDOptional(r))
+	if !ok {
+		return
+	}
+
+	pr, ok := loadPullRequest(w, r, repo)
+	if !ok {
+		return
+	}
+
+	reviews, err := models.GetPullRequestReviews(pr.ID)
+	if err != nil {
+		http.Error(w, "Failed to get reviews: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the reviews as JSON
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reviews)
+}
+
+// CreateReviewComment handles POST /api/repos/{owner}/{repo}/pulls/{id}/comments
+// A comment is either anchored to a path and line, or replies to another comment with in_reply_to
+func CreateReviewComment(w http.ResponseWriter, r *http.Request) {
+	// Get current user from context
+	currentUser, err := utils.GetUserFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	repo, ok := loadPullRequestRepository(w, r, currentUser.ID)
+	if !ok {
+		return
+	}
+
+	pr, ok := loadPullRequest(w, r, repo)
+	if !ok {
+		return
+	}
+
+	// Parse the request body
+	var input models.ReviewCommentInput
+	err = json.NewDecoder(r.Body).Decode(&input)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	repoPath := utils.RepositoryDiskPath(repo.Owner.Username, repo.Name)
+	comment, ok := anchorReviewComment(w, r, repoPath, pr, input)
+	if !ok {
+		return
+	}
+
+	if err := models.CreateReviewComment(pr.ID, currentUser.Username, comment); err != nil {
+		http.Error(w, "Failed to create comment: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	markOutdatedComments(r.Context(), repoPath, pr, []*models.ReviewComment{comment})
+
+	// Return the created comment as JSON
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(comment)
+}
+
+// GetReviewComments handles GET /api/repos/{owner}/{repo}/pulls/{id}/comments
+func GetReviewComments(w http.ResponseWriter, r *http.Request) {
+	repo, ok := loadPullRequestRepository(w, r, getUserIDOptional(r))
+	if !ok {
+		return
+	}
+
+	pr, ok := loadPullRequest(w, r, repo)
+	if !ok {
+		return
+	}
+
+	comments, err := models.GetPullRequestReviewComments(pr.ID)
+	if err != nil {
+		http.Error(w, "Failed to get comments: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	markOutdatedComments(r.Context(), utils.RepositoryDiskPath(repo.Owner.Username, repo.Name), pr, comments)
+
+	// Return the comments as JSON
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(comments)
+}
+
+// UpdateReviewComment handles PATCH /api/repos/{owner}/{repo}/pulls/{id}/comments/{comment_id}
+// Only the author of a comment can edit it
+func UpdateReviewComment(w http.ResponseWriter, r *http.Request) {
+	// Get current user from context
+	currentUser, err := utils.GetUserFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	repo, ok := loadPullRequestRepository(w, r, currentUser.ID)
+	if !ok {
+		return
+	}
+
+	pr, ok := loadPullRequest(w, r, repo)
+	if !ok {
+		return
+	}
+
+	comment, ok := loadReviewComment(w, r, pr)
+	if !ok {
+		return
+	}
+
+	if comment.CreatedBy != currentUser.Username {
+		http.Error(w, "Unauthorized to edit this comment", http.StatusForbidden)
+		return
+	}
+
+	// Parse the request body
+	var input struct {
+		Body string `json:"body"`
+	}
+	err = json.NewDecoder(r.Body).Decode(&input)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if input.Body == "" {
+		http.Error(w, "Body cannot be empty", http.StatusBadRequest)
+		return
+	}
+
+	if err := models.UpdateReviewComment(comment, input.Body); err != nil {
+		http.Error(w, "Failed to update comment: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	markOutdatedComments(r.Context(), utils.RepositoryDiskPath(repo.Owner.Username, repo.Name), pr, []*models.ReviewComment{comment})
+
+	// Return the updated comment as JSON
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(comment)
+}
+
+// DeleteReviewComment handles DELETE /api/repos/{owner}/{repo}/pulls/{id}/comments/{comment_id}
+// The author of a comment and repository admins can delete it
+func DeleteReviewComment(w http.ResponseWriter, r *http.Request) {
+	// Get current user from context
+	currentUser, err := utils.GetUserFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	repo, ok := loadPullRequestRepository(w, r, currentUser.ID)
+	if !ok {
+		return
+	}
+
+	pr, ok := loadPullRequest(w, r, repo)
+	if !ok {
+		return
+	}
+
+	comment, ok := loadReviewComment(w, r, pr)
+	if !ok {
+		return
+	}
+
+	if comment.CreatedBy != currentUser.Username && !repoAccess.CanAdminRepository(repo.ID, repo.OwnerID, currentUser.ID) {
+		http.Error(w, "Unauthorized to delete this comment", http.StatusForbidden)
+		return
+	}
+
+	if err := models.DeleteReviewComment(comment.ID); err != nil {
+		http.Error(w, "Failed to delete comment: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// loadReviewComment looks up the review comment named in the URL, which must belong to the pull request
+func loadReviewComment(w http.ResponseWriter, r *http.Request, pr *models.PullRequest) (*models.ReviewComment, bool) {
+	comment, err := models.GetReviewComment(mux.Vars(r)["comment_id"])
+	if err != nil {
+		http.Error(w, "Error retrieving comment", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	if comment == nil || comment.PullRequestID != pr.ID {
+		http.Error(w, "Comment not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	return comment, true
+}
+
+// reviewCommit resolves the commit a review or comment is made on. It defaults to the
+// current head and must be one of the commits the pull request has pointed to.
+func reviewCommit(w http.ResponseWriter, r *http.Request, repoPath string, pr *models.PullRequest, ref string) (string, bool) {
+	if ref == "" {
+		return pr.HeadSHA, true
+	}
+
+	commitSHA, err := utils.ResolveCommit(r.Context(), repoPath, ref)
+	if err != nil {
+		http.Error(w, "Commit not found: "+ref, http.StatusUnprocessableEntity)
+		return "", false
+	}
+
+	isAncestor, err := utils.IsAncestor(r.Context(), repoPath, commitSHA, pr.HeadSHA)
+	if err != nil {
+		http.Error(w, "Error checking commit", http.StatusInternalServerError)
+		return "", false
+	}
+	if !isAncestor {
+		http.Error(w, "Commit is not part of this pull request: "+ref, http.StatusUnprocessableEntity)
+		return "", false
+	}
+
+	return commitSHA, true
+}
+
+// anchorReviewComment validates where a comment is placed and builds it. Replies take their
+// position from the start of the thread. Other comments must point at an existing line of a
+// file the pull request changes: a line of the new file for the RIGHT side, or of the file
+// at the merge base for the LEFT side.
+func anchorReviewComment(w http.ResponseWriter, r *http.Request, repoPath string, pr *models.PullRequest, input models.ReviewCommentInput) (*models.ReviewComment, bool) {
+	if input.Body == "" {
+		http.Error(w, "Comment body is required", http.StatusBadRequest)
+		return nil, false
+	}
+
+	if input.InReplyTo != "" {
+		parent, err := models.GetReviewComment(input.InReplyTo)
+		if err != nil {
+			http.Error(w, "Error retrieving comment", http.StatusInternalServerError)
+			return nil, false
+		}
+		if parent == nil || parent.PullRequestID != pr.ID {
+			http.Error(w, "Comment to reply to not found", http.StatusUnprocessableEntity)
+			return nil, false
+		}
+
+		// Threads are flat: replies to replies belong to the first comment
+		threadID := parent.ID
+		if parent.InReplyTo != "" {
+			threadID = parent.InReplyTo
+		}
+
+		return &models.ReviewComment{
+			InReplyTo: threadID,
+			Path:      parent.Path,
+			CommitSHA: parent.CommitSHA,
+			Line:      parent.Line,
+			Side:      parent.Side,
+			Body:      input.Body,
+		}, true
+	}
+
+	if input.Path == "" || input.Line < 1 {
+		http.Error(w, "Path and a positive line are required", http.StatusBadRequest)
+		return nil, false
+	}
+
+	side := strings.ToUpper(input.Side)
+	if side == "" {
+		side = models.DiffSideRight
+	}
+	if side != models.DiffSideLeft && side != models.DiffSideRight {
+		http.Error(w, "side must be LEFT or RIGHT", http.StatusBadRequest)
+		return nil, false
+	}
+
+	commitSHA, ok := reviewCommit(w, r, repoPath, pr, input.CommitSHA)
+	if !ok {
+		return nil, false
+	}
+
+	base, ok := pullRequestBase(w, r, repoPath, pr)
+	if !ok {
+		return nil, false
+	}
+
+	mergeBase, err := utils.MergeBase(r.Context(), repoPath, base, commitSHA)
+	if err != nil || mergeBase == "" {
+		http.Error(w, "Error comparing branches", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	files, err := utils.GetDiff(r.Context(), repoPath, mergeBase, commitSHA)
+	if err != nil {
+		http.Error(w, "Error retrieving changes: "+err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+
+	// Find the changed file and where its lines are read from
+	var file *utils.FileDiff
+	for _, f := range files {
+		if f.Filename == input.Path {
+			file = f
+			break
+		}
+	}
+	if file == nil {
+		http.Error(w, "File is not changed by this pull request: "+input.Path, http.StatusUnprocessableEntity)
+		return nil, false
+	}
+
+	lineCommit, linePath := commitSHA, file.Filename
+	if side == models.DiffSideLeft {
+		lineCommit = mergeBase
+		if file.PreviousFilename != "" {
+			linePath = file.PreviousFilename
+		}
+	}
+
+	lines, err := utils.CountFileLines(r.Context(), repoPath, lineCommit, linePath)
+	if err != nil || input.Line > lines {
+		http.Error(w, "Line is outside of the file", http.StatusUnprocessableEntity)
+		return nil, false
+	}
+
+	return &models.ReviewComment{
+		Path:      file.Filename,
+		CommitSHA: commitSHA,
+		Line:      input.Line,
+		Side:      side,
+		Body:      input.Body,
+	}, true
+}
+
+// markOutdatedComments flags comments on files that changed after the commit they were made on
+func markOutdatedComments(ctx context.Context, repoPath string, pr *models.PullRequest, comments []*models.ReviewComment) {
+	changed := map[string]bool{}
+
+	for _, comment := range comments {
+		key := comment.CommitSHA + ":" + comment.Path
+		outdated, seen := changed[key]
+		if !seen {
+			var err error
+			outdated, err = utils.FileChangedBetween(ctx, repoPath, comment.CommitSHA, pr.HeadSHA, comment.Path)
+			if err != nil {
+				outdated = false
+			}
+			changed[key] = outdated
+		}
+		comment.Outdated = outdated
+	}
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github-clone/auth"
+	"github-clone/models"
+	"github-clone/utils"
+	"github-clone/webhook"
+
+	"github.com/gorilla/mux"
+)
+
+// TestMergePullRequestSendsPushWebhook checks that merging a pull request sends a push event
+// for the base branch, as pushing the merge would
+func TestMergePullRequestSendsPushWebhook(t *testing.T) {
+	owner, err := models.CreateUser("mergeowner", "mergeowner@example.com", "x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err := models.CreateRepository(owner.ID, models.RepositoryInput{Name: "merged"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	repoPath := utils.RepositoryDiskPath(owner.Username, repo.Name)
+
+	ctx := context.Background()
+	base := writeTestCommit(t, repoPath, "", "a.txt", "one\n")
+	head := writeTestCommit(t, repoPath, base, "a.txt", "two\n")
+	if err := utils.UpdateRef(ctx, repoPath, "refs/heads/main", base, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.UpdateRef(ctx, repoPath, "refs/heads/feature", head, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	hook, err := models.CreateWebhook(repo.ID, owner.ID, "https://example.com/hook", "", []string{models.WebhookEventPush}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pr, err := models.CreatePullRequest(repo.ID, repo.ID, owner.Username, head, models.PullRequestInput{Title: "Change a.txt", Head: "feature", Base: "main"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest("PUT", "/api/repos/mergeowner/merged/pulls/"+pr.ID+"/merge", nil)
+	r = mux.SetURLVars(r, map[string]string{"owner": owner.Username, "repo": repo.Name, "id": pr.ID})
+	r = r.WithContext(context.WithValue(r.Context(), auth.UserIDKey, owner.ID))
+	w := httptest.NewRecorder()
+	MergePullRequest(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("merge: status %d: %s", w.Code, w.Body.String())
+	}
+
+	merged, err := utils.ResolveBranch(ctx, repoPath, "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deliveries, err := models.GetWebhookDeliveries(hook.ID, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 1 || deliveries[0].Event != models.WebhookEventPush {
+		t.Fatalf("got %d deliveries, want a single push", len(deliveries))
+	}
+	delivery, err := models.GetWebhookDelivery(deliveries[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var payload webhook.PushPayload
+	if err := json.Unmarshal([]byte(delivery.Payload), &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Ref != "refs/heads/main" || payload.Before != base || payload.After != merged {
+		t.Errorf("push of %s from %s to %s, want refs/heads/main from %s to %s",
+			payload.Ref, payload.Before, payload.After, base, merged)
+	}
+	if payload.Sender.Username != owner.Username {
+		t.Errorf("sender is %q, want %q", payload.Sender.Username, owner.Username)
+	}
+}
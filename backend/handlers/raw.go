@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github-clone/utils"
+)
+
+// GetRawFile handles GET /api/{username}/{reponame}/raw?path=&ref=&download=
+// The bytes of the file are streamed as they are, with a Content-Type sniffed from the
+// content. The blob SHA is the ETag, and single byte ranges are supported so large files
+// can be resumed. With download=true the file is sent as an attachment.
+func GetRawFile(w http.ResponseWriter, r *http.Request) {
+	repo, ok := loadRepositoryForViewer(w, r, getUserIDOptional(r))
+	if !ok {
+		return
+	}
+
+	// Get the file path from query parameters
+	filePath := strings.Trim(r.URL.Query().Get("path"), "/")
+	if filePath == "" {
+		http.Error(w, "File path is required", http.StatusBadRequest)
+		return
+	}
+
+	repoPath := utils.RepositoryDiskPath(repo.Owner.Username, repo.Name)
+	blob, err := utils.GetBlobInfo(r.Context(), repoPath, r.URL.Query().Get("ref"), filePath)
+	switch {
+	case err == utils.ErrRefNotFound:
+		http.Error(w, "Ref not found", http.StatusNotFound)
+		return
+	case err == utils.ErrPathNotFound:
+		http.Error(w, "File not found", http.StatusNotFound)
+		return
+	case err != nil:
+		log.Printf("Error looking up %s in %s: %v", filePath, repoPath, err)
+		http.Error(w, "Error retrieving file", http.StatusInternalServerError)
+		return
+	}
+
+	// A blob never changes, so the ETag is all a client needs to revalidate. The ref may
+	// move to another blob, so clients must still ask.
+	etag := `"` + blob.SHA + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "private, no-cache")
+	w.Header().Set("Accept-Ranges", "bytes")
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	reader, err := utils.OpenBlob(r.Context(), repoPath, blob.SHA)
+	if err != nil {
+		log.Printf("Error reading %s in %s: %v", filePath, repoPath, err)
+		http.Error(w, "Error retrieving file", http.StatusInternalServerError)
+		return
+	}
+	defer reader.Close()
+
+	// Sniff the type from the start of the file, then put those bytes back in front
+	sniff := make([]byte, 512)
+	n, _ := io.ReadFull(reader, sniff)
+	body := io.MultiReader(bytes.NewReader(sniff[:n]), reader)
+
+	// Files are served from the API origin, so HTML, SVG and scripts must not be rendered
+	// or run by the browser. Text of any kind is served as plain text.
+	contentType := http.DetectContentType(sniff[:n])
+	if strings.HasPrefix(contentType, "text/") {
+		contentType = "text/plain; charset=utf-8"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; sandbox")
+
+	disposition := "inline"
+	if download, _ := strconv.ParseBool(r.URL.Query().Get("download")); download {
+		disposition = "attachment"
+	}
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": path.Base(filePath)}))
+
+	// If-Range asks for the range only if the file has not changed since it was last seen
+	start, length := int64(0), blob.Size
+	status := http.StatusOK
+	if rangeHeader := r.Header.Get("Range"); rangeHeader != "" && (r.Header.Get("If-Range") == "" || r.Header.Get("If-Range") == etag) {
+		var satisfiable bool
+		start, length, satisfiable = parseByteRange(rangeHeader, blob.Size)
+		if !satisfiable {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", blob.Size))
+			http.Error(w, "Requested range not satisfiable", http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		if start != 0 || length != blob.Size {
+			status = http.StatusPartialContent
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, start+length-1, blob.Size))
+		}
+	}
+
+	w.Header().Set("Content-Length", strconv.FormatInt(length, 10))
+	w.WriteHeader(status)
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	if _, err := io.CopyN(io.Discard, body, start); err != nil {
+		log.Printf("Error reading %s in %s: %v", filePath, repoPath, err)
+		return
+	}
+	if _, err := io.CopyN(w, body, length); err != nil {
+		// Usually the client went away
+		log.Printf("Error streaming %s from %s: %v", filePath, repoPath, err)
+	}
+}
+
+// etagMatches reports whether an If-None-Match header lists an ETag
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// parseByteRange reads a Range header of a single byte range: "bytes=first-last",
+// "bytes=first-" or "bytes=-suffix". Headers it does not understand, including several
+// ranges, select the whole file, as the range is only a hint. Returns the start and length
+// of the range and false when it lies outside the file.
+func parseByteRange(header string, size int64) (int64, int64, bool) {
+	spec, found := strings.CutPrefix(header, "bytes=")
+	if !found || strings.Contains(spec, ",") {
+		return 0, size, true
+	}
+
+	first, last, found := strings.Cut(strings.TrimSpace(spec), "-")
+	if !found {
+		return 0, size, true
+	}
+
+	if first == "" {
+		// The last bytes of the file
+		suffix, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || suffix < 0 {
+			return 0, size, true
+		}
+		if suffix == 0 {
+			return 0, 0, false
+		}
+		if suffix > size {
+			suffix = size
+		}
+		return size - suffix, suffix, true
+	}
+
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return 0, size, true
+	}
+	if start >= size {
+		return 0, 0, false
+	}
+
+	end := size - 1
+	if last != "" {
+		end, err = strconv.ParseInt(last, 10, 64)
+		if err != nil || end < start {
+			return 0, size, true
+		}
+		if end > size-1 {
+			end = size - 1
+		}
+	}
+
+	return start, end - start + 1, true
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import "testing"
+
+func TestParseByteRange(t *testing.T) {
+	tests := []struct {
+		header      string
+		size        int64
+		wantStart   int64
+		wantLength  int64
+		wantSatisfy bool
+	}{
+		{"bytes=0-99", 1000, 0, 100, true},
+		{"bytes=100-199", 1000, 100, 100, true},
+		{"bytes=900-", 1000, 900, 100, true},
+		{"bytes=-100", 1000, 900, 100, true},
+		{"bytes=990-2000", 1000, 990, 10, true},   // The end is clamped to the file
+		{"bytes=-5000", 1000, 0, 1000, true},      // So is the suffix
+		{"bytes=5-5", 1000, 5, 1, true},           // A single byte
+		{"bytes=1000-", 1000, 0, 0, false},        // Starts past the end
+		{"bytes=-0", 1000, 0, 0, false},           // An empty suffix
+		{"bytes=0-", 0, 0, 0, false},              // Nothing to send from an empty file
+		{"", 1000, 0, 1000, true},                 // No range
+		{"items=0-10", 1000, 0, 1000, true},       // Unknown unit
+		{"bytes=0-10,20-30", 1000, 0, 1000, true}, // Several ranges
+		{"bytes=10-5", 1000, 0, 1000, true},       // End before start
+		{"bytes=a-b", 1000, 0, 1000, true},
+		{"bytes=-", 1000, 0, 1000, true},
+		{"bytes=5", 1000, 0, 1000, true},
+		{"bytes=-1-5", 1000, 0, 1000, true},
+	}
+
+	for _, tt := range tests {
+		start, length, ok := parseByteRange(tt.header, tt.size)
+		if start != tt.wantStart || length != tt.wantLength || ok != tt.wantSatisfy {
+			t.Errorf("parseByteRange(%q, %d) = %d, %d, %v, want %d, %d, %v",
+				tt.header, tt.size, start, length, ok, tt.wantStart, tt.wantLength, tt.wantSatisfy)
+		}
+	}
+}
@@ -0,0 +1,567 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github-clone/models"
+	"github-clone/utils"
+
+	"github.com/gorilla/mux"
+)
+
+// maxReleaseAssetSize is the largest file that can be uploaded to a release
+const maxReleaseAssetSize = 2 << 30
+
+// GetReleases handles GET /api/{username}/{reponame}/releases
+// Drafts are only listed for users who can push to the repository.
+func GetReleases(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDOptional(r)
+	repo, ok := loadRepositoryForViewer(w, r, userID)
+	if !ok {
+		return
+	}
+
+	releases, err := models.GetRepositoryReleases(repo.ID, canPushToRepository(repo, userID))
+	if err != nil {
+		http.Error(w, "Error retrieving releases", http.StatusInternalServerError)
+		return
+	}
+
+	// Return success response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(releases)
+}
+
+// GetLatestRelease handles GET /api/{username}/{reponame}/releases/latest
+// The latest release is the most recently published one that is not a prerelease.
+func GetLatestRelease(w http.ResponseWriter, r *http.Request) {
+	repo, ok := loadRepositoryForViewer(w, r, getUserIDOptional(r))
+	if !ok {
+		return
+	}
+
+	release, err := models.GetLatestRelease(repo.ID)
+	if err != nil {
+		http.Error(w, "Error retrieving release", http.StatusInternalServerError)
+		return
+	}
+	if release == nil {
+		http.Error(w, "Release not found", http.StatusNotFound)
+		return
+	}
+
+	// Return success response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(release)
+}
+
+// GetReleaseByTag handles GET /api/{username}/{reponame}/releases/tags/{tag}
+func GetReleaseByTag(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDOptional(r)
+	repo, ok := loadRepositoryForViewer(w, r, userID)
+	if !ok {
+		return
+	}
+
+	release, err := models.GetReleaseByTag(repo.ID, mux.Vars(r)["tag"])
+	if err != nil {
+		http.Error(w, "Error retrieving release", http.StatusInternalServerError)
+		return
+	}
+	if release == nil || (release.Draft && !canPushToRepository(repo, userID)) {
+		http.Error(w, "Release not found", http.StatusNotFound)
+		return
+	}
+
+	// Return success response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(release)
+}
+
+// GetRelease handles GET /api/{username}/{reponame}/releases/{id}
+func GetRelease(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDOptional(r)
+	repo, ok := loadRepositoryForViewer(w, r, userID)
+	if !ok {
+		return
+	}
+
+	release, ok := loadRelease(w, r, repo, userID)
+	if !ok {
+		return
+	}
+
+	// Return success response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(release)
+}
+
+// CreateRelease handles POST /api/{username}/{reponame}/releases
+// Publishing a release on a tag that does not exist yet creates an annotated tag at
+// target_commitish, which defaults to the default branch.
+func CreateRelease(w http.ResponseWriter, r *http.Request) {
+	// Get the authenticated user ID from the token
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	repo, ok := loadRepositoryForPush(w, r, userID)
+	if !ok {
+		return
+	}
+
+	// Parse the request body
+	var input models.ReleaseInput
+	err = json.NewDecoder(r.Body).Decode(&input)
+	if err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if input.TagName == nil {
+		http.Error(w, "Tag name is required", http.StatusBadRequest)
+		return
+	}
+
+	release := &models.Release{
+		RepositoryID: repo.ID,
+		AuthorID:     userID,
+	}
+	if input.TargetCommitish == nil || *input.TargetCommitish == "" {
+		repoPath := utils.RepositoryDiskPath(repo.Owner.Username, repo.Name)
+		release.TargetCommitish, _ = utils.GetDefaultBranch(r.Context(), repoPath)
+	}
+	if !applyReleaseInput(w, release, input) {
+		return
+	}
+
+	if !releaseTagAvailable(w, repo.ID, release) {
+		return
+	}
+
+	if !release.Draft && !ensureReleaseTag(w, r, repo, release, userID) {
+		return
+	}
+
+	if err := models.CreateRelease(release); err != nil {
+		http.Error(w, "Failed to create release: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	release, err = models.GetReleaseByID(release.ID)
+	if err != nil || release == nil {
+		http.Error(w, "Error retrieving release", http.StatusInternalServerError)
+		return
+	}
+
+	// Return success response
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(release)
+}
+
+// UpdateRelease handles PATCH /api/{username}/{reponame}/releases/{id}
+// Setting draft to false publishes the release, creating its tag if needed.
+func UpdateRelease(w http.ResponseWriter, r *http.Request) {
+	// Get the authenticated user ID from the token
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	repo, ok := loadRepositoryForPush(w, r, userID)
+	if !ok {
+		return
+	}
+
+	release, ok := loadRelease(w, r, repo, userID)
+	if !ok {
+		return
+	}
+
+	// Parse the request body
+	var input models.ReleaseInput
+	err = json.NewDecoder(r.Body).Decode(&input)
+	if err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if !applyReleaseInput(w, release, input) {
+		return
+	}
+
+	if !releaseTagAvailable(w, repo.ID, release) {
+		return
+	}
+
+	if !release.Draft && !ensureReleaseTag(w, r, repo, release, userID) {
+		return
+	}
+
+	if err := models.UpdateRelease(release); err != nil {
+		http.Error(w, "Failed to update release: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return success response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(release)
+}
+
+// DeleteRelease handles DELETE /api/{username}/{reponame}/releases/{id}
+// The tag of the release is kept.
+func DeleteRelease(w http.ResponseWriter, r *http.Request) {
+	// Get the authenticated user ID from the token
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	repo, ok := loadRepositoryForPush(w, r, userID)
+	if !ok {
+		return
+	}
+
+	release, ok := loadRelease(w, r, repo, userID)
+	if !ok {
+		return
+	}
+
+	if err := models.DeleteRelease(release.ID); err != nil {
+		http.Error(w, "Failed to delete release", http.StatusInternalServerError)
+		return
+	}
+
+	releaseDir := filepath.Join(utils.RepositoryDataPath(repo.Owner.Username, repo.Name), "releases", release.ID)
+	if err := os.RemoveAll(releaseDir); err != nil {
+		log.Printf("Error deleting assets of release %s: %v", release.ID, err)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// UploadReleaseAsset handles POST /api/{username}/{reponame}/releases/{id}/assets?name=
+// The request body is the content of the file, and its Content-Type is kept for downloads.
+func UploadReleaseAsset(w http.ResponseWriter, r *http.Request) {
+	// Get the authenticated user ID from the token
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	repo, ok := loadRepositoryForPush(w, r, userID)
+	if !ok {
+		return
+	}
+
+	release, ok := loadRelease(w, r, repo, userID)
+	if !ok {
+		return
+	}
+
+	name := strings.TrimSpace(r.URL.Query().Get("name"))
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, "/\\") {
+		http.Error(w, "A file name without slashes is required", http.StatusBadRequest)
+		return
+	}
+
+	for _, existing := range release.Assets {
+		if existing.Name == name {
+			http.Error(w, "An asset with this name already exists", http.StatusConflict)
+			return
+		}
+	}
+
+	asset := &models.ReleaseAsset{
+		ReleaseID:   release.ID,
+		Name:        name,
+		ContentType: r.Header.Get("Content-Type"),
+		UploaderID:  userID,
+	}
+	if asset.ContentType == "" {
+		asset.ContentType = "application/octet-stream"
+	}
+
+	// Write the upload to a temporary file first, so a failed upload leaves nothing behind
+	releaseDir := filepath.Join(utils.RepositoryDataPath(repo.Owner.Username, repo.Name), "releases", release.ID)
+	if err := os.MkdirAll(releaseDir, 0755); err != nil {
+		log.Printf("Error creating release directory %s: %v", releaseDir, err)
+		http.Error(w, "Failed to store asset", http.StatusInternalServerError)
+		return
+	}
+	tmp, err := os.CreateTemp(releaseDir, ".upload-*")
+	if err != nil {
+		log.Printf("Error creating upload file in %s: %v", releaseDir, err)
+		http.Error(w, "Failed to store asset", http.StatusInternalServerError)
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	asset.Size, err = io.Copy(tmp, http.MaxBytesReader(w, r.Body, maxReleaseAssetSize))
+	if err != nil {
+		http.Error(w, "Failed to read upload: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := tmp.Close(); err != nil {
+		log.Printf("Error writing upload file %s: %v", tmp.Name(), err)
+		http.Error(w, "Failed to store asset", http.StatusInternalServerError)
+		return
+	}
+
+	if err := models.CreateReleaseAsset(asset); err != nil {
+		http.Error(w, "Failed to create asset: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(releaseDir, asset.ID)); err != nil {
+		log.Printf("Error storing asset %s: %v", asset.ID, err)
+		models.DeleteReleaseAsset(asset.ID)
+		http.Error(w, "Failed to store asset", http.StatusInternalServerError)
+		return
+	}
+
+	asset, err = models.GetReleaseAssetByID(asset.ID)
+	if err != nil || asset == nil {
+		http.Error(w, "Error retrieving asset", http.StatusInternalServerError)
+		return
+	}
+
+	// Return success response
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(asset)
+}
+
+// GetReleaseAsset handles GET /api/{username}/{reponame}/releases/assets/{asset_id}
+func GetReleaseAsset(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDOptional(r)
+	repo, ok := loadRepositoryForViewer(w, r, userID)
+	if !ok {
+		return
+	}
+
+	asset, ok := loadReleaseAsset(w, r, repo, userID)
+	if !ok {
+		return
+	}
+
+	// Return success response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(asset)
+}
+
+// DownloadReleaseAsset handles GET /api/{username}/{reponame}/releases/assets/{asset_id}/download
+// Every download is counted, except requests for a later part of the file, which resume a
+// download that was already counted.
+func DownloadReleaseAsset(w http.ResponseWriter, r *http.Request) {
+	userID := getUserIDOptional(r)
+	repo, ok := loadRepositoryForViewer(w, r, userID)
+	if !ok {
+		return
+	}
+
+	asset, ok := loadReleaseAsset(w, r, repo, userID)
+	if !ok {
+		return
+	}
+
+	assetPath := filepath.Join(utils.RepositoryDataPath(repo.Owner.Username, repo.Name), "releases", asset.ReleaseID, asset.ID)
+	file, err := os.Open(assetPath)
+	if err != nil {
+		log.Printf("Error opening asset %s: %v", assetPath, err)
+		http.Error(w, "Error retrieving asset", http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+
+	if r.Method == http.MethodGet && r.Header.Get("Range") == "" {
+		if err := models.IncrementReleaseAssetDownloads(asset.ID); err != nil {
+			log.Printf("Error counting download of asset %s: %v", asset.ID, err)
+		}
+	}
+
+	w.Header().Set("Content-Type", asset.ContentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": asset.Name}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeContent(w, r, asset.Name, asset.CreatedAt, file)
+}
+
+// DeleteReleaseAsset handles DELETE /api/{username}/{reponame}/releases/assets/{asset_id}
+func DeleteReleaseAsset(w http.ResponseWriter, r *http.Request) {
+	// Get the authenticated user ID from the token
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	repo, ok := loadRepositoryForPush(w, r, userID)
+	if !ok {
+		return
+	}
+
+	asset, ok := loadReleaseAsset(w, r, repo, userID)
+	if !ok {
+		return
+	}
+
+	if err := models.DeleteReleaseAsset(asset.ID); err != nil {
+		http.Error(w, "Failed to delete asset", http.StatusInternalServerError)
+		return
+	}
+
+	assetPath := filepath.Join(utils.RepositoryDataPath(repo.Owner.Username, repo.Name), "releases", asset.ReleaseID, asset.ID)
+	if err := os.Remove(assetPath); err != nil {
+		log.Printf("Error deleting asset file %s: %v", assetPath, err)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// canPushToRepository reports whether a possibly anonymous user can push to a repository
+func canPushToRepository(repo *models.Repository, userID string) bool {
+	return userID != "" && repoAccess.CanPushToRepository(repo.ID, repo.OwnerID, userID)
+}
+
+// loadRelease looks up the release named in the URL. Drafts are only found by users who can push.
+func loadRelease(w http.ResponseWriter, r *http.Request, repo *models.Repository, userID string) (*models.Release, bool) {
+	release, err := models.GetReleaseByID(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Error retrieving release", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	if release == nil || release.RepositoryID != repo.ID || (release.Draft && !canPushToRepository(repo, userID)) {
+		http.Error(w, "Release not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	return release, true
+}
+
+// loadReleaseAsset looks up the release asset named in the URL. Assets of drafts are only
+// found by users who can push.
+func loadReleaseAsset(w http.ResponseWriter, r *http.Request, repo *models.Repository, userID string) (*models.ReleaseAsset, bool) {
+	asset, err := models.GetReleaseAssetByID(mux.Vars(r)["asset_id"])
+	if err != nil {
+		http.Error(w, "Error retrieving asset", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	var release *models.Release
+	if asset != nil {
+		release, err = models.GetReleaseByID(asset.ReleaseID)
+		if err != nil {
+			http.Error(w, "Error retrieving release", http.StatusInternalServerError)
+			return nil, false
+		}
+	}
+
+	if release == nil || release.RepositoryID != repo.ID || (release.Draft && !canPushToRepository(repo, userID)) {
+		http.Error(w, "Asset not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	return asset, true
+}
+
+// applyReleaseInput copies the fields set in the input onto a release, writing a 400 if the
+// tag name is invalid
+func applyReleaseInput(w http.ResponseWriter, release *models.Release, input models.ReleaseInput) bool {
+	if input.TagName != nil {
+		tagName := strings.TrimPrefix(strings.TrimSpace(*input.TagName), "refs/tags/")
+		if !utils.IsValidRefName(tagName) {
+			http.Error(w, "Invalid tag name", http.StatusBadRequest)
+			return false
+		}
+		release.TagName = tagName
+	}
+
+	if input.TargetCommitish != nil && *input.TargetCommitish != "" {
+		release.TargetCommitish = *input.TargetCommitish
+	}
+	if input.Name != nil {
+		release.Name = *input.Name
+	}
+	if input.Body != nil {
+		release.Body = *input.Body
+	}
+	if input.Draft != nil {
+		release.Draft = *input.Draft
+	}
+	if input.Prerelease != nil {
+		release.Prerelease = *input.Prerelease
+	}
+
+	return true
+}
+
+// releaseTagAvailable writes a 409 if another release of the repository uses the same tag
+func releaseTagAvailable(w http.ResponseWriter, repositoryID string, release *models.Release) bool {
+	existing, err := models.GetReleaseByTag(repositoryID, release.TagName)
+	if err != nil {
+		http.Error(w, "Error retrieving releases", http.StatusInternalServerError)
+		return false
+	}
+
+	if existing != nil && existing.ID != release.ID {
+		http.Error(w, "A release for this tag already exists", http.StatusConflict)
+		return false
+	}
+	return true
+}
+
+// ensureReleaseTag creates the tag of a release being published, unless it already exists.
+// The tag is annotated with the release name and tagged by the publishing user.
+func ensureReleaseTag(w http.ResponseWriter, r *http.Request, repo *models.Repository, release *models.Release, userID string) bool {
+	repoPath := utils.RepositoryDiskPath(repo.Owner.Username, repo.Name)
+
+	existing, err := utils.GetTag(r.Context(), repoPath, release.TagName)
+	if err != nil {
+		http.Error(w, "Error retrieving tag", http.StatusInternalServerError)
+		return false
+	}
+	if existing != nil {
+		return true
+	}
+
+	commitSHA, ok := resolveStartPoint(w, r, repoPath, release.TargetCommitish)
+	if !ok {
+		return false
+	}
+
+	tagger, err := models.GetUserByID(userID)
+	if err != nil || tagger == nil {
+		http.Error(w, "Error retrieving user", http.StatusInternalServerError)
+		return false
+	}
+
+	message := release.Name
+	if message == "" {
+		message = release.TagName
+	}
+
+	refsBefore, _ := utils.ListRefs(r.Context(), repoPath)
+	err = utils.CreateTag(r.Context(), repoPath, release.TagName, commitSHA, message, utils.GitSignature{Name: tagger.Username, Email: tagger.Email})
+	if err != nil {
+		log.Printf("Error creating tag %s in %s: %v", release.TagName, repoPath, err)
+		http.Error(w, "Failed to create tag", http.StatusInternalServerError)
+		return false
+	}
+	notifyRefChange(r, repo, repoPath, userID, refsBefore)
+
+	return true
+}
@@ -6,6 +6,8 @@ import (
 
 	"github-clone/auth"
 	"github-clone/models"
+	"github-clone/utils"
+	"github-clone/webhook"
 
 	"github.com/gorilla/mux"
 )
@@ -104,7 +106,7 @@ func GetRepository(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check if user has access to this repository
-	if repo.OwnerID != userID && !repo.IsPublic {
+	if !repoAccess.CanViewRepository(repo.ID, repo.OwnerID, repo.IsPublic, userID) {
 		http.Error(w, "You don't have access to this repository", http.StatusForbidden)
 		return
 	}
@@ -139,8 +141,8 @@ func UpdateRepository(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check if user is the owner
-	if repo.OwnerID != userID {
+	// Check if user is allowed to change repository settings
+	if !repoAccess.CanAdminRepository(repo.ID, repo.OwnerID, userID) {
 		http.Error(w, "You don't have permission to update this repository", http.StatusForbidden)
 		return
 	}
@@ -166,6 +168,10 @@ func UpdateRepository(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if changes := repositoryChanges(repo, updatedRepo); len(changes) > 0 {
+		webhook.RepositoryEvent(updatedRepo, webhookSender(r, userID), "updated", changes)
+	}
+
 	// Return success response
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(updatedRepo)
@@ -202,6 +208,13 @@ func DeleteRepository(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Webhooks are deleted together with the repository, so look them up first
+	hooks, err := models.GetRepositoryWebhooks(repo.ID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve webhooks", http.StatusInternalServerError)
+		return
+	}
+
 	// Delete the repository
 	err = models.DeleteRepository(repoID)
 	if err != nil {
@@ -209,51 +222,29 @@ func DeleteRepository(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	webhook.RepositoryDeleted(hooks, repo, webhookSender(r, userID))
+
 	// Return success response
 	w.WriteHeader(http.StatusNoContent)
 }
 
-// Helper function to extract user ID from the request token
-func getUserIDFromRequest(r *http.Request) (string, error) {
-	// Get the token from the Authorization header
-	tokenString := r.Header.Get("Authorization")
-	if tokenString == "" {
-		return "", auth.ErrInvalidToken
-	}
+// repoAccess is the access checker shared by all repository handlers
+var repoAccess utils.RepoAccessChecker = utils.NewRepoAccess()
 
-	// Remove "Bearer " prefix if present
-	if len(tokenString) > 7 && tokenString[:7] == "Bearer " {
-		tokenString = tokenString[7:]
-	}
-
-	// Validate the token and extract the claims
-	claims, err := auth.ValidateToken(tokenString)
-	if err != nil {
-		return "", err
+// Helper function to extract user ID from the request token.
+// Only the user authenticated by AuthMiddleware is trusted: the middleware also checks the
+// scopes of personal access tokens, and leaves the user out when a token lacks the scope.
+func getUserIDFromRequest(r *http.Request) (string, error) {
+	if userID, ok := r.Context().Value(auth.UserIDKey).(string); ok && userID != "" {
+		return userID, nil
 	}
-
-	return claims.UserID, nil
+	return "", auth.ErrInvalidToken
 }
 
 // getUserIDOptional extracts the user ID from the request token if available
-// Returns empty string instead of error if no token is provided
+// Returns empty string instead of error if no token is provided, or if AuthMiddleware did
+// not accept it
 func getUserIDOptional(r *http.Request) string {
-	// Get the token from the Authorization header
-	tokenString := r.Header.Get("Authorization")
-	if tokenString == "" {
-		return "" // No error, just no user ID
-	}
-
-	// Remove "Bearer " prefix if present
-	if len(tokenString) > 7 && tokenString[:7] == "Bearer " {
-		tokenString = tokenString[7:]
-	}
-
-	// Validate the token and extract the claims
-	claims, err := auth.ValidateToken(tokenString)
-	if err != nil {
-		return "" // Invalid token, but we don't return an error
-	}
-
-	return claims.UserID
+	userID, _ := getUserIDFromRequest(r)
+	return userID
 }
@@ -35,7 +35,7 @@ func GetRepositoryContents(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check if the user has access to this repository
-	if repo.OwnerID != userID && !repo.IsPublic {
+	if !repoAccess.CanViewRepository(repo.ID, repo.OwnerID, repo.IsPublic, userID) {
 		// Only allow access if the user is the owner or the repository is public
 		http.Error(w, "Access denied", http.StatusForbidden)
 		return
@@ -78,7 +78,7 @@ func GetRepositoryContents(w http.ResponseWriter, r *http.Request) {
 	repoPath := filepath.Join(baseRepoPath, repo.Owner.Username, gitRepoName)
 
 	// Get the contents
-	contents, err := utils.GetRepositoryContents(repoPath, path, ref)
+	contents, err := utils.GetRepositoryContents(r.Context(), repoPath, path, ref)
 	if err != nil {
 		http.Error(w, "Error retrieving repository contents: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -111,7 +111,7 @@ func GetFileContent(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check if the user has access to this repository
-	if repo.OwnerID != userID && !repo.IsPublic {
+	if !repoAccess.CanViewRepository(repo.ID, repo.OwnerID, repo.IsPublic, userID) {
 		// Only allow access if the user is the owner or the repository is public
 		http.Error(w, "Access denied", http.StatusForbidden)
 		return
@@ -155,7 +155,7 @@ func GetFileContent(w http.ResponseWriter, r *http.Request) {
 	repoPath := filepath.Join(baseRepoPath, repo.Owner.Username, gitRepoName)
 
 	// Get the file content
-	fileEntry, err := utils.GetFileContent(repoPath, filePath, ref)
+	fileEntry, err := utils.GetFileContent(r.Context(), repoPath, filePath, ref)
 	if err != nil {
 		http.Error(w, "Error retrieving file content: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -188,7 +188,7 @@ func GetCommitHistory(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check if the user has access to this repository
-	if repo.OwnerID != userID && !repo.IsPublic {
+	if !repoAccess.CanViewRepository(repo.ID, repo.OwnerID, repo.IsPublic, userID) {
 		// Only allow access if the user is the owner or the repository is public
 		http.Error(w, "Access denied", http.StatusForbidden)
 		return
@@ -226,7 +226,7 @@ func GetCommitHistory(w http.ResponseWriter, r *http.Request) {
 	repoPath := filepath.Join(baseRepoPath, repo.Owner.Username, gitRepoName)
 
 	// Get the commit history
-	commits, err := utils.GetCommitHistory(repoPath, ref, limit)
+	commits, err := utils.GetCommitHistory(r.Context(), repoPath, ref, limit)
 	if err != nil {
 		http.Error(w, "Error retrieving commit history: "+err.Error(), http.StatusInternalServerError)
 		return
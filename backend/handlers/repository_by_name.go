@@ -10,6 +10,7 @@ import (
 
 	"github-clone/models"
 	"github-clone/utils"
+	"github-clone/webhook"
 
 	"github.com/gorilla/mux"
 )
@@ -36,7 +37,7 @@ func GetRepositoryByUsername(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check if user has access to this repository
-	if repo.OwnerID != userID && !repo.IsPublic {
+	if !repoAccess.CanViewRepository(repo.ID, repo.OwnerID, repo.IsPublic, userID) {
 		http.Error(w, "You don't have access to this repository", http.StatusForbidden)
 		return
 	}
@@ -71,7 +72,7 @@ func GetRepositoryContentsByUsername(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check if user has access to this repository
-	if repo.OwnerID != userID && !repo.IsPublic {
+	if !repoAccess.CanViewRepository(repo.ID, repo.OwnerID, repo.IsPublic, userID) {
 		http.Error(w, "You don't have access to this repository", http.StatusForbidden)
 		return
 	}
@@ -110,7 +111,7 @@ func GetRepositoryContentsByUsername(w http.ResponseWriter, r *http.Request) {
 	repoPath := filepath.Join(baseRepoPath, username, gitRepoName)
 
 	// Get the contents
-	contents, err := utils.GetRepositoryContents(repoPath, path, ref)
+	contents, err := utils.GetRepositoryContents(r.Context(), repoPath, path, ref)
 	if err != nil {
 		http.Error(w, "Error retrieving repository contents: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -143,7 +144,7 @@ func GetFileContentByUsername(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check if user has access to this repository
-	if repo.OwnerID != userID && !repo.IsPublic {
+	if !repoAccess.CanViewRepository(repo.ID, repo.OwnerID, repo.IsPublic, userID) {
 		http.Error(w, "You don't have access to this repository", http.StatusForbidden)
 		return
 	}
@@ -183,7 +184,7 @@ func GetFileContentByUsername(w http.ResponseWriter, r *http.Request) {
 	repoPath := filepath.Join(baseRepoPath, username, gitRepoName)
 
 	// Get the file content
-	fileEntry, err := utils.GetFileContent(repoPath, filePath, ref)
+	fileEntry, err := utils.GetFileContent(r.Context(), repoPath, filePath, ref)
 	if err != nil {
 		http.Error(w, "Error retrieving file content: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -216,23 +217,15 @@ func GetCommitHistoryByUsername(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check if user has access to this repository
-	if repo.OwnerID != userID && !repo.IsPublic {
+	if !repoAccess.CanViewRepository(repo.ID, repo.OwnerID, repo.IsPublic, userID) {
 		http.Error(w, "You don't have access to this repository", http.StatusForbidden)
 		return
 	}
 
-	// Get the ref (branch, tag, commit) from query parameters
-	ref := r.URL.Query().Get("ref")
-	if ref == "" {
-		ref = "HEAD" // Default to HEAD
-	}
-
-	// Get the limit parameter
-	limit := 10 // Default to 10 commits
-	if limitParam := r.URL.Query().Get("limit"); limitParam != "" {
-		if _, err := json.Number(limitParam).Int64(); err == nil {
-			json.Unmarshal([]byte(limitParam), &limit)
-		}
+	// Get the ref, the filters and the page from query parameters
+	query, ok := commitQueryFromRequest(w, r)
+	if !ok {
+		return
 	}
 	
 	// Get the repository path on the filesystem using username-based path
@@ -253,12 +246,25 @@ func GetCommitHistoryByUsername(w http.ResponseWriter, r *http.Request) {
 	repoPath := filepath.Join(baseRepoPath, username, gitRepoName)
 
 	// Get the commit history
-	commits, err := utils.GetCommitHistory(repoPath, ref, limit)
+	commits, nextCursor, err := utils.ListCommits(r.Context(), repoPath, query)
+	if err == utils.ErrRefNotFound {
+		http.Error(w, "Ref not found", http.StatusNotFound)
+		return
+	}
+	if err == utils.ErrInvalidCursor {
+		http.Error(w, "Invalid cursor", http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		http.Error(w, "Error retrieving commit history: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	// The body stays a plain list of commits, so the next page is announced in a header
+	if nextCursor != "" {
+		w.Header().Set("X-Next-Cursor", nextCursor)
+	}
+
 	// Return the commit history as JSON
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(commits)
@@ -289,8 +295,8 @@ func UpdateRepositoryByUsername(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check if user is the owner
-	if repo.OwnerID != userID {
+	// Check if user is allowed to change repository settings
+	if !repoAccess.CanAdminRepository(repo.ID, repo.OwnerID, userID) {
 		http.Error(w, "You don't have permission to update this repository", http.StatusForbidden)
 		return
 	}
@@ -316,6 +322,10 @@ func UpdateRepositoryByUsername(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if changes := repositoryChanges(repo, updatedRepo); len(changes) > 0 {
+		webhook.RepositoryEvent(updatedRepo, webhookSender(r, userID), "updated", changes)
+	}
+
 	// Return success response
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(updatedRepo)
@@ -352,6 +362,13 @@ func DeleteRepositoryByUsername(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Webhooks are deleted together with the repository, so look them up first
+	hooks, err := models.GetRepositoryWebhooks(repo.ID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve webhooks", http.StatusInternalServerError)
+		return
+	}
+
 	// Delete the repository
 	err = models.DeleteRepository(repo.ID)
 	if err != nil {
@@ -359,6 +376,8 @@ func DeleteRepositoryByUsername(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	webhook.RepositoryDeleted(hooks, repo, webhookSender(r, userID))
+
 	// Return success response
 	w.WriteHeader(http.StatusNoContent)
 }
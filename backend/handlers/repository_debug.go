@@ -1,15 +1,16 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 
 	"github-clone/models"
+	"github-clone/utils"
 
 	"github.com/gorilla/mux"
 )
@@ -36,7 +37,7 @@ func DebugRepositoryPath(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	// Check if user has access to this repository
-	if repo.OwnerID != userID && !repo.IsPublic {
+	if !repoAccess.CanViewRepository(repo.ID, repo.OwnerID, repo.IsPublic, userID) {
 		http.Error(w, "You don't have access to this repository", http.StatusForbidden)
 		return
 	}
@@ -79,10 +80,10 @@ func DebugRepositoryPath(w http.ResponseWriter, r *http.Request) {
 
 	// Check git repository details if a path exists
 	if pathInfo["paths"].(map[string]interface{})["username_path"].(map[string]interface{})["exists"].(bool) {
-		pathInfo["git_info"] = getGitInfo(usernamePath)
+		pathInfo["git_info"] = getGitInfo(r.Context(), usernamePath)
 		pathInfo["contents"] = listDirectory(usernamePath)
 	} else if pathInfo["paths"].(map[string]interface{})["userid_path"].(map[string]interface{})["exists"].(bool) {
-		pathInfo["git_info"] = getGitInfo(useridPath)
+		pathInfo["git_info"] = getGitInfo(r.Context(), useridPath)
 		pathInfo["contents"] = listDirectory(useridPath)
 	}
 
@@ -97,9 +98,12 @@ func fileExists(path string) bool {
 }
 
 // Get git repository information
-func getGitInfo(repoPath string) map[string]interface{} {
+func getGitInfo(ctx context.Context, repoPath string) map[string]interface{} {
+	ctx, cancel := utils.WithGitTimeout(ctx, utils.GitCommandTimeout())
+	defer cancel()
+
 	// Check if there are any branches
-	cmd := exec.Command("git", "-C", repoPath, "branch")
+	cmd := utils.GitCommand(ctx, "-C", repoPath, "branch")
 	output, err := cmd.CombinedOutput()
 	
 	branches := []string{}
@@ -116,7 +120,7 @@ func getGitInfo(repoPath string) map[string]interface{} {
 	}
 
 	// Check commit count
-	cmd = exec.Command("git", "-C", repoPath, "rev-list", "--count", "--all")
+	cmd = utils.GitCommand(ctx, "-C", repoPath, "rev-list", "--count", "--all")
 	output, err = cmd.CombinedOutput()
 	
 	commitCount := 0
@@ -41,6 +41,11 @@ func AddSSHKey(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The key must not already be registered to a user or a repository
+	if !sshKeyFingerprintAvailable(w, fingerprint) {
+		return
+	}
+
 	// Create the SSH key
 	sshKey, err := models.CreateSSHKey(userID, input, fingerprint)
 	if err != nil {
@@ -0,0 +1,424 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github-clone/models"
+
+	"github.com/gorilla/mux"
+)
+
+// GetOrganizationTeams handles GET /api/orgs/{org}/teams
+func GetOrganizationTeams(w http.ResponseWriter, r *http.Request) {
+	// Get the authenticated user ID from the token
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	org, ok := loadOrganization(w, mux.Vars(r)["org"])
+	if !ok {
+		return
+	}
+
+	if !requireOrganizationMember(w, org, userID) {
+		return
+	}
+
+	teams, err := models.GetOrganizationTeams(org.ID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve teams", http.StatusInternalServerError)
+		return
+	}
+
+	// Return success response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(teams)
+}
+
+// CreateTeam handles POST /api/orgs/{org}/teams
+func CreateTeam(w http.ResponseWriter, r *http.Request) {
+	// Get the authenticated user ID from the token
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	org, ok := loadOrganization(w, mux.Vars(r)["org"])
+	if !ok {
+		return
+	}
+
+	if !requireOrganizationOwner(w, org, userID) {
+		return
+	}
+
+	// Parse the request body
+	var input models.TeamInput
+	err = json.NewDecoder(r.Body).Decode(&input)
+	if err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if !validAccountName.MatchString(input.Name) {
+		http.Error(w, "Invalid team name", http.StatusBadRequest)
+		return
+	}
+
+	existing, err := models.GetTeamByName(org.ID, input.Name)
+	if err != nil {
+		http.Error(w, "Server error checking team existence", http.StatusInternalServerError)
+		return
+	}
+	if existing != nil {
+		http.Error(w, "The organization already has a team with this name", http.StatusConflict)
+		return
+	}
+
+	team, err := models.CreateTeam(org.ID, input)
+	if err != nil {
+		http.Error(w, "Failed to create team: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return success response
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(team)
+}
+
+// GetTeam handles GET /api/orgs/{org}/teams/{team}
+func GetTeam(w http.ResponseWriter, r *http.Request) {
+	// Get the authenticated user ID from the token
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	org, ok := loadOrganization(w, vars["org"])
+	if !ok {
+		return
+	}
+
+	if !requireOrganizationMember(w, org, userID) {
+		return
+	}
+
+	team, ok := loadTeam(w, org, vars["team"])
+	if !ok {
+		return
+	}
+
+	// Return success response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(team)
+}
+
+// DeleteTeam handles DELETE /api/orgs/{org}/teams/{team}
+func DeleteTeam(w http.ResponseWriter, r *http.Request) {
+	// Get the authenticated user ID from the token
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	org, ok := loadOrganization(w, vars["org"])
+	if !ok {
+		return
+	}
+
+	if !requireOrganizationOwner(w, org, userID) {
+		return
+	}
+
+	team, ok := loadTeam(w, org, vars["team"])
+	if !ok {
+		return
+	}
+
+	if err := models.DeleteTeam(team.ID); err != nil {
+		http.Error(w, "Failed to delete team: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return success response
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetTeamMembers handles GET /api/orgs/{org}/teams/{team}/members
+func GetTeamMembers(w http.ResponseWriter, r *http.Request) {
+	// Get the authenticated user ID from the token
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	org, ok := loadOrganization(w, vars["org"])
+	if !ok {
+		return
+	}
+
+	if !requireOrganizationMember(w, org, userID) {
+		return
+	}
+
+	team, ok := loadTeam(w, org, vars["team"])
+	if !ok {
+		return
+	}
+
+	members, err := models.GetTeamMembers(team.ID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve team members", http.StatusInternalServerError)
+		return
+	}
+
+	// Return success response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(members)
+}
+
+// AddTeamMember handles PUT /api/orgs/{org}/teams/{team}/members/{username}
+func AddTeamMember(w http.ResponseWriter, r *http.Request) {
+	// Get the authenticated user ID from the token
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	org, ok := loadOrganization(w, vars["org"])
+	if !ok {
+		return
+	}
+
+	if !requireOrganizationOwner(w, org, userID) {
+		return
+	}
+
+	team, ok := loadTeam(w, org, vars["team"])
+	if !ok {
+		return
+	}
+
+	member, ok := loadPersonalAccount(w, vars["username"])
+	if !ok {
+		return
+	}
+
+	// Teams can only contain members of their organization
+	role, err := models.GetOrganizationMemberRole(org.ID, member.ID)
+	if err != nil {
+		http.Error(w, "Error checking organization membership", http.StatusInternalServerError)
+		return
+	}
+	if role == "" {
+		http.Error(w, "User must be a member of the organization before joining a team", http.StatusBadRequest)
+		return
+	}
+
+	if err := models.AddTeamMember(team.ID, member.ID); err != nil {
+		http.Error(w, "Failed to add team member: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return success response
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RemoveTeamMember handles DELETE /api/orgs/{org}/teams/{team}/members/{username}
+func RemoveTeamMember(w http.ResponseWriter, r *http.Request) {
+	// Get the authenticated user ID from the token
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	org, ok := loadOrganization(w, vars["org"])
+	if !ok {
+		return
+	}
+
+	member, ok := loadPersonalAccount(w, vars["username"])
+	if !ok {
+		return
+	}
+
+	// Members may leave a team on their own
+	if member.ID != userID && !requireOrganizationOwner(w, org, userID) {
+		return
+	}
+
+	team, ok := loadTeam(w, org, vars["team"])
+	if !ok {
+		return
+	}
+
+	if err := models.RemoveTeamMember(team.ID, member.ID); err != nil {
+		http.Error(w, "Failed to remove team member: "+err.Error(), http.StatusNotFound)
+		return
+	}
+
+	// Return success response
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetTeamRepositories handles GET /api/orgs/{org}/teams/{team}/repos
+func GetTeamRepositories(w http.ResponseWriter, r *http.Request) {
+	// Get the authenticated user ID from the token
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	org, ok := loadOrganization(w, vars["org"])
+	if !ok {
+		return
+	}
+
+	if !requireOrganizationMember(w, org, userID) {
+		return
+	}
+
+	team, ok := loadTeam(w, org, vars["team"])
+	if !ok {
+		return
+	}
+
+	grants, err := models.GetTeamRepositories(team.ID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve team repositories", http.StatusInternalServerError)
+		return
+	}
+
+	// Return success response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(grants)
+}
+
+// SetTeamRepository handles PUT /api/orgs/{org}/teams/{team}/repos/{reponame}
+// It grants the team read, write or admin access to one of the organization's repositories
+func SetTeamRepository(w http.ResponseWriter, r *http.Request) {
+	// Get the authenticated user ID from the token
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	org, ok := loadOrganization(w, vars["org"])
+	if !ok {
+		return
+	}
+
+	if !requireOrganizationOwner(w, org, userID) {
+		return
+	}
+
+	team, ok := loadTeam(w, org, vars["team"])
+	if !ok {
+		return
+	}
+
+	// Teams can only be granted access to repositories owned by their organization
+	repo, err := models.GetRepositoryByOwnerAndName(org.ID, vars["reponame"])
+	if err != nil {
+		http.Error(w, "Error retrieving repository", http.StatusInternalServerError)
+		return
+	}
+	if repo == nil {
+		http.Error(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	// Parse the request body
+	var input models.TeamRepositoryInput
+	err = json.NewDecoder(r.Body).Decode(&input)
+	if err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if err := models.SetTeamRepository(team.ID, repo.ID, input); err != nil {
+		http.Error(w, "Failed to grant repository access: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Return success response
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RemoveTeamRepository handles DELETE /api/orgs/{org}/teams/{team}/repos/{reponame}
+func RemoveTeamRepository(w http.ResponseWriter, r *http.Request) {
+	// Get the authenticated user ID from the token
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	org, ok := loadOrganization(w, vars["org"])
+	if !ok {
+		return
+	}
+
+	if !requireOrganizationOwner(w, org, userID) {
+		return
+	}
+
+	team, ok := loadTeam(w, org, vars["team"])
+	if !ok {
+		return
+	}
+
+	repo, err := models.GetRepositoryByOwnerAndName(org.ID, vars["reponame"])
+	if err != nil {
+		http.Error(w, "Error retrieving repository", http.StatusInternalServerError)
+		return
+	}
+	if repo == nil {
+		http.Error(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	if err := models.RemoveTeamRepository(team.ID, repo.ID); err != nil {
+		http.Error(w, "Failed to revoke repository access: "+err.Error(), http.StatusNotFound)
+		return
+	}
+
+	// Return success response
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// loadTeam looks up a team of an organization by name and writes a 404 if it does not exist
+func loadTeam(w http.ResponseWriter, org *models.Organization, name string) (*models.Team, bool) {
+	team, err := models.GetTeamByName(org.ID, name)
+	if err != nil {
+		http.Error(w, "Error retrieving team", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	if team == nil {
+		http.Error(w, "Team not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	return team, true
+}
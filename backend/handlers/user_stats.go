@@ -1,12 +1,12 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"github-clone/utils"
 	"net/http"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 	"time"
@@ -32,7 +32,12 @@ func GetUserStats(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	stats, err := getUserStats(username)
+	// The statistics run git against every repository of the user, so they are stopped
+	// together when the client goes away or when they take longer than a git command may
+	ctx, cancel := utils.WithGitTimeout(r.Context(), utils.GitCommandTimeout())
+	defer cancel()
+
+	stats, err := getUserStats(ctx, username)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Error getting user stats: %v", err), http.StatusInternalServerError)
 		return
@@ -44,7 +49,7 @@ func GetUserStats(w http.ResponseWriter, r *http.Request) {
 }
 
 // getUserStats calculates statistics for a user
-func getUserStats(username string) (UserStats, error) {
+func getUserStats(ctx context.Context, username string) (UserStats, error) {
 	stats := UserStats{}
 
 	// Get user's repositories
@@ -75,7 +80,7 @@ func getUserStats(username string) (UserStats, error) {
 
 	for _, repo := range repos {
 		// Count commits - safely handle errors
-		commits, err := utils.GetRepositoryCommitCount(username, repo.Name)
+		commits, err := utils.GetRepositoryCommitCount(ctx, username, repo.Name)
 		if err != nil {
 			fmt.Printf("Error counting commits for %s/%s: %v\n", username, repo.Name, err)
 			// Continue with next repo, don't add any commits for this one
@@ -86,7 +91,7 @@ func getUserStats(username string) (UserStats, error) {
 		// Count lines of code - safely handle errors
 		// Append .git to the repository name as seen in the file structure
 		repoPath := filepath.Join(repoBasePath, username, repo.Name+".git")
-		lines, err := countLinesOfCode(repoPath)
+		lines, err := countLinesOfCode(ctx, repoPath)
 		if err != nil {
 			fmt.Printf("Error counting lines for %s/%s: %v\n", username, repo.Name, err)
 			// Continue with next repo, don't add any lines for this one
@@ -110,10 +115,10 @@ func getUserStats(username string) (UserStats, error) {
 }
 
 // countLinesOfCode counts the lines of code in a repository using git commands
-func countLinesOfCode(repoPath string) (int, error) {
+func countLinesOfCode(ctx context.Context, repoPath string) (int, error) {
 	// For bare repositories, we to use git commands to get the stats
 	// This command gets the latest commit and counts total lines in all files
-	cmd := exec.Command("git", "-C", repoPath, "ls-tree", "-r", "HEAD", "--name-only")
+	cmd := utils.GitCommand(ctx, "-C", repoPath, "ls-tree", "-r", "HEAD", "--name-only")
 	files, err := cmd.Output()
 	if err != nil {
 		return 0, fmt.Errorf("error listing files: %v", err)
@@ -135,7 +140,7 @@ func countLinesOfCode(repoPath string) (int, error) {
 		}
 
 		// Use git show to get the file content and count lines
-		showCmd := exec.Command("git", "-C", repoPath, "show", fmt.Sprintf("HEAD:%s", filename))
+		showCmd := utils.GitCommand(ctx, "-C", repoPath, "show", fmt.Sprintf("HEAD:%s", filename))
 		content, err := showCmd.Output()
 		if err != nil {
 			continue
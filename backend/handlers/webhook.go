@@ -0,0 +1,380 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github-clone/models"
+	"github-clone/utils"
+	"github-clone/webhook"
+
+	"github.com/gorilla/mux"
+)
+
+// GetWebhooks handles GET /api/{username}/{reponame}/hooks
+func GetWebhooks(w http.ResponseWriter, r *http.Request) {
+	// Get the authenticated user ID from the token
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Only repository admins can manage webhooks
+	repo, ok := loadRepositoryForAdmin(w, r, userID)
+	if !ok {
+		return
+	}
+
+	hooks, err := models.GetRepositoryWebhooks(repo.ID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve webhooks", http.StatusInternalServerError)
+		return
+	}
+
+	// Return success response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hooks)
+}
+
+// CreateWebhook handles POST /api/{username}/{reponame}/hooks
+func CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	// Get the authenticated user ID from the token
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Only repository admins can manage webhooks
+	repo, ok := loadRepositoryForAdmin(w, r, userID)
+	if !ok {
+		return
+	}
+
+	// Parse the request body
+	var input models.WebhookInput
+	err = json.NewDecoder(r.Body).Decode(&input)
+	if err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if input.URL == nil || !isValidWebhookURL(*input.URL) {
+		http.Error(w, "A valid http or https URL to an external host is required", http.StatusBadRequest)
+		return
+	}
+
+	// Webhooks are notified about pushes unless told otherwise
+	events := input.Events
+	if len(events) == 0 {
+		events = []string{models.WebhookEventPush}
+	}
+	if !validWebhookEvents(w, events) {
+		return
+	}
+
+	secret := ""
+	if input.Secret != nil {
+		secret = *input.Secret
+	}
+
+	active := true
+	if input.Active != nil {
+		active = *input.Active
+	}
+
+	hook, err := models.CreateWebhook(repo.ID, userID, *input.URL, secret, events, active)
+	if err != nil {
+		http.Error(w, "Failed to create webhook: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Let the receiver know the webhook is set up
+	if hook.Active {
+		webhook.Ping(repo, hook, webhookSender(r, userID))
+	}
+
+	// Return success response
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(hook)
+}
+
+// GetWebhook handles GET /api/{username}/{reponame}/hooks/{id}
+func GetWebhook(w http.ResponseWriter, r *http.Request) {
+	// Get the authenticated user ID from the token
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	hook, ok := loadWebhook(w, r, userID)
+	if !ok {
+		return
+	}
+
+	// Return success response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hook)
+}
+
+// UpdateWebhook handles PATCH /api/{username}/{reponame}/hooks/{id}
+func UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	// Get the authenticated user ID from the token
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	hook, ok := loadWebhook(w, r, userID)
+	if !ok {
+		return
+	}
+
+	// Parse the request body
+	var input models.WebhookInput
+	err = json.NewDecoder(r.Body).Decode(&input)
+	if err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if input.URL != nil {
+		if !isValidWebhookURL(*input.URL) {
+			http.Error(w, "A valid http or https URL to an external host is required", http.StatusBadRequest)
+			return
+		}
+		hook.URL = *input.URL
+	}
+
+	if input.Events != nil {
+		if len(input.Events) == 0 {
+			http.Error(w, "At least one event is required", http.StatusBadRequest)
+			return
+		}
+		if !validWebhookEvents(w, input.Events) {
+			return
+		}
+		hook.Events = input.Events
+	}
+
+	if input.Secret != nil {
+		hook.Secret = *input.Secret
+	}
+
+	if input.Active != nil {
+		hook.Active = *input.Active
+	}
+
+	if err := models.UpdateWebhook(hook); err != nil {
+		http.Error(w, "Failed to update webhook: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return success response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hook)
+}
+
+// DeleteWebhook handles DELETE /api/{username}/{reponame}/hooks/{id}
+func DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	// Get the authenticated user ID from the token
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	hook, ok := loadWebhook(w, r, userID)
+	if !ok {
+		return
+	}
+
+	if err := models.DeleteWebhook(hook.ID); err != nil {
+		http.Error(w, "Failed to delete webhook", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetWebhookDeliveries handles GET /api/{username}/{reponame}/hooks/{id}/deliveries
+func GetWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	// Get the authenticated user ID from the token
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	hook, ok := loadWebhook(w, r, userID)
+	if !ok {
+		return
+	}
+
+	// Get pagination parameters
+	limit := 30 // Default limit
+	offset := 0 // Default offset
+
+	if parsedLimit, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && parsedLimit > 0 {
+		limit = parsedLimit
+	}
+	if parsedOffset, err := strconv.Atoi(r.URL.Query().Get("offset")); err == nil && parsedOffset >= 0 {
+		offset = parsedOffset
+	}
+
+	deliveries, err := models.GetWebhookDeliveries(hook.ID, limit, offset)
+	if err != nil {
+		http.Error(w, "Failed to retrieve deliveries", http.StatusInternalServerError)
+		return
+	}
+
+	// Return success response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deliveries)
+}
+
+// GetWebhookDelivery handles GET /api/{username}/{reponame}/hooks/{id}/deliveries/{delivery_id}
+// Unlike the list, a single delivery includes its payload and the response that was received
+func GetWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	// Get the authenticated user ID from the token
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	hook, ok := loadWebhook(w, r, userID)
+	if !ok {
+		return
+	}
+
+	delivery, ok := loadWebhookDelivery(w, r, hook)
+	if !ok {
+		return
+	}
+
+	// Return success response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(delivery)
+}
+
+// RedeliverWebhookDelivery handles POST /api/{username}/{reponame}/hooks/{id}/deliveries/{delivery_id}/redeliver
+// It queues a new delivery with the same payload
+func RedeliverWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	// Get the authenticated user ID from the token
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	hook, ok := loadWebhook(w, r, userID)
+	if !ok {
+		return
+	}
+
+	delivery, ok := loadWebhookDelivery(w, r, hook)
+	if !ok {
+		return
+	}
+
+	redelivery, err := webhook.Redeliver(hook, delivery)
+	if err != nil {
+		http.Error(w, "Failed to queue redelivery", http.StatusInternalServerError)
+		return
+	}
+
+	// Return success response
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(redelivery)
+}
+
+// loadWebhook looks up the webhook named in the URL for a repository admin
+func loadWebhook(w http.ResponseWriter, r *http.Request, userID string) (*models.Webhook, bool) {
+	// Only repository admins can manage webhooks
+	repo, ok := loadRepositoryForAdmin(w, r, userID)
+	if !ok {
+		return nil, false
+	}
+
+	hook, err := models.GetWebhookByID(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Error retrieving webhook", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	if hook == nil || hook.RepositoryID != repo.ID {
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	return hook, true
+}
+
+// loadWebhookDelivery looks up the delivery named in the URL, which must belong to the webhook
+func loadWebhookDelivery(w http.ResponseWriter, r *http.Request, hook *models.Webhook) (*models.WebhookDelivery, bool) {
+	delivery, err := models.GetWebhookDelivery(mux.Vars(r)["delivery_id"])
+	if err != nil {
+		http.Error(w, "Error retrieving delivery", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	if delivery == nil || delivery.WebhookID != hook.ID {
+		http.Error(w, "Delivery not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	return delivery, true
+}
+
+// isValidWebhookURL reports whether a webhook URL is an absolute http or https URL whose host
+// is not the server itself or an address of its private network
+func isValidWebhookURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Hostname() != "" && webhook.IsAllowedHost(u.Hostname())
+}
+
+// validWebhookEvents writes a 400 if any of the events cannot be subscribed to
+func validWebhookEvents(w http.ResponseWriter, events []string) bool {
+	for _, event := range events {
+		if !models.IsValidWebhookEvent(event) {
+			http.Error(w, "Unknown webhook event: "+event, http.StatusBadRequest)
+			return false
+		}
+	}
+	return true
+}
+
+// repositoryChanges lists the settings that differ between two versions of a repository,
+// with their previous values
+func repositoryChanges(before, after *models.Repository) map[string]interface{} {
+	changes := map[string]interface{}{}
+	if before.Name != after.Name {
+		changes["name"] = map[string]interface{}{"from": before.Name}
+	}
+	if before.Description != after.Description {
+		changes["description"] = map[string]interface{}{"from": before.Description}
+	}
+	if before.IsPublic != after.IsPublic {
+		changes["is_public"] = map[string]interface{}{"from": before.IsPublic}
+	}
+	return changes
+}
+
+// webhookSender identifies the user making a request in webhook payloads
+func webhookSender(r *http.Request, userID string) webhook.User {
+	if currentUser, err := utils.GetUserFromContext(r); err == nil {
+		return webhook.User{ID: currentUser.ID, Username: currentUser.Username}
+	}
+	return webhook.User{ID: userID}
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"context" // Added for AuthMiddleware
 	"fmt"
 	"log"
 	"net/http"
@@ -11,13 +10,21 @@ import (
 
 	"github-clone/auth"   // Added for AuthMiddleware
 	"github-clone/config"
+	"github-clone/githook"
 	"github-clone/handlers"
+	"github-clone/models"
 	"github-clone/ssh"
+	"github-clone/webhook"
 
 	"github.com/gorilla/mux"
 )
 
 func main() {
+	// Git hooks run the server binary as "hook <name>" to hand pushes back to the server
+	if len(os.Args) > 1 && os.Args[1] == "hook" {
+		os.Exit(githook.Run(os.Args[2:]))
+	}
+
 	config.LoadEnv()
 
 	if err := config.ConnectDB(); err != nil {
@@ -44,8 +51,28 @@ func main() {
 		hostKeyPath = filepath.Join(dir, "ssh_host_key")
 	}
 
+	// Repository hooks call back into this server through the internal hook endpoint
+	githook.Configure("http://127.0.0.1:" + httpPort + "/internal/hooks")
+	if err := models.InstallRepositoryHooks(); err != nil {
+		log.Printf("Failed to install repository Git hooks: %v", err)
+	}
+
 	go startSSHServer(sshPort, hostKeyPath)
 
+	// Deliver queued webhook requests in the background
+	webhook.Start()
+
+	router := newRouter()
+
+	log.Printf("HTTP server starting on port %s", httpPort)
+	if err := http.ListenAndServe(":"+httpPort, router); err != nil {
+		log.Fatalf("Failed to start HTTP server: %v", err)
+	}
+}
+
+// newRouter registers the routes of the API, the Git HTTP protocol and the internal hook
+// endpoint behind the CORS and authentication middleware
+func newRouter() *mux.Router {
 	router := mux.NewRouter()
 
 	// Apply CORS for all routes
@@ -71,19 +98,114 @@ func main() {
 	router.HandleFunc("/api/auth/login", handlers.Login).Methods("POST", "OPTIONS")
 	router.HandleFunc("/api/user/git-access-token", handlers.GenerateGitAccessTokenHandler).Methods("POST", "OPTIONS") // New route for Git access token generation
 
+	// Personal access token routes
+	router.HandleFunc("/api/user/tokens", handlers.CreateAccessToken).Methods("POST", "OPTIONS")
+	router.HandleFunc("/api/user/tokens", handlers.GetAccessTokens).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/user/tokens/{id}", handlers.DeleteAccessToken).Methods("DELETE", "OPTIONS")
+
+	// Organization and team routes (registered before the /api/{username}/{reponame} routes they would otherwise match)
+	router.HandleFunc("/api/orgs", handlers.CreateOrganization).Methods("POST", "OPTIONS")
+	router.HandleFunc("/api/user/orgs", handlers.GetUserOrganizations).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/orgs/{org}", handlers.GetOrganization).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/orgs/{org}/repos", handlers.GetOrganizationRepositories).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/orgs/{org}/repos", handlers.CreateOrganizationRepository).Methods("POST", "OPTIONS")
+	router.HandleFunc("/api/orgs/{org}/members", handlers.GetOrganizationMembers).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/orgs/{org}/members/{username}", handlers.SetOrganizationMember).Methods("PUT", "OPTIONS")
+	router.HandleFunc("/api/orgs/{org}/members/{username}", handlers.RemoveOrganizationMember).Methods("DELETE", "OPTIONS")
+	router.HandleFunc("/api/orgs/{org}/teams", handlers.GetOrganizationTeams).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/orgs/{org}/teams", handlers.CreateTeam).Methods("POST", "OPTIONS")
+	router.HandleFunc("/api/orgs/{org}/teams/{team}", handlers.GetTeam).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/orgs/{org}/teams/{team}", handlers.DeleteTeam).Methods("DELETE", "OPTIONS")
+	router.HandleFunc("/api/orgs/{org}/teams/{team}/members", handlers.GetTeamMembers).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/orgs/{org}/teams/{team}/members/{username}", handlers.AddTeamMember).Methods("PUT", "OPTIONS")
+	router.HandleFunc("/api/orgs/{org}/teams/{team}/members/{username}", handlers.RemoveTeamMember).Methods("DELETE", "OPTIONS")
+	router.HandleFunc("/api/orgs/{org}/teams/{team}/repos", handlers.GetTeamRepositories).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/orgs/{org}/teams/{team}/repos/{reponame}", handlers.SetTeamRepository).Methods("PUT", "OPTIONS")
+	router.HandleFunc("/api/orgs/{org}/teams/{team}/repos/{reponame}", handlers.RemoveTeamRepository).Methods("DELETE", "OPTIONS")
+
+	// SSH Key routes (registered before /api/{username}/{reponame}, which would otherwise match /api/ssh-keys/{id})
+	router.HandleFunc("/api/ssh-keys", handlers.AddSSHKey).Methods("POST", "OPTIONS")
+	router.HandleFunc("/api/ssh-keys", handlers.GetSSHKeys).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/ssh-keys/{id}", handlers.DeleteSSHKey).Methods("DELETE", "OPTIONS")
+
 	// GitHub-like Repository routes
 	router.HandleFunc("/api/{username}/{reponame}", handlers.GetRepositoryByUsername).Methods("GET", "OPTIONS")
 	router.HandleFunc("/api/{username}/{reponame}", handlers.UpdateRepositoryByUsername).Methods("PUT", "OPTIONS")
 	router.HandleFunc("/api/{username}/{reponame}", handlers.DeleteRepositoryByUsername).Methods("DELETE", "OPTIONS")
 	router.HandleFunc("/api/{username}/{reponame}/contents", handlers.GetRepositoryContentsByUsername).Methods("GET", "OPTIONS")
 	router.HandleFunc("/api/{username}/{reponame}/file", handlers.GetFileContentByUsername).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/{username}/{reponame}/blame", handlers.GetBlame).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/{username}/{reponame}/raw", handlers.GetRawFile).Methods("GET", "HEAD", "OPTIONS")
+	router.HandleFunc("/api/{username}/{reponame}/archive/{archive:.+}", handlers.GetArchive).Methods("GET", "HEAD", "OPTIONS")
+	// Release routes. Fixed paths come before /releases/{id} so they are not taken for an ID.
+	router.HandleFunc("/api/{username}/{reponame}/releases", handlers.GetReleases).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/{username}/{reponame}/releases", handlers.CreateRelease).Methods("POST", "OPTIONS")
+	router.HandleFunc("/api/{username}/{reponame}/releases/latest", handlers.GetLatestRelease).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/{username}/{reponame}/releases/tags/{tag:.+}", handlers.GetReleaseByTag).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/{username}/{reponame}/releases/assets/{asset_id}", handlers.GetReleaseAsset).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/{username}/{reponame}/releases/assets/{asset_id}", handlers.DeleteReleaseAsset).Methods("DELETE", "OPTIONS")
+	router.HandleFunc("/api/{username}/{reponame}/releases/assets/{asset_id}/download", handlers.DownloadReleaseAsset).Methods("GET", "HEAD", "OPTIONS")
+	router.HandleFunc("/api/{username}/{reponame}/releases/{id}", handlers.GetRelease).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/{username}/{reponame}/releases/{id}", handlers.UpdateRelease).Methods("PATCH", "OPTIONS")
+	router.HandleFunc("/api/{username}/{reponame}/releases/{id}", handlers.DeleteRelease).Methods("DELETE", "OPTIONS")
+	router.HandleFunc("/api/{username}/{reponame}/releases/{id}/assets", handlers.UploadReleaseAsset).Methods("POST", "OPTIONS")
 	router.HandleFunc("/api/{username}/{reponame}/commits", handlers.GetCommitHistoryByUsername).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/{username}/{reponame}/commits/{sha:.+}", handlers.GetCommit).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/{username}/{reponame}/compare/{basehead:.+}", handlers.CompareRefs).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/{username}/{reponame}/lfs", handlers.GetLFSUsage).Methods("GET", "OPTIONS")
+
+	// Repository collaborator routes
+	router.HandleFunc("/api/{username}/{reponame}/collaborators", handlers.GetRepositoryCollaborators).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/{username}/{reponame}/collaborators/{collaborator}", handlers.AddRepositoryCollaborator).Methods("PUT", "OPTIONS")
+	router.HandleFunc("/api/{username}/{reponame}/collaborators/{collaborator}", handlers.RemoveRepositoryCollaborator).Methods("DELETE", "OPTIONS")
+
+	// Deploy key routes
+	router.HandleFunc("/api/{username}/{reponame}/keys", handlers.GetDeployKeys).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/{username}/{reponame}/keys", handlers.AddDeployKey).Methods("POST", "OPTIONS")
+	router.HandleFunc("/api/{username}/{reponame}/keys/{id}", handlers.DeleteDeployKey).Methods("DELETE", "OPTIONS")
+	
+	// Fork routes
+	router.HandleFunc("/api/{username}/{reponame}/forks", handlers.CreateFork).Methods("POST", "OPTIONS")
+	router.HandleFunc("/api/{username}/{reponame}/forks", handlers.GetRepositoryForks).Methods("GET", "OPTIONS")
+	
+	// Branch and tag routes (names may contain slashes)
+	router.HandleFunc("/api/{username}/{reponame}/branches", handlers.GetBranches).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/{username}/{reponame}/branches", handlers.CreateBranch).Methods("POST", "OPTIONS")
+	router.HandleFunc("/api/{username}/{reponame}/branches/{branch:.+}", handlers.GetBranch).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/{username}/{reponame}/branches/{branch:.+}", handlers.DeleteBranch).Methods("DELETE", "OPTIONS")
+	router.HandleFunc("/api/{username}/{reponame}/tags", handlers.GetTags).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/{username}/{reponame}/tags", handlers.CreateTag).Methods("POST", "OPTIONS")
+	router.HandleFunc("/api/{username}/{reponame}/tags/{tag:.+}", handlers.GetTag).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/{username}/{reponame}/tags/{tag:.+}", handlers.DeleteTag).Methods("DELETE", "OPTIONS")
+	router.HandleFunc("/api/{username}/{reponame}/default-branch", handlers.GetDefaultBranch).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/{username}/{reponame}/default-branch", handlers.SetDefaultBranch).Methods("PUT", "OPTIONS")
+	
+	// Branch protection routes
+	router.HandleFunc("/api/{username}/{reponame}/branch-protections", handlers.GetBranchProtections).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/{username}/{reponame}/branch-protections", handlers.CreateBranchProtection).Methods("POST", "OPTIONS")
+	router.HandleFunc("/api/{username}/{reponame}/branch-protections/{id}", handlers.GetBranchProtection).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/{username}/{reponame}/branch-protections/{id}", handlers.UpdateBranchProtection).Methods("PATCH", "OPTIONS")
+	router.HandleFunc("/api/{username}/{reponame}/branch-protections/{id}", handlers.DeleteBranchProtection).Methods("DELETE", "OPTIONS")
+	
+	// Webhook routes
+	router.HandleFunc("/api/{username}/{reponame}/hooks", handlers.GetWebhooks).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/{username}/{reponame}/hooks", handlers.CreateWebhook).Methods("POST", "OPTIONS")
+	router.HandleFunc("/api/{username}/{reponame}/hooks/{id}", handlers.GetWebhook).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/{username}/{reponame}/hooks/{id}", handlers.UpdateWebhook).Methods("PATCH", "OPTIONS")
+	router.HandleFunc("/api/{username}/{reponame}/hooks/{id}", handlers.DeleteWebhook).Methods("DELETE", "OPTIONS")
+	router.HandleFunc("/api/{username}/{reponame}/hooks/{id}/deliveries", handlers.GetWebhookDeliveries).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/{username}/{reponame}/hooks/{id}/deliveries/{delivery_id}", handlers.GetWebhookDelivery).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/{username}/{reponame}/hooks/{id}/deliveries/{delivery_id}/redeliver", handlers.RedeliverWebhookDelivery).Methods("POST", "OPTIONS")
 	// Debug endpoint
 	router.HandleFunc("/api/{username}/{reponame}/debug", handlers.DebugRepositoryPath).Methods("GET", "OPTIONS")
 	
 	// Public repository 
 	router.HandleFunc("/api/public/{username}/{reponame}/contents", handlers.GetPublicRepositoryContents).Methods("GET", "OPTIONS")
 	router.HandleFunc("/api/public/{username}/{reponame}/file", handlers.GetPublicFileContent).Methods("GET", "OPTIONS")
+	// Raw files, archives and release assets can be linked from <img> and <a> tags, which cannot send a token
+	router.HandleFunc("/api/public/{username}/{reponame}/raw", handlers.GetRawFile).Methods("GET", "HEAD", "OPTIONS")
+	router.HandleFunc("/api/public/{username}/{reponame}/archive/{archive:.+}", handlers.GetArchive).Methods("GET", "HEAD", "OPTIONS")
+	router.HandleFunc("/api/public/{username}/{reponame}/releases/assets/{asset_id}/download", handlers.DownloadReleaseAsset).Methods("GET", "HEAD", "OPTIONS")
 	
 	// Issue routes
 	router.HandleFunc("/api/repos/{owner}/{repo}/issues", handlers.CreateIssue).Methods("POST", "OPTIONS")
@@ -95,25 +217,47 @@ func main() {
 	router.HandleFunc("/api/repos/{owner}/{repo}/issues/{id}/vote", handlers.VoteOnIssue).Methods("POST", "OPTIONS")
 	router.HandleFunc("/api/repos/{owner}/{repo}/issues/{id}/vote", handlers.RemoveVoteFromIssue).Methods("DELETE", "OPTIONS")
 	
+	// Pull request routes
+	router.HandleFunc("/api/repos/{owner}/{repo}/pulls", handlers.CreatePullRequest).Methods("POST", "OPTIONS")
+	router.HandleFunc("/api/repos/{owner}/{repo}/pulls", handlers.GetRepositoryPullRequests).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/repos/{owner}/{repo}/pulls/{id}", handlers.GetPullRequest).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/repos/{owner}/{repo}/pulls/{id}", handlers.UpdatePullRequest).Methods("PATCH", "OPTIONS")
+	router.HandleFunc("/api/repos/{owner}/{repo}/pulls/{id}/commits", handlers.GetPullRequestCommits).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/repos/{owner}/{repo}/pulls/{id}/files", handlers.GetPullRequestFiles).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/repos/{owner}/{repo}/pulls/{id}/merge", handlers.MergePullRequest).Methods("PUT", "OPTIONS")
+	
+	// Pull request review routes
+	router.HandleFunc("/api/repos/{owner}/{repo}/pulls/{id}/reviews", handlers.SubmitReview).Methods("POST", "OPTIONS")
+	router.HandleFunc("/api/repos/{owner}/{repo}/pulls/{id}/reviews", handlers.GetPullRequestReviews).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/repos/{owner}/{repo}/pulls/{id}/comments", handlers.CreateReviewComment).Methods("POST", "OPTIONS")
+	router.HandleFunc("/api/repos/{owner}/{repo}/pulls/{id}/comments", handlers.GetReviewComments).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/repos/{owner}/{repo}/pulls/{id}/comments/{comment_id}", handlers.UpdateReviewComment).Methods("PATCH", "OPTIONS")
+	router.HandleFunc("/api/repos/{owner}/{repo}/pulls/{id}/comments/{comment_id}", handlers.DeleteReviewComment).Methods("DELETE", "OPTIONS")
+	
 	// Git HTTP protocol routes
 	router.HandleFunc("/git/{username}/{reponame}", handlers.HandleGitHTTP).Methods("GET", "POST", "OPTIONS")
 	router.HandleFunc("/git/{username}/{reponame}/info/refs", handlers.HandleGitHTTP).Methods("GET", "OPTIONS")
 	router.HandleFunc("/git/{username}/{reponame}/git-upload-pack", handlers.HandleGitHTTP).Methods("POST", "OPTIONS")
 	router.HandleFunc("/git/{username}/{reponame}/git-receive-pack", handlers.HandleGitHTTP).Methods("POST", "OPTIONS")
 
+	// Git LFS API, authorized like the Git routes above. LFS clients append .git to remote URLs.
+	router.HandleFunc("/git/{username}/{reponame}/info/lfs/objects/batch", handlers.LFSBatch).Methods("POST", "OPTIONS")
+	router.HandleFunc("/git/{username}/{reponame}/info/lfs/objects/verify", handlers.LFSVerifyObject).Methods("POST", "OPTIONS")
+	router.HandleFunc("/git/{username}/{reponame}/info/lfs/objects/{oid}", handlers.LFSDownloadObject).Methods("GET", "HEAD", "OPTIONS")
+	router.HandleFunc("/git/{username}/{reponame}/info/lfs/objects/{oid}", handlers.LFSUploadObject).Methods("PUT", "OPTIONS")
+	router.HandleFunc("/git/{username}/{reponame}/info/lfs/locks", handlers.LFSListLocks).Methods("GET", "OPTIONS")
+	router.HandleFunc("/git/{username}/{reponame}/info/lfs/locks", handlers.LFSCreateLock).Methods("POST", "OPTIONS")
+	router.HandleFunc("/git/{username}/{reponame}/info/lfs/locks/verify", handlers.LFSVerifyLocks).Methods("POST", "OPTIONS")
+	router.HandleFunc("/git/{username}/{reponame}/info/lfs/locks/{id}/unlock", handlers.LFSUnlock).Methods("POST", "OPTIONS")
+
 	// Repository listing 
 	router.HandleFunc("/api/repositories", handlers.GetUserRepositories).Methods("GET", "OPTIONS")
 	router.HandleFunc("/api/repositories", handlers.CreateRepository).Methods("POST", "OPTIONS")
 
-	// SSH Key routes
-	router.HandleFunc("/api/ssh-keys", handlers.AddSSHKey).Methods("POST", "OPTIONS")
-	router.HandleFunc("/api/ssh-keys", handlers.GetSSHKeys).Methods("GET", "OPTIONS")
-	router.HandleFunc("/api/ssh-keys/{id}", handlers.DeleteSSHKey).Methods("DELETE", "OPTIONS")
+	// Internal endpoint for the Git hooks of repositories, authenticated by the hook secret
+	router.HandleFunc("/internal/hooks/{hook}", handlers.HandleInternalHook).Methods("POST")
 
-	log.Printf("HTTP server starting on port %s", httpPort)
-	if err := http.ListenAndServe(":"+httpPort, router); err != nil {
-		log.Fatalf("Failed to start HTTP server: %v", err)
-	}
+	return router
 }
 
 // startSSHServer initializes and starts the SSH server
@@ -166,35 +310,32 @@ func AuthMiddleware(next http.Handler) http.Handler {
 			}
 		}
 
-		// Handle Git routes: some can be public (for clone/fetch of public repos),
-		// but we still want to pass userID if a token is provided for potential private access checks later.
+		// Hook requests authenticate with the hook secret instead of a user token
+		if strings.HasPrefix(requestPath, "/internal/hooks/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Handle Git routes: clones of public repositories need no credentials, so authentication
+		// is optional here. Git clients send HTTP Basic credentials (password or token), and
+		// HandleGitHTTP answers with a Basic challenge when the repository or a push requires them.
 		if strings.HasPrefix(requestPath, "/git/") {
-			tokenString := extractToken(r)
-			if tokenString != "" {
-				claims, _ := auth.ValidateToken(tokenString) // Ignore error for optional auth
-				if claims != nil {
-					ctx := context.WithValue(r.Context(), auth.UserIDKey, claims.UserID)
-					r = r.WithContext(ctx)
-				}
-			}
-			// For specific git paths like info/refs or GET on the base git path, allow if repo is public (checked in HandleGitHTTP)
-			// For git-upload-pack (fetch/clone data), also allow if repo is public (checked in HandleGitHTTP)
-			// git-receive-pack (push) is always authenticated within HandleGitHTTP.
-			if r.Method == "GET" && (strings.HasSuffix(requestPath, "/info/refs") || len(strings.Split(strings.TrimPrefix(requestPath, "/git/"), "/")) == 2) {
-				// This covers GET /git/{user}/{repo} and GET /git/{user}/{repo}/info/refs
-				// Actual public/private check happens in HandleGitHTTP
-				next.ServeHTTP(w, r)
-				return
-			}
-			if r.Method == "POST" && strings.HasSuffix(requestPath, "/git-upload-pack") {
-				// Actual public/private check happens in HandleGitHTTP
-				next.ServeHTTP(w, r)
+			r, ok := handlers.AuthenticateGitRequest(w, r)
+			if !ok {
 				return
 			}
-			// All other Git paths (like git-receive-pack) or if not explicitly public, fall through to require token
+			next.ServeHTTP(w, r)
+			return
 		}
 
 		if isPublic && !strings.HasPrefix(requestPath, "/git/") {
+			// Pass the user along if a valid token was sent, so private content they can see is included
+			if tokenString := extractToken(r); tokenString != "" {
+				userID, scopes, err := handlers.AuthenticateToken(tokenString)
+				if err == nil && (scopes == nil || auth.HasScope(scopes, requiredScope(r))) {
+					r = r.WithContext(auth.WithAuthentication(r.Context(), userID, scopes))
+				}
+			}
 			next.ServeHTTP(w, r)
 			return
 		}
@@ -209,19 +350,45 @@ func AuthMiddleware(next http.Handler) http.Handler {
 		}
 		log.Printf("AuthMiddleware: Extracted token for %s. Token prefix: %s... Attempting validation.", r.URL.Path, tokenString[:min(len(tokenString),10)])
 
-		claims, err := auth.ValidateToken(tokenString)
+		userID, scopes, err := handlers.AuthenticateToken(tokenString)
 		if err != nil {
 			log.Printf("AuthMiddleware: Token validation FAILED for path %s. Token prefix: %s... Error: %v", r.URL.Path, tokenString[:min(len(tokenString),10)], err)
 			http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
 			return
 		}
-		log.Printf("AuthMiddleware: Token validation SUCCESS for UserID: %s, Path: %s", claims.UserID, r.URL.Path)
+		log.Printf("AuthMiddleware: Token validation SUCCESS for UserID: %s, Path: %s", userID, r.URL.Path)
+
+		// Personal access tokens are limited to the scopes they were granted
+		if scopes != nil {
+			if required := requiredScope(r); required != "" && !auth.HasScope(scopes, required) {
+				log.Printf("AuthMiddleware: Token for UserID %s lacks scope %s for %s %s", userID, required, r.Method, r.URL.Path)
+				http.Error(w, "Token does not have the required scope: "+required, http.StatusForbidden)
+				return
+			}
+		}
 
-		ctx := context.WithValue(r.Context(), auth.UserIDKey, claims.UserID)
-		next.ServeHTTP(w, r.WithContext(ctx))
+		next.ServeHTTP(w, r.WithContext(auth.WithAuthentication(r.Context(), userID, scopes)))
 	})
 }
 
+// requiredScope returns the personal access token scope needed for an API request.
+// Git requests are checked in HandleGitHTTP and token management is refused for tokens altogether.
+func requiredScope(r *http.Request) string {
+	path := r.URL.Path
+	switch {
+	case strings.HasPrefix(path, "/git/"), strings.HasPrefix(path, "/api/user/tokens"), path == "/api/user/git-access-token":
+		return ""
+	case strings.HasPrefix(path, "/api/ssh-keys"):
+		return auth.ScopeAdminKeys
+	case strings.HasPrefix(path, "/api/repos/") && strings.Contains(path, "/issues") && r.Method != "GET":
+		return auth.ScopeIssues
+	case r.Method == "GET":
+		return auth.ScopeRepoRead
+	default:
+		return auth.ScopeRepoWrite
+	}
+}
+
 // min is a helper function to avoid panics if string is too short
 func min(a, b int) int {
 	if a < b {
@@ -246,6 +413,7 @@ func corsMiddleware(next http.Handler) http.Handler {
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, PATCH, OPTIONS")
 		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Requested-With")
 		w.Header().Set("Access-Control-Allow-Credentials", "true")
+		w.Header().Set("Access-Control-Expose-Headers", "X-Next-Cursor")
 		w.Header().Set("Access-Control-Max-Age", "3600")
 
 		if r.Method == "OPTIONS" {
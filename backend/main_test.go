@@ -0,0 +1,166 @@
+package main
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github-clone/auth"
+	"github-clone/config"
+	"github-clone/models"
+	"github-clone/utils"
+)
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "ngh-main-test-*")
+	if err != nil {
+		log.Fatal(err)
+	}
+	os.Setenv("DB_PATH", filepath.Join(dir, "test.db"))
+	os.Setenv("REPOSITORIES_PATH", filepath.Join(dir, "repositories"))
+	os.Setenv("ARCHIVE_CACHE_PATH", filepath.Join(dir, "archive-cache"))
+	os.Setenv("JWT_SECRET", "test-secret")
+	log.SetOutput(io.Discard)
+
+	if err := config.ConnectDB(); err != nil {
+		log.Fatal(err)
+	}
+
+	code := m.Run()
+	config.DB.Close()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func TestRequiredScope(t *testing.T) {
+	tests := []struct {
+		method string
+		path   string
+		want   string
+	}{
+		{"GET", "/git/al/r/info/refs", ""},
+		{"POST", "/git/al/r/git-receive-pack", ""},
+		{"GET", "/api/user/tokens", ""},
+		{"POST", "/api/user/git-access-token", ""},
+		{"GET", "/api/ssh-keys", auth.ScopeAdminKeys},
+		{"DELETE", "/api/ssh-keys/1", auth.ScopeAdminKeys},
+		{"POST", "/api/repos/al/r/issues", auth.ScopeIssues},
+		{"GET", "/api/repos/al/r/issues", auth.ScopeRepoRead},
+		{"GET", "/api/al/r/raw", auth.ScopeRepoRead},
+		{"POST", "/api/al/r/branches", auth.ScopeRepoWrite},
+		{"DELETE", "/api/al/r/releases/1", auth.ScopeRepoWrite},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, tt.path, nil)
+		if got := requiredScope(r); got != tt.want {
+			t.Errorf("requiredScope(%s %s) = %q, want %q", tt.method, tt.path, got, tt.want)
+		}
+	}
+}
+
+// TestTokenScopesOnPublicRoutes checks that a token without repo:read is treated as anonymous
+// on the routes that do not require authentication, so it cannot reach private repositories
+func TestTokenScopesOnPublicRoutes(t *testing.T) {
+	user, err := models.CreateUser("scopeowner", "scopeowner@example.com", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err := models.CreateRepository(user.ID, models.RepositoryInput{Name: "secret", IsPublic: false})
+	if err != nil {
+		t.Fatal(err)
+	}
+	commitFile(t, utils.RepositoryDiskPath(user.Username, repo.Name), "README.md", "private\n")
+
+	release := &models.Release{RepositoryID: repo.ID, TagName: "v1", TargetCommitish: "main", AuthorID: user.ID}
+	if err := models.CreateRelease(release); err != nil {
+		t.Fatal(err)
+	}
+	asset := &models.ReleaseAsset{ReleaseID: release.ID, Name: "a.txt", ContentType: "text/plain", Size: 7, UploaderID: user.ID}
+	if err := models.CreateReleaseAsset(asset); err != nil {
+		t.Fatal(err)
+	}
+	assetDir := filepath.Join(utils.RepositoryDataPath(user.Username, repo.Name), "releases", release.ID)
+	if err := os.MkdirAll(assetDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(assetDir, asset.ID), []byte("private"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, issuesToken, err := models.CreateAccessToken(user.ID, models.AccessTokenInput{Name: "issues", Scopes: []string{auth.ScopeIssues}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, readToken, err := models.CreateAccessToken(user.ID, models.AccessTokenInput{Name: "read", Scopes: []string{auth.ScopeRepoRead}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router := newRouter()
+	get := func(path, token string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", path, nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	publicPaths := []string{
+		"/api/public/scopeowner/secret/raw?path=README.md",
+		"/api/public/scopeowner/secret/archive/main.zip",
+		"/api/public/scopeowner/secret/releases/assets/" + asset.ID + "/download",
+	}
+	for _, path := range publicPaths {
+		if w := get(path, issuesToken); w.Code != http.StatusNotFound {
+			t.Errorf("GET %s with an issues token: status %d, want 404", path, w.Code)
+		}
+		if w := get(path, readToken); w.Code != http.StatusOK {
+			t.Errorf("GET %s with a repo:read token: status %d, want 200", path, w.Code)
+		}
+	}
+
+	// The authenticated routes refuse the token outright
+	if w := get("/api/scopeowner/secret/raw?path=README.md", issuesToken); w.Code != http.StatusForbidden {
+		t.Errorf("GET raw with an issues token: status %d, want 403", w.Code)
+	}
+
+	// Private repositories are left out of the owner's list
+	w := get("/api/repositories/user?username=scopeowner", issuesToken)
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), `"secret"`) {
+		t.Errorf("listing with an issues token: status %d, body %s", w.Code, w.Body.String())
+	}
+	w = get("/api/repositories/user?username=scopeowner", readToken)
+	if !strings.Contains(w.Body.String(), `"secret"`) {
+		t.Errorf("listing with a repo:read token does not include the private repository: %s", w.Body.String())
+	}
+}
+
+// commitFile makes main of a bare repository point at a commit holding a single file. The
+// objects are written directly, so the repository's hooks do not run.
+func commitFile(t *testing.T, repoPath, name, content string) {
+	t.Helper()
+	git := func(stdin string, args ...string) string {
+		cmd := exec.Command("git", append([]string{"-C", repoPath}, args...)...)
+		cmd.Stdin = strings.NewReader(stdin)
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=Test", "GIT_AUTHOR_EMAIL=test@example.com",
+			"GIT_COMMITTER_NAME=Test", "GIT_COMMITTER_EMAIL=test@example.com")
+		out, err := cmd.Output()
+		if err != nil {
+			t.Fatalf("git %v: %v", args, err)
+		}
+		return strings.TrimSpace(string(out))
+	}
+
+	blob := git(content, "hash-object", "-w", "--stdin")
+	tree := git("100644 blob "+blob+"\t"+name+"\n", "mktree")
+	commit := git("", "commit-tree", tree, "-m", "Add "+name)
+	git("", "update-ref", "refs/heads/main", commit)
+}
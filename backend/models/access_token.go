@@ -0,0 +1,198 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github-clone/auth"
+	"github-clone/config"
+
+	"github.com/google/uuid"
+)
+
+// Access token errors
+var (
+	ErrAccessTokenExpired = errors.New("access token has expired")
+)
+
+// AccessToken represents a named personal access token. The token value itself is never stored.
+type AccessToken struct {
+	ID          string     `json:"id"`
+	UserID      string     `json:"user_id"`
+	Name        string     `json:"name"`
+	TokenPrefix string     `json:"token_prefix"` // First characters of the token to help users recognise it
+	Scopes      []string   `json:"scopes"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	LastUsedAt  *time.Time `json:"last_used_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// AccessTokenInput is used for creating personal access tokens
+type AccessTokenInput struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expires_in_days"` // 0 means the token never expires
+}
+
+// CreateAccessToken creates a new personal access token for a user.
+// It returns the stored token metadata together with the plain token, which is only available now.
+func CreateAccessToken(userID string, input AccessTokenInput) (*AccessToken, string, error) {
+	if len(input.Scopes) == 0 {
+		return nil, "", errors.New("at least one scope is required")
+	}
+	for _, scope := range input.Scopes {
+		if !auth.IsValidScope(scope) {
+			return nil, "", errors.New("unknown scope: " + scope)
+		}
+	}
+	if input.ExpiresInDays < 0 {
+		return nil, "", errors.New("expires_in_days cannot be negative")
+	}
+
+	plainToken, tokenHash, err := auth.GenerateAccessToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now()
+	token := &AccessToken{
+		ID:          uuid.New().String(),
+		UserID:      userID,
+		Name:        input.Name,
+		TokenPrefix: plainToken[:len(auth.AccessTokenPrefix)+6],
+		Scopes:      input.Scopes,
+		CreatedAt:   now,
+	}
+
+	if input.ExpiresInDays > 0 {
+		expiresAt := now.AddDate(0, 0, input.ExpiresInDays)
+		token.ExpiresAt = &expiresAt
+	}
+
+	_, err = config.DB.Exec(`
+		INSERT INTO personal_access_tokens (id, user_id, name, token_hash, token_prefix, scopes, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, token.ID, token.UserID, token.Name, tokenHash, token.TokenPrefix, strings.Join(token.Scopes, ","), token.ExpiresAt, token.CreatedAt)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	return token, plainToken, nil
+}
+
+// GetAccessTokensByUserID retrieves all personal access tokens of a user
+func GetAccessTokensByUserID(userID string) ([]*AccessToken, error) {
+	rows, err := config.DB.Query(`
+		SELECT id, user_id, name, token_prefix, scopes, expires_at, last_used_at, created_at
+		FROM personal_access_tokens
+		WHERE user_id = ?
+		ORDER BY created_at DESC
+	`, userID)
+
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []*AccessToken{}
+
+	for rows.Next() {
+		token, err := scanAccessToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// GetAccessTokenByID retrieves a personal access token by its ID
+func GetAccessTokenByID(id string) (*AccessToken, error) {
+	row := config.DB.QueryRow(`
+		SELECT id, user_id, name, token_prefix, scopes, expires_at, last_used_at, created_at
+		FROM personal_access_tokens
+		WHERE id = ?
+	`, id)
+
+	token, err := scanAccessToken(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// AuthenticateAccessToken looks up a personal access token by its value, rejects
+// expired tokens and records when the token was last used
+func AuthenticateAccessToken(plainToken string) (*AccessToken, error) {
+	row := config.DB.QueryRow(`
+		SELECT id, user_id, name, token_prefix, scopes, expires_at, last_used_at, created_at
+		FROM personal_access_tokens
+		WHERE token_hash = ?
+	`, auth.HashAccessToken(plainToken))
+
+	token, err := scanAccessToken(row)
+	if err == sql.ErrNoRows {
+		return nil, auth.ErrInvalidToken
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if token.ExpiresAt != nil && now.After(*token.ExpiresAt) {
+		return nil, ErrAccessTokenExpired
+	}
+
+	_, err = config.DB.Exec("UPDATE personal_access_tokens SET last_used_at = ? WHERE id = ?", now, token.ID)
+	if err != nil {
+		return nil, err
+	}
+	token.LastUsedAt = &now
+
+	return token, nil
+}
+
+// DeleteAccessToken revokes a personal access token
+func DeleteAccessToken(id string) error {
+	_, err := config.DB.Exec("DELETE FROM personal_access_tokens WHERE id = ?", id)
+	return err
+}
+
+// scanAccessToken reads a personal access token from a query result
+func scanAccessToken(scanner interface{ Scan(...interface{}) error }) (*AccessToken, error) {
+	var token AccessToken
+	var scopes string
+	var expiresAt, lastUsedAt sql.NullTime
+
+	err := scanner.Scan(
+		&token.ID, &token.UserID, &token.Name, &token.TokenPrefix, &scopes,
+		&expiresAt, &lastUsedAt, &token.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	token.Scopes = strings.Split(scopes, ",")
+	if expiresAt.Valid {
+		token.ExpiresAt = &expiresAt.Time
+	}
+	if lastUsedAt.Valid {
+		token.LastUsedAt = &lastUsedAt.Time
+	}
+
+	return &token, nil
+}
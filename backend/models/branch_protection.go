@@ -0,0 +1,271 @@
+package models
+
+import (
+	"database/sql"
+	"path"
+	"time"
+
+	"github-clone/config"
+
+	"github.com/google/uuid"
+)
+
+// BranchProtection is a rule that limits how the branches matching its pattern can change.
+// Patterns use path.Match syntax, e.g. "main" or "release/*".
+type BranchProtection struct {
+	ID                 string                    `json:"id"`
+	RepositoryID       string                    `json:"repository_id"`
+	Pattern            string                    `json:"pattern"`
+	AllowForcePushes   bool                      `json:"allow_force_pushes"`
+	AllowDeletions     bool                      `json:"allow_deletions"`
+	RestrictPushes     bool                      `json:"restrict_pushes"`
+	Pushers            []*BranchProtectionPusher `json:"pushers"` // Who may push when pushes are restricted; deploy keys never may
+	RequirePullRequest bool                      `json:"require_pull_request"`
+	CreatedBy          string                    `json:"created_by,omitempty"`
+	CreatedAt          time.Time                 `json:"created_at"`
+	UpdatedAt          time.Time                 `json:"updated_at"`
+}
+
+// BranchProtectionPusher is a user allowed to push to the branches of a rule
+type BranchProtectionPusher struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+}
+
+// BranchProtectionInput is used for creating and updating branch protection rules.
+// Fields left out keep their current value, or their default when creating a rule.
+type BranchProtectionInput struct {
+	Pattern            *string  `json:"pattern"`
+	AllowForcePushes   *bool    `json:"allow_force_pushes"`
+	AllowDeletions     *bool    `json:"allow_deletions"`
+	RestrictPushes     *bool    `json:"restrict_pushes"`
+	Pushers            []string `json:"pushers"` // Usernames
+	RequirePullRequest *bool    `json:"require_pull_request"`
+}
+
+const branchProtectionColumns = "id, repository_id, pattern, allow_force_pushes, allow_deletions, restrict_pushes, require_pull_request, created_by, created_at, updated_at"
+
+// IsValidBranchPattern reports whether a branch protection pattern can be matched
+func IsValidBranchPattern(pattern string) bool {
+	if pattern == "" {
+		return false
+	}
+	_, err := path.Match(pattern, "")
+	return err == nil
+}
+
+// Matches reports whether the rule applies to a branch, given without its refs/heads/ prefix
+func (p *BranchProtection) Matches(branch string) bool {
+	matched, err := path.Match(p.Pattern, branch)
+	return err == nil && matched
+}
+
+// CanPush reports whether a user may push to the branches of the rule. Deploy keys push
+// without a user, so they cannot push to branches whose pushes are restricted.
+func (p *BranchProtection) CanPush(userID string) bool {
+	if !p.RestrictPushes {
+		return true
+	}
+	for _, pusher := range p.Pushers {
+		if userID != "" && pusher.ID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateBranchProtection adds a branch protection rule to a repository
+func CreateBranchProtection(p *BranchProtection) error {
+	now := time.Now()
+	p.ID = uuid.New().String()
+	p.CreatedAt = now
+	p.UpdatedAt = now
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO branch_protections (id, repository_id, pattern, allow_force_pushes, allow_deletions, restrict_pushes, require_pull_request, created_by, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, p.ID, p.RepositoryID, p.Pattern, p.AllowForcePushes, p.AllowDeletions, p.RestrictPushes, p.RequirePullRequest, nullString(p.CreatedBy), p.CreatedAt, p.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	if err := insertBranchProtectionPushers(tx, p); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetBranchProtectionByID retrieves a branch protection rule by its ID
+func GetBranchProtectionByID(id string) (*BranchProtection, error) {
+	p, err := scanBranchProtection(config.DB.QueryRow(
+		"SELECT "+branchProtectionColumns+" FROM branch_protections WHERE id = ?",
+		id,
+	))
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := loadBranchProtectionPushers([]*BranchProtection{p}); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// GetRepositoryBranchProtections retrieves all branch protection rules of a repository
+func GetRepositoryBranchProtections(repositoryID string) ([]*BranchProtection, error) {
+	rows, err := config.DB.Query(
+		"SELECT "+branchProtectionColumns+" FROM branch_protections WHERE repository_id = ? ORDER BY pattern",
+		repositoryID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	protections := []*BranchProtection{}
+	for rows.Next() {
+		p, err := scanBranchProtection(rows)
+		if err != nil {
+			return nil, err
+		}
+		protections = append(protections, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := loadBranchProtectionPushers(protections); err != nil {
+		return nil, err
+	}
+
+	return protections, nil
+}
+
+// GetBranchProtectionsForBranch retrieves the rules of a repository that apply to a branch.
+// Every matching rule applies, so a change must satisfy all of them.
+func GetBranchProtectionsForBranch(repositoryID, branch string) ([]*BranchProtection, error) {
+	protections, err := GetRepositoryBranchProtections(repositoryID)
+	if err != nil {
+		return nil, err
+	}
+
+	matching := []*BranchProtection{}
+	for _, p := range protections {
+		if p.Matches(branch) {
+			matching = append(matching, p)
+		}
+	}
+	return matching, nil
+}
+
+// UpdateBranchProtection saves the settings and pushers of a branch protection rule
+func UpdateBranchProtection(p *BranchProtection) error {
+	p.UpdatedAt = time.Now()
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE branch_protections
+		SET pattern = ?, allow_force_pushes = ?, allow_deletions = ?, restrict_pushes = ?, require_pull_request = ?, updated_at = ?
+		WHERE id = ?
+	`, p.Pattern, p.AllowForcePushes, p.AllowDeletions, p.RestrictPushes, p.RequirePullRequest, p.UpdatedAt, p.ID)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM branch_protection_pushers WHERE protection_id = ?", p.ID); err != nil {
+		return err
+	}
+	if err := insertBranchProtectionPushers(tx, p); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteBranchProtection removes a branch protection rule
+func DeleteBranchProtection(id string) error {
+	_, err := config.DB.Exec("DELETE FROM branch_protections WHERE id = ?", id)
+	return err
+}
+
+// insertBranchProtectionPushers stores the pushers of a rule
+func insertBranchProtectionPushers(tx *sql.Tx, p *BranchProtection) error {
+	for _, pusher := range p.Pushers {
+		_, err := tx.Exec(
+			"INSERT OR IGNORE INTO branch_protection_pushers (protection_id, user_id) VALUES (?, ?)",
+			p.ID, pusher.ID,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadBranchProtectionPushers fills in the pushers of each rule
+func loadBranchProtectionPushers(protections []*BranchProtection) error {
+	for _, p := range protections {
+		rows, err := config.DB.Query(`
+			SELECT u.id, u.username
+			FROM branch_protection_pushers bp
+			JOIN users u ON bp.user_id = u.id
+			WHERE bp.protection_id = ?
+			ORDER BY u.username
+		`, p.ID)
+		if err != nil {
+			return err
+		}
+
+		p.Pushers = []*BranchProtectionPusher{}
+		for rows.Next() {
+			var pusher BranchProtectionPusher
+			if err := rows.Scan(&pusher.ID, &pusher.Username); err != nil {
+				rows.Close()
+				return err
+			}
+			p.Pushers = append(p.Pushers, &pusher)
+		}
+		rows.Close()
+
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scanBranchProtection reads a branch protection rule from a query result
+func scanBranchProtection(scanner interface{ Scan(...interface{}) error }) (*BranchProtection, error) {
+	var p BranchProtection
+	var createdBy sql.NullString
+
+	err := scanner.Scan(
+		&p.ID, &p.RepositoryID, &p.Pattern, &p.AllowForcePushes, &p.AllowDeletions, &p.RestrictPushes, &p.RequirePullRequest,
+		&createdBy, &p.CreatedAt, &p.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	p.CreatedBy = createdBy.String
+	p.Pushers = []*BranchProtectionPusher{}
+	return &p, nil
+}
@@ -0,0 +1,58 @@
+package models
+
+import "testing"
+
+func TestBranchProtectionMatches(t *testing.T) {
+	tests := []struct {
+		pattern string
+		branch  string
+		want    bool
+	}{
+		{"main", "main", true},
+		{"main", "main2", false},
+		{"release/*", "release/1.0", true},
+		{"release/*", "release/1.0/hotfix", false},
+		{"release/*", "release", false},
+		{"*", "feature", true},
+		{"*", "feature/x", false},
+		{"v[0-9]", "v1", true},
+		{"v[0-9]", "va", false},
+		{"[", "[", false}, // Invalid patterns match nothing
+	}
+
+	for _, tt := range tests {
+		p := &BranchProtection{Pattern: tt.pattern}
+		if got := p.Matches(tt.branch); got != tt.want {
+			t.Errorf("Matches(%q) with pattern %q = %v, want %v", tt.branch, tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestBranchProtectionCanPush(t *testing.T) {
+	restricted := &BranchProtection{
+		RestrictPushes: true,
+		Pushers:        []*BranchProtectionPusher{{ID: "alice"}},
+	}
+	open := &BranchProtection{}
+	nobody := &BranchProtection{RestrictPushes: true}
+
+	tests := []struct {
+		name   string
+		rule   *BranchProtection
+		userID string
+		want   bool
+	}{
+		{"unrestricted user", open, "bob", true},
+		{"unrestricted deploy key", open, "", true},
+		{"listed pusher", restricted, "alice", true},
+		{"unlisted user", restricted, "bob", false},
+		{"deploy key on restricted branch", restricted, "", false},
+		{"no pushers", nobody, "alice", false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.rule.CanPush(tt.userID); got != tt.want {
+			t.Errorf("%s: CanPush(%q) = %v, want %v", tt.name, tt.userID, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github-clone/config"
+	"github-clone/utils"
+)
+
+// Collaborator represents a user who has been granted access to a repository
+type Collaborator struct {
+	RepositoryID string        `json:"repository_id"`
+	UserID       string        `json:"user_id"`
+	Permission   string        `json:"permission"` // 'read', 'write' or 'admin'
+	CreatedAt    time.Time     `json:"created_at"`
+	User         *UserResponse `json:"user,omitempty"`
+}
+
+// CollaboratorInput is used for adding or updating a collaborator
+type CollaboratorInput struct {
+	Permission string `json:"permission"`
+}
+
+// AddCollaborator grants a user access to a repository, updating the permission if the user is already a collaborator
+func AddCollaborator(repoID, userID string, input CollaboratorInput) (*Collaborator, error) {
+	if !utils.IsValidPermission(input.Permission) {
+		return nil, errors.New("permission must be one of 'read', 'write' or 'admin'")
+	}
+
+	now := time.Now()
+
+	_, err := config.DB.Exec(`
+		INSERT INTO repository_collaborators (repository_id, user_id, permission, created_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(repository_id, user_id) DO UPDATE SET permission = excluded.permission
+	`, repoID, userID, input.Permission, now)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return GetCollaborator(repoID, userID)
+}
+
+// GetCollaborator retrieves a single collaborator of a repository
+func GetCollaborator(repoID, userID string) (*Collaborator, error) {
+	var collaborator Collaborator
+	var user UserResponse
+
+	err := config.DB.QueryRow(`
+		SELECT c.repository_id, c.user_id, c.permission, c.created_at,
+		       u.id, u.username, u.email, u.created_at
+		FROM repository_collaborators c
+		JOIN users u ON c.user_id = u.id
+		WHERE c.repository_id = ? AND c.user_id = ?
+	`, repoID, userID).Scan(
+		&collaborator.RepositoryID, &collaborator.UserID, &collaborator.Permission, &collaborator.CreatedAt,
+		&user.ID, &user.Username, &user.Email, &user.CreatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	collaborator.User = &user
+
+	return &collaborator, nil
+}
+
+// GetRepositoryCollaborators retrieves all collaborators of a repository
+func GetRepositoryCollaborators(repoID string) ([]*Collaborator, error) {
+	rows, err := config.DB.Query(`
+		SELECT c.repository_id, c.user_id, c.permission, c.created_at,
+		       u.id, u.username, u.email, u.created_at
+		FROM repository_collaborators c
+		JOIN users u ON c.user_id = u.id
+		WHERE c.repository_id = ?
+		ORDER BY u.username ASC
+	`, repoID)
+
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	collaborators := []*Collaborator{}
+
+	for rows.Next() {
+		var collaborator Collaborator
+		var user UserResponse
+
+		err := rows.Scan(
+			&collaborator.RepositoryID, &collaborator.UserID, &collaborator.Permission, &collaborator.CreatedAt,
+			&user.ID, &user.Username, &user.Email, &user.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		collaborator.User = &user
+		collaborators = append(collaborators, &collaborator)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return collaborators, nil
+}
+
+// RemoveCollaborator revokes a user's access to a repository
+func RemoveCollaborator(repoID, userID string) error {
+	result, err := config.DB.Exec(
+		"DELETE FROM repository_collaborators WHERE repository_id = ? AND user_id = ?",
+		repoID, userID,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return errors.New("collaborator not found")
+	}
+
+	return nil
+}
@@ -0,0 +1,162 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github-clone/config"
+
+	"github.com/google/uuid"
+)
+
+// DeployKey is an SSH key that grants access to a single repository rather than a user account
+type DeployKey struct {
+	ID           string     `json:"id"`
+	RepositoryID string     `json:"repository_id"`
+	Title        string     `json:"title"`
+	PublicKey    string     `json:"public_key"`
+	Fingerprint  string     `json:"fingerprint"`
+	ReadOnly     bool       `json:"read_only"`
+	CreatedBy    string     `json:"created_by,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	LastUsedAt   *time.Time `json:"last_used_at"`
+	LastUsedIP   string     `json:"last_used_ip,omitempty"`
+}
+
+// DeployKeyInput is used for adding deploy keys
+type DeployKeyInput struct {
+	Title     string `json:"title"`
+	PublicKey string `json:"public_key"`
+	ReadOnly  *bool  `json:"read_only"` // Defaults to true
+}
+
+const deployKeyColumns = "id, repository_id, title, public_key, fingerprint, read_only, created_by, created_at, last_used_at, last_used_ip"
+
+// CreateDeployKey adds a deploy key to a repository
+func CreateDeployKey(repositoryID, createdBy string, input DeployKeyInput, fingerprint string) (*DeployKey, error) {
+	readOnly := true
+	if input.ReadOnly != nil {
+		readOnly = *input.ReadOnly
+	}
+
+	key := &DeployKey{
+		ID:           uuid.New().String(),
+		RepositoryID: repositoryID,
+		Title:        input.Title,
+		PublicKey:    input.PublicKey,
+		Fingerprint:  fingerprint,
+		ReadOnly:     readOnly,
+		CreatedBy:    createdBy,
+		CreatedAt:    time.Now(),
+	}
+
+	_, err := config.DB.Exec(`
+		INSERT INTO deploy_keys (id, repository_id, title, public_key, fingerprint, read_only, created_by, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, key.ID, key.RepositoryID, key.Title, key.PublicKey, key.Fingerprint, key.ReadOnly, key.CreatedBy, key.CreatedAt)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// GetRepositoryDeployKeys retrieves all deploy keys of a repository
+func GetRepositoryDeployKeys(repositoryID string) ([]*DeployKey, error) {
+	rows, err := config.DB.Query(
+		"SELECT "+deployKeyColumns+" FROM deploy_keys WHERE repository_id = ? ORDER BY created_at",
+		repositoryID,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []*DeployKey{}
+
+	for rows.Next() {
+		key, err := scanDeployKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// GetDeployKeyByID retrieves a deploy key by its ID
+func GetDeployKeyByID(id string) (*DeployKey, error) {
+	key, err := scanDeployKey(config.DB.QueryRow(
+		"SELECT "+deployKeyColumns+" FROM deploy_keys WHERE id = ?",
+		id,
+	))
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// GetDeployKeyByFingerprint looks up a deploy key by its SHA256 fingerprint
+func GetDeployKeyByFingerprint(fingerprint string) (*DeployKey, error) {
+	key, err := scanDeployKey(config.DB.QueryRow(
+		"SELECT "+deployKeyColumns+" FROM deploy_keys WHERE fingerprint = ?",
+		fingerprint,
+	))
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// RecordDeployKeyUsage stores when and from which address a deploy key was last used
+func RecordDeployKeyUsage(id, remoteIP string) error {
+	_, err := config.DB.Exec(
+		"UPDATE deploy_keys SET last_used_at = ?, last_used_ip = ? WHERE id = ?",
+		time.Now(), remoteIP, id,
+	)
+	return err
+}
+
+// DeleteDeployKey removes a deploy key
+func DeleteDeployKey(id string) error {
+	_, err := config.DB.Exec("DELETE FROM deploy_keys WHERE id = ?", id)
+	return err
+}
+
+// scanDeployKey reads a deploy key from a query result
+func scanDeployKey(scanner interface{ Scan(...interface{}) error }) (*DeployKey, error) {
+	var key DeployKey
+	var createdBy, lastUsedIP sql.NullString
+	var lastUsedAt sql.NullTime
+
+	err := scanner.Scan(
+		&key.ID, &key.RepositoryID, &key.Title, &key.PublicKey, &key.Fingerprint, &key.ReadOnly,
+		&createdBy, &key.CreatedAt, &lastUsedAt, &lastUsedIP,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	key.CreatedBy = createdBy.String
+	key.LastUsedIP = lastUsedIP.String
+	if lastUsedAt.Valid {
+		key.LastUsedAt = &lastUsedAt.Time
+	}
+
+	return &key, nil
+}
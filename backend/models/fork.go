@@ -0,0 +1,104 @@
+package models
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github-clone/config"
+	"github-clone/utils"
+
+	"github.com/google/uuid"
+)
+
+// CreateFork copies a repository into the namespace of ownerID under the given name.
+// The fork keeps the visibility and description of its parent.
+func CreateFork(parent *Repository, ownerID, name string) (*Repository, error) {
+	owner, err := GetUserByID(ownerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get repository owner: %w", err)
+	}
+	if owner == nil {
+		return nil, fmt.Errorf("repository owner not found")
+	}
+
+	now := time.Now()
+	fork := &Repository{
+		ID:          uuid.New().String(),
+		Name:        name,
+		Description: parent.Description,
+		OwnerID:     ownerID,
+		IsPublic:    parent.IsPublic,
+		ParentID:    parent.ID,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		Owner:       owner,
+	}
+
+	parentPath := utils.RepositoryDiskPath(parent.Owner.Username, parent.Name)
+	forkPath := utils.RepositoryDiskPath(owner.Username, fork.Name)
+
+	if err := utils.ForkGitRepository(parentPath, forkPath); err != nil {
+		return nil, err
+	}
+
+	// Forks get the same hooks as new repositories
+	if err := utils.CreateRepositoryHooks(forkPath); err != nil {
+		utils.DeleteGitRepository(forkPath)
+		return nil, err
+	}
+
+	_, err = config.DB.Exec(
+		"INSERT INTO repositories (id, name, description, owner_id, is_public, parent_id, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		fork.ID, fork.Name, fork.Description, fork.OwnerID, fork.IsPublic, fork.ParentID, fork.CreatedAt, fork.UpdatedAt,
+	)
+	if err != nil {
+		// If database insertion fails, clean up the Git repository
+		utils.DeleteGitRepository(forkPath)
+		return nil, err
+	}
+
+	// The fork's history points at the parent's LFS files, so it needs access to them
+	if err := CopyLFSObjects(parent.ID, fork.ID); err != nil {
+		log.Printf("Failed to copy LFS objects of %s to fork %s: %v", parent.ID, fork.ID, err)
+	}
+
+	return fork, nil
+}
+
+// GetRepositoryForks fetches the direct forks of a repository, oldest first
+func GetRepositoryForks(parentID string) ([]*Repository, error) {
+	query := `
+		SELECT r.id, r.name, r.description, r.owner_id, r.is_public, COALESCE(r.parent_id, ''), r.created_at, r.updated_at,
+		       u.id, u.username, u.email, u.created_at
+		FROM repositories r
+		JOIN users u ON r.owner_id = u.id
+		WHERE r.parent_id = ?
+		ORDER BY r.created_at ASC
+	`
+
+	rows, err := config.DB.Query(query, parentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	forks := []*Repository{}
+	for rows.Next() {
+		var repo Repository
+		var owner User
+
+		err := rows.Scan(
+			&repo.ID, &repo.Name, &repo.Description, &repo.OwnerID, &repo.IsPublic, &repo.ParentID, &repo.CreatedAt, &repo.UpdatedAt,
+			&owner.ID, &owner.Username, &owner.Email, &owner.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		repo.Owner = &owner
+		forks = append(forks, &repo)
+	}
+
+	return forks, rows.Err()
+}
@@ -0,0 +1,193 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github-clone/config"
+
+	"github.com/google/uuid"
+)
+
+// LFSObject is a Git LFS object held by a repository
+type LFSObject struct {
+	RepositoryID string    `json:"repository_id"`
+	OID          string    `json:"oid"`
+	Size         int64     `json:"size"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// LFSUsage sums up the Git LFS objects of a repository
+type LFSUsage struct {
+	Objects int   `json:"objects"`
+	Size    int64 `json:"size"` // In bytes
+}
+
+// LFSLock is a Git LFS lock on a file, preventing others from pushing changes to it. It is
+// encoded as the Git LFS locking API expects.
+type LFSLock struct {
+	ID           string       `json:"id"`
+	RepositoryID string       `json:"-"`
+	Path         string       `json:"path"`
+	Ref          string       `json:"-"`
+	OwnerID      string       `json:"-"`
+	Owner        LFSLockOwner `json:"owner"`
+	LockedAt     time.Time    `json:"locked_at"`
+}
+
+// LFSLockOwner names the user holding a lock
+type LFSLockOwner struct {
+	Name string `json:"name"` // Username
+}
+
+// GetLFSObject retrieves an object of a repository, returning nil if the repository does
+// not hold it
+func GetLFSObject(repositoryID, oid string) (*LFSObject, error) {
+	var object LFSObject
+	err := config.DB.QueryRow(
+		"SELECT repository_id, oid, size, created_at FROM lfs_objects WHERE repository_id = ? AND oid = ?",
+		repositoryID, oid,
+	).Scan(&object.RepositoryID, &object.OID, &object.Size, &object.CreatedAt)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &object, nil
+}
+
+// CreateLFSObject records that a repository holds an object. Recording it again is not an error.
+func CreateLFSObject(repositoryID, oid string, size int64) error {
+	_, err := config.DB.Exec(
+		"INSERT OR IGNORE INTO lfs_objects (repository_id, oid, size, created_at) VALUES (?, ?, ?, ?)",
+		repositoryID, oid, size, time.Now(),
+	)
+	return err
+}
+
+// CopyLFSObjects gives a repository the objects of another, so a fork can download the
+// LFS files of its parent
+func CopyLFSObjects(fromRepositoryID, toRepositoryID string) error {
+	_, err := config.DB.Exec(`
+		INSERT OR IGNORE INTO lfs_objects (repository_id, oid, size, created_at)
+		SELECT ?, oid, size, created_at FROM lfs_objects WHERE repository_id = ?
+	`, toRepositoryID, fromRepositoryID)
+	return err
+}
+
+// GetLFSUsage counts the objects of a repository and their total size
+func GetLFSUsage(repositoryID string) (*LFSUsage, error) {
+	var usage LFSUsage
+	err := config.DB.QueryRow(
+		"SELECT COUNT(*), COALESCE(SUM(size), 0) FROM lfs_objects WHERE repository_id = ?",
+		repositoryID,
+	).Scan(&usage.Objects, &usage.Size)
+	if err != nil {
+		return nil, err
+	}
+	return &usage, nil
+}
+
+const lfsLockColumns = "l.id, l.repository_id, l.path, l.ref, l.owner_id, u.username, l.locked_at"
+
+const lfsLockFrom = "FROM lfs_locks l JOIN users u ON u.id = l.owner_id"
+
+// CreateLFSLock locks a file of a repository
+func CreateLFSLock(repositoryID, path, ref, ownerID string) (*LFSLock, error) {
+	lock := &LFSLock{
+		ID:           uuid.New().String(),
+		RepositoryID: repositoryID,
+		Path:         path,
+		Ref:          ref,
+		OwnerID:      ownerID,
+		LockedAt:     time.Now(),
+	}
+
+	_, err := config.DB.Exec(
+		"INSERT INTO lfs_locks (id, repository_id, path, ref, owner_id, locked_at) VALUES (?, ?, ?, ?, ?, ?)",
+		lock.ID, lock.RepositoryID, lock.Path, nullString(lock.Ref), lock.OwnerID, lock.LockedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return GetLFSLockByID(lock.ID)
+}
+
+// GetLFSLockByID retrieves a lock
+func GetLFSLockByID(id string) (*LFSLock, error) {
+	return getLFSLock("SELECT "+lfsLockColumns+" "+lfsLockFrom+" WHERE l.id = ?", id)
+}
+
+// GetLFSLockByPath retrieves the lock on a file of a repository
+func GetLFSLockByPath(repositoryID, path string) (*LFSLock, error) {
+	return getLFSLock("SELECT "+lfsLockColumns+" "+lfsLockFrom+" WHERE l.repository_id = ? AND l.path = ?", repositoryID, path)
+}
+
+// GetLFSLocks retrieves up to limit locks of a repository by path, skipping the first
+// offset ones. An empty path or ID does not filter.
+func GetLFSLocks(repositoryID, path, id string, limit, offset int) ([]*LFSLock, error) {
+	query := "SELECT " + lfsLockColumns + " " + lfsLockFrom + " WHERE l.repository_id = ?"
+	args := []interface{}{repositoryID}
+	if path != "" {
+		query += " AND l.path = ?"
+		args = append(args, path)
+	}
+	if id != "" {
+		query += " AND l.id = ?"
+		args = append(args, id)
+	}
+	query += " ORDER BY l.path LIMIT ? OFFSET ?"
+	args = append(args, limit, offset)
+
+	rows, err := config.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	locks := []*LFSLock{}
+	for rows.Next() {
+		lock, err := scanLFSLock(rows)
+		if err != nil {
+			return nil, err
+		}
+		locks = append(locks, lock)
+	}
+
+	return locks, rows.Err()
+}
+
+// DeleteLFSLock removes a lock
+func DeleteLFSLock(id string) error {
+	_, err := config.DB.Exec("DELETE FROM lfs_locks WHERE id = ?", id)
+	return err
+}
+
+// getLFSLock retrieves a single lock, returning nil if there is none
+func getLFSLock(query string, args ...interface{}) (*LFSLock, error) {
+	lock, err := scanLFSLock(config.DB.QueryRow(query, args...))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return lock, nil
+}
+
+// scanLFSLock reads a lock from a query result
+func scanLFSLock(scanner interface{ Scan(...interface{}) error }) (*LFSLock, error) {
+	var lock LFSLock
+	var ref sql.NullString
+
+	err := scanner.Scan(&lock.ID, &lock.RepositoryID, &lock.Path, &ref, &lock.OwnerID, &lock.Owner.Name, &lock.LockedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	lock.Ref = ref.String
+	return &lock, nil
+}
@@ -0,0 +1,314 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github-clone/config"
+
+	"github.com/google/uuid"
+)
+
+// Organization member roles
+const (
+	OrganizationRoleOwner  = "owner"
+	OrganizationRoleMember = "member"
+)
+
+// Organization represents a group account that can own repositories
+type Organization struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"` // Shares the username namespace
+	DisplayName string    `json:"display_name"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// OrganizationInput is used for creating organizations
+type OrganizationInput struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+	Description string `json:"description"`
+}
+
+// OrganizationMember represents a user's membership in an organization
+type OrganizationMember struct {
+	OrganizationID string        `json:"organization_id"`
+	UserID         string        `json:"user_id"`
+	Role           string        `json:"role"` // 'owner' or 'member'
+	CreatedAt      time.Time     `json:"created_at"`
+	User           *UserResponse `json:"user,omitempty"`
+}
+
+// OrganizationMemberInput is used for adding members or changing their role
+type OrganizationMemberInput struct {
+	Role string `json:"role"`
+}
+
+// CreateOrganization creates a new organization with the creator as its first owner
+func CreateOrganization(creatorID string, input OrganizationInput) (*Organization, error) {
+	id := uuid.New().String()
+	now := time.Now()
+
+	org := &Organization{
+		ID:          id,
+		Name:        input.Name,
+		DisplayName: input.DisplayName,
+		Description: input.Description,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// The users row reserves the name and lets repository queries resolve the owner.
+	// Organizations cannot log in, so they get an unusable password and a placeholder email.
+	_, err = tx.Exec(
+		"INSERT INTO users (id, username, email, password, type, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		org.ID, org.Name, fmt.Sprintf("%s@organizations.invalid", org.ID), "", UserTypeOrganization, org.CreatedAt, org.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(
+		"INSERT INTO organizations (id, display_name, description, created_at, updated_at) VALUES (?, ?, ?, ?, ?)",
+		org.ID, org.DisplayName, org.Description, org.CreatedAt, org.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(
+		"INSERT INTO organization_members (organization_id, user_id, role, created_at) VALUES (?, ?, ?, ?)",
+		org.ID, creatorID, OrganizationRoleOwner, now,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return org, nil
+}
+
+// GetOrganizationByName retrieves an organization by its name
+func GetOrganizationByName(name string) (*Organization, error) {
+	var org Organization
+	var displayName, description sql.NullString
+
+	err := config.DB.QueryRow(`
+		SELECT o.id, u.username, o.display_name, o.description, o.created_at, o.updated_at
+		FROM organizations o
+		JOIN users u ON o.id = u.id
+		WHERE u.username = ?
+	`, name).Scan(&org.ID, &org.Name, &displayName, &description, &org.CreatedAt, &org.UpdatedAt)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	org.DisplayName = displayName.String
+	org.Description = description.String
+
+	return &org, nil
+}
+
+// GetUserOrganizations retrieves all organizations a user is a member of
+func GetUserOrganizations(userID string) ([]*Organization, error) {
+	rows, err := config.DB.Query(`
+		SELECT o.id, u.username, o.display_name, o.description, o.created_at, o.updated_at
+		FROM organizations o
+		JOIN users u ON o.id = u.id
+		JOIN organization_members m ON m.organization_id = o.id
+		WHERE m.user_id = ?
+		ORDER BY u.username ASC
+	`, userID)
+
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orgs := []*Organization{}
+
+	for rows.Next() {
+		var org Organization
+		var displayName, description sql.NullString
+
+		err := rows.Scan(&org.ID, &org.Name, &displayName, &description, &org.CreatedAt, &org.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		org.DisplayName = displayName.String
+		org.Description = description.String
+		orgs = append(orgs, &org)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return orgs, nil
+}
+
+// GetOrganizationMemberRole returns the role a user holds in an organization, or "" if not a member
+func GetOrganizationMemberRole(orgID, userID string) (string, error) {
+	var role string
+
+	err := config.DB.QueryRow(
+		"SELECT role FROM organization_members WHERE organization_id = ? AND user_id = ?",
+		orgID, userID,
+	).Scan(&role)
+
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return role, nil
+}
+
+// GetOrganizationMembers retrieves all members of an organization
+func GetOrganizationMembers(orgID string) ([]*OrganizationMember, error) {
+	rows, err := config.DB.Query(`
+		SELECT m.organization_id, m.user_id, m.role, m.created_at,
+		       u.id, u.username, u.email, u.created_at
+		FROM organization_members m
+		JOIN users u ON m.user_id = u.id
+		WHERE m.organization_id = ?
+		ORDER BY u.username ASC
+	`, orgID)
+
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []*OrganizationMember{}
+
+	for rows.Next() {
+		var member OrganizationMember
+		var user UserResponse
+
+		err := rows.Scan(
+			&member.OrganizationID, &member.UserID, &member.Role, &member.CreatedAt,
+			&user.ID, &user.Username, &user.Email, &user.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		member.User = &user
+		members = append(members, &member)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return members, nil
+}
+
+// SetOrganizationMember adds a user to an organization or changes their role
+func SetOrganizationMember(orgID, userID string, input OrganizationMemberInput) error {
+	if input.Role != OrganizationRoleOwner && input.Role != OrganizationRoleMember {
+		return errors.New("role must be either 'owner' or 'member'")
+	}
+
+	// Demoting the last owner would leave nobody able to manage the organization
+	if input.Role == OrganizationRoleMember {
+		if err := ensureAnotherOwner(orgID, userID); err != nil {
+			return err
+		}
+	}
+
+	_, err := config.DB.Exec(`
+		INSERT INTO organization_members (organization_id, user_id, role, created_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(organization_id, user_id) DO UPDATE SET role = excluded.role
+	`, orgID, userID, input.Role, time.Now())
+
+	return err
+}
+
+// RemoveOrganizationMember removes a user from an organization and all of its teams
+func RemoveOrganizationMember(orgID, userID string) error {
+	if err := ensureAnotherOwner(orgID, userID); err != nil {
+		return err
+	}
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
+		"DELETE FROM organization_members WHERE organization_id = ? AND user_id = ?",
+		orgID, userID,
+	)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return errors.New("member not found")
+	}
+
+	_, err = tx.Exec(
+		"DELETE FROM team_members WHERE user_id = ? AND team_id IN (SELECT id FROM teams WHERE organization_id = ?)",
+		userID, orgID,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ensureAnotherOwner returns an error if userID is the only owner of the organization
+func ensureAnotherOwner(orgID, userID string) error {
+	var otherOwners int
+
+	err := config.DB.QueryRow(
+		"SELECT COUNT(*) FROM organization_members WHERE organization_id = ? AND role = ? AND user_id != ?",
+		orgID, OrganizationRoleOwner, userID,
+	).Scan(&otherOwners)
+	if err != nil {
+		return err
+	}
+
+	role, err := GetOrganizationMemberRole(orgID, userID)
+	if err != nil {
+		return err
+	}
+
+	if role == OrganizationRoleOwner && otherOwners == 0 {
+		return errors.New("an organization must keep at least one owner")
+	}
+
+	return nil
+}
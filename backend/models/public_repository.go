@@ -6,6 +6,7 @@ import (
 
 // GetPublicRepositories fetches all public repositories with pagination
 // If requestingUserID is provided, it will include private repositories owned by that user
+// or shared with them as a collaborator
 func GetPublicRepositories(limit, offset int, requestingUserID string, sort string) ([]*Repository, error) {
 	var query string
 	var args []interface{}
@@ -16,17 +17,18 @@ func GetPublicRepositories(limit, offset int, requestingUserID string, sort stri
 	}
 
 	if requestingUserID != "" {
-		// If user is authenticated, show public repos + their own private repos
+		// If user is authenticated, show public repos + private repos they own or collaborate on
 		query = `
 			SELECT r.id, r.name, r.description, r.owner_id, r.is_public, r.created_at, r.updated_at,
 				u.id, u.username, u.email, u.created_at
 			FROM repositories r
 			LEFT JOIN users u ON r.owner_id = u.id
 			WHERE r.is_public = 1 OR r.owner_id = ?
+				OR r.id IN (SELECT repository_id FROM repository_collaborators WHERE user_id = ?)
 			` + orderByClause + `
 			LIMIT ? OFFSET ?
 		`
-		args = []interface{}{requestingUserID, limit, offset}
+		args = []interface{}{requestingUserID, requestingUserID, limit, offset}
 	} else {
 		// If no user is authenticated, only show public repos
 		query = `
@@ -106,17 +108,18 @@ func GetUserPublicRepositories(username string, limit, offset int, requestingUse
 		`
 		args = []interface{}{userID, limit, offset}
 	} else {
-		// Otherwise, only show public repos
+		// Otherwise, only show public repos and private repos shared with the requesting user
 		query = `
 			SELECT r.id, r.name, r.description, r.owner_id, r.is_public, r.created_at, r.updated_at,
 				u.id, u.username, u.email, u.created_at
 			FROM repositories r
 			LEFT JOIN users u ON r.owner_id = u.id
-			WHERE r.owner_id = ? AND r.is_public = 1
+			WHERE r.owner_id = ? AND (r.is_public = 1
+				OR r.id IN (SELECT repository_id FROM repository_collaborators WHERE user_id = ?))
 			` + orderByClause + `
 			LIMIT ? OFFSET ?
 		`
-		args = []interface{}{userID, limit, offset}
+		args = []interface{}{userID, requestingUserID, limit, offset}
 	}
 
 	rows, err := config.DB.Query(query, args...)
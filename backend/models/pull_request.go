@@ -0,0 +1,266 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github-clone/config"
+
+	"github.com/google/uuid"
+)
+
+// Pull request states
+const (
+	PullRequestOpen   = "open"
+	PullRequestClosed = "closed"
+	PullRequestMerged = "merged"
+)
+
+// PullRequest proposes merging the head branch into the base branch of a repository
+type PullRequest struct {
+	ID               string     `json:"id"`
+	RepositoryID     string     `json:"repository_id"`
+	HeadRepositoryID string     `json:"head_repository_id,omitempty"` // Repository holding the head branch; empty if it was deleted
+	Title            string     `json:"title"`
+	Description      string     `json:"description"`
+	HeadRef          string     `json:"head_ref"`
+	BaseRef          string     `json:"base_ref"`
+	HeadSHA          string     `json:"head_sha"`
+	BaseSHA          string     `json:"base_sha,omitempty"` // Tip of the base branch when the pull request was merged
+	State            string     `json:"state"`
+	CreatedBy        string     `json:"created_by"` // Username of creator
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+	ClosedAt         *time.Time `json:"closed_at"`
+	MergedAt         *time.Time `json:"merged_at"`
+	MergedBy         string     `json:"merged_by,omitempty"` // Username of who merged it
+	MergeMethod      string     `json:"merge_method,omitempty"`
+	MergeCommitSHA   string     `json:"merge_commit_sha,omitempty"`
+
+	// Computed when a single pull request is retrieved
+	Mergeable *bool `json:"mergeable,omitempty"`
+}
+
+// PullRequestInput is used for creating pull requests
+type PullRequestInput struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Head        string `json:"head"` // Branch with the changes
+	Base        string `json:"base"` // Branch the changes should be merged into
+}
+
+// PullRequestUpdateInput is used for editing pull requests. Only set fields are changed.
+type PullRequestUpdateInput struct {
+	Title       *string `json:"title"`
+	Description *string `json:"description"`
+	State       *string `json:"state"` // "open" or "closed"
+	Base        *string `json:"base"`
+}
+
+// MergePullRequestInput is used for merging pull requests
+type MergePullRequestInput struct {
+	MergeMethod   string `json:"merge_method"` // "merge", "squash" or "rebase"; defaults to "merge"
+	CommitTitle   string `json:"commit_title"`
+	CommitMessage string `json:"commit_message"`
+	SHA           string `json:"sha"` // If set, the head must still be at this commit
+}
+
+const pullRequestColumns = `id, repository_id, head_repository_id, title, description, head_ref, base_ref,
+	head_sha, base_sha, state, created_by, created_at, updated_at, closed_at,
+	merged_at, merged_by, merge_method, merge_commit_sha`
+
+// CreatePullRequest creates a new open pull request
+func CreatePullRequest(repoID, headRepoID, createdBy, headSHA string, input PullRequestInput) (*PullRequest, error) {
+	now := time.Now()
+
+	pr := &PullRequest{
+		ID:               uuid.New().String(),
+		RepositoryID:     repoID,
+		HeadRepositoryID: headRepoID,
+		Title:            input.Title,
+		Description:      input.Description,
+		HeadRef:          input.Head,
+		BaseRef:          input.Base,
+		HeadSHA:          headSHA,
+		State:            PullRequestOpen,
+		CreatedBy:        createdBy,
+		CreatedAt:        now,
+		UpdatedAt:        now,
+	}
+
+	_, err := config.DB.Exec(`
+		INSERT INTO pull_requests (id, repository_id, head_repository_id, title, description, head_ref, base_ref,
+			head_sha, state, created_by, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, pr.ID, pr.RepositoryID, pr.HeadRepositoryID, pr.Title, pr.Description, pr.HeadRef, pr.BaseRef,
+		pr.HeadSHA, pr.State, pr.CreatedBy, pr.CreatedAt, pr.UpdatedAt)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return pr, nil
+}
+
+// GetPullRequest retrieves a pull request by ID
+func GetPullRequest(id string) (*PullRequest, error) {
+	pr, err := scanPullRequest(config.DB.QueryRow(
+		"SELECT "+pullRequestColumns+" FROM pull_requests WHERE id = ?",
+		id,
+	))
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return pr, nil
+}
+
+// GetRepositoryPullRequests retrieves the pull requests of a repository with pagination.
+// state may be "open", "closed", "merged" or "all".
+func GetRepositoryPullRequests(repoID, state string, limit, offset int) ([]*PullRequest, error) {
+	query := "SELECT " + pullRequestColumns + " FROM pull_requests WHERE repository_id = ?"
+	args := []interface{}{repoID}
+
+	if state != "all" {
+		query += " AND state = ?"
+		args = append(args, state)
+	}
+
+	query += " ORDER BY created_at DESC LIMIT ? OFFSET ?"
+	args = append(args, limit, offset)
+
+	rows, err := config.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	prs := []*PullRequest{}
+	for rows.Next() {
+		pr, err := scanPullRequest(rows)
+		if err != nil {
+			return nil, err
+		}
+		prs = append(prs, pr)
+	}
+
+	return prs, rows.Err()
+}
+
+// FindOpenPullRequest returns the open pull request for the same head and base branches, if any
+func FindOpenPullRequest(repoID, headRepoID, headRef, baseRef string) (*PullRequest, error) {
+	pr, err := scanPullRequest(config.DB.QueryRow(
+		"SELECT "+pullRequestColumns+` FROM pull_requests
+		WHERE repository_id = ? AND head_repository_id = ? AND head_ref = ? AND base_ref = ? AND state = ?`,
+		repoID, headRepoID, headRef, baseRef, PullRequestOpen,
+	))
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return pr, nil
+}
+
+// UpdatePullRequest saves the title, description, base branch and state of a pull request
+func UpdatePullRequest(pr *PullRequest) error {
+	if pr.State == PullRequestMerged {
+		return errors.New("merged pull requests cannot be changed")
+	}
+
+	now := time.Now()
+	var closedAt *time.Time
+	if pr.State == PullRequestClosed {
+		closedAt = pr.ClosedAt
+		if closedAt == nil {
+			closedAt = &now
+		}
+	}
+
+	_, err := config.DB.Exec(`
+		UPDATE pull_requests
+		SET title = ?, description = ?, base_ref = ?, state = ?, closed_at = ?, updated_at = ?
+		WHERE id = ? AND state != ?
+	`, pr.Title, pr.Description, pr.BaseRef, pr.State, closedAt, now, pr.ID, PullRequestMerged)
+
+	if err != nil {
+		return err
+	}
+
+	pr.ClosedAt = closedAt
+	pr.UpdatedAt = now
+	return nil
+}
+
+// UpdatePullRequestHead records the commit the head branch currently points to
+func UpdatePullRequestHead(id, headSHA string) error {
+	_, err := config.DB.Exec("UPDATE pull_requests SET head_sha = ? WHERE id = ?", headSHA, id)
+	return err
+}
+
+// MarkPullRequestMerged records that a pull request was merged
+func MarkPullRequestMerged(pr *PullRequest, mergedBy, method, baseSHA, mergeCommitSHA string) error {
+	now := time.Now()
+
+	_, err := config.DB.Exec(`
+		UPDATE pull_requests
+		SET state = ?, merged_at = ?, merged_by = ?, merge_method = ?, base_sha = ?, merge_commit_sha = ?,
+			closed_at = ?, updated_at = ?
+		WHERE id = ?
+	`, PullRequestMerged, now, mergedBy, method, baseSHA, mergeCommitSHA, now, now, pr.ID)
+
+	if err != nil {
+		return err
+	}
+
+	pr.State = PullRequestMerged
+	pr.MergedAt = &now
+	pr.MergedBy = mergedBy
+	pr.MergeMethod = method
+	pr.BaseSHA = baseSHA
+	pr.MergeCommitSHA = mergeCommitSHA
+	pr.ClosedAt = &now
+	pr.UpdatedAt = now
+	return nil
+}
+
+// scanPullRequest reads a pull request from a query result
+func scanPullRequest(scanner interface{ Scan(...interface{}) error }) (*PullRequest, error) {
+	var pr PullRequest
+	var headRepoID, description, baseSHA, mergedBy, mergeMethod, mergeCommitSHA sql.NullString
+	var closedAt, mergedAt sql.NullTime
+
+	err := scanner.Scan(
+		&pr.ID, &pr.RepositoryID, &headRepoID, &pr.Title, &description, &pr.HeadRef, &pr.BaseRef,
+		&pr.HeadSHA, &baseSHA, &pr.State, &pr.CreatedBy, &pr.CreatedAt, &pr.UpdatedAt, &closedAt,
+		&mergedAt, &mergedBy, &mergeMethod, &mergeCommitSHA,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	pr.HeadRepositoryID = headRepoID.String
+	pr.Description = description.String
+	pr.BaseSHA = baseSHA.String
+	pr.MergedBy = mergedBy.String
+	pr.MergeMethod = mergeMethod.String
+	pr.MergeCommitSHA = mergeCommitSHA.String
+	if closedAt.Valid {
+		pr.ClosedAt = &closedAt.Time
+	}
+	if mergedAt.Valid {
+		pr.MergedAt = &mergedAt.Time
+	}
+
+	return &pr, nil
+}
@@ -0,0 +1,268 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github-clone/config"
+
+	"github.com/google/uuid"
+)
+
+// Review states
+const (
+	ReviewApproved         = "approved"
+	ReviewChangesRequested = "changes_requested"
+	ReviewCommented        = "commented"
+)
+
+// Sides of a diff a review comment can be anchored to
+const (
+	DiffSideLeft  = "LEFT"  // The old version of the file
+	DiffSideRight = "RIGHT" // The new version of the file
+)
+
+// Review is a set of review comments submitted together with a verdict on a pull request
+type Review struct {
+	ID            string           `json:"id"`
+	PullRequestID string           `json:"pull_request_id"`
+	State         string           `json:"state"`
+	Body          string           `json:"body"`
+	CommitSHA     string           `json:"commit_sha"` // Head of the pull request when the review was submitted
+	CreatedBy     string           `json:"created_by"` // Username of reviewer
+	SubmittedAt   time.Time        `json:"submitted_at"`
+	Comments      []*ReviewComment `json:"comments,omitempty"`
+}
+
+// ReviewComment is a comment on a line of a file changed by a pull request
+type ReviewComment struct {
+	ID            string    `json:"id"`
+	PullRequestID string    `json:"pull_request_id"`
+	ReviewID      string    `json:"review_id,omitempty"`
+	InReplyTo     string    `json:"in_reply_to,omitempty"`
+	Path          string    `json:"path"`
+	CommitSHA     string    `json:"commit_sha"`
+	Line          int       `json:"line"`
+	Side          string    `json:"side"`
+	Body          string    `json:"body"`
+	CreatedBy     string    `json:"created_by"` // Username of creator
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+
+	// Set when the file has changed since the commit the comment was made on
+	Outdated bool `json:"outdated"`
+}
+
+// ReviewInput is used for submitting reviews
+type ReviewInput struct {
+	Event     string               `json:"event"` // "APPROVE", "REQUEST_CHANGES" or "COMMENT"
+	Body      string               `json:"body"`
+	CommitSHA string               `json:"commit_sha"` // Defaults to the current head of the pull request
+	Comments  []ReviewCommentInput `json:"comments"`
+}
+
+// ReviewCommentInput is used for creating review comments, either on their own or as part of a review.
+// Replies only need a body; they are anchored to the same line as the comment they reply to.
+type ReviewCommentInput struct {
+	Body      string `json:"body"`
+	Path      string `json:"path"`
+	Line      int    `json:"line"`
+	Side      string `json:"side"`       // "LEFT" or "RIGHT"; defaults to "RIGHT"
+	CommitSHA string `json:"commit_sha"` // Defaults to the current head of the pull request
+	InReplyTo string `json:"in_reply_to"`
+}
+
+const reviewCommentColumns = `id, pull_request_id, review_id, in_reply_to, path, commit_sha, line, side, body,
+	created_by, created_at, updated_at`
+
+// CreateReview stores a review together with its comments in a single transaction.
+// The comments must already be anchored; their IDs and timestamps are filled in here.
+func CreateReview(pullRequestID, createdBy, state, body, commitSHA string, comments []*ReviewComment) (*Review, error) {
+	review := &Review{
+		ID:            uuid.New().String(),
+		PullRequestID: pullRequestID,
+		State:         state,
+		Body:          body,
+		CommitSHA:     commitSHA,
+		CreatedBy:     createdBy,
+		SubmittedAt:   time.Now(),
+		Comments:      comments,
+	}
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO pull_request_reviews (id, pull_request_id, state, body, commit_sha, created_by, submitted_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, review.ID, review.PullRequestID, review.State, review.Body, review.CommitSHA, review.CreatedBy, review.SubmittedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, comment := range comments {
+		comment.ReviewID = review.ID
+		if err := insertReviewComment(tx, comment, pullRequestID, createdBy); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return review, nil
+}
+
+// GetPullRequestReviews retrieves the reviews of a pull request, oldest first
+func GetPullRequestReviews(pullRequestID string) ([]*Review, error) {
+	rows, err := config.DB.Query(`
+		SELECT id, pull_request_id, state, body, commit_sha, created_by, submitted_at
+		FROM pull_request_reviews
+		WHERE pull_request_id = ?
+		ORDER BY submitted_at ASC
+	`, pullRequestID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reviews := []*Review{}
+	for rows.Next() {
+		var review Review
+		var body sql.NullString
+		err := rows.Scan(&review.ID, &review.PullRequestID, &review.State, &body, &review.CommitSHA,
+			&review.CreatedBy, &review.SubmittedAt)
+		if err != nil {
+			return nil, err
+		}
+		review.Body = body.String
+		reviews = append(reviews, &review)
+	}
+
+	return reviews, rows.Err()
+}
+
+// CreateReviewComment stores a review comment that is not part of a review
+func CreateReviewComment(pullRequestID, createdBy string, comment *ReviewComment) error {
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := insertReviewComment(tx, comment, pullRequestID, createdBy); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetReviewComment retrieves a review comment by ID
+func GetReviewComment(id string) (*ReviewComment, error) {
+	comment, err := scanReviewComment(config.DB.QueryRow(
+		"SELECT "+reviewCommentColumns+" FROM pull_request_comments WHERE id = ?",
+		id,
+	))
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return comment, nil
+}
+
+// GetPullRequestReviewComments retrieves the review comments of a pull request, oldest first
+func GetPullRequestReviewComments(pullRequestID string) ([]*ReviewComment, error) {
+	rows, err := config.DB.Query(
+		"SELECT "+reviewCommentColumns+" FROM pull_request_comments WHERE pull_request_id = ? ORDER BY created_at ASC",
+		pullRequestID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments := []*ReviewComment{}
+	for rows.Next() {
+		comment, err := scanReviewComment(rows)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, comment)
+	}
+
+	return comments, rows.Err()
+}
+
+// UpdateReviewComment changes the body of a review comment
+func UpdateReviewComment(comment *ReviewComment, body string) error {
+	now := time.Now()
+
+	_, err := config.DB.Exec(
+		"UPDATE pull_request_comments SET body = ?, updated_at = ? WHERE id = ?",
+		body, now, comment.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	comment.Body = body
+	comment.UpdatedAt = now
+	return nil
+}
+
+// DeleteReviewComment deletes a review comment and its replies
+func DeleteReviewComment(id string) error {
+	_, err := config.DB.Exec("DELETE FROM pull_request_comments WHERE id = ?", id)
+	return err
+}
+
+// insertReviewComment inserts a review comment within a transaction
+func insertReviewComment(tx *sql.Tx, comment *ReviewComment, pullRequestID, createdBy string) error {
+	now := time.Now()
+	comment.ID = uuid.New().String()
+	comment.PullRequestID = pullRequestID
+	comment.CreatedBy = createdBy
+	comment.CreatedAt = now
+	comment.UpdatedAt = now
+
+	_, err := tx.Exec(`
+		INSERT INTO pull_request_comments (id, pull_request_id, review_id, in_reply_to, path, commit_sha, line, side,
+			body, created_by, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, comment.ID, comment.PullRequestID, nullString(comment.ReviewID), nullString(comment.InReplyTo), comment.Path,
+		comment.CommitSHA, comment.Line, comment.Side, comment.Body, comment.CreatedBy, comment.CreatedAt, comment.UpdatedAt)
+
+	return err
+}
+
+// nullString stores empty strings as NULL so optional foreign keys stay valid
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// scanReviewComment reads a review comment from a query result
+func scanReviewComment(scanner interface{ Scan(...interface{}) error }) (*ReviewComment, error) {
+	var comment ReviewComment
+	var reviewID, inReplyTo sql.NullString
+
+	err := scanner.Scan(
+		&comment.ID, &comment.PullRequestID, &reviewID, &inReplyTo, &comment.Path, &comment.CommitSHA,
+		&comment.Line, &comment.Side, &comment.Body, &comment.CreatedBy, &comment.CreatedAt, &comment.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	comment.ReviewID = reviewID.String
+	comment.InReplyTo = inReplyTo.String
+	return &comment, nil
+}
@@ -0,0 +1,298 @@
+package models
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github-clone/config"
+
+	"github.com/google/uuid"
+)
+
+// Release presents a tag of a repository with notes and downloadable files. Drafts are only
+// visible to users who can push, and their tag is created when they are published.
+type Release struct {
+	ID              string          `json:"id"`
+	RepositoryID    string          `json:"repository_id"`
+	TagName         string          `json:"tag_name"`
+	TargetCommitish string          `json:"target_commitish"` // Branch or commit the tag is created from
+	Name            string          `json:"name"`
+	Body            string          `json:"body"` // Release notes in Markdown
+	Draft           bool            `json:"draft"`
+	Prerelease      bool            `json:"prerelease"`
+	AuthorID        string          `json:"author_id,omitempty"`
+	Author          string          `json:"author,omitempty"` // Username of the author
+	CreatedAt       time.Time       `json:"created_at"`
+	UpdatedAt       time.Time       `json:"updated_at"`
+	PublishedAt     *time.Time      `json:"published_at"`
+	Assets          []*ReleaseAsset `json:"assets"`
+}
+
+// ReleaseAsset is a file uploaded to a release
+type ReleaseAsset struct {
+	ID            string    `json:"id"`
+	ReleaseID     string    `json:"release_id"`
+	Name          string    `json:"name"`
+	ContentType   string    `json:"content_type"`
+	Size          int64     `json:"size"`
+	DownloadCount int       `json:"download_count"`
+	UploaderID    string    `json:"uploader_id,omitempty"`
+	Uploader      string    `json:"uploader,omitempty"` // Username of the uploader
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// ReleaseInput is used for creating and updating releases. Fields left out keep their
+// current value, or their default when creating a release.
+type ReleaseInput struct {
+	TagName         *string `json:"tag_name"`
+	TargetCommitish *string `json:"target_commitish"`
+	Name            *string `json:"name"`
+	Body            *string `json:"body"`
+	Draft           *bool   `json:"draft"`
+	Prerelease      *bool   `json:"prerelease"`
+}
+
+const releaseColumns = `r.id, r.repository_id, r.tag_name, r.target_commitish, r.name, r.body, r.draft, r.prerelease,
+	r.author_id, u.username, r.created_at, r.updated_at, r.published_at`
+
+const releaseFrom = "FROM releases r LEFT JOIN users u ON u.id = r.author_id"
+
+const releaseAssetColumns = `a.id, a.release_id, a.name, a.content_type, a.size, a.download_count, a.uploader_id,
+	u.username, a.created_at`
+
+const releaseAssetFrom = "FROM release_assets a LEFT JOIN users u ON u.id = a.uploader_id"
+
+// CreateRelease adds a release to a repository
+func CreateRelease(release *Release) error {
+	now := time.Now()
+	release.ID = uuid.New().String()
+	release.CreatedAt = now
+	release.UpdatedAt = now
+	release.Assets = []*ReleaseAsset{}
+	if !release.Draft {
+		release.PublishedAt = &now
+	}
+
+	_, err := config.DB.Exec(`
+		INSERT INTO releases (id, repository_id, tag_name, target_commitish, name, body, draft, prerelease,
+			author_id, created_at, updated_at, published_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, release.ID, release.RepositoryID, release.TagName, release.TargetCommitish, release.Name, release.Body,
+		release.Draft, release.Prerelease, nullString(release.AuthorID), release.CreatedAt, release.UpdatedAt,
+		release.PublishedAt)
+
+	return err
+}
+
+// GetReleaseByID retrieves a release with its assets
+func GetReleaseByID(id string) (*Release, error) {
+	return getRelease("SELECT "+releaseColumns+" "+releaseFrom+" WHERE r.id = ?", id)
+}
+
+// GetReleaseByTag retrieves the release of a tag with its assets
+func GetReleaseByTag(repositoryID, tagName string) (*Release, error) {
+	return getRelease("SELECT "+releaseColumns+" "+releaseFrom+" WHERE r.repository_id = ? AND r.tag_name = ?", repositoryID, tagName)
+}
+
+// GetLatestRelease retrieves the most recently published release that is neither a draft
+// nor a prerelease
+func GetLatestRelease(repositoryID string) (*Release, error) {
+	return getRelease(
+		"SELECT "+releaseColumns+" "+releaseFrom+`
+		WHERE r.repository_id = ? AND r.draft = 0 AND r.prerelease = 0
+		ORDER BY r.published_at DESC LIMIT 1`,
+		repositoryID,
+	)
+}
+
+// GetRepositoryReleases retrieves the releases of a repository with their assets, newest
+// first. Drafts are only included when asked for.
+func GetRepositoryReleases(repositoryID string, includeDrafts bool) ([]*Release, error) {
+	query := "SELECT " + releaseColumns + " " + releaseFrom + " WHERE r.repository_id = ?"
+	if !includeDrafts {
+		query += " AND r.draft = 0"
+	}
+	query += " ORDER BY COALESCE(r.published_at, r.created_at) DESC"
+
+	rows, err := config.DB.Query(query, repositoryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	releases := []*Release{}
+	for rows.Next() {
+		release, err := scanRelease(rows)
+		if err != nil {
+			return nil, err
+		}
+		releases = append(releases, release)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := loadReleaseAssets(releases); err != nil {
+		return nil, err
+	}
+
+	return releases, nil
+}
+
+// UpdateRelease saves the changes made to a release. A draft is published when it stops
+// being a draft.
+func UpdateRelease(release *Release) error {
+	release.UpdatedAt = time.Now()
+	if !release.Draft && release.PublishedAt == nil {
+		publishedAt := release.UpdatedAt
+		release.PublishedAt = &publishedAt
+	}
+
+	_, err := config.DB.Exec(`
+		UPDATE releases SET tag_name = ?, target_commitish = ?, name = ?, body = ?, draft = ?, prerelease = ?,
+			updated_at = ?, published_at = ?
+		WHERE id = ?
+	`, release.TagName, release.TargetCommitish, release.Name, release.Body, release.Draft, release.Prerelease,
+		release.UpdatedAt, release.PublishedAt, release.ID)
+
+	return err
+}
+
+// DeleteRelease removes a release and its assets from the database
+func DeleteRelease(id string) error {
+	_, err := config.DB.Exec("DELETE FROM releases WHERE id = ?", id)
+	return err
+}
+
+// CreateReleaseAsset records a file uploaded to a release
+func CreateReleaseAsset(asset *ReleaseAsset) error {
+	asset.ID = uuid.New().String()
+	asset.CreatedAt = time.Now()
+
+	_, err := config.DB.Exec(`
+		INSERT INTO release_assets (id, release_id, name, content_type, size, uploader_id, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, asset.ID, asset.ReleaseID, asset.Name, asset.ContentType, asset.Size, nullString(asset.UploaderID), asset.CreatedAt)
+
+	return err
+}
+
+// GetReleaseAssetByID retrieves a release asset
+func GetReleaseAssetByID(id string) (*ReleaseAsset, error) {
+	asset, err := scanReleaseAsset(config.DB.QueryRow("SELECT "+releaseAssetColumns+" "+releaseAssetFrom+" WHERE a.id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return asset, nil
+}
+
+// IncrementReleaseAssetDownloads counts a download of a release asset
+func IncrementReleaseAssetDownloads(id string) error {
+	_, err := config.DB.Exec("UPDATE release_assets SET download_count = download_count + 1 WHERE id = ?", id)
+	return err
+}
+
+// DeleteReleaseAsset removes a release asset from the database
+func DeleteReleaseAsset(id string) error {
+	_, err := config.DB.Exec("DELETE FROM release_assets WHERE id = ?", id)
+	return err
+}
+
+// getRelease retrieves a single release with its assets, returning nil if there is none
+func getRelease(query string, args ...interface{}) (*Release, error) {
+	release, err := scanRelease(config.DB.QueryRow(query, args...))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := loadReleaseAssets([]*Release{release}); err != nil {
+		return nil, err
+	}
+
+	return release, nil
+}
+
+// loadReleaseAssets fills in the assets of releases with a single query
+func loadReleaseAssets(releases []*Release) error {
+	if len(releases) == 0 {
+		return nil
+	}
+
+	byID := make(map[string]*Release, len(releases))
+	args := make([]interface{}, 0, len(releases))
+	for _, release := range releases {
+		byID[release.ID] = release
+		args = append(args, release.ID)
+	}
+
+	rows, err := config.DB.Query(
+		"SELECT "+releaseAssetColumns+" "+releaseAssetFrom+
+			" WHERE a.release_id IN (?"+strings.Repeat(", ?", len(args)-1)+") ORDER BY a.name",
+		args...,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		asset, err := scanReleaseAsset(rows)
+		if err != nil {
+			return err
+		}
+		release := byID[asset.ReleaseID]
+		release.Assets = append(release.Assets, asset)
+	}
+
+	return rows.Err()
+}
+
+// scanRelease reads a release from a query result
+func scanRelease(scanner interface{ Scan(...interface{}) error }) (*Release, error) {
+	var release Release
+	var name, body, authorID, author sql.NullString
+	var publishedAt sql.NullTime
+
+	err := scanner.Scan(
+		&release.ID, &release.RepositoryID, &release.TagName, &release.TargetCommitish, &name, &body,
+		&release.Draft, &release.Prerelease, &authorID, &author, &release.CreatedAt, &release.UpdatedAt, &publishedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	release.Name = name.String
+	release.Body = body.String
+	release.AuthorID = authorID.String
+	release.Author = author.String
+	if publishedAt.Valid {
+		release.PublishedAt = &publishedAt.Time
+	}
+	release.Assets = []*ReleaseAsset{}
+	return &release, nil
+}
+
+// scanReleaseAsset reads a release asset from a query result
+func scanReleaseAsset(scanner interface{ Scan(...interface{}) error }) (*ReleaseAsset, error) {
+	var asset ReleaseAsset
+	var uploaderID, uploader sql.NullString
+
+	err := scanner.Scan(
+		&asset.ID, &asset.ReleaseID, &asset.Name, &asset.ContentType, &asset.Size, &asset.DownloadCount,
+		&uploaderID, &uploader, &asset.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	asset.UploaderID = uploaderID.String
+	asset.Uploader = uploader.String
+	return &asset, nil
+}
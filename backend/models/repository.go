@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
 	"strings"
@@ -22,6 +23,7 @@ type Repository struct {
 	Description string    `json:"description"`
 	OwnerID     string    `json:"owner_id"`
 	IsPublic    bool      `json:"is_public"`
+	ParentID    string    `json:"parent_id,omitempty"` // Repository this one was forked from
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 	Owner       *User     `json:"owner,omitempty"` // Owner information
@@ -113,7 +115,7 @@ func CreateRepository(ownerID string, input RepositoryInput) (*Repository, error
 // GetRepositoryByID fetches a repository by its ID
 func GetRepositoryByID(id string) (*Repository, error) {
 	query := `
-		SELECT r.id, r.name, r.description, r.owner_id, r.is_public, r.created_at, r.updated_at,
+		SELECT r.id, r.name, r.description, r.owner_id, r.is_public, COALESCE(r.parent_id, ''), r.created_at, r.updated_at,
 		       u.id, u.username, u.email, u.created_at
 		FROM repositories r
 		LEFT JOIN users u ON r.owner_id = u.id
@@ -125,7 +127,7 @@ func GetRepositoryByID(id string) (*Repository, error) {
 	
 	// Query the database
 	err := config.DB.QueryRow(query, id).Scan(
-		&repo.ID, &repo.Name, &repo.Description, &repo.OwnerID, &repo.IsPublic, &repo.CreatedAt, &repo.UpdatedAt,
+		&repo.ID, &repo.Name, &repo.Description, &repo.OwnerID, &repo.IsPublic, &repo.ParentID, &repo.CreatedAt, &repo.UpdatedAt,
 		&owner.ID, &owner.Username, &owner.Email, &owner.CreatedAt,
 	)
 	
@@ -145,7 +147,7 @@ func GetRepositoryByID(id string) (*Repository, error) {
 // GetRepositoryByOwnerAndName fetches a repository by owner ID and repository name
 func GetRepositoryByOwnerAndName(ownerID, name string) (*Repository, error) {
 	query := `
-		SELECT r.id, r.name, r.description, r.owner_id, r.is_public, r.created_at, r.updated_at,
+		SELECT r.id, r.name, r.description, r.owner_id, r.is_public, COALESCE(r.parent_id, ''), r.created_at, r.updated_at,
 		       u.id, u.username, u.email, u.created_at
 		FROM repositories r
 		LEFT JOIN users u ON r.owner_id = u.id
@@ -157,7 +159,7 @@ func GetRepositoryByOwnerAndName(ownerID, name string) (*Repository, error) {
 	
 	// Query the database
 	err := config.DB.QueryRow(query, ownerID, name).Scan(
-		&repo.ID, &repo.Name, &repo.Description, &repo.OwnerID, &repo.IsPublic, &repo.CreatedAt, &repo.UpdatedAt,
+		&repo.ID, &repo.Name, &repo.Description, &repo.OwnerID, &repo.IsPublic, &repo.ParentID, &repo.CreatedAt, &repo.UpdatedAt,
 		&owner.ID, &owner.Username, &owner.Email, &owner.CreatedAt,
 	)
 	
@@ -183,7 +185,7 @@ func GetRepositoryByName(username, repoName string) (*Repository, error) {
 // GetRepositoryByUsernameAndName fetches a repository by username and repository name
 func GetRepositoryByUsernameAndName(username, repoName string) (*Repository, error) {
 	query := `
-		SELECT r.id, r.name, r.description, r.owner_id, r.is_public, r.created_at, r.updated_at,
+		SELECT r.id, r.name, r.description, r.owner_id, r.is_public, COALESCE(r.parent_id, ''), r.created_at, r.updated_at,
 		       u.id, u.username, u.email, u.created_at
 		FROM repositories r
 		JOIN users u ON r.owner_id = u.id
@@ -195,7 +197,7 @@ func GetRepositoryByUsernameAndName(username, repoName string) (*Repository, err
 	
 	// Query the database
 	err := config.DB.QueryRow(query, username, repoName).Scan(
-		&repo.ID, &repo.Name, &repo.Description, &repo.OwnerID, &repo.IsPublic, &repo.CreatedAt, &repo.UpdatedAt,
+		&repo.ID, &repo.Name, &repo.Description, &repo.OwnerID, &repo.IsPublic, &repo.ParentID, &repo.CreatedAt, &repo.UpdatedAt,
 		&owner.ID, &owner.Username, &owner.Email, &owner.CreatedAt,
 	)
 	
@@ -215,7 +217,7 @@ func GetRepositoryByUsernameAndName(username, repoName string) (*Repository, err
 // GetUserRepositories fetches all repositories owned by a user
 func GetUserRepositories(userID string) ([]*Repository, error) {
 	query := `
-		SELECT r.id, r.name, r.description, r.owner_id, r.is_public, r.created_at, r.updated_at,
+		SELECT r.id, r.name, r.description, r.owner_id, r.is_public, COALESCE(r.parent_id, ''), r.created_at, r.updated_at,
 		       u.id, u.username, u.email, u.created_at
 		FROM repositories r
 		LEFT JOIN users u ON r.owner_id = u.id
@@ -236,7 +238,7 @@ func GetUserRepositories(userID string) ([]*Repository, error) {
 		var owner User
 		
 		err := rows.Scan(
-			&repo.ID, &repo.Name, &repo.Description, &repo.OwnerID, &repo.IsPublic, &repo.CreatedAt, &repo.UpdatedAt,
+			&repo.ID, &repo.Name, &repo.Description, &repo.OwnerID, &repo.IsPublic, &repo.ParentID, &repo.CreatedAt, &repo.UpdatedAt,
 			&owner.ID, &owner.Username, &owner.Email, &owner.CreatedAt,
 		)
 		
@@ -300,6 +302,18 @@ func DeleteRepository(id string) error {
 		return errors.New("repository not found")
 	}
 	
+	// Forks borrow objects from this repository, give them their own copies first
+	forks, err := GetRepositoryForks(id)
+	if err != nil {
+		return err
+	}
+	for _, fork := range forks {
+		forkPath := utils.RepositoryDiskPath(fork.Owner.Username, fork.Name)
+		if err := utils.DissociateGitRepository(forkPath); err != nil {
+			return fmt.Errorf("failed to detach fork %s/%s: %w", fork.Owner.Username, fork.Name, err)
+		}
+	}
+	
 	// Delete from database first
 	_, err = config.DB.Exec("DELETE FROM repositories WHERE id = ?", id)
 	if err != nil {
@@ -307,8 +321,50 @@ func DeleteRepository(id string) error {
 	}
 	
 	// Then delete from filesystem
-	repoPath := utils.GetRepositoryPath(repo.OwnerID, repo.Name)
+	repoPath := utils.RepositoryDiskPath(repo.Owner.Username, repo.Name)
 	err = utils.DeleteGitRepository(repoPath)
+	if err != nil {
+		return err
+	}
 	
-	return err
+	// Along with release assets and other files kept outside the Git repository
+	return os.RemoveAll(utils.RepositoryDataPath(repo.Owner.Username, repo.Name))
+}
+
+// InstallRepositoryHooks rewrites the Git hooks of every repository, so repositories created
+// by older versions of the server call back into it as well
+func InstallRepositoryHooks() error {
+	rows, err := config.DB.Query(`
+		SELECT u.username, r.name
+		FROM repositories r
+		JOIN users u ON r.owner_id = u.id
+	`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	paths := []string{}
+	for rows.Next() {
+		var ownerUsername, name string
+		if err := rows.Scan(&ownerUsername, &name); err != nil {
+			return err
+		}
+		paths = append(paths, utils.RepositoryDiskPath(ownerUsername, name))
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, repoPath := range paths {
+		// Repositories missing on disk have nothing to update
+		if _, err := os.Stat(repoPath); os.IsNotExist(err) {
+			continue
+		}
+		if err := utils.CreateRepositoryHooks(repoPath); err != nil {
+			log.Printf("Failed to install Git hooks in %s: %v", repoPath, err)
+		}
+	}
+
+	return nil
 }
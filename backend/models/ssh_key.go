@@ -2,6 +2,7 @@ package models
 
 import (
 	"database/sql"
+	"sync"
 	"time"
 
 	"github-clone/config"
@@ -11,12 +12,14 @@ import (
 
 // SSHKey represents a user's SSH public key
 type SSHKey struct {
-	ID          string    `json:"id"`
-	UserID      string    `json:"user_id"`
-	Name        string    `json:"name"`
-	PublicKey   string    `json:"public_key"`
-	Fingerprint string    `json:"fingerprint"`
-	CreatedAt   time.Time `json:"created_at"`
+	ID          string     `json:"id"`
+	UserID      string     `json:"user_id"`
+	Name        string     `json:"name"`
+	PublicKey   string     `json:"public_key"`
+	Fingerprint string     `json:"fingerprint"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastUsedAt  *time.Time `json:"last_used_at"`
+	LastUsedIP  string     `json:"last_used_ip,omitempty"`
 }
 
 // SSHKeyInput is used for creating SSH keys
@@ -25,6 +28,23 @@ type SSHKeyInput struct {
 	PublicKey string `json:"public_key"`
 }
 
+// sshKeyCacheTTL bounds how long a cached key is trusted, so keys removed
+// without going through DeleteSSHKey (e.g. when a user is deleted) expire as well
+const sshKeyCacheTTL = 5 * time.Minute
+
+type cachedSSHKey struct {
+	key      *SSHKey
+	cachedAt time.Time
+}
+
+// sshKeyCache maps fingerprints to keys for SSH authentication
+var sshKeyCache = struct {
+	sync.RWMutex
+	keys map[string]cachedSSHKey
+}{keys: make(map[string]cachedSSHKey)}
+
+const sshKeyColumns = "id, user_id, name, public_key, fingerprint, created_at, last_used_at, last_used_ip"
+
 // CreateSSHKey adds a new SSH key for a user
 func CreateSSHKey(userID string, input SSHKeyInput, fingerprint string) (*SSHKey, error) {
 	id := uuid.New().String()
@@ -49,12 +69,14 @@ func CreateSSHKey(userID string, input SSHKeyInput, fingerprint string) (*SSHKey
 		return nil, err
 	}
 
+	invalidateSSHKeyCache(fingerprint)
+
 	return sshKey, nil
 }
 
 func GetSSHKeysByUserID(userID string) ([]*SSHKey, error) {
 	rows, err := config.DB.Query(
-		"SELECT id, user_id, name, public_key, fingerprint, created_at FROM ssh_keys WHERE user_id = ?",
+		"SELECT "+sshKeyColumns+" FROM ssh_keys WHERE user_id = ?",
 		userID,
 	)
 
@@ -66,12 +88,11 @@ func GetSSHKeysByUserID(userID string) ([]*SSHKey, error) {
 	keys := []*SSHKey{}
 
 	for rows.Next() {
-		var key SSHKey
-		err := rows.Scan(&key.ID, &key.UserID, &key.Name, &key.PublicKey, &key.Fingerprint, &key.CreatedAt)
+		key, err := scanSSHKey(rows)
 		if err != nil {
 			return nil, err
 		}
-		keys = append(keys, &key)
+		keys = append(keys, key)
 	}
 
 	return keys, nil
@@ -79,7 +100,7 @@ func GetSSHKeysByUserID(userID string) ([]*SSHKey, error) {
 
 func GetAllSSHKeys() ([]*SSHKey, error) {
 	rows, err := config.DB.Query(
-		"SELECT id, user_id, name, public_key, fingerprint, created_at FROM ssh_keys",
+		"SELECT " + sshKeyColumns + " FROM ssh_keys",
 	)
 
 	if err != nil {
@@ -90,24 +111,21 @@ func GetAllSSHKeys() ([]*SSHKey, error) {
 	keys := []*SSHKey{}
 
 	for rows.Next() {
-		var key SSHKey
-		err := rows.Scan(&key.ID, &key.UserID, &key.Name, &key.PublicKey, &key.Fingerprint, &key.CreatedAt)
+		key, err := scanSSHKey(rows)
 		if err != nil {
 			return nil, err
 		}
-		keys = append(keys, &key)
+		keys = append(keys, key)
 	}
 
 	return keys, nil
 }
 
 func GetSSHKeyByID(id string) (*SSHKey, error) {
-	var key SSHKey
-
-	err := config.DB.QueryRow(
-		"SELECT id, user_id, name, public_key, fingerprint, created_at FROM ssh_keys WHERE id = ?",
+	key, err := scanSSHKey(config.DB.QueryRow(
+		"SELECT "+sshKeyColumns+" FROM ssh_keys WHERE id = ?",
 		id,
-	).Scan(&key.ID, &key.UserID, &key.Name, &key.PublicKey, &key.Fingerprint, &key.CreatedAt)
+	))
 
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -117,14 +135,54 @@ func GetSSHKeyByID(id string) (*SSHKey, error) {
 		return nil, err
 	}
 
-	return &key, nil
+	return key, nil
+}
+
+// GetSSHKeyByFingerprint looks up a key by its SHA256 fingerprint using the unique index.
+// Results are cached in memory; CreateSSHKey and DeleteSSHKey invalidate the cache.
+func GetSSHKeyByFingerprint(fingerprint string) (*SSHKey, error) {
+	sshKeyCache.RLock()
+	cached, ok := sshKeyCache.keys[fingerprint]
+	sshKeyCache.RUnlock()
+
+	if ok && time.Since(cached.cachedAt) < sshKeyCacheTTL {
+		return cached.key, nil
+	}
+
+	key, err := scanSSHKey(config.DB.QueryRow(
+		"SELECT "+sshKeyColumns+" FROM ssh_keys WHERE fingerprint = ?",
+		fingerprint,
+	))
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	sshKeyCache.Lock()
+	sshKeyCache.keys[fingerprint] = cachedSSHKey{key: key, cachedAt: time.Now()}
+	sshKeyCache.Unlock()
+
+	return key, nil
+}
+
+// RecordSSHKeyUsage stores when and from which address a key was last used to log in
+func RecordSSHKeyUsage(id, remoteIP string) error {
+	_, err := config.DB.Exec(
+		"UPDATE ssh_keys SET last_used_at = ?, last_used_ip = ? WHERE id = ?",
+		time.Now(), remoteIP, id,
+	)
+	return err
 }
 
 func GetUserBySSHKey(fingerprint string) (*User, error) {
 	var user User
 
 	err := config.DB.QueryRow(`
-		SELECT u.id, u.username, u.email, u.password, u.created_at, u.updated_at 
+		SELECT u.id, u.username, u.email, u.password, u.created_at, u.updated_at
 		FROM users u
 		JOIN ssh_keys s ON u.id = s.user_id
 		WHERE s.fingerprint = ?`,
@@ -142,6 +200,45 @@ func GetUserBySSHKey(fingerprint string) (*User, error) {
 }
 
 func DeleteSSHKey(id string) error {
-	_, err := config.DB.Exec("DELETE FROM ssh_keys WHERE id = ?", id)
-	return err
+	key, err := GetSSHKeyByID(id)
+	if err != nil {
+		return err
+	}
+
+	_, err = config.DB.Exec("DELETE FROM ssh_keys WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	if key != nil {
+		invalidateSSHKeyCache(key.Fingerprint)
+	}
+
+	return nil
+}
+
+// invalidateSSHKeyCache drops a fingerprint from the authentication cache
+func invalidateSSHKeyCache(fingerprint string) {
+	sshKeyCache.Lock()
+	delete(sshKeyCache.keys, fingerprint)
+	sshKeyCache.Unlock()
+}
+
+// scanSSHKey reads an SSH key from a query result
+func scanSSHKey(scanner interface{ Scan(...interface{}) error }) (*SSHKey, error) {
+	var key SSHKey
+	var lastUsedAt sql.NullTime
+	var lastUsedIP sql.NullString
+
+	err := scanner.Scan(&key.ID, &key.UserID, &key.Name, &key.PublicKey, &key.Fingerprint, &key.CreatedAt, &lastUsedAt, &lastUsedIP)
+	if err != nil {
+		return nil, err
+	}
+
+	if lastUsedAt.Valid {
+		key.LastUsedAt = &lastUsedAt.Time
+	}
+	key.LastUsedIP = lastUsedIP.String
+
+	return &key, nil
 }
@@ -0,0 +1,287 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github-clone/config"
+	"github-clone/utils"
+
+	"github.com/google/uuid"
+)
+
+// Team represents a group of organization members that can be granted access to repositories
+type Team struct {
+	ID             string    `json:"id"`
+	OrganizationID string    `json:"organization_id"`
+	Name           string    `json:"name"`
+	Description    string    `json:"description"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// TeamInput is used for creating teams
+type TeamInput struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// TeamRepository represents the access a team has been granted on a repository
+type TeamRepository struct {
+	TeamID       string      `json:"team_id"`
+	RepositoryID string      `json:"repository_id"`
+	Permission   string      `json:"permission"` // 'read', 'write' or 'admin'
+	CreatedAt    time.Time   `json:"created_at"`
+	Repository   *Repository `json:"repository,omitempty"`
+}
+
+// TeamRepositoryInput is used for granting a team access to a repository
+type TeamRepositoryInput struct {
+	Permission string `json:"permission"`
+}
+
+// CreateTeam creates a new team in an organization
+func CreateTeam(orgID string, input TeamInput) (*Team, error) {
+	id := uuid.New().String()
+	now := time.Now()
+
+	team := &Team{
+		ID:             id,
+		OrganizationID: orgID,
+		Name:           input.Name,
+		Description:    input.Description,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+
+	_, err := config.DB.Exec(
+		"INSERT INTO teams (id, organization_id, name, description, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)",
+		team.ID, team.OrganizationID, team.Name, team.Description, team.CreatedAt, team.UpdatedAt,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return team, nil
+}
+
+// GetTeamByName retrieves a team of an organization by name
+func GetTeamByName(orgID, name string) (*Team, error) {
+	var team Team
+	var description sql.NullString
+
+	err := config.DB.QueryRow(
+		"SELECT id, organization_id, name, description, created_at, updated_at FROM teams WHERE organization_id = ? AND name = ?",
+		orgID, name,
+	).Scan(&team.ID, &team.OrganizationID, &team.Name, &description, &team.CreatedAt, &team.UpdatedAt)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	team.Description = description.String
+
+	return &team, nil
+}
+
+// GetOrganizationTeams retrieves all teams of an organization
+func GetOrganizationTeams(orgID string) ([]*Team, error) {
+	rows, err := config.DB.Query(
+		"SELECT id, organization_id, name, description, created_at, updated_at FROM teams WHERE organization_id = ? ORDER BY name ASC",
+		orgID,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	teams := []*Team{}
+
+	for rows.Next() {
+		var team Team
+		var description sql.NullString
+
+		err := rows.Scan(&team.ID, &team.OrganizationID, &team.Name, &description, &team.CreatedAt, &team.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		team.Description = description.String
+		teams = append(teams, &team)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return teams, nil
+}
+
+// DeleteTeam removes a team along with its memberships and repository grants. They are
+// deleted explicitly rather than left to the foreign key cascades, since permissions are
+// computed from them without looking at the teams table.
+func DeleteTeam(id string) error {
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.Exec("DELETE FROM team_members WHERE team_id = ?", id); err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec("DELETE FROM team_repositories WHERE team_id = ?", id); err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec("DELETE FROM teams WHERE id = ?", id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// AddTeamMember adds a user to a team
+func AddTeamMember(teamID, userID string) error {
+	_, err := config.DB.Exec(`
+		INSERT INTO team_members (team_id, user_id, created_at)
+		VALUES (?, ?, ?)
+		ON CONFLICT(team_id, user_id) DO NOTHING
+	`, teamID, userID, time.Now())
+
+	return err
+}
+
+// RemoveTeamMember removes a user from a team
+func RemoveTeamMember(teamID, userID string) error {
+	result, err := config.DB.Exec("DELETE FROM team_members WHERE team_id = ? AND user_id = ?", teamID, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return errors.New("team member not found")
+	}
+
+	return nil
+}
+
+// GetTeamMembers retrieves all members of a team
+func GetTeamMembers(teamID string) ([]*UserResponse, error) {
+	rows, err := config.DB.Query(`
+		SELECT u.id, u.username, u.email, u.created_at
+		FROM team_members tm
+		JOIN users u ON tm.user_id = u.id
+		WHERE tm.team_id = ?
+		ORDER BY u.username ASC
+	`, teamID)
+
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []*UserResponse{}
+
+	for rows.Next() {
+		var user UserResponse
+		if err := rows.Scan(&user.ID, &user.Username, &user.Email, &user.CreatedAt); err != nil {
+			return nil, err
+		}
+		members = append(members, &user)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return members, nil
+}
+
+// SetTeamRepository grants a team access to a repository, updating the permission if already granted
+func SetTeamRepository(teamID, repoID string, input TeamRepositoryInput) error {
+	if !utils.IsValidPermission(input.Permission) {
+		return errors.New("permission must be one of 'read', 'write' or 'admin'")
+	}
+
+	_, err := config.DB.Exec(`
+		INSERT INTO team_repositories (team_id, repository_id, permission, created_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(team_id, repository_id) DO UPDATE SET permission = excluded.permission
+	`, teamID, repoID, input.Permission, time.Now())
+
+	return err
+}
+
+// RemoveTeamRepository revokes a team's access to a repository
+func RemoveTeamRepository(teamID, repoID string) error {
+	result, err := config.DB.Exec("DELETE FROM team_repositories WHERE team_id = ? AND repository_id = ?", teamID, repoID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return errors.New("team does not have access to this repository")
+	}
+
+	return nil
+}
+
+// GetTeamRepositories retrieves all repositories a team has been granted access to
+func GetTeamRepositories(teamID string) ([]*TeamRepository, error) {
+	rows, err := config.DB.Query(`
+		SELECT tr.team_id, tr.repository_id, tr.permission, tr.created_at,
+		       r.id, r.name, r.description, r.owner_id, r.is_public, r.created_at, r.updated_at
+		FROM team_repositories tr
+		JOIN repositories r ON tr.repository_id = r.id
+		WHERE tr.team_id = ?
+		ORDER BY r.name ASC
+	`, teamID)
+
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	grants := []*TeamRepository{}
+
+	for rows.Next() {
+		var grant TeamRepository
+		var repo Repository
+
+		err := rows.Scan(
+			&grant.TeamID, &grant.RepositoryID, &grant.Permission, &grant.CreatedAt,
+			&repo.ID, &repo.Name, &repo.Description, &repo.OwnerID, &repo.IsPublic, &repo.CreatedAt, &repo.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		grant.Repository = &repo
+		grants = append(grants, &grant)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return grants, nil
+}
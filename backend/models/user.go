@@ -9,16 +9,30 @@ import (
 	"github.com/google/uuid"
 )
 
+// Account types stored in the users table
+const (
+	UserTypeUser         = "user"
+	UserTypeOrganization = "organization"
+)
+
 // User represents a user in the system
+// Organizations are stored as users with Type set to UserTypeOrganization so
+// they share the username namespace and can own repositories
 type User struct {
 	ID        string    `json:"id"`
 	Username  string    `json:"username"`
 	Email     string    `json:"email"`
 	Password  string    `json:"-"` // Password is not sent in JSON responses
+	Type      string    `json:"type,omitempty"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
+// IsOrganization reports whether this account is an organization
+func (u *User) IsOrganization() bool {
+	return u.Type == UserTypeOrganization
+}
+
 // UserResponse is the user data returned to clients (excludes sensitive data)
 type UserResponse struct {
 	ID        string    `json:"id"`
@@ -49,14 +63,15 @@ func CreateUser(username, email, password string) (*User, error) {
 		Username:  username,
 		Email:     email,
 		Password:  password, // Note: This should be pre-hashed
+		Type:      UserTypeUser,
 		CreatedAt: now,
 		UpdatedAt: now,
 	}
 	
 	// Insert the user into the database
 	_, err := config.DB.Exec(
-		"INSERT INTO users (id, username, email, password, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6)",
-		user.ID, user.Username, user.Email, user.Password, user.CreatedAt, user.UpdatedAt,
+		"INSERT INTO users (id, username, email, password, type, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7)",
+		user.ID, user.Username, user.Email, user.Password, user.Type, user.CreatedAt, user.UpdatedAt,
 	)
 	
 	if err != nil {
@@ -71,9 +86,9 @@ func GetUserByEmail(email string) (*User, error) {
 	var user User
 	
 	err := config.DB.QueryRow(
-		"SELECT id, username, email, password, created_at, updated_at FROM users WHERE email = $1",
+		"SELECT id, username, email, password, type, created_at, updated_at FROM users WHERE email = $1",
 		email,
-	).Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.CreatedAt, &user.UpdatedAt)
+	).Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.Type, &user.CreatedAt, &user.UpdatedAt)
 	
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -91,9 +106,9 @@ func GetUserByUsername(username string) (*User, error) {
 	var user User
 	
 	err := config.DB.QueryRow(
-		"SELECT id, username, email, password, created_at, updated_at FROM users WHERE username = $1",
+		"SELECT id, username, email, password, type, created_at, updated_at FROM users WHERE username = $1",
 		username,
-	).Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.CreatedAt, &user.UpdatedAt)
+	).Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.Type, &user.CreatedAt, &user.UpdatedAt)
 	
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -111,9 +126,9 @@ func GetUserByID(id string) (*User, error) {
 	var user User
 	
 	err := config.DB.QueryRow(
-		"SELECT id, username, email, password, created_at, updated_at FROM users WHERE id = $1",
+		"SELECT id, username, email, password, type, created_at, updated_at FROM users WHERE id = $1",
 		id,
-	).Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.CreatedAt, &user.UpdatedAt)
+	).Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.Type, &user.CreatedAt, &user.UpdatedAt)
 	
 	if err == sql.ErrNoRows {
 		return nil, nil
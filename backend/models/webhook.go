@@ -0,0 +1,360 @@
+package models
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github-clone/config"
+
+	"github.com/google/uuid"
+)
+
+// Webhook events
+const (
+	WebhookEventPush       = "push"
+	WebhookEventIssues     = "issues"
+	WebhookEventIssueVote  = "issue_vote"
+	WebhookEventRepository = "repository"
+	WebhookEventPing       = "ping"
+	WebhookEventAll        = "*"
+)
+
+// WebhookEvents lists the events a webhook can subscribe to
+var WebhookEvents = []string{WebhookEventPush, WebhookEventIssues, WebhookEventIssueVote, WebhookEventRepository}
+
+// Webhook delivery states
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// Webhook sends a request to a URL when subscribed events happen in a repository
+type Webhook struct {
+	ID           string    `json:"id"`
+	RepositoryID string    `json:"repository_id"`
+	URL          string    `json:"url"`
+	Secret       string    `json:"-"`
+	HasSecret    bool      `json:"has_secret"`
+	Events       []string  `json:"events"`
+	Active       bool      `json:"active"`
+	CreatedBy    string    `json:"created_by,omitempty"` // ID of the user who created it
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// WebhookInput is used for creating or updating webhooks. Only set fields are changed on update.
+type WebhookInput struct {
+	URL    *string  `json:"url"`
+	Secret *string  `json:"secret"`
+	Events []string `json:"events"`
+	Active *bool    `json:"active"`
+}
+
+// WebhookDelivery is a single request sent, or waiting to be sent, for a webhook
+type WebhookDelivery struct {
+	ID             string     `json:"id"`
+	WebhookID      string     `json:"webhook_id,omitempty"`
+	Event          string     `json:"event"`
+	URL            string     `json:"url"`
+	Payload        string     `json:"payload,omitempty"`
+	Signature      string     `json:"-"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  *time.Time `json:"next_attempt_at,omitempty"`
+	LastAttemptAt  *time.Time `json:"last_attempt_at,omitempty"`
+	ResponseStatus int        `json:"response_status,omitempty"`
+	ResponseBody   string     `json:"response_body,omitempty"`
+	Error          string     `json:"error,omitempty"`
+	DurationMs     int64      `json:"duration_ms,omitempty"`
+	RedeliveryOf   string     `json:"redelivery_of,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// IsValidWebhookEvent reports whether a webhook can subscribe to an event
+func IsValidWebhookEvent(event string) bool {
+	if event == WebhookEventAll {
+		return true
+	}
+	for _, e := range WebhookEvents {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Subscribes reports whether the webhook should be notified about an event
+func (h *Webhook) Subscribes(event string) bool {
+	if event == WebhookEventPing {
+		return true
+	}
+	for _, e := range h.Events {
+		if e == event || e == WebhookEventAll {
+			return true
+		}
+	}
+	return false
+}
+
+const webhookColumns = "id, repository_id, url, secret, events, active, created_by, created_at, updated_at"
+
+// CreateWebhook creates a webhook for a repository
+func CreateWebhook(repositoryID, createdBy, url, secret string, events []string, active bool) (*Webhook, error) {
+	now := time.Now()
+	hook := &Webhook{
+		ID:           uuid.New().String(),
+		RepositoryID: repositoryID,
+		URL:          url,
+		Secret:       secret,
+		HasSecret:    secret != "",
+		Events:       events,
+		Active:       active,
+		CreatedBy:    createdBy,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+
+	_, err := config.DB.Exec(
+		"INSERT INTO webhooks ("+webhookColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		hook.ID, hook.RepositoryID, hook.URL, hook.Secret, strings.Join(hook.Events, ","), hook.Active,
+		nullString(hook.CreatedBy), hook.CreatedAt, hook.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return hook, nil
+}
+
+// GetWebhookByID retrieves a webhook by ID
+func GetWebhookByID(id string) (*Webhook, error) {
+	hook, err := scanWebhook(config.DB.QueryRow("SELECT "+webhookColumns+" FROM webhooks WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return hook, nil
+}
+
+// GetRepositoryWebhooks retrieves all webhooks of a repository
+func GetRepositoryWebhooks(repositoryID string) ([]*Webhook, error) {
+	rows, err := config.DB.Query(
+		"SELECT "+webhookColumns+" FROM webhooks WHERE repository_id = ? ORDER BY created_at ASC",
+		repositoryID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hooks := []*Webhook{}
+	for rows.Next() {
+		hook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, hook)
+	}
+
+	return hooks, rows.Err()
+}
+
+// UpdateWebhook saves the URL, secret, events and active flag of a webhook
+func UpdateWebhook(hook *Webhook) error {
+	hook.UpdatedAt = time.Now()
+	hook.HasSecret = hook.Secret != ""
+
+	_, err := config.DB.Exec(
+		"UPDATE webhooks SET url = ?, secret = ?, events = ?, active = ?, updated_at = ? WHERE id = ?",
+		hook.URL, hook.Secret, strings.Join(hook.Events, ","), hook.Active, hook.UpdatedAt, hook.ID,
+	)
+	return err
+}
+
+// DeleteWebhook deletes a webhook together with its delivery history and pending deliveries
+func DeleteWebhook(id string) error {
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM webhook_deliveries WHERE webhook_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM webhooks WHERE id = ?", id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// scanWebhook reads a webhook from a query result
+func scanWebhook(scanner interface{ Scan(...interface{}) error }) (*Webhook, error) {
+	var hook Webhook
+	var secret, createdBy sql.NullString
+	var events string
+
+	err := scanner.Scan(&hook.ID, &hook.RepositoryID, &hook.URL, &secret, &events, &hook.Active, &createdBy,
+		&hook.CreatedAt, &hook.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	hook.Secret = secret.String
+	hook.HasSecret = hook.Secret != ""
+	hook.CreatedBy = createdBy.String
+	hook.Events = []string{}
+	if events != "" {
+		hook.Events = strings.Split(events, ",")
+	}
+
+	return &hook, nil
+}
+
+const webhookDeliveryColumns = `id, webhook_id, event, url, payload, signature, status, attempts, next_attempt_at,
+	last_attempt_at, response_status, response_body, error, duration_ms, redelivery_of, created_at`
+
+// CreateWebhookDelivery queues a delivery to be sent as soon as possible.
+// Due times are kept in UTC so they compare correctly in the database.
+func CreateWebhookDelivery(webhookID, event, url, payload, signature, redeliveryOf string) (*WebhookDelivery, error) {
+	now := time.Now().UTC()
+	delivery := &WebhookDelivery{
+		ID:            uuid.New().String(),
+		WebhookID:     webhookID,
+		Event:         event,
+		URL:           url,
+		Payload:       payload,
+		Signature:     signature,
+		Status:        DeliveryPending,
+		NextAttemptAt: &now,
+		RedeliveryOf:  redeliveryOf,
+		CreatedAt:     now,
+	}
+
+	_, err := config.DB.Exec(`
+		INSERT INTO webhook_deliveries (id, webhook_id, event, url, payload, signature, status, attempts,
+			next_attempt_at, redelivery_of, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, 0, ?, ?, ?)
+	`, delivery.ID, nullString(delivery.WebhookID), delivery.Event, delivery.URL, delivery.Payload,
+		nullString(delivery.Signature), delivery.Status, delivery.NextAttemptAt, nullString(delivery.RedeliveryOf),
+		delivery.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return delivery, nil
+}
+
+// GetWebhookDelivery retrieves a delivery by ID
+func GetWebhookDelivery(id string) (*WebhookDelivery, error) {
+	delivery, err := scanWebhookDelivery(config.DB.QueryRow(
+		"SELECT "+webhookDeliveryColumns+" FROM webhook_deliveries WHERE id = ?",
+		id,
+	))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return delivery, nil
+}
+
+// GetWebhookDeliveries retrieves the deliveries of a webhook, newest first, without their
+// payloads and response bodies
+func GetWebhookDeliveries(webhookID string, limit, offset int) ([]*WebhookDelivery, error) {
+	rows, err := config.DB.Query(
+		"SELECT "+webhookDeliveryColumns+" FROM webhook_deliveries WHERE webhook_id = ? ORDER BY created_at DESC LIMIT ? OFFSET ?",
+		webhookID, limit, offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []*WebhookDelivery{}
+	for rows.Next() {
+		delivery, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		delivery.Payload = ""
+		delivery.ResponseBody = ""
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, rows.Err()
+}
+
+// GetDueWebhookDeliveries retrieves pending deliveries whose next attempt is due, oldest first
+func GetDueWebhookDeliveries(now time.Time, limit int) ([]*WebhookDelivery, error) {
+	rows, err := config.DB.Query(
+		"SELECT "+webhookDeliveryColumns+" FROM webhook_deliveries WHERE status = ? AND next_attempt_at <= ? ORDER BY next_attempt_at ASC LIMIT ?",
+		DeliveryPending, now, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []*WebhookDelivery{}
+	for rows.Next() {
+		delivery, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, rows.Err()
+}
+
+// RecordWebhookDeliveryAttempt saves the outcome of an attempt to send a delivery
+func RecordWebhookDeliveryAttempt(delivery *WebhookDelivery) error {
+	_, err := config.DB.Exec(`
+		UPDATE webhook_deliveries
+		SET status = ?, attempts = ?, next_attempt_at = ?, last_attempt_at = ?, response_status = ?,
+			response_body = ?, error = ?, duration_ms = ?
+		WHERE id = ?
+	`, delivery.Status, delivery.Attempts, delivery.NextAttemptAt, delivery.LastAttemptAt, delivery.ResponseStatus,
+		delivery.ResponseBody, delivery.Error, delivery.DurationMs, delivery.ID)
+	return err
+}
+
+// scanWebhookDelivery reads a delivery from a query result
+func scanWebhookDelivery(scanner interface{ Scan(...interface{}) error }) (*WebhookDelivery, error) {
+	var delivery WebhookDelivery
+	var webhookID, signature, responseBody, errorText, redeliveryOf sql.NullString
+	var nextAttemptAt, lastAttemptAt sql.NullTime
+	var responseStatus, durationMs sql.NullInt64
+
+	err := scanner.Scan(
+		&delivery.ID, &webhookID, &delivery.Event, &delivery.URL, &delivery.Payload, &signature, &delivery.Status,
+		&delivery.Attempts, &nextAttemptAt, &lastAttemptAt, &responseStatus, &responseBody, &errorText, &durationMs,
+		&redeliveryOf, &delivery.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	delivery.WebhookID = webhookID.String
+	delivery.Signature = signature.String
+	delivery.ResponseStatus = int(responseStatus.Int64)
+	delivery.ResponseBody = responseBody.String
+	delivery.Error = errorText.String
+	delivery.DurationMs = durationMs.Int64
+	delivery.RedeliveryOf = redeliveryOf.String
+	if nextAttemptAt.Valid {
+		delivery.NextAttemptAt = &nextAttemptAt.Time
+	}
+	if lastAttemptAt.Valid {
+		delivery.LastAttemptAt = &lastAttemptAt.Time
+	}
+
+	return &delivery, nil
+}
@@ -1,6 +1,7 @@
 package ssh
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"log"
@@ -12,7 +13,9 @@ import (
 	"sync"
 	"time"
 
+	"github-clone/githook"
 	"github-clone/models"
+	"github-clone/utils"
 
 	"golang.org/x/crypto/ssh"
 )
@@ -105,8 +108,25 @@ func (s *Server) handleConnection(conn net.Conn) {
 	timeoutConn.SetDeadline(time.Time{})
 
 	log.Printf("SSH connection from %s (%s)", sshConn.RemoteAddr(), sshConn.ClientVersion())
+
+	// Record the key usage now that the client has proven it holds the private key.
+	// authPublicKey also runs for keys that are only offered, so it is not recorded there.
+	remoteIP, _, _ := net.SplitHostPort(sshConn.RemoteAddr().String())
+	if keyID := sshConn.Permissions.Extensions["key_id"]; keyID != "" {
+		if err := models.RecordSSHKeyUsage(keyID, remoteIP); err != nil {
+			log.Printf("Failed to record usage of SSH key %s: %v", keyID, err)
+		}
+	} else if keyID := sshConn.Permissions.Extensions["deploy_key_id"]; keyID != "" {
+		if err := models.RecordDeployKeyUsage(keyID, remoteIP); err != nil {
+			log.Printf("Failed to record usage of deploy key %s: %v", keyID, err)
+		}
+	}
 	defer log.Printf("SSH connection closed from %s", sshConn.RemoteAddr())
 
+	// Git commands run for this connection are stopped when it closes
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
 	// Discard all global requests
 	go ssh.DiscardRequests(reqs)
 
@@ -123,23 +143,63 @@ func (s *Server) handleConnection(conn net.Conn) {
 			continue
 		}
 
-		// Get username from connection
-		username := sshConn.Permissions.Extensions["username"]
+		// Get the authenticated identity from the connection
+		identity := identityFromPermissions(sshConn.Permissions)
 
 		// Handle channel requests (exec, shell, etc.)
-		go s.handleChannelRequests(channel, requests, username)
+		go s.handleChannelRequests(ctx, channel, requests, identity)
+	}
+}
+
+// sshIdentity describes who authenticated an SSH connection: either a user,
+// or a deploy key that is limited to a single repository
+type sshIdentity struct {
+	UserID   string
+	Username string
+
+	DeployKeyID  string
+	RepositoryID string
+	ReadOnly     bool
+}
+
+// identityFromPermissions reads the identity stored by authPublicKey
+func identityFromPermissions(perms *ssh.Permissions) sshIdentity {
+	if perms == nil {
+		return sshIdentity{}
+	}
+	return sshIdentity{
+		UserID:       perms.Extensions["user_id"],
+		Username:     perms.Extensions["username"],
+		DeployKeyID:  perms.Extensions["deploy_key_id"],
+		RepositoryID: perms.Extensions["repository_id"],
+		ReadOnly:     perms.Extensions["read_only"] == "true",
 	}
 }
 
 // handleChannelRequests processes requests on an SSH channel
-func (s *Server) handleChannelRequests(channel ssh.Channel, requests <-chan *ssh.Request, username string) {
+func (s *Server) handleChannelRequests(ctx context.Context, channel ssh.Channel, requests <-chan *ssh.Request, identity sshIdentity) {
 	defer channel.Close()
 
+	// Protocol version requested by the client in an "env" request sent before the command
+	gitProtocol := ""
+
 	for req := range requests {
 		switch req.Type {
+		case "env":
+			// Git clients ask for protocol v2 through GIT_PROTOCOL. Other variables are refused,
+			// as they could change how Git runs on the server.
+			var payload struct{ Name, Value string }
+			accepted := ssh.Unmarshal(req.Payload, &payload) == nil &&
+				payload.Name == "GIT_PROTOCOL" && utils.IsValidGitProtocol(payload.Value)
+			if accepted {
+				gitProtocol = payload.Value
+			}
+			if req.WantReply {
+				req.Reply(accepted, nil)
+			}
 		case "exec":
 			// Handle exec request (Git command)
-			s.handleExecRequest(channel, req, username)
+			s.handleExecRequest(ctx, channel, req, identity, gitProtocol)
 			return
 		default:
 			if req.WantReply {
@@ -150,143 +210,111 @@ func (s *Server) handleChannelRequests(channel ssh.Channel, requests <-chan *ssh
 }
 
 // handleExecRequest processes an exec request (Git command)
-func (s *Server) handleExecRequest(channel ssh.Channel, req *ssh.Request, username string) {
+func (s *Server) handleExecRequest(ctx context.Context, channel ssh.Channel, req *ssh.Request, identity sshIdentity, gitProtocol string) {
 	// Acknowledge the request
 	if req.WantReply {
 		req.Reply(true, nil)
 	}
 
 	// Parse the command
-	command := string(req.Payload[4:]) // Skip the 4-byte length prefix
-	log.Printf("Exec request from %s: %s", username, command)
+	var payload struct{ Command string }
+	if err := ssh.Unmarshal(req.Payload, &payload); err != nil {
+		fmt.Fprintf(channel.Stderr(), "Invalid exec request\n")
+		channel.SendRequest("exit-status", false, []byte{0, 0, 0, 1})
+		return
+	}
+	command := payload.Command
+	log.Printf("Exec request from %s: %s", identity.Username, command)
 
 	// Handle Git commands
 	if strings.HasPrefix(command, "git-") || strings.HasPrefix(command, "git ") {
-		s.handleGitCommand(channel, command, username)
+		s.handleGitCommand(ctx, channel, command, identity, gitProtocol)
 	} else {
 		fmt.Fprintf(channel.Stderr(), "Unsupported command: %s\n", command)
 		channel.SendRequest("exit-status", false, []byte{0, 0, 0, 1})
 	}
 }
 
-// handleGitCommand executes a Git command (upload-pack or receive-pack)
-func (s *Server) handleGitCommand(channel ssh.Channel, command string, username string) {
-	log.Printf("Git command from %s: %s", username, command)
-
-	// Parse the command to extract the repository path
-	var repoPath string
-	var gitCommand string
-
-	if strings.HasPrefix(command, "git-upload-pack") {
-		parts := strings.SplitN(command, "'", 3)
-		if len(parts) >= 2 {
-			repoPath = strings.Trim(parts[1], "'")
-			gitCommand = "git-upload-pack"
-		}
-	} else if strings.HasPrefix(command, "git-receive-pack") {
-		parts := strings.SplitN(command, "'", 3)
-		if len(parts) >= 2 {
-			repoPath = strings.Trim(parts[1], "'")
-			gitCommand = "git-receive-pack"
-		}
-	} else if strings.HasPrefix(command, "git ") {
-		// Handle 'git' commands
-		parts := strings.Fields(command)
-		if len(parts) >= 3 {
-			gitCommand = parts[1]
-			repoPath = parts[2]
-		}
-	}
+// handleGitCommand executes a Git command (upload-pack or receive-pack). gitProtocol is the
+// GIT_PROTOCOL value sent by the client, if any. Git is stopped when ctx is done, when the
+// client stops reading, or when GitTransportTimeout has passed.
+func (s *Server) handleGitCommand(ctx context.Context, channel ssh.Channel, command string, identity sshIdentity, gitProtocol string) {
+	log.Printf("Git command from %s: %s", identity.Username, command)
 
-	if repoPath == "" || gitCommand == "" {
-		fmt.Fprintf(channel.Stderr(), "Invalid Git command format\n")
+	gitCommand, repoOwner, repoName, err := parseGitCommand(command)
+	if err != nil {
+		fmt.Fprintf(channel.Stderr(), "%v\n", err)
 		channel.SendRequest("exit-status", false, []byte{0, 0, 0, 1})
 		return
 	}
 
-	// Clean up the repository path
-	repoPath = strings.TrimPrefix(repoPath, "/")
+	log.Printf("Looking for repository: %s/%s", repoOwner, repoName)
 
-	// Map the repository path to the actual filesystem path
-	// Format: username/reponame
-	parts := strings.SplitN(repoPath, "/", 2)
-	if len(parts) != 2 {
-		fmt.Fprintf(channel.Stderr(), "Invalid repository path: %s\n", repoPath)
+	// Only repositories known to the database are served, and their location on disk is
+	// built from the stored owner and name rather than from the client's path
+	repo, err := models.GetRepositoryByUsernameAndName(repoOwner, repoName)
+	if err != nil {
+		log.Printf("Error retrieving repository information: %v", err)
+		fmt.Fprintf(channel.Stderr(), "Server error\n")
 		channel.SendRequest("exit-status", false, []byte{0, 0, 0, 1})
 		return
 	}
 
-	repoOwner := parts[0]
-	repoName := parts[1]
-
-	// Get the base repository path
-	baseRepoPath := os.Getenv("REPOSITORIES_PATH")
-	if baseRepoPath == "" {
-		// Default to a subdirectory in the current working directory
-		dir, _ := os.Getwd()
-		baseRepoPath = filepath.Join(dir, "repositories")
+	// Repositories the user cannot see are reported as missing
+	if repo == nil || repo.Owner == nil || !canReadRepository(identity, repo) {
+		fmt.Fprintf(channel.Stderr(), "Repository not found: %s/%s\n", repoOwner, repoName)
+		channel.SendRequest("exit-status", false, []byte{0, 0, 0, 1})
+		return
 	}
 
-	log.Printf("Looking for repository: %s/%s", repoOwner, repoName)
-	
-	// Format Git repository path - username/repo.git
-	gitRepoName := repoName
-	if !strings.HasSuffix(gitRepoName, ".git") {
-		gitRepoName += ".git"
+	if gitCommand == "git-receive-pack" && !canWriteRepository(identity, repo) {
+		log.Printf("User %s (ID: %s) DENIED push to repo %s/%s", identity.Username, identity.UserID, repoOwner, repoName)
+		fmt.Fprintf(channel.Stderr(), "You don't have write access to this repository\n")
+		channel.SendRequest("exit-status", false, []byte{0, 0, 0, 1})
+		return
 	}
-	
-	// Construct the full filesystem path to the repository
-	fsRepoPath := filepath.Join(baseRepoPath, repoOwner, gitRepoName)
-	
-	// Check if the repository exists
+
+	fsRepoPath := utils.RepositoryDiskPath(repo.Owner.Username, repo.Name)
+
+	// Check if the repository exists on disk
 	if _, err := os.Stat(fsRepoPath); os.IsNotExist(err) {
-		// Repository doesn't exist
+		log.Printf("Repository %s/%s is in the database but missing at %s", repoOwner, repoName, fsRepoPath)
 		fmt.Fprintf(channel.Stderr(), "Repository not found: %s/%s\n", repoOwner, repoName)
 		channel.SendRequest("exit-status", false, []byte{0, 0, 0, 1})
 		return
 	}
-	
+
 	log.Printf("Found repository at: %s", fsRepoPath)
-	
-	// Check repository visibility permissions
-	// Get repository information from the database
-	repo, err := models.GetRepositoryByUsernameAndName(repoOwner, strings.TrimSuffix(repoName, ".git"))
-	if err != nil {
-		log.Printf("Error retrieving repository information: %v", err)
-		// Continue with filesystem check only
-	} else if repo != nil {
-		// Check if this is a private repository that requires specific access
-		if !repo.IsPublic {
-			// Extract user ID from the SSH connection permissions
-			userIDFromSSH := "" // Default to no user
-			
-			// For git-upload-pack (read/clone), only owners can access private repos
-			if gitCommand == "git-upload-pack" && repo.OwnerID != userIDFromSSH {
-				fmt.Fprintf(channel.Stderr(), "You don't have access to this private repository\n")
-				channel.SendRequest("exit-status", false, []byte{0, 0, 0, 1})
-				return
-			}
-			
-			// For git-receive-pack (write/push), only owners can push
-			if gitCommand == "git-receive-pack" && repo.OwnerID != userIDFromSSH {
-				fmt.Fprintf(channel.Stderr(), "You don't have write access to this repository\n")
-				channel.SendRequest("exit-status", false, []byte{0, 0, 0, 1})
-				return
-			}
-		}
-	}
 
 	// Execute the Git command
 	log.Printf("Executing %s on %s", gitCommand, fsRepoPath)
 
-	// Create the command
-	cmd := exec.Command(gitCommand, fsRepoPath)
+	// Create the command, run through git so it gets the serving configuration
+	ctx, cancel := utils.WithGitTimeout(ctx, utils.GitTransportTimeout())
+	defer cancel()
+	cmd := utils.GitCommand(ctx, utils.GitServeArgs(strings.TrimPrefix(gitCommand, "git-"), fsRepoPath)...)
+	gitOperation := gitCommand + " of " + repoOwner + "/" + repoName + " for " + identity.Username
+	cmd.Env = os.Environ()
+	if gitProtocol != "" {
+		cmd.Env = append(cmd.Env, "GIT_PROTOCOL="+gitProtocol)
+	}
 
 	// Set up pipes for stdin, stdout, stderr
 	stdin, _ := cmd.StdinPipe()
 	stdout, _ := cmd.StdoutPipe()
 	stderr, _ := cmd.StderrPipe()
 
+	// The repository's hooks call back into the server on behalf of the pusher
+	if gitCommand == "git-receive-pack" {
+		cmd.Env = append(cmd.Env, githook.Environ(githook.Pusher{
+			RepositoryID: repo.ID,
+			UserID:       identity.UserID,
+			Username:     identity.Username,
+			DeployKeyID:  identity.DeployKeyID,
+			Protocol:     "ssh",
+		})...)
+	}
+
 	// Start the command
 	if err := cmd.Start(); err != nil {
 		log.Printf("Failed to start Git command: %v", err)
@@ -298,20 +326,23 @@ func (s *Server) handleGitCommand(channel ssh.Channel, command string, username
 	// Set up a wait group to coordinate goroutines
 	var wg sync.WaitGroup
 	
-	// Copy data between SSH channel and command pipes
-	wg.Add(3)
+	// Copy data between SSH channel and command pipes. Only the output is waited for: a
+	// client that keeps its side open must not keep the command from finishing.
+	wg.Add(2)
 	
 	// Handle stdin copying
 	go func() {
-		defer wg.Done()
 		io.Copy(stdin, channel)
 		stdin.Close()
 	}()
 
-	// Handle stdout copying
+	// Handle stdout copying. If the client stops reading, git is stopped rather than left
+	// blocked on a full pipe.
 	go func() {
 		defer wg.Done()
-		io.Copy(channel, stdout)
+		if _, err := io.Copy(channel, stdout); err != nil {
+			cancel()
+		}
 	}()
 	
 	// Handle stderr copying
@@ -320,20 +351,74 @@ func (s *Server) handleGitCommand(channel ssh.Channel, command string, username
 		io.Copy(channel.Stderr(), stderr)
 	}()
 
-	// Wait for all I/O to complete
+	// Wait for all output to be sent
 	wg.Wait()
 	
 	// Wait for the command to complete
 	if err := cmd.Wait(); err != nil {
-		log.Printf("Git command error: %v", err)
+		if !utils.LogGitAborted(ctx, gitOperation) {
+			log.Printf("Git command error: %v", err)
+		}
 		// Send exit status 1 to indicate error
 		channel.SendRequest("exit-status", false, []byte{0, 0, 0, 1})
 	} else {
-		// Send exit status 0 to indicate success
 		channel.SendRequest("exit-status", false, []byte{0, 0, 0, 0})
 	}
 }
 
+// parseGitCommand validates an exec command sent by a Git client and returns the Git service
+// together with the owner and name of the requested repository.
+// Clients send e.g. git-upload-pack '/owner/repo.git' or git upload-pack 'owner/repo'.
+func parseGitCommand(command string) (string, string, string, error) {
+	command = strings.TrimSpace(command)
+
+	var service, argument string
+	if strings.HasPrefix(command, "git ") {
+		rest := strings.TrimSpace(strings.TrimPrefix(command, "git "))
+		verb, arg, _ := strings.Cut(rest, " ")
+		service, argument = "git-"+verb, arg
+	} else {
+		verb, arg, _ := strings.Cut(command, " ")
+		service, argument = verb, arg
+	}
+
+	// Only the two services needed for fetching and pushing are allowed
+	if service != "git-upload-pack" && service != "git-receive-pack" {
+		return "", "", "", fmt.Errorf("Unsupported Git command: %s", service)
+	}
+
+	argument = strings.TrimSpace(argument)
+	if len(argument) >= 2 && (argument[0] == '\'' || argument[0] == '"') && argument[len(argument)-1] == argument[0] {
+		argument = argument[1 : len(argument)-1]
+	}
+
+	// Format: username/reponame, optionally with a leading slash and a .git suffix
+	repoPath := strings.TrimSuffix(strings.TrimPrefix(argument, "/"), ".git")
+	parts := strings.Split(repoPath, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", "", fmt.Errorf("Invalid repository path: %s", argument)
+	}
+
+	return service, parts[0], parts[1], nil
+}
+
+// canReadRepository decides whether an SSH identity may fetch from a repository
+func canReadRepository(identity sshIdentity, repo *models.Repository) bool {
+	// Deploy keys only reach the repository they belong to
+	if identity.DeployKeyID != "" {
+		return identity.RepositoryID == repo.ID
+	}
+	return utils.NewRepoAccess().CanCloneRepository(repo.ID, repo.OwnerID, repo.IsPublic, identity.UserID)
+}
+
+// canWriteRepository decides whether an SSH identity may push to a repository
+func canWriteRepository(identity sshIdentity, repo *models.Repository) bool {
+	if identity.DeployKeyID != "" {
+		return identity.RepositoryID == repo.ID && !identity.ReadOnly
+	}
+	return utils.NewRepoAccess().CanPushToRepository(repo.ID, repo.OwnerID, identity.UserID)
+}
+
 // authPublicKey authenticates a user by their public SSH key
 func (s *Server) authPublicKey(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
 	// Generate fingerprint for the key
@@ -342,60 +427,59 @@ func (s *Server) authPublicKey(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.P
 	log.Printf("SSH AUTH: Key offered - User=%s, Type=%s, Fingerprint=%s",
 		conn.User(), keyType, fingerprint)
 
-	// Match keys by directly comparing fingerprints
-	keys, err := models.GetAllSSHKeys()
+	// Resolve the key with a single indexed lookup on its fingerprint
+	k, err := models.GetSSHKeyByFingerprint(fingerprint)
 	if err != nil {
 		log.Printf("SSH AUTH ERROR: Database query failed: %v", err)
 		return nil, fmt.Errorf("server error")
 	}
 
-	log.Printf("SSH AUTH: Checking %d keys in database", len(keys))
-	
-	// If no keys in database, fail early
-	if len(keys) == 0 {
-		log.Printf("SSH AUTH FAILED: No keys in database. Add a key through the web interface.")
-		return nil, fmt.Errorf("no keys in database")
+	if k == nil {
+		return s.authDeployKey(fingerprint)
 	}
 
-	// Try direct matching with each key
-	for _, k := range keys {
-		log.Printf("SSH AUTH: Checking key '%s' (ID: %s)", k.Name, k.ID)
-		
-		// Parse the stored public key
-		parsedKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(k.PublicKey))
-		if err != nil {
-			log.Printf("SSH AUTH: Failed to parse stored key: %v", err)
-			continue
-		}
-		
-		// Get the fingerprint in the same format as the client key
-		storedFingerprint := ssh.FingerprintSHA256(parsedKey)
-		log.Printf("SSH AUTH: Comparing - Stored=%s vs Client=%s", storedFingerprint, fingerprint)
-		
-		// If fingerprints match, authentication succeeds
-		if storedFingerprint == fingerprint {
-			// Get the user associated with this key
-			user, err := models.GetUserByID(k.UserID)
-			if err != nil || user == nil {
-				log.Printf("SSH AUTH ERROR: Key matched but user lookup failed: %v", err)
-				return nil, fmt.Errorf("server error")
-			}
-			
-			log.Printf("SSH AUTH SUCCESS: User %s authenticated with key '%s'", user.Username, k.Name)
-			
-			// Return permissions with username for later use
-			return &ssh.Permissions{
-				Extensions: map[string]string{
-					"username": user.Username,
-					"user_id":  user.ID,
-				},
-			}, nil
-		}
+	// Get the user associated with this key
+	user, err := models.GetUserByID(k.UserID)
+	if err != nil || user == nil {
+		log.Printf("SSH AUTH ERROR: Key matched but user lookup failed: %v", err)
+		return nil, fmt.Errorf("server error")
+	}
+
+	log.Printf("SSH AUTH SUCCESS: User %s authenticated with key '%s'", user.Username, k.Name)
+
+	// Return permissions with username for later use
+	return &ssh.Permissions{
+		Extensions: map[string]string{
+			"username": user.Username,
+			"user_id":  user.ID,
+			"key_id":   k.ID,
+		},
+	}, nil
+}
+
+// authDeployKey authenticates a deploy key, which grants access to a single repository
+func (s *Server) authDeployKey(fingerprint string) (*ssh.Permissions, error) {
+	k, err := models.GetDeployKeyByFingerprint(fingerprint)
+	if err != nil {
+		log.Printf("SSH AUTH ERROR: Database query failed: %v", err)
+		return nil, fmt.Errorf("server error")
+	}
+
+	if k == nil {
+		log.Printf("SSH AUTH FAILED: No matching key found for %s", fingerprint)
+		return nil, fmt.Errorf("unknown key")
 	}
 
-	// If we get here, no matching key was found
-	log.Printf("SSH AUTH FAILED: No matching key found for %s", fingerprint)
-	return nil, fmt.Errorf("unknown key")
+	log.Printf("SSH AUTH SUCCESS: Deploy key '%s' authenticated for repository %s (read only: %t)", k.Title, k.RepositoryID, k.ReadOnly)
+
+	return &ssh.Permissions{
+		Extensions: map[string]string{
+			"username":      "deploy key " + k.Title,
+			"deploy_key_id": k.ID,
+			"repository_id": k.RepositoryID,
+			"read_only":     fmt.Sprintf("%t", k.ReadOnly),
+		},
+	}, nil
 }
 
 // loadHostKey loads an SSH host key from a file
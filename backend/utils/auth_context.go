@@ -4,7 +4,6 @@ import (
 	"database/sql"
 	"errors"
 	"net/http"
-	"strings"
 	
 	"github-clone/auth"
 	"github-clone/config"
@@ -16,31 +15,18 @@ type CurrentUser struct {
 	Username string
 }
 
-// GetUserFromContext extracts the user from the Authorization header
+// GetUserFromContext returns the user authenticated by AuthMiddleware. The Authorization
+// header is not read again here, since the middleware may have declined a token that lacks
+// the scope the route requires.
 func GetUserFromContext(r *http.Request) (*CurrentUser, error) {
-	// Get the Authorization header
-	authHeader := r.Header.Get("Authorization")
-	if authHeader == "" {
-		return nil, errors.New("authorization header is required")
-	}
-	
-	// Check if it starts with "Bearer "
-	if !strings.HasPrefix(authHeader, "Bearer ") {
-		return nil, errors.New("authorization header must be Bearer token")
-	}
-	
-	// Extract the token
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-	
-	// Validate the token
-	claims, err := auth.ValidateToken(tokenString)
-	if err != nil {
-		return nil, errors.New("invalid token")
+	userID, ok := r.Context().Value(auth.UserIDKey).(string)
+	if !ok || userID == "" {
+		return nil, errors.New("authentication required")
 	}
 	
 	// Get the user from the database
 	var username string
-	err = config.DB.QueryRow("SELECT username FROM users WHERE id = ?", claims.UserID).Scan(&username)
+	err := config.DB.QueryRow("SELECT username FROM users WHERE id = ?", userID).Scan(&username)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, errors.New("user not found")
@@ -50,7 +36,7 @@ func GetUserFromContext(r *http.Request) (*CurrentUser, error) {
 	
 	// Return the current user
 	return &CurrentUser{
-		ID:       claims.UserID,
+		ID:       userID,
 		Username: username,
 	}, nil
 }
@@ -1,12 +1,14 @@
 package utils
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
+
+	"github-clone/githook"
 )
 
 // InitializeGitRepository initializes a bare Git repository at the specified path
@@ -17,9 +19,7 @@ func InitializeGitRepository(repoPath string) error {
 	}
 
 	// Initialize bare Git repository
-	cmd := exec.Command("git", "init", "--bare")
-	cmd.Dir = repoPath
-	output, err := cmd.CombinedOutput()
+	output, err := runGitSetup(repoPath, "init", "--bare")
 	if err != nil {
 		return fmt.Errorf("failed to initialize Git repository: %w\nOutput: %s", err, string(output))
 	}
@@ -58,30 +58,133 @@ func GetRepositoryPath(ownerID, repoName string) string {
 	return filepath.Join(baseRepoPath, ownerID, repoName)
 }
 
-// CreateRepositoryHooks sets up the necessary Git hooks for a repository
+// RepositoryDiskPath returns the filesystem path of a repository from its owner's username and its name
+func RepositoryDiskPath(ownerUsername, repoName string) string {
+	baseRepoPath := os.Getenv("REPOSITORIES_PATH")
+	if baseRepoPath == "" {
+		// Default to a subdirectory in the current working directory
+		dir, _ := os.Getwd()
+		baseRepoPath = filepath.Join(dir, "repositories")
+	}
+
+	return filepath.Join(baseRepoPath, ownerUsername, strings.TrimSuffix(repoName, ".git")+".git")
+}
+
+// RepositoryDataPath returns the directory holding the files of a repository that are not
+// part of its Git data, such as release assets. It sits next to the Git repository.
+func RepositoryDataPath(ownerUsername, repoName string) string {
+	return strings.TrimSuffix(RepositoryDiskPath(ownerUsername, repoName), ".git") + ".data"
+}
+
+// CreateRepositoryHooks installs the pre-receive, update and post-receive hooks of a repository.
+// They run the server binary's "hook" subcommand, which hands the push to the server so it
+// can enforce its rules and react to ref updates. The absolute path of the binary is written
+// into the scripts, and the hooks of every repository are installed again when the server
+// starts, so they follow the binary when it moves.
+//
+// A push the server cannot check is refused: pre-receive and update fail when the binary is
+// missing, or when the push did not come through the server and carries no hook secret.
+// post-receive runs after the refs were updated and only skips its work.
 func CreateRepositoryHooks(repoPath string) error {
-	// Create a post-receive hook to update the working directory
 	hooksDir := filepath.Join(repoPath, "hooks")
 	if err := os.MkdirAll(hooksDir, 0755); err != nil {
 		return fmt.Errorf("failed to create hooks directory: %w", err)
 	}
 
-	// Create post-receive hook
-	hookPath := filepath.Join(hooksDir, "post-receive")
-	hookContent := `#!/bin/sh
-# This hook is called after a successful push
-echo "Repository updated successfully!"
+	binary := shellQuote(githook.Binary())
+	for _, hook := range githook.Hooks {
+		onMissing := `echo "NotGitHub: this push cannot be checked by the server and is refused" >&2
+	exit 1`
+		if hook == githook.PostReceive {
+			onMissing = "exit 0"
+		}
+
+		hookContent := fmt.Sprintf(`#!/bin/sh
+# Installed by NotGitHub: hands the push to the application server.
+if [ ! -x %s ] || [ -z "$%s" ]; then
+	%s
+fi
+exec %s hook %s "$@"
+`, binary, githook.EnvToken, onMissing, binary, hook)
 
-# Make sure the hook exits with success (important for Git client)
-exit 0
-`
-	if err := os.WriteFile(hookPath, []byte(hookContent), 0755); err != nil {
-		return fmt.Errorf("failed to create post-receive hook: %w", err)
+		hookPath := filepath.Join(hooksDir, hook)
+		if err := os.WriteFile(hookPath, []byte(hookContent), 0755); err != nil {
+			return fmt.Errorf("failed to create %s hook: %w", hook, err)
+		}
 	}
 
 	return nil
 }
 
+// shellQuote quotes a string for use as a single word in a shell script
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// ForkGitRepository creates a bare copy of a repository that borrows the objects of the
+// source through git alternates instead of copying them, so forks take little disk space
+func ForkGitRepository(sourcePath, forkPath string) error {
+	if err := os.MkdirAll(filepath.Dir(forkPath), 0755); err != nil {
+		return fmt.Errorf("failed to create repository directory: %w", err)
+	}
+
+	output, err := runGitSetup("", "clone", "--bare", "--shared", "--quiet", sourcePath, forkPath)
+	if err != nil {
+		return fmt.Errorf("failed to fork Git repository: %w\nOutput: %s", err, string(output))
+	}
+
+	// The fork is a repository of its own, not a mirror that fetches from the source
+	if output, err := runGitSetup(forkPath, "remote", "remove", "origin"); err != nil {
+		DeleteGitRepository(forkPath)
+		return fmt.Errorf("failed to remove origin from fork: %w\nOutput: %s", err, string(output))
+	}
+
+	// Forks rely on the objects of the source, so the source must never prune them
+	if output, err := runGitSetup(sourcePath, "config", "gc.pruneExpire", "never"); err != nil {
+		DeleteGitRepository(forkPath)
+		return fmt.Errorf("failed to configure source repository: %w\nOutput: %s", err, string(output))
+	}
+
+	log.Printf("Forked Git repository %s to %s", sourcePath, forkPath)
+	return nil
+}
+
+// DissociateGitRepository copies the objects a fork borrows from its source into the fork
+// and stops borrowing them, so the fork keeps working after the source is deleted
+func DissociateGitRepository(repoPath string) error {
+	alternatesPath := filepath.Join(repoPath, "objects", "info", "alternates")
+	if _, err := os.Stat(alternatesPath); os.IsNotExist(err) {
+		return nil
+	}
+
+	if output, err := runGitSetup(repoPath, "repack", "-a", "-d", "-q"); err != nil {
+		return fmt.Errorf("failed to repack repository: %w\nOutput: %s", err, string(output))
+	}
+
+	if err := os.Remove(alternatesPath); err != nil {
+		return fmt.Errorf("failed to remove alternates: %w", err)
+	}
+
+	return nil
+}
+
+// runGitSetup runs a git command that creates or changes a repository on disk in dir, or in
+// the working directory if dir is empty, and returns its combined output. These commands
+// go along with changes to the database, so they are not stopped when the client goes away,
+// only when they take longer than GitCommandTimeout.
+func runGitSetup(dir string, args ...string) ([]byte, error) {
+	ctx, cancel := WithGitTimeout(context.Background(), GitCommandTimeout())
+	defer cancel()
+
+	cmd := GitCommand(ctx, args...)
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	if LogGitAborted(ctx, "git "+strings.Join(args, " ")) {
+		return output, fmt.Errorf("git %s: %w", args[0], ctx.Err())
+	}
+	return output, err
+}
+
 // DeleteGitRepository removes a Git repository from the filesystem
 func DeleteGitRepository(repoPath string) error {
 	if err := os.RemoveAll(repoPath); err != nil {
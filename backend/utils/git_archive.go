@@ -0,0 +1,134 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ArchiveFormats maps the file extensions of archive downloads to git archive formats
+var ArchiveFormats = map[string]string{
+	".tar.gz": "tar.gz",
+	".zip":    "zip",
+}
+
+// archiveLocks holds a mutex per cached archive, so concurrent downloads of an archive that
+// is not cached yet run git only once
+var archiveLocks sync.Map
+
+// Archive is a snapshot of a repository at a commit, packed into a single file
+type Archive struct {
+	Commit string
+	Tree   string
+	Prefix string // The top-level directory of the archive, named <repository>-<ref>
+	Format string // A value of ArchiveFormats
+}
+
+// FileName is the name the archive is downloaded as
+func (a *Archive) FileName() string {
+	return a.Prefix + "." + a.Format
+}
+
+// CachePath is where the archive is cached. Archives are keyed by tree SHA, so commits with
+// the same files, such as a tag and the branch it was cut from, share an archive.
+func (a *Archive) CachePath() string {
+	return filepath.Join(archiveCacheDir(), a.Tree[:2], a.Tree+"-"+a.Prefix+"."+a.Format)
+}
+
+// archiveCacheDir returns the directory archives are cached in
+func archiveCacheDir() string {
+	cacheDir := os.Getenv("ARCHIVE_CACHE_PATH")
+	if cacheDir == "" {
+		// Default to a subdirectory in the current working directory
+		dir, _ := os.Getwd()
+		cacheDir = filepath.Join(dir, "archive-cache")
+	}
+	return cacheDir
+}
+
+// NewArchive describes the archive of a repository at a branch, tag or commit. Returns
+// ErrRefNotFound if the ref does not exist.
+func NewArchive(ctx context.Context, repoPath, repoName, ref, format string) (*Archive, error) {
+	commit, err := ResolveCommit(ctx, repoPath, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	tree, err := runGit(ctx, repoPath, "rev-parse", "--verify", commit+"^{tree}")
+	if err != nil {
+		return nil, fmt.Errorf("error resolving tree of %s: %w", commit, err)
+	}
+
+	// Ref names cannot contain characters that are unsafe in file names, except slashes
+	return &Archive{
+		Commit: commit,
+		Tree:   strings.TrimSpace(tree),
+		Prefix: strings.TrimSuffix(repoName, ".git") + "-" + strings.ReplaceAll(ref, "/", "-"),
+		Format: format,
+	}, nil
+}
+
+// OpenCachedArchive opens the cached copy of an archive, returning nil if there is none
+func OpenCachedArchive(archive *Archive) (*os.File, error) {
+	file, err := os.Open(archive.CachePath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return file, err
+}
+
+// WriteArchive runs git archive and streams its output to w while caching it. The cached
+// copy is only kept when the whole archive was written. Git is stopped when ctx is done or
+// GitTransportTimeout has passed.
+func WriteArchive(ctx context.Context, repoPath string, archive *Archive, w io.Writer) error {
+	cachePath := archive.CachePath()
+
+	lock, _ := archiveLocks.LoadOrStore(cachePath, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	// Another download may have cached the archive while this one waited
+	if cached, err := OpenCachedArchive(archive); err == nil && cached != nil {
+		defer cached.Close()
+		_, err := io.Copy(w, cached)
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0755); err != nil {
+		return fmt.Errorf("error creating archive cache directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(cachePath), ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("error creating archive cache file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	ctx, cancel := WithGitTimeout(ctx, GitTransportTimeout())
+	defer cancel()
+
+	cmd := GitCommand(ctx, "-C", repoPath, "archive", "--format="+archive.Format, "--prefix="+archive.Prefix+"/", archive.Commit)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	cmd.Stdout = io.MultiWriter(tmp, w)
+
+	if err := cmd.Run(); err != nil {
+		if LogGitAborted(ctx, "archive of "+archive.Commit+" in "+repoPath) {
+			return fmt.Errorf("git archive: %w", ctx.Err())
+		}
+		return fmt.Errorf("git archive: %w - %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing archive cache file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), cachePath); err != nil {
+		return fmt.Errorf("error caching archive: %w", err)
+	}
+
+	return nil
+}
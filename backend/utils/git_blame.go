@@ -0,0 +1,122 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrPathNotFound is returned when a file does not exist at a commit
+var ErrPathNotFound = errors.New("path not found")
+
+// Blame attributes every line of a file at a commit to the commit that last changed it
+type Blame struct {
+	Path   string        `json:"path"`
+	Commit string        `json:"commit"` // The commit the file was blamed at
+	Ranges []*BlameRange `json:"ranges"`
+}
+
+// BlameRange is a run of consecutive lines last changed by the same commit. Line numbers
+// start at 1 and EndLine is inclusive.
+type BlameRange struct {
+	StartLine int      `json:"start_line"`
+	EndLine   int      `json:"end_line"`
+	Commit    *Commit  `json:"commit"` // The message is the summary line of the commit
+	Lines     []string `json:"lines"`
+}
+
+// GetBlame blames a file at a branch, tag or commit. Returns ErrRefNotFound if the ref does
+// not exist and ErrPathNotFound if the file does not exist at that commit.
+func GetBlame(ctx context.Context, repoPath, filePath, ref string) (*Blame, error) {
+	if ref == "" {
+		ref = "HEAD"
+	}
+
+	sha, err := ResolveCommit(ctx, repoPath, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	// Directories and submodules cannot be blamed
+	objectType, err := runGit(ctx, repoPath, "cat-file", "-t", sha+":"+filePath)
+	if err != nil || strings.TrimSpace(objectType) != "blob" {
+		return nil, ErrPathNotFound
+	}
+
+	out, err := runGit(ctx, repoPath, "blame", "--porcelain", sha, "--", filePath)
+	if err != nil {
+		return nil, fmt.Errorf("error blaming file: %w", err)
+	}
+
+	return &Blame{Path: filePath, Commit: sha, Ranges: parseBlamePorcelain(out)}, nil
+}
+
+// parseBlamePorcelain groups the output of git blame --porcelain into ranges. Each line of
+// the file is printed as a header "<sha> <original line> <final line> [<lines in group>]",
+// followed by the details of the commit the first time it appears, and then the content of
+// the line prefixed with a tab.
+func parseBlamePorcelain(output string) []*BlameRange {
+	commits := map[string]*Commit{}
+	ranges := []*BlameRange{}
+
+	var commit *Commit
+	lineNumber := 0
+	expectHeader := true
+
+	for _, text := range strings.Split(output, "\n") {
+		if expectHeader {
+			fields := strings.Fields(text)
+			if len(fields) < 3 {
+				continue
+			}
+			lineNumber, _ = strconv.Atoi(fields[2])
+			commit = commits[fields[0]]
+			if commit == nil {
+				commit = &Commit{SHA: fields[0]}
+				commits[fields[0]] = commit
+			}
+			expectHeader = false
+			continue
+		}
+
+		if strings.HasPrefix(text, "\t") {
+			content := strings.TrimPrefix(text, "\t")
+			var last *BlameRange
+			if len(ranges) > 0 {
+				last = ranges[len(ranges)-1]
+			}
+			if last != nil && last.Commit == commit && last.EndLine == lineNumber-1 {
+				last.EndLine = lineNumber
+				last.Lines = append(last.Lines, content)
+			} else {
+				ranges = append(ranges, &BlameRange{
+					StartLine: lineNumber,
+					EndLine:   lineNumber,
+					Commit:    commit,
+					Lines:     []string{content},
+				})
+			}
+			expectHeader = true
+			continue
+		}
+
+		key, value, _ := strings.Cut(text, " ")
+		switch key {
+		case "author":
+			commit.Author = value
+		case "author-mail":
+			commit.Email = strings.TrimSuffix(strings.TrimPrefix(value, "<"), ">")
+		case "author-time":
+			if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+				commit.Timestamp = time.Unix(seconds, 0).UTC()
+			}
+		case "summary":
+			commit.Message = value
+		}
+	}
+
+	return ranges
+}
@@ -0,0 +1,98 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// binarySniffLength is how much of a file is searched for NUL bytes, as git does when it
+// decides whether to show a diff
+const binarySniffLength = 8000
+
+// BlobInfo describes a file at a commit without reading its content
+type BlobInfo struct {
+	SHA  string
+	Mode string
+	Size int64
+}
+
+// GetBlobInfo looks up a file at a branch, tag or commit. Returns ErrRefNotFound if the ref
+// does not exist and ErrPathNotFound if the path is missing or not a file.
+func GetBlobInfo(ctx context.Context, repoPath, ref, filePath string) (*BlobInfo, error) {
+	if ref == "" {
+		ref = "HEAD"
+	}
+
+	commit, err := ResolveCommit(ctx, repoPath, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	// -z prints the path as it is instead of quoting unusual characters
+	out, err := runGit(ctx, repoPath, "ls-tree", "-l", "-z", commit, "--", filePath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading tree: %w", err)
+	}
+
+	// <mode> SP <type> SP <sha> SP <size> TAB <path>
+	meta, path, found := strings.Cut(strings.TrimSuffix(out, "\x00"), "\t")
+	fields := strings.Fields(meta)
+	if !found || path != filePath || len(fields) != 4 || fields[1] != "blob" {
+		return nil, ErrPathNotFound
+	}
+
+	size, err := strconv.ParseInt(fields[3], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("unexpected ls-tree output: %q", out)
+	}
+
+	return &BlobInfo{SHA: fields[2], Mode: fields[0], Size: size}, nil
+}
+
+// blobReader streams the content of a blob from git cat-file
+type blobReader struct {
+	io.ReadCloser
+	cmd    *exec.Cmd
+	cancel context.CancelFunc
+}
+
+// Close stops reading and waits for git to exit. Closing before the end of the blob makes
+// git fail with a broken pipe, which is not an error for the reader.
+func (b *blobReader) Close() error {
+	b.ReadCloser.Close()
+	b.cmd.Wait()
+	b.cancel()
+	return nil
+}
+
+// OpenBlob streams the content of a blob. The caller must close the reader. Git is stopped
+// when ctx is done or GitTransportTimeout has passed.
+func OpenBlob(ctx context.Context, repoPath, sha string) (io.ReadCloser, error) {
+	ctx, cancel := WithGitTimeout(ctx, GitTransportTimeout())
+	cmd := GitCommand(ctx, "-C", repoPath, "cat-file", "blob", sha)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		cancel()
+		return nil, fmt.Errorf("error reading blob %s: %w", sha, err)
+	}
+
+	return &blobReader{ReadCloser: stdout, cmd: cmd, cancel: cancel}, nil
+}
+
+// IsBinary reports whether content looks like a binary file rather than text, using the
+// same rule as git: a NUL byte near the start
+func IsBinary(content []byte) bool {
+	if len(content) > binarySniffLength {
+		content = content[:binarySniffLength]
+	}
+	return bytes.IndexByte(content, 0) >= 0
+}
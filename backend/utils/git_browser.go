@@ -2,14 +2,17 @@ package utils
 
 import (
 	"bytes"
-	"encoding/json"
+	"context"
+	"encoding/base64"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
 	"time"
+	"unicode/utf8"
 )
 
 // FileEntry represents a file or directory in the repository
@@ -26,6 +29,7 @@ type FileEntry struct {
 	SubEntries  []*FileEntry `json:"entries,omitempty"`
 	LastCommit  *Commit      `json:"last_commit,omitempty"`
 	ContentType string       `json:"content_type,omitempty"`
+	Binary      bool         `json:"binary,omitempty"` // Content is base64 encoded and not meant to be displayed as text
 }
 
 // Commit represents a Git commit
@@ -39,12 +43,16 @@ type Commit struct {
 	TimestampStr string `json:"-"`
 }
 
-// GetRepositoryContents retrieves files and directories at the specified path
-func GetRepositoryContents(repoPath, relativePath, ref string) ([]*FileEntry, error) {
+// GetRepositoryContents retrieves files and directories at the specified path. Git is
+// stopped when ctx is done or GitCommandTimeout has passed.
+func GetRepositoryContents(ctx context.Context, repoPath, relativePath, ref string) ([]*FileEntry, error) {
 	if ref == "" {
 		ref = "HEAD" // Default to HEAD if no ref is provided
 	}
 
+	ctx, cancel := WithGitTimeout(ctx, GitCommandTimeout())
+	defer cancel()
+
 	// Handle root directory
 	if relativePath == "" || relativePath == "/" {
 		relativePath = "."
@@ -59,10 +67,10 @@ func GetRepositoryContents(repoPath, relativePath, ref string) ([]*FileEntry, er
 	var cmd *exec.Cmd
 	if relativePath == "." {
 		// Use --name-only to just get paths for the root directory to get top-level entries
-		cmd = exec.Command("git", "-C", repoPath, "ls-tree", ref)
+		cmd = GitCommand(ctx, "-C", repoPath, "ls-tree", ref)
 	} else {
 		// Check if the path is a directory by using ls-tree to see its type
-		checkDirCmd := exec.Command("git", "-C", repoPath, "ls-tree", ref, relativePath)
+		checkDirCmd := GitCommand(ctx, "-C", repoPath, "ls-tree", ref, relativePath)
 		var checkOut, checkErr bytes.Buffer
 		checkDirCmd.Stdout = &checkOut
 		checkDirCmd.Stderr = &checkErr
@@ -78,11 +86,11 @@ func GetRepositoryContents(repoPath, relativePath, ref string) ([]*FileEntry, er
 			// If it's a directory, we need to get its contents
 			// Use the ref:path/ format to get contents INSIDE the directory
 			log.Printf("'%s' is a directory, getting its contents", relativePath)
-			cmd = exec.Command("git", "-C", repoPath, "ls-tree", ref, relativePath + "/")
+			cmd = GitCommand(ctx, "-C", repoPath, "ls-tree", ref, relativePath + "/")
 		} else {
 			// If it's not a directory (or not found), use regular ls-tree
 			log.Printf("'%s' is not a directory, using standard ls-tree", relativePath)
-			cmd = exec.Command("git", "-C", repoPath, "ls-tree", ref, relativePath)
+			cmd = GitCommand(ctx, "-C", repoPath, "ls-tree", ref, relativePath)
 		}
 	}
 	
@@ -90,18 +98,21 @@ func GetRepositoryContents(repoPath, relativePath, ref string) ([]*FileEntry, er
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 	err := cmd.Run()
+	if LogGitAborted(ctx, "listing "+relativePath+" in "+repoPath) {
+		return nil, ctx.Err()
+	}
 
 	// If there's an error or empty output, try different approach for root dir
 	if (err != nil || stdout.String() == "") && relativePath == "." {
 		// Try direct ls-files approach for bare repos or repos with just files
-		allFilesCmd := exec.Command("git", "-C", repoPath, "ls-files")
+		allFilesCmd := GitCommand(ctx, "-C", repoPath, "ls-files")
 		allFilesCmd.Stdout = &stdout
 		allFilesCmd.Stderr = &stderr
 		err = allFilesCmd.Run()
 		
 		if err != nil || stdout.String() == "" {
 			// Check if it's a valid but empty repo
-			validCmd := exec.Command("git", "-C", repoPath, "rev-parse", "--is-inside-work-tree")
+			validCmd := GitCommand(ctx, "-C", repoPath, "rev-parse", "--is-inside-work-tree")
 			if validCmd.Run() != nil {
 				return nil, fmt.Errorf("error listing files: %v - %s", err, stderr.String())
 			}
@@ -159,6 +170,11 @@ func GetRepositoryContents(repoPath, relativePath, ref string) ([]*FileEntry, er
 			continue
 		}
 
+		// Each entry runs git again, so stop as soon as the request is gone
+		if LogGitAborted(ctx, "listing "+relativePath+" in "+repoPath) {
+			return nil, ctx.Err()
+		}
+
 		// Format for ls-tree output: <mode> <type> <object> <TAB> <file>
 		// First, split by tab to separate the metadata from filename
 		parts := strings.SplitN(line, "\t", 2)
@@ -199,7 +215,7 @@ func GetRepositoryContents(repoPath, relativePath, ref string) ([]*FileEntry, er
 		// For files, get the size
 		size := int64(0)
 		if entryType == "file" {
-			sizeCmd := exec.Command("git", "-C", repoPath, "cat-file", "-s", sha)
+			sizeCmd := GitCommand(ctx, "-C", repoPath, "cat-file", "-s", sha)
 			sizeOutput, err := sizeCmd.Output()
 			if err == nil {
 				fmt.Sscanf(string(sizeOutput), "%d", &size)
@@ -225,7 +241,7 @@ func GetRepositoryContents(repoPath, relativePath, ref string) ([]*FileEntry, er
 		var lastCommit *Commit
 		// Only get the last commit for top-level directories or files
 		if !strings.Contains(filePath, "/") || strings.Count(filePath, "/") == 1 {
-			lastCommit, _ = GetLastCommitForFile(repoPath, filePath, ref)
+			lastCommit, _ = GetLastCommitForFile(ctx, repoPath, filePath, ref)
 		}
 
 		// Determine content type for files
@@ -253,19 +269,23 @@ func GetRepositoryContents(repoPath, relativePath, ref string) ([]*FileEntry, er
 	return entries, nil
 }
 
-// GetFileContent retrieves the content of a file
-func GetFileContent(repoPath, filePath, ref string) (*FileEntry, error) {
+// GetFileContent retrieves the content of a file. Git is stopped when ctx is done or
+// GitCommandTimeout has passed.
+func GetFileContent(ctx context.Context, repoPath, filePath, ref string) (*FileEntry, error) {
 	if ref == "" {
 		ref = "HEAD"
 	}
 
+	ctx, cancel := WithGitTimeout(ctx, GitCommandTimeout())
+	defer cancel()
+
 	// Check if the repository exists
 	if _, err := os.Stat(repoPath); os.IsNotExist(err) {
 		return nil, fmt.Errorf("repository does not exist")
 	}
 	
 	// First, check if this path is a directory
-	checkTypeCmd := exec.Command("git", "-C", repoPath, "ls-tree", ref, filePath)
+	checkTypeCmd := GitCommand(ctx, "-C", repoPath, "ls-tree", ref, filePath)
 	var typeOut, typeErr bytes.Buffer
 	checkTypeCmd.Stdout = &typeOut
 	checkTypeCmd.Stderr = &typeErr
@@ -279,7 +299,7 @@ func GetFileContent(repoPath, filePath, ref string) (*FileEntry, error) {
 	}
 
 	// Get file metadata
-	cmd := exec.Command("git", "-C", repoPath, "ls-tree", "-l", ref, filePath)
+	cmd := GitCommand(ctx, "-C", repoPath, "ls-tree", "-l", ref, filePath)
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
@@ -328,7 +348,7 @@ func GetFileContent(repoPath, filePath, ref string) (*FileEntry, error) {
 	
 	// Build the Git command with proper path format
 	fileCmdStr := fmt.Sprintf("%s:%s", ref, gitPath)
-	cmd = exec.Command("git", "-C", repoPath, "show", fileCmdStr)
+	cmd = GitCommand(ctx, "-C", repoPath, "show", fileCmdStr)
 	stdout.Reset()
 	stderr.Reset()
 	cmd.Stdout = &stdout
@@ -338,13 +358,16 @@ func GetFileContent(repoPath, filePath, ref string) (*FileEntry, error) {
 	log.Printf("Executing git command: git -C %s show %s", repoPath, fileCmdStr)
 	
 	err = cmd.Run()
+	if LogGitAborted(ctx, "reading "+fileCmdStr+" in "+repoPath) {
+		return nil, ctx.Err()
+	}
 	if err != nil {
 		log.Printf("Error fetching file content: %v - %s", err, stderr.String())
 		return nil, fmt.Errorf("error getting file content: %v - %s", err, stderr.String())
 	}
 
 	// Get last commit for this file
-	lastCommit, _ := GetLastCommitForFile(repoPath, filePath, ref)
+	lastCommit, _ := GetLastCommitForFile(ctx, repoPath, filePath, ref)
 
 	// Determine content type (simple detection based on file extension)
 	fileExt := strings.ToLower(filepath.Ext(name))
@@ -353,123 +376,71 @@ func GetFileContent(repoPath, filePath, ref string) (*FileEntry, error) {
 	sizeInt := int64(0)
 	fmt.Sscanf(size, "%d", &sizeInt)
 
-	// Try to clean the content string for better display
-	content := stdout.String()
-	
-	// Remove common BOM and control characters that might appear
-	content = strings.ReplaceAll(content, "\uFEFF", "") // BOM
-	content = strings.ReplaceAll(content, "\u0000", "") // Null byte
-
-	return &FileEntry{
+	entry := &FileEntry{
 		Name:        name,
 		Path:        filePath,
 		Type:        "file",
 		Size:        sizeInt,
 		Mode:        mode,
 		SHA:         sha,
-		Content:     content,
-		Encoding:    "utf-8", // We're assuming UTF-8 encoding
 		LastCommit:  lastCommit,
 		ContentType: contentType,
-	}, nil
-}
-
-// GetCommitHistory retrieves the commit history for a repository
-func GetCommitHistory(repoPath, ref string, limit int) ([]*Commit, error) {
-	if ref == "" {
-		ref = "HEAD"
 	}
 
-	if limit <= 0 {
-		limit = 10 // Default to 10 commits
+	// Text is returned as it is. Binary files, and text that is not valid UTF-8 and would
+	// be altered by JSON encoding, are returned base64 encoded.
+	content := stdout.Bytes()
+	switch {
+	case IsBinary(content):
+		entry.Binary = true
+		entry.Encoding = "base64"
+		entry.Content = base64.StdEncoding.EncodeToString(content)
+		entry.ContentType = http.DetectContentType(content)
+	case !utf8.Valid(content):
+		entry.Encoding = "base64"
+		entry.Content = base64.StdEncoding.EncodeToString(content)
+	default:
+		entry.Encoding = "utf-8"
+		entry.Content = string(content)
 	}
 
+	return entry, nil
+}
+
+// GetCommitHistory retrieves the first commits of the history of a ref. See ListCommits for
+// filtering and paging.
+func GetCommitHistory(ctx context.Context, repoPath, ref string, limit int) ([]*Commit, error) {
 	// Check if the repository exists
 	if _, err := os.Stat(repoPath); os.IsNotExist(err) {
 		return nil, fmt.Errorf("repository does not exist")
 	}
 
-	// Get commit history
-	cmd := exec.Command(
-		"git", "-C", repoPath, "log", 
-		"--pretty=format:{\"sha\":\"%H\",\"author\":\"%an\",\"email\":\"%ae\",\"message\":\"%s\",\"timestampStr\":\"%ci\"}", 
-		"--max-count", fmt.Sprintf("%d", limit),
-		ref,
-	)
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-	err := cmd.Run()
-	if err != nil {
-		return nil, fmt.Errorf("error getting commit history: %v - %s", err, stderr.String())
-	}
-
-	// Parse the JSON lines
-	lines := strings.Split(stdout.String(), "\n")
-	commits := make([]*Commit, 0, len(lines))
-
-	for _, line := range lines {
-		if line == "" {
-			continue
-		}
-
-		var commit Commit
-		if err := json.Unmarshal([]byte(line), &commit); err != nil {
-			return nil, fmt.Errorf("error parsing commit: %v", err)
-		}
-
-		// Parse the timestamp
-		timestamp, err := time.Parse("2006-01-02 15:04:05 -0700", commit.TimestampStr)
-		if err == nil {
-			commit.Timestamp = timestamp
-		}
-
-		commits = append(commits, &commit)
-	}
-
-	return commits, nil
+	commits, _, err := ListCommits(ctx, repoPath, CommitQuery{Ref: ref, Limit: limit})
+	return commits, err
 }
 
 // GetLastCommitForFile gets the last commit that modified a specific file
-func GetLastCommitForFile(repoPath, filePath, ref string) (*Commit, error) {
+func GetLastCommitForFile(ctx context.Context, repoPath, filePath, ref string) (*Commit, error) {
 	if ref == "" {
 		ref = "HEAD"
 	}
 
+	if strings.HasPrefix(ref, "-") {
+		return nil, ErrRefNotFound
+	}
+
 	// Get the last commit for this file
-	cmd := exec.Command(
-		"git", "-C", repoPath, "log", 
-		"--pretty=format:{\"sha\":\"%H\",\"author\":\"%an\",\"email\":\"%ae\",\"message\":\"%s\",\"timestampStr\":\"%ci\"}", 
-		"-n", "1",
-		ref,
-		"--",
-		filePath,
-	)
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-	err := cmd.Run()
+	out, err := runGit(ctx, repoPath, "log", commitLogFormat, "-n", "1", "--end-of-options", ref, "--", filePath)
 	if err != nil {
-		return nil, fmt.Errorf("error getting last commit: %v - %s", err, stderr.String())
+		return nil, fmt.Errorf("error getting last commit: %w", err)
 	}
 
-	output := strings.TrimSpace(stdout.String())
-	if output == "" {
+	commits := parseCommitLog(out)
+	if len(commits) == 0 {
 		return nil, nil
 	}
 
-	var commit Commit
-	if err := json.Unmarshal([]byte(output), &commit); err != nil {
-		return nil, fmt.Errorf("error parsing commit: %v", err)
-	}
-
-	// Parse the timestamp
-	timestamp, err := time.Parse("2006-01-02 15:04:05 -0700", commit.TimestampStr)
-	if err == nil {
-		commit.Timestamp = timestamp
-	}
-
-	return &commit, nil
+	return commits[0], nil
 }
 
 // determineContentType returns a content type based on file extension
@@ -0,0 +1,86 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// Defaults for the longest git may run, overridden by GIT_COMMAND_TIMEOUT and
+// GIT_TRANSPORT_TIMEOUT
+const (
+	defaultGitCommandTimeout   = 2 * time.Minute
+	defaultGitTransportTimeout = 2 * time.Hour
+)
+
+// gitWaitDelay is how long Wait waits for the output of a stopped git to be closed. Processes
+// git started could otherwise keep its pipes open and Wait from returning.
+const gitWaitDelay = 5 * time.Second
+
+// GitCommandTimeout returns the longest a git command run to browse or change a repository
+// may take, set with GIT_COMMAND_TIMEOUT (e.g. "30s"). Zero means no limit.
+func GitCommandTimeout() time.Duration {
+	return gitTimeout("GIT_COMMAND_TIMEOUT", defaultGitCommandTimeout)
+}
+
+// GitTransportTimeout returns the longest git may take to transfer data to or from a client
+// (clones, fetches, pushes, archives and raw files), set with GIT_TRANSPORT_TIMEOUT (e.g. "1h").
+// Zero means no limit.
+func GitTransportTimeout() time.Duration {
+	return gitTimeout("GIT_TRANSPORT_TIMEOUT", defaultGitTransportTimeout)
+}
+
+// gitTimeout reads a timeout from the environment, falling back to its default if the
+// variable is unset or invalid
+func gitTimeout(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout < 0 {
+		log.Printf("Invalid %s %q, using %s", name, value, fallback)
+		return fallback
+	}
+	return timeout
+}
+
+// WithGitTimeout returns a context that is done when ctx is, or when the timeout expires.
+// A zero timeout adds no limit.
+func WithGitTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// GitCommand creates a git command that is killed when ctx is done. Git runs in its own
+// process group, so the processes it starts, such as the pack-objects of an upload-pack,
+// are killed along with it.
+func GitCommand(ctx context.Context, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	setProcessGroup(cmd)
+	cmd.Cancel = func() error {
+		return killProcessGroup(cmd)
+	}
+	cmd.WaitDelay = gitWaitDelay
+	return cmd
+}
+
+// LogGitAborted logs a git operation that was stopped before it finished, and reports whether
+// it was. Operations are stopped when the client goes away or when they take too long.
+func LogGitAborted(ctx context.Context, operation string) bool {
+	switch err := ctx.Err(); {
+	case errors.Is(err, context.DeadlineExceeded):
+		log.Printf("Git operation timed out and was stopped: %s", operation)
+		return true
+	case errors.Is(err, context.Canceled):
+		log.Printf("Git operation stopped because the client went away: %s", operation)
+		return true
+	default:
+		return false
+	}
+}
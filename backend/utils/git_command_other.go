@@ -0,0 +1,14 @@
+//go:build !unix
+
+package utils
+
+import "os/exec"
+
+// setProcessGroup does nothing where process groups are not available
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// killProcessGroup kills the command. Processes it started are left running, as they
+// cannot be found through a process group.
+func killProcessGroup(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
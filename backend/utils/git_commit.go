@@ -0,0 +1,94 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// emptyTreeSHA is the ID of the tree with no entries, used to diff root commits
+const emptyTreeSHA = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+
+// CommitDetail is a single commit with its full message, parents and changes
+type CommitDetail struct {
+	SHA       string         `json:"sha"`
+	Tree      string         `json:"tree"`
+	Parents   []string       `json:"parents"`
+	Message   string         `json:"message"` // The full message, including the body
+	Author    CommitIdentity `json:"author"`
+	Committer CommitIdentity `json:"committer"`
+	Stats     CommitStats    `json:"stats"`
+	Files     []*FileDiff    `json:"files"`
+}
+
+// CommitIdentity is the author or committer of a commit
+type CommitIdentity struct {
+	Name  string    `json:"name"`
+	Email string    `json:"email"`
+	Date  time.Time `json:"date"`
+}
+
+// CommitStats sums the line changes of all files in a commit
+type CommitStats struct {
+	Additions int `json:"additions"`
+	Deletions int `json:"deletions"`
+	Total     int `json:"total"`
+}
+
+// commitDetailFormat prints the fields of a commit separated by NUL bytes. The message comes
+// last, as it is the only field that can contain newlines.
+const commitDetailFormat = "--format=%H%x00%T%x00%P%x00%an%x00%ae%x00%aI%x00%cn%x00%ce%x00%cI%x00%B"
+
+// GetCommitDetail retrieves a commit with its changes. The diff is taken against the first
+// parent, so merge commits show what the merge brought into the branch, and root commits
+// show every file as added. Returns ErrRefNotFound if the commit does not exist.
+func GetCommitDetail(ctx context.Context, repoPath, ref string) (*CommitDetail, error) {
+	sha, err := ResolveCommit(ctx, repoPath, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := runGit(ctx, repoPath, "show", "-s", commitDetailFormat, sha)
+	if err != nil {
+		return nil, fmt.Errorf("error reading commit: %w", err)
+	}
+
+	fields := strings.SplitN(out, "\x00", 10)
+	if len(fields) != 10 {
+		return nil, fmt.Errorf("unexpected commit format for %s", sha)
+	}
+
+	commit := &CommitDetail{
+		SHA:       fields[0],
+		Tree:      fields[1],
+		Parents:   strings.Fields(fields[2]),
+		Author:    CommitIdentity{Name: fields[3], Email: fields[4]},
+		Committer: CommitIdentity{Name: fields[6], Email: fields[7]},
+		Message:   strings.TrimRight(fields[9], "\n"),
+	}
+	if date, err := time.Parse(time.RFC3339, fields[5]); err == nil {
+		commit.Author.Date = date
+	}
+	if date, err := time.Parse(time.RFC3339, fields[8]); err == nil {
+		commit.Committer.Date = date
+	}
+
+	from := emptyTreeSHA
+	if len(commit.Parents) > 0 {
+		from = commit.Parents[0]
+	}
+
+	commit.Files, err = GetDiff(ctx, repoPath, from, commit.SHA)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range commit.Files {
+		commit.Stats.Additions += file.Additions
+		commit.Stats.Deletions += file.Deletions
+	}
+	commit.Stats.Total = commit.Stats.Additions + commit.Stats.Deletions
+
+	return commit, nil
+}
@@ -0,0 +1,492 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrRefNotFound is returned when a branch, tag or commit cannot be resolved
+var ErrRefNotFound = errors.New("ref not found")
+
+// FileDiff describes the changes made to a single file between two commits
+type FileDiff struct {
+	Filename         string `json:"filename"`
+	PreviousFilename string `json:"previous_filename,omitempty"` // Set for renamed and copied files
+	Status           string `json:"status"`                      // "added", "modified", "deleted", "renamed", "copied" or "changed"
+	Additions        int    `json:"additions"`
+	Deletions        int    `json:"deletions"`
+	Binary           bool   `json:"binary"`
+	Patch            string `json:"patch,omitempty"`
+}
+
+// runGit runs a git command against a repository and returns its standard output. The command
+// is stopped when ctx is done, or when it takes longer than GitCommandTimeout.
+func runGit(ctx context.Context, repoPath string, args ...string) (string, error) {
+	return runGitEnv(ctx, repoPath, nil, args...)
+}
+
+// runGitEnv runs a git command with additional environment variables
+func runGitEnv(ctx context.Context, repoPath string, env []string, args ...string) (string, error) {
+	ctx, cancel := WithGitTimeout(ctx, GitCommandTimeout())
+	defer cancel()
+
+	cmd := GitCommand(ctx, append([]string{"-C", repoPath}, args...)...)
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if LogGitAborted(ctx, "git "+args[0]+" in "+repoPath) {
+			return stdout.String(), fmt.Errorf("git %s: %w", args[0], ctx.Err())
+		}
+		return stdout.String(), fmt.Errorf("git %s: %w - %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+
+	return stdout.String(), nil
+}
+
+// ResolveCommit returns the commit SHA a branch, tag or commit reference points to
+func ResolveCommit(ctx context.Context, repoPath, ref string) (string, error) {
+	// Refuse option-like refs so user input cannot change the meaning of the command
+	if ref == "" || strings.HasPrefix(ref, "-") {
+		return "", ErrRefNotFound
+	}
+
+	out, err := runGit(ctx, repoPath, "rev-parse", "--verify", "--quiet", "--end-of-options", ref+"^{commit}")
+	if err != nil {
+		return "", ErrRefNotFound
+	}
+
+	return strings.TrimSpace(out), nil
+}
+
+// ResolveBranch returns the commit SHA at the tip of a branch
+func ResolveBranch(ctx context.Context, repoPath, branch string) (string, error) {
+	if branch == "" || strings.HasPrefix(branch, "-") {
+		return "", ErrRefNotFound
+	}
+	return ResolveCommit(ctx, repoPath, "refs/heads/"+branch)
+}
+
+// MergeBase returns the best common ancestor of two commits, or "" if they share no history
+func MergeBase(ctx context.Context, repoPath, a, b string) (string, error) {
+	out, err := runGit(ctx, repoPath, "merge-base", a, b)
+	if err != nil {
+		// merge-base exits with status 1 and no output when there is no common ancestor
+		if strings.TrimSpace(out) == "" {
+			return "", nil
+		}
+		return "", err
+	}
+
+	return strings.TrimSpace(out), nil
+}
+
+// IsAncestor reports whether ancestor is reachable from descendant
+func IsAncestor(ctx context.Context, repoPath, ancestor, descendant string) (bool, error) {
+	return IsAncestorEnv(ctx, repoPath, nil, ancestor, descendant)
+}
+
+// IsAncestorEnv is IsAncestor with additional environment variables for git, e.g. to see
+// the quarantined objects of a push that has not been accepted yet
+func IsAncestorEnv(ctx context.Context, repoPath string, env []string, ancestor, descendant string) (bool, error) {
+	_, err := runGitEnv(ctx, repoPath, env, "merge-base", "--is-ancestor", ancestor, descendant)
+	if err == nil {
+		return true, nil
+	}
+
+	// merge-base --is-ancestor exits with status 1 when the commit is not an ancestor
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		return false, nil
+	}
+	return false, err
+}
+
+// FileChangedBetween reports whether a file differs between two commits
+func FileChangedBetween(ctx context.Context, repoPath, from, to, path string) (bool, error) {
+	if from == to {
+		return false, nil
+	}
+
+	_, err := runGit(ctx, repoPath, "diff", "--quiet", from, to, "--", path)
+	if err == nil {
+		return false, nil
+	}
+
+	// diff --quiet exits with status 1 when there are differences
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		return true, nil
+	}
+	return false, err
+}
+
+// CountFileLines returns the number of lines of a file at a commit
+func CountFileLines(ctx context.Context, repoPath, commit, path string) (int, error) {
+	out, err := runGit(ctx, repoPath, "cat-file", "blob", commit+":"+path)
+	if err != nil {
+		return 0, ErrRefNotFound
+	}
+
+	if out == "" {
+		return 0, nil
+	}
+	lines := strings.Count(out, "\n")
+	if !strings.HasSuffix(out, "\n") {
+		lines++
+	}
+	return lines, nil
+}
+
+// UpdateRef points a reference at a commit. If oldSHA is not empty the update only
+// happens while the reference still points at oldSHA, so concurrent updates are detected.
+func UpdateRef(ctx context.Context, repoPath, ref, newSHA, oldSHA string) error {
+	args := []string{"update-ref", ref, newSHA}
+	if oldSHA != "" {
+		args = append(args, oldSHA)
+	}
+	_, err := runGit(ctx, repoPath, args...)
+	return err
+}
+
+// DeleteRef removes a reference
+func DeleteRef(ctx context.Context, repoPath, ref string) error {
+	_, err := runGit(ctx, repoPath, "update-ref", "-d", ref)
+	return err
+}
+
+// FetchIntoRef copies a commit from another repository on disk into a reference of this repository
+func FetchIntoRef(ctx context.Context, repoPath, sourceRepoPath, sourceRef, targetRef string) error {
+	_, err := runGit(ctx, repoPath, "fetch", "--quiet", "--no-tags", sourceRepoPath, "+"+sourceRef+":"+targetRef)
+	return err
+}
+
+// commitLogFormat prints the commit fields used by parseCommitLog, separated by NUL
+// bytes and terminated by a record separator, so messages can contain any text
+const commitLogFormat = "--format=%H%x00%an%x00%ae%x00%cI%x00%s%x1e"
+
+// parseCommitLog parses git log output produced with commitLogFormat
+func parseCommitLog(output string) []*Commit {
+	commits := []*Commit{}
+
+	for _, record := range strings.Split(output, "\x1e") {
+		record = strings.TrimLeft(record, "\n")
+		if record == "" {
+			continue
+		}
+
+		fields := strings.Split(record, "\x00")
+		if len(fields) < 5 {
+			continue
+		}
+
+		commit := &Commit{
+			SHA:          fields[0],
+			Author:       fields[1],
+			Email:        fields[2],
+			TimestampStr: fields[3],
+			Message:      fields[4],
+		}
+		if timestamp, err := time.Parse(time.RFC3339, fields[3]); err == nil {
+			commit.Timestamp = timestamp
+		}
+
+		commits = append(commits, commit)
+	}
+
+	return commits
+}
+
+// GetCommitsBetween lists the commits reachable from head but not from base, oldest first
+func GetCommitsBetween(ctx context.Context, repoPath, base, head string) ([]*Commit, error) {
+	out, err := runGit(ctx, repoPath, "log", "--reverse", commitLogFormat, base+".."+head)
+	if err != nil {
+		return nil, fmt.Errorf("error getting commits: %w", err)
+	}
+
+	return parseCommitLog(out), nil
+}
+
+// GetNewCommits lists up to limit commits reachable from head but not from any of the
+// excluded commits, oldest first. With limit 0 all commits are listed.
+func GetNewCommits(ctx context.Context, repoPath, head string, exclude []string, limit int) ([]*Commit, error) {
+	args := []string{"log", "--reverse", commitLogFormat}
+	if limit > 0 {
+		args = append(args, "--max-count="+strconv.Itoa(limit))
+	}
+	args = append(args, head)
+	if len(exclude) > 0 {
+		args = append(args, "--not")
+		args = append(args, exclude...)
+	}
+
+	out, err := runGit(ctx, repoPath, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error getting commits: %w", err)
+	}
+
+	return parseCommitLog(out), nil
+}
+
+// ListRefs returns the commit every branch and tag of a repository points to, keyed by full ref name
+func ListRefs(ctx context.Context, repoPath string) (map[string]string, error) {
+	out, err := runGit(ctx, repoPath, "for-each-ref", "--format=%(objectname) %(refname)", "refs/heads", "refs/tags")
+	if err != nil {
+		return nil, err
+	}
+
+	refs := map[string]string{}
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		sha, ref, found := strings.Cut(line, " ")
+		if found {
+			refs[ref] = sha
+		}
+	}
+
+	return refs, nil
+}
+
+// ErrNoCommonHistory is returned when two commits share no ancestor
+var ErrNoCommonHistory = errors.New("no common history")
+
+// maxCompareCommits is the largest number of commits listed in a comparison
+const maxCompareCommits = 250
+
+// Comparison describes how a head commit differs from a base commit: the commits head has
+// since their merge base, and the changes those commits make
+type Comparison struct {
+	BaseCommit      string      `json:"base_commit"`
+	HeadCommit      string      `json:"head_commit"`
+	MergeBaseCommit string      `json:"merge_base_commit"`
+	Status          string      `json:"status"` // "identical", "ahead", "behind" or "diverged"
+	AheadBy         int         `json:"ahead_by"`
+	BehindBy        int         `json:"behind_by"`
+	TotalCommits    int         `json:"total_commits"`
+	Commits         []*Commit   `json:"commits"` // The newest maxCompareCommits at most, oldest first
+	Stats           CommitStats `json:"stats"`
+	ChangedFiles    int         `json:"changed_files"`
+	Files           []*FileDiff `json:"files"`
+}
+
+// CompareRefs compares two branches, tags or commits. Returns ErrRefNotFound if either does
+// not exist and ErrNoCommonHistory if they are unrelated.
+func CompareRefs(ctx context.Context, repoPath, base, head string) (*Comparison, error) {
+	baseSHA, err := ResolveCommit(ctx, repoPath, base)
+	if err != nil {
+		return nil, err
+	}
+	headSHA, err := ResolveCommit(ctx, repoPath, head)
+	if err != nil {
+		return nil, err
+	}
+
+	mergeBase, err := MergeBase(ctx, repoPath, baseSHA, headSHA)
+	if err != nil {
+		return nil, err
+	}
+	if mergeBase == "" {
+		return nil, ErrNoCommonHistory
+	}
+
+	comparison := &Comparison{
+		BaseCommit:      baseSHA,
+		HeadCommit:      headSHA,
+		MergeBaseCommit: mergeBase,
+	}
+
+	comparison.AheadBy, comparison.BehindBy, err = AheadBehind(ctx, repoPath, baseSHA, headSHA)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case comparison.AheadBy == 0 && comparison.BehindBy == 0:
+		comparison.Status = "identical"
+	case comparison.BehindBy == 0:
+		comparison.Status = "ahead"
+	case comparison.AheadBy == 0:
+		comparison.Status = "behind"
+	default:
+		comparison.Status = "diverged"
+	}
+
+	comparison.TotalCommits = comparison.AheadBy
+	comparison.Commits, err = GetNewCommits(ctx, repoPath, headSHA, []string{baseSHA}, maxCompareCommits)
+	if err != nil {
+		return nil, err
+	}
+
+	// The changes head makes since it split off from base, as a pull request would show them
+	comparison.Files, err = GetDiff(ctx, repoPath, mergeBase, headSHA)
+	if err != nil {
+		return nil, err
+	}
+	comparison.ChangedFiles = len(comparison.Files)
+	for _, file := range comparison.Files {
+		comparison.Stats.Additions += file.Additions
+		comparison.Stats.Deletions += file.Deletions
+	}
+	comparison.Stats.Total = comparison.Stats.Additions + comparison.Stats.Deletions
+
+	return comparison, nil
+}
+
+// GetDiffBetween returns the per-file changes head introduces relative to its merge base with base
+func GetDiffBetween(ctx context.Context, repoPath, base, head string) ([]*FileDiff, error) {
+	mergeBase, err := MergeBase(ctx, repoPath, base, head)
+	if err != nil {
+		return nil, err
+	}
+	if mergeBase == "" {
+		return nil, fmt.Errorf("%s and %s have no common history", base, head)
+	}
+
+	return GetDiff(ctx, repoPath, mergeBase, head)
+}
+
+// GetDiff returns the per-file changes between two commits, detecting renames
+func GetDiff(ctx context.Context, repoPath, from, to string) ([]*FileDiff, error) {
+	// File names and change types. With -z every field is NUL terminated:
+	// status, path, and for renames and copies a second path.
+	statusOut, err := runGit(ctx, repoPath, "diff", "-M", "--name-status", "-z", from, to)
+	if err != nil {
+		return nil, fmt.Errorf("error getting diff: %w", err)
+	}
+
+	diffs := []*FileDiff{}
+	fields := strings.Split(strings.TrimSuffix(statusOut, "\x00"), "\x00")
+	for i := 0; i < len(fields) && fields[i] != ""; {
+		status := fields[i]
+		diff := &FileDiff{}
+
+		switch status[0] {
+		case 'R', 'C':
+			if i+2 >= len(fields) {
+				return nil, fmt.Errorf("unexpected diff output")
+			}
+			diff.PreviousFilename = fields[i+1]
+			diff.Filename = fields[i+2]
+			if status[0] == 'R' {
+				diff.Status = "renamed"
+			} else {
+				diff.Status = "copied"
+			}
+			i += 3
+		default:
+			if i+1 >= len(fields) {
+				return nil, fmt.Errorf("unexpected diff output")
+			}
+			diff.Filename = fields[i+1]
+			diff.Status = diffStatusName(status[0])
+			i += 2
+		}
+
+		diffs = append(diffs, diff)
+	}
+
+	// Line counts, in the same order as the name-status output
+	numstatOut, err := runGit(ctx, repoPath, "diff", "-M", "--numstat", "-z", from, to)
+	if err != nil {
+		return nil, fmt.Errorf("error getting diff stats: %w", err)
+	}
+	stats := parseNumstat(numstatOut)
+
+	// The patch of every file, again in the same order
+	patchOut, err := runGit(ctx, repoPath, "diff", "-M", "--no-color", from, to)
+	if err != nil {
+		return nil, fmt.Errorf("error getting patch: %w", err)
+	}
+	patches := splitPatch(patchOut)
+
+	for i, diff := range diffs {
+		if i < len(stats) {
+			diff.Additions = stats[i].additions
+			diff.Deletions = stats[i].deletions
+			diff.Binary = stats[i].binary
+		}
+		if i < len(patches) && !diff.Binary {
+			diff.Patch = patches[i]
+		}
+	}
+
+	return diffs, nil
+}
+
+// diffStatusName converts a git status letter into the name used by the API
+func diffStatusName(status byte) string {
+	switch status {
+	case 'A':
+		return "added"
+	case 'D':
+		return "deleted"
+	case 'M':
+		return "modified"
+	default:
+		return "changed"
+	}
+}
+
+type numstat struct {
+	additions int
+	deletions int
+	binary    bool
+}
+
+// parseNumstat parses git diff --numstat -z output. Renames are printed as
+// "added<TAB>deleted<TAB>" followed by the old and new paths as separate fields.
+func parseNumstat(output string) []numstat {
+	stats := []numstat{}
+	fields := strings.Split(output, "\x00")
+
+	for i := 0; i < len(fields); i++ {
+		parts := strings.SplitN(fields[i], "\t", 3)
+		if len(parts) < 3 {
+			continue
+		}
+
+		var stat numstat
+		if parts[0] == "-" && parts[1] == "-" {
+			stat.binary = true
+		} else {
+			stat.additions, _ = strconv.Atoi(parts[0])
+			stat.deletions, _ = strconv.Atoi(parts[1])
+		}
+		stats = append(stats, stat)
+
+		// An empty path means the old and new paths of a rename follow
+		if parts[2] == "" {
+			i += 2
+		}
+	}
+
+	return stats
+}
+
+// splitPatch splits the output of git diff into one patch per file
+func splitPatch(output string) []string {
+	patches := []string{}
+	var current strings.Builder
+
+	for _, line := range strings.SplitAfter(output, "\n") {
+		if strings.HasPrefix(line, "diff --git ") && current.Len() > 0 {
+			patches = append(patches, current.String())
+			current.Reset()
+		}
+		current.WriteString(line)
+	}
+	if current.Len() > 0 {
+		patches = append(patches, current.String())
+	}
+
+	return patches
+}
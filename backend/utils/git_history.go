@@ -0,0 +1,155 @@
+package utils
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidCursor is returned when a pagination cursor was not produced by ListCommits
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// maxCommitPage is the largest number of commits returned by one call to ListCommits
+const maxCommitPage = 100
+
+// CommitQuery selects the commits listed by ListCommits. Zero values do not filter.
+type CommitQuery struct {
+	Ref    string    // Branch, tag or commit to start from, HEAD by default
+	Path   string    // Only commits changing this file or directory
+	Follow bool      // Follow renames when Path is a file
+	Author string    // Substring of the author name or email, case-insensitive
+	Since  time.Time // Only commits made at or after this time
+	Until  time.Time // Only commits made at or before this time
+	Limit  int       // Commits per page, 10 by default
+	Cursor string    // Where the previous page ended, as returned by ListCommits
+}
+
+// ListCommits lists one page of the history of a ref, newest first. It also returns the
+// cursor of the next page, or "" on the last page.
+//
+// The cursor records the commit the first page started from, so later pages are not
+// shifted by pushes made while paging. Reading the log stops when ctx is done.
+func ListCommits(ctx context.Context, repoPath string, query CommitQuery) ([]*Commit, string, error) {
+	limit := query.Limit
+	if limit <= 0 {
+		limit = 10
+	}
+	if limit > maxCommitPage {
+		limit = maxCommitPage
+	}
+
+	var head string
+	offset := 0
+	if query.Cursor != "" {
+		var err error
+		head, offset, err = decodeCommitCursor(query.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		if _, err := ResolveCommit(ctx, repoPath, head); err != nil {
+			return nil, "", ErrInvalidCursor
+		}
+	} else {
+		ref := query.Ref
+		if ref == "" {
+			ref = "HEAD"
+		}
+		var err error
+		head, err = ResolveCommit(ctx, repoPath, ref)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	args := []string{"log", commitLogFormat}
+	if query.Author != "" {
+		args = append(args, "--fixed-strings", "--regexp-ignore-case", "--author="+query.Author)
+	}
+	if !query.Since.IsZero() {
+		args = append(args, "--since="+query.Since.Format(time.RFC3339))
+	}
+	if !query.Until.IsZero() {
+		args = append(args, "--until="+query.Until.Format(time.RFC3339))
+	}
+
+	// git log --follow loses track of renames when commits are skipped, so with it the
+	// earlier pages are read again and dropped here. One extra commit is read to tell
+	// whether there is a next page.
+	follow := query.Follow && query.Path != "" && isFile(ctx, repoPath, head, query.Path)
+	if follow {
+		args = append(args, "--follow", "--max-count="+strconv.Itoa(offset+limit+1))
+	} else {
+		args = append(args, "--skip="+strconv.Itoa(offset), "--max-count="+strconv.Itoa(limit+1))
+	}
+
+	args = append(args, "--end-of-options", head, "--")
+	if query.Path != "" {
+		args = append(args, query.Path)
+	}
+
+	out, err := runGit(ctx, repoPath, args...)
+	if err != nil {
+		return nil, "", fmt.Errorf("error getting commit history: %w", err)
+	}
+
+	commits := parseCommitLog(out)
+	if follow {
+		if offset > len(commits) {
+			offset = len(commits)
+		}
+		commits = commits[offset:]
+	}
+
+	nextCursor := ""
+	if len(commits) > limit {
+		commits = commits[:limit]
+		nextCursor = encodeCommitCursor(head, offset+limit)
+	}
+
+	return commits, nextCursor, nil
+}
+
+// isFile reports whether a path is a file at a commit
+func isFile(ctx context.Context, repoPath, commit, path string) bool {
+	out, err := runGit(ctx, repoPath, "cat-file", "-t", commit+":"+path)
+	return err == nil && strings.TrimSpace(out) == "blob"
+}
+
+// encodeCommitCursor builds an opaque cursor from the commit paging started at and the
+// number of commits already returned
+func encodeCommitCursor(head string, offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(head + ":" + strconv.Itoa(offset)))
+}
+
+// decodeCommitCursor reverses encodeCommitCursor
+func decodeCommitCursor(cursor string) (string, int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", 0, ErrInvalidCursor
+	}
+
+	head, offsetStr, found := strings.Cut(string(raw), ":")
+	offset, err := strconv.Atoi(offsetStr)
+	if !found || err != nil || offset < 0 || !isHexSHA(head) {
+		return "", 0, ErrInvalidCursor
+	}
+
+	return head, offset, nil
+}
+
+// isHexSHA reports whether s looks like a full commit SHA
+func isHexSHA(s string) bool {
+	if len(s) != 40 && len(s) != 64 {
+		return false
+	}
+	for _, c := range s {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCommitCursorRoundTrip(t *testing.T) {
+	tests := []struct {
+		head   string
+		offset int
+	}{
+		{strings.Repeat("a", 40), 0},
+		{"0123456789abcdef0123456789abcdef01234567", 30},
+		{strings.Repeat("f", 64), 1 << 20},
+	}
+
+	for _, tt := range tests {
+		cursor := encodeCommitCursor(tt.head, tt.offset)
+		head, offset, err := decodeCommitCursor(cursor)
+		if err != nil || head != tt.head || offset != tt.offset {
+			t.Errorf("decodeCommitCursor(encodeCommitCursor(%s, %d)) = %s, %d, %v", tt.head, tt.offset, head, offset, err)
+		}
+	}
+}
+
+func TestDecodeCommitCursorInvalid(t *testing.T) {
+	sha := strings.Repeat("a", 40)
+	encode := func(s string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(s))
+	}
+
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{"empty", ""},
+		{"not base64", "!!!"},
+		{"padded base64", base64.URLEncoding.EncodeToString([]byte(sha + ":10"))},
+		{"no separator", encode(sha)},
+		{"negative offset", encode(sha + ":-1")},
+		{"offset not a number", encode(sha + ":ten")},
+		{"short SHA", encode("abc123:1")},
+		{"uppercase SHA", encode(strings.Repeat("A", 40) + ":1")},
+		{"ref name", encode("main:1")},
+		{"option-like head", encode("--all:1")},
+	}
+
+	for _, tt := range tests {
+		if _, _, err := decodeCommitCursor(tt.cursor); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("%s: decodeCommitCursor(%q) error %v, want ErrInvalidCursor", tt.name, tt.cursor, err)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Merge methods supported for pull requests
+const (
+	MergeMethodMerge  = "merge"
+	MergeMethodSquash = "squash"
+	MergeMethodRebase = "rebase"
+)
+
+// Merge errors
+var (
+	ErrMergeConflict      = errors.New("merge conflict")
+	ErrRebaseMergeCommits = errors.New("cannot rebase commits that contain merges")
+)
+
+// GitSignature identifies the author or committer of a commit
+type GitSignature struct {
+	Name  string
+	Email string
+}
+
+// IsValidMergeMethod reports whether a merge method is supported
+func IsValidMergeMethod(method string) bool {
+	return method == MergeMethodMerge || method == MergeMethodSquash || method == MergeMethodRebase
+}
+
+// mergeTree computes the tree that results from merging two commits without touching
+// any working tree. It returns ErrMergeConflict if the merge cannot be done automatically.
+func mergeTree(ctx context.Context, repoPath, base, head string) (string, error) {
+	ctx, cancel := WithGitTimeout(ctx, GitCommandTimeout())
+	defer cancel()
+
+	cmd := GitCommand(ctx, "-C", repoPath, "merge-tree", "--write-tree", "--no-messages", base, head)
+	out, err := cmd.Output()
+	if err != nil {
+		if LogGitAborted(ctx, "merge-tree "+base+" "+head+" in "+repoPath) {
+			return "", fmt.Errorf("git merge-tree: %w", ctx.Err())
+		}
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+			return "", ErrMergeConflict
+		}
+		return "", fmt.Errorf("git merge-tree: %w", err)
+	}
+
+	lines := strings.SplitN(strings.TrimSpace(string(out)), "\n", 2)
+	return lines[0], nil
+}
+
+// CanMergeCleanly reports whether head can be merged into base without conflicts
+func CanMergeCleanly(ctx context.Context, repoPath, base, head string) (bool, error) {
+	_, err := mergeTree(ctx, repoPath, base, head)
+	if err == ErrMergeConflict {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// signatureEnv returns the environment variables that set a commit's author and committer
+func signatureEnv(author, committer GitSignature) []string {
+	return []string{
+		"GIT_AUTHOR_NAME=" + author.Name,
+		"GIT_AUTHOR_EMAIL=" + author.Email,
+		"GIT_COMMITTER_NAME=" + committer.Name,
+		"GIT_COMMITTER_EMAIL=" + committer.Email,
+	}
+}
+
+// CreateMergeCommits combines head into base using the given method and returns the
+// resulting commit SHA. The new commits are written to the bare repository but no
+// branch is updated; use UpdateRef to move the base branch afterwards.
+//   - merge creates a merge commit with base and head as parents
+//   - squash creates a single commit on top of base with the combined changes
+//   - rebase replays every commit of head on top of base, keeping their authors
+func CreateMergeCommits(ctx context.Context, repoPath, method, baseSHA, headSHA, message string, author, committer GitSignature) (string, error) {
+	switch method {
+	case MergeMethodMerge, MergeMethodSquash:
+		tree, err := mergeTree(ctx, repoPath, baseSHA, headSHA)
+		if err != nil {
+			return "", err
+		}
+
+		args := []string{"commit-tree", tree, "-p", baseSHA}
+		if method == MergeMethodMerge {
+			args = append(args, "-p", headSHA)
+		}
+		args = append(args, "-m", message)
+
+		out, err := runGitEnv(ctx, repoPath, signatureEnv(author, committer), args...)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(out), nil
+
+	case MergeMethodRebase:
+		return rebaseCommits(ctx, repoPath, baseSHA, headSHA, committer)
+
+	default:
+		return "", fmt.Errorf("unsupported merge method: %s", method)
+	}
+}
+
+// rebaseCommits replays the commits of head that are not in base on top of base.
+// git cannot cherry-pick without a working tree, so this happens in a temporary clone
+// that shares the bare repository's objects; the new commits are fetched back afterwards.
+func rebaseCommits(ctx context.Context, repoPath, baseSHA, headSHA string, committer GitSignature) (string, error) {
+	merges, err := runGit(ctx, repoPath, "rev-list", "--merges", baseSHA+".."+headSHA)
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(merges) != "" {
+		return "", ErrRebaseMergeCommits
+	}
+
+	commitList, err := runGit(ctx, repoPath, "rev-list", "--reverse", baseSHA+".."+headSHA)
+	if err != nil {
+		return "", err
+	}
+	commits := strings.Fields(commitList)
+	if len(commits) == 0 {
+		return baseSHA, nil
+	}
+
+	workDir, err := os.MkdirTemp("", "rebase-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	if _, err := runGit(ctx, repoPath, "clone", "--quiet", "--shared", "--no-checkout", repoPath, workDir); err != nil {
+		return "", err
+	}
+	if _, err := runGit(ctx, workDir, "checkout", "--quiet", "--detach", baseSHA); err != nil {
+		return "", err
+	}
+
+	// Authors are kept from the original commits, only the committer changes
+	env := []string{
+		"GIT_COMMITTER_NAME=" + committer.Name,
+		"GIT_COMMITTER_EMAIL=" + committer.Email,
+	}
+	args := append([]string{"cherry-pick", "--allow-empty"}, commits...)
+	if _, err := runGitEnv(ctx, workDir, env, args...); err != nil {
+		return "", ErrMergeConflict
+	}
+
+	out, err := runGit(ctx, workDir, "rev-parse", "HEAD")
+	if err != nil {
+		return "", err
+	}
+	result := strings.TrimSpace(out)
+
+	// Bring the new commits into the bare repository through a temporary reference
+	tempRef := "refs/tmp/rebase-" + uuid.New().String()
+	if err := FetchIntoRef(ctx, repoPath, workDir, "HEAD", tempRef); err != nil {
+		return "", err
+	}
+	if err := DeleteRef(ctx, repoPath, tempRef); err != nil {
+		return "", err
+	}
+
+	return result, nil
+}
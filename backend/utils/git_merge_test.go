@@ -0,0 +1,146 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// writeTestCommit writes a commit with the given files into a bare repository and returns its
+// SHA, without updating any ref
+func writeTestCommit(t *testing.T, repoPath string, files map[string]string, message string, parents ...string) string {
+	t.Helper()
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var tree strings.Builder
+	for _, name := range names {
+		blob := runTestGitInput(t, repoPath, files[name], "hash-object", "-w", "--stdin")
+		tree.WriteString("100644 blob " + blob + "\t" + name + "\n")
+	}
+	treeSHA := runTestGitInput(t, repoPath, tree.String(), "mktree")
+
+	args := []string{"commit-tree", treeSHA, "-m", message}
+	for _, parent := range parents {
+		args = append(args, "-p", parent)
+	}
+	return runTestGit(t, repoPath, args...)
+}
+
+func TestCreateMergeCommits(t *testing.T) {
+	repoPath := filepath.Join(t.TempDir(), "repo.git")
+	if err := InitializeGitRepository(repoPath); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	author := GitSignature{Name: "Merge Author", Email: "author@example.com"}
+	committer := GitSignature{Name: "Merge Committer", Email: "committer@example.com"}
+
+	// base changes a.txt and head adds b.txt in two commits, so they merge cleanly
+	root := writeTestCommit(t, repoPath, map[string]string{"a.txt": "one\n"}, "root")
+	base := writeTestCommit(t, repoPath, map[string]string{"a.txt": "two\n"}, "base", root)
+	head1 := writeTestCommit(t, repoPath, map[string]string{"a.txt": "one\n", "b.txt": "b\n"}, "head 1", root)
+	head2 := writeTestCommit(t, repoPath, map[string]string{"a.txt": "one\n", "b.txt": "bb\n"}, "head 2", head1)
+	// conflicting changes a.txt differently from base
+	conflicting := writeTestCommit(t, repoPath, map[string]string{"a.txt": "three\n"}, "conflicting", root)
+
+	files := func(sha string) string {
+		return runTestGit(t, repoPath, "ls-tree", "--name-only", sha)
+	}
+	content := func(sha, name string) string {
+		return runTestGit(t, repoPath, "cat-file", "blob", sha+":"+name)
+	}
+	parents := func(sha string) []string {
+		return strings.Fields(runTestGit(t, repoPath, "rev-list", "--parents", "-n", "1", sha))[1:]
+	}
+
+	t.Run("merge", func(t *testing.T) {
+		sha, err := CreateMergeCommits(ctx, repoPath, MergeMethodMerge, base, head2, "Merge head", author, committer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := parents(sha); len(got) != 2 || got[0] != base || got[1] != head2 {
+			t.Errorf("parents %v, want [%s %s]", got, base, head2)
+		}
+		if content(sha, "a.txt") != "two" || content(sha, "b.txt") != "bb" {
+			t.Errorf("merged tree has a.txt %q and b.txt %q", content(sha, "a.txt"), content(sha, "b.txt"))
+		}
+		if got := runTestGit(t, repoPath, "show", "-s", "--format=%an <%ae>|%cn <%ce>|%s", sha); got != "Merge Author <author@example.com>|Merge Committer <committer@example.com>|Merge head" {
+			t.Errorf("commit %q", got)
+		}
+	})
+
+	t.Run("squash", func(t *testing.T) {
+		sha, err := CreateMergeCommits(ctx, repoPath, MergeMethodSquash, base, head2, "Squash head", author, committer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := parents(sha); len(got) != 1 || got[0] != base {
+			t.Errorf("parents %v, want [%s]", got, base)
+		}
+		if files(sha) != "a.txt\nb.txt" || content(sha, "b.txt") != "bb" {
+			t.Errorf("squashed tree has files %q", files(sha))
+		}
+	})
+
+	t.Run("rebase", func(t *testing.T) {
+		sha, err := CreateMergeCommits(ctx, repoPath, MergeMethodRebase, base, head2, "", author, committer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		log := runTestGit(t, repoPath, "log", "--format=%s|%an|%cn", base+".."+sha)
+		if log != "head 2|Test|Merge Committer\nhead 1|Test|Merge Committer" {
+			t.Errorf("rebased commits:\n%s", log)
+		}
+		if got := runTestGit(t, repoPath, "rev-parse", sha+"~2"); got != base {
+			t.Errorf("rebased commits start at %s, want %s", got, base)
+		}
+		if content(sha, "a.txt") != "two" || content(sha, "b.txt") != "bb" {
+			t.Errorf("rebased tree has a.txt %q and b.txt %q", content(sha, "a.txt"), content(sha, "b.txt"))
+		}
+		if refs := runTestGit(t, repoPath, "for-each-ref", "refs/tmp"); refs != "" {
+			t.Errorf("temporary refs left behind: %s", refs)
+		}
+	})
+
+	t.Run("rebase without new commits", func(t *testing.T) {
+		sha, err := CreateMergeCommits(ctx, repoPath, MergeMethodRebase, head2, head1, "", author, committer)
+		if err != nil || sha != head2 {
+			t.Errorf("got %s, %v, want %s", sha, err, head2)
+		}
+	})
+
+	t.Run("conflicts", func(t *testing.T) {
+		for _, method := range []string{MergeMethodMerge, MergeMethodSquash, MergeMethodRebase} {
+			if _, err := CreateMergeCommits(ctx, repoPath, method, base, conflicting, "m", author, committer); !errors.Is(err, ErrMergeConflict) {
+				t.Errorf("%s: error %v, want ErrMergeConflict", method, err)
+			}
+		}
+		if clean, err := CanMergeCleanly(ctx, repoPath, base, conflicting); err != nil || clean {
+			t.Errorf("CanMergeCleanly = %v, %v, want false", clean, err)
+		}
+		if clean, err := CanMergeCleanly(ctx, repoPath, base, head2); err != nil || !clean {
+			t.Errorf("CanMergeCleanly = %v, %v, want true", clean, err)
+		}
+	})
+
+	t.Run("rebase of merge commits", func(t *testing.T) {
+		merge := writeTestCommit(t, repoPath, map[string]string{"a.txt": "one\n", "b.txt": "bb\n"}, "merge", head2, root)
+		if _, err := CreateMergeCommits(ctx, repoPath, MergeMethodRebase, base, merge, "", author, committer); !errors.Is(err, ErrRebaseMergeCommits) {
+			t.Errorf("error %v, want ErrRebaseMergeCommits", err)
+		}
+	})
+
+	t.Run("unknown method", func(t *testing.T) {
+		if _, err := CreateMergeCommits(ctx, repoPath, "octopus", base, head2, "m", author, committer); err == nil {
+			t.Error("no error for an unknown merge method")
+		}
+	})
+}
@@ -0,0 +1,36 @@
+package utils
+
+// gitServeConfig is the configuration Git runs with when serving fetches and pushes to
+// clients. Filters let clients make partial clones, such as --filter=blob:none.
+var gitServeConfig = []string{
+	"uploadpack.allowFilter=true",
+}
+
+// GitServeArgs returns the arguments for running a Git command that serves clients, with
+// the serving configuration passed on the command line. Git passes it on to the commands
+// it runs, so it also reaches the upload-pack started by git http-backend.
+func GitServeArgs(args ...string) []string {
+	serveArgs := make([]string, 0, 2*len(gitServeConfig)+len(args))
+	for _, option := range gitServeConfig {
+		serveArgs = append(serveArgs, "-c", option)
+	}
+	return append(serveArgs, args...)
+}
+
+// IsValidGitProtocol reports whether a value sent by a client in the Git-Protocol header or
+// the GIT_PROTOCOL environment variable is safe to pass on to Git. The value is a list of
+// colon-separated key=value parameters, such as version=2.
+func IsValidGitProtocol(value string) bool {
+	if value == "" || len(value) > 256 {
+		return false
+	}
+	for _, c := range value {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '=', c == ':', c == '.', c == '-', c == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,223 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// zeroSHA stands for a ref that does not exist in update-ref, which then only creates refs
+const zeroSHA = "0000000000000000000000000000000000000000"
+
+// Branch is a branch of a repository with the commit it points to
+type Branch struct {
+	Name      string  `json:"name"`
+	Commit    *Commit `json:"commit"`
+	IsDefault bool    `json:"is_default"`
+	Protected bool    `json:"protected"`
+	// Commits the branch has that the default branch does not, and the other way round
+	Ahead  int `json:"ahead"`
+	Behind int `json:"behind"`
+}
+
+// Tag is a tag of a repository. Annotated tags have their own SHA, message and tagger;
+// the commit is the one the tag points to in both cases.
+type Tag struct {
+	Name        string     `json:"name"`
+	SHA         string     `json:"sha"`
+	Commit      *Commit    `json:"commit"`
+	Annotated   bool       `json:"annotated"`
+	Message     string     `json:"message,omitempty"`
+	Tagger      string     `json:"tagger,omitempty"`
+	TaggerEmail string     `json:"tagger_email,omitempty"`
+	TaggedAt    *time.Time `json:"tagged_at,omitempty"`
+}
+
+// refCommitFormat prints the commit a ref points to with for-each-ref. The starred variant
+// reads the commit an annotated tag points to.
+const refCommitFormat = "%(objectname)%00%(authorname)%00%(authoremail:trim)%00%(committerdate:iso-strict)%00%(contents:subject)"
+const peeledCommitFormat = "%(*objectname)%00%(*authorname)%00%(*authoremail:trim)%00%(*committerdate:iso-strict)%00%(*contents:subject)"
+
+// refCommit builds a commit from the five fields printed by refCommitFormat
+func refCommit(fields []string) *Commit {
+	commit := &Commit{
+		SHA:          fields[0],
+		Author:       fields[1],
+		Email:        fields[2],
+		TimestampStr: fields[3],
+		Message:      fields[4],
+	}
+	if timestamp, err := time.Parse(time.RFC3339, fields[3]); err == nil {
+		commit.Timestamp = timestamp
+	}
+	return commit
+}
+
+// IsValidRefName reports whether a branch or tag name can be used in a ref, following the
+// rules of git check-ref-format
+func IsValidRefName(name string) bool {
+	if name == "" || strings.HasPrefix(name, "-") || name == "HEAD" {
+		return false
+	}
+	_, err := runGit(context.Background(), ".", "check-ref-format", "refs/heads/"+name)
+	return err == nil
+}
+
+// GetDefaultBranch returns the branch HEAD points to
+func GetDefaultBranch(ctx context.Context, repoPath string) (string, error) {
+	out, err := runGit(ctx, repoPath, "symbolic-ref", "--short", "HEAD")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// SetDefaultBranch points HEAD at a branch. The branch does not need to exist yet, as in an
+// empty repository.
+func SetDefaultBranch(ctx context.Context, repoPath, branch string) error {
+	_, err := runGit(ctx, repoPath, "symbolic-ref", "HEAD", "refs/heads/"+branch)
+	return err
+}
+
+// ListBranches lists the branches of a repository by name. Ahead and behind counts are
+// relative to the default branch.
+func ListBranches(ctx context.Context, repoPath string) ([]*Branch, error) {
+	out, err := runGit(ctx, repoPath, "for-each-ref", "--sort=refname", "--format=%(refname:strip=2)%00"+refCommitFormat+"%1e", "refs/heads")
+	if err != nil {
+		return nil, fmt.Errorf("error listing branches: %w", err)
+	}
+
+	defaultBranch, _ := GetDefaultBranch(ctx, repoPath)
+
+	branches := []*Branch{}
+	for _, record := range strings.Split(out, "\x1e") {
+		fields := strings.Split(strings.TrimLeft(record, "\n"), "\x00")
+		if len(fields) < 6 {
+			continue
+		}
+
+		branch := &Branch{
+			Name:      fields[0],
+			Commit:    refCommit(fields[1:6]),
+			IsDefault: fields[0] == defaultBranch,
+		}
+
+		if !branch.IsDefault && defaultBranch != "" {
+			branch.Ahead, branch.Behind, err = AheadBehind(ctx, repoPath, "refs/heads/"+defaultBranch, branch.Commit.SHA)
+			if err != nil {
+				// The default branch may not exist yet
+				branch.Ahead, branch.Behind = 0, 0
+			}
+		}
+
+		branches = append(branches, branch)
+	}
+
+	return branches, nil
+}
+
+// GetBranch looks up a single branch, returning nil if it does not exist
+func GetBranch(ctx context.Context, repoPath, name string) (*Branch, error) {
+	branches, err := ListBranches(ctx, repoPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, branch := range branches {
+		if branch.Name == name {
+			return branch, nil
+		}
+	}
+	return nil, nil
+}
+
+// ListTags lists the tags of a repository, newest first
+func ListTags(ctx context.Context, repoPath string) ([]*Tag, error) {
+	format := "--format=%(refname:strip=2)%00%(objecttype)%00%(taggername)%00%(taggeremail:trim)%00%(taggerdate:iso-strict)%00%(contents)%00" +
+		refCommitFormat + "%00" + peeledCommitFormat + "%1e"
+	out, err := runGit(ctx, repoPath, "for-each-ref", "--sort=-creatordate", format, "refs/tags")
+	if err != nil {
+		return nil, fmt.Errorf("error listing tags: %w", err)
+	}
+
+	tags := []*Tag{}
+	for _, record := range strings.Split(out, "\x1e") {
+		fields := strings.Split(strings.TrimLeft(record, "\n"), "\x00")
+		if len(fields) < 16 {
+			continue
+		}
+
+		tag := &Tag{Name: fields[0], SHA: fields[6]}
+		switch fields[1] {
+		case "tag":
+			tag.Annotated = true
+			tag.Tagger = fields[2]
+			tag.TaggerEmail = fields[3]
+			if taggedAt, err := time.Parse(time.RFC3339, fields[4]); err == nil {
+				tag.TaggedAt = &taggedAt
+			}
+			tag.Message = strings.TrimSpace(fields[5])
+			tag.Commit = refCommit(fields[11:16])
+		case "commit":
+			tag.Commit = refCommit(fields[6:11])
+		default:
+			// Tags of trees and blobs have no commit
+		}
+
+		tags = append(tags, tag)
+	}
+
+	return tags, nil
+}
+
+// GetTag looks up a single tag, returning nil if it does not exist
+func GetTag(ctx context.Context, repoPath, name string) (*Tag, error) {
+	tags, err := ListTags(ctx, repoPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, tag := range tags {
+		if tag.Name == name {
+			return tag, nil
+		}
+	}
+	return nil, nil
+}
+
+// AheadBehind counts the commits head has that base does not (ahead) and the commits base
+// has that head does not (behind)
+func AheadBehind(ctx context.Context, repoPath, base, head string) (int, int, error) {
+	out, err := runGit(ctx, repoPath, "rev-list", "--left-right", "--count", base+"..."+head)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	fields := strings.Fields(out)
+	if len(fields) != 2 {
+		return 0, 0, fmt.Errorf("unexpected rev-list output: %q", out)
+	}
+	behind, _ := strconv.Atoi(fields[0])
+	ahead, _ := strconv.Atoi(fields[1])
+	return ahead, behind, nil
+}
+
+// CreateBranch creates a branch pointing at a commit, failing if the branch already exists
+func CreateBranch(ctx context.Context, repoPath, name, commitSHA string) error {
+	return UpdateRef(ctx, repoPath, "refs/heads/"+name, commitSHA, zeroSHA)
+}
+
+// CreateTag creates a tag pointing at a commit, failing if the tag already exists. With a
+// message the tag is annotated and records the tagger.
+func CreateTag(ctx context.Context, repoPath, name, commitSHA, message string, tagger GitSignature) error {
+	if message == "" {
+		return UpdateRef(ctx, repoPath, "refs/tags/"+name, commitSHA, zeroSHA)
+	}
+
+	env := []string{
+		"GIT_COMMITTER_NAME=" + tagger.Name,
+		"GIT_COMMITTER_EMAIL=" + tagger.Email,
+	}
+	_, err := runGitEnv(ctx, repoPath, env, "tag", "--annotate", "--message", message, name, commitSHA)
+	return err
+}
@@ -0,0 +1,110 @@
+package utils
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github-clone/githook"
+)
+
+// gitTestEnv is the environment of git commands run by tests, with a fixed identity and
+// without the hook variables of the server
+func gitTestEnv() []string {
+	env := []string{}
+	for _, v := range os.Environ() {
+		if !strings.HasPrefix(v, "NGH_") {
+			env = append(env, v)
+		}
+	}
+	return append(env,
+		"GIT_AUTHOR_NAME=Test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=Test", "GIT_COMMITTER_EMAIL=test@example.com")
+}
+
+// runTestGit runs git in dir and fails the test if it does not succeed
+func runTestGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	return runTestGitInput(t, dir, "", args...)
+}
+
+// runTestGitInput runs git in dir with the given standard input
+func runTestGitInput(t *testing.T, dir, stdin string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = gitTestEnv()
+	cmd.Stdin = strings.NewReader(stdin)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v: %v\n%s", args, err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func TestRepositoryHooksRefuseUncheckedPushes(t *testing.T) {
+	dir := t.TempDir()
+	repoPath := filepath.Join(dir, "repo.git")
+	if err := InitializeGitRepository(repoPath); err != nil {
+		t.Fatal(err)
+	}
+
+	workDir := filepath.Join(dir, "work")
+	runTestGit(t, dir, "init", "-q", "-b", "main", workDir)
+	if err := os.WriteFile(filepath.Join(workDir, "README.md"), []byte("hello\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	runTestGit(t, workDir, "add", ".")
+	runTestGit(t, workDir, "commit", "-q", "-m", "init")
+
+	// Before the server is configured the hooks do not know its binary; once it is, pushes
+	// that did not come through the server still lack the hook secret
+	for _, configured := range []bool{false, true} {
+		if configured {
+			githook.Configure("http://127.0.0.1:1/internal/hooks")
+		}
+		if err := CreateRepositoryHooks(repoPath); err != nil {
+			t.Fatal(err)
+		}
+
+		cmd := exec.Command("git", "push", "-q", repoPath, "main")
+		cmd.Dir = workDir
+		cmd.Env = gitTestEnv()
+		out, err := cmd.CombinedOutput()
+		if err == nil {
+			t.Fatalf("push accepted (configured: %v)", configured)
+		}
+		if !strings.Contains(string(out), "cannot be checked by the server") {
+			t.Errorf("push refused with unexpected output (configured: %v): %s", configured, out)
+		}
+		if refs := runTestGit(t, repoPath, "for-each-ref"); refs != "" {
+			t.Errorf("refused push updated refs: %s", refs)
+		}
+
+		// post-receive runs after the refs were updated and has nothing to refuse
+		postReceive := exec.Command(filepath.Join(repoPath, "hooks", githook.PostReceive))
+		postReceive.Env = gitTestEnv()
+		if err := postReceive.Run(); err != nil {
+			t.Errorf("post-receive failed (configured: %v): %v", configured, err)
+		}
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"/usr/local/bin/server", "'/usr/local/bin/server'"},
+		{"/srv/it's here/server", `'/srv/it'\''s here/server'`},
+		{"", "''"},
+	}
+
+	for _, tt := range tests {
+		if got := shellQuote(tt.in); got != tt.want {
+			t.Errorf("shellQuote(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// ErrLFSObjectMismatch is returned when uploaded content does not match its object ID
+var ErrLFSObjectMismatch = errors.New("content does not match the object ID")
+
+// LFSStoragePath returns the directory Git LFS objects are stored in. Objects are stored by
+// their SHA-256, so repositories holding the same file share a single copy.
+func LFSStoragePath() string {
+	storagePath := os.Getenv("LFS_STORAGE_PATH")
+	if storagePath == "" {
+		// Default to a subdirectory in the current working directory
+		dir, _ := os.Getwd()
+		storagePath = filepath.Join(dir, "lfs-objects")
+	}
+	return storagePath
+}
+
+// IsValidLFSOID reports whether an object ID is a lowercase hex SHA-256, as Git LFS uses
+func IsValidLFSOID(oid string) bool {
+	if len(oid) != 64 {
+		return false
+	}
+	for _, c := range oid {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// LFSObjectPath returns the path of a stored object, fanned out by the first bytes of its ID
+func LFSObjectPath(oid string) string {
+	return filepath.Join(LFSStoragePath(), oid[0:2], oid[2:4], oid)
+}
+
+// StoreLFSObject writes the content of an object to storage, returning its size. The content
+// is only kept if its SHA-256 matches the object ID.
+func StoreLFSObject(oid string, content io.Reader) (int64, error) {
+	objectPath := LFSObjectPath(oid)
+	if err := os.MkdirAll(filepath.Dir(objectPath), 0755); err != nil {
+		return 0, fmt.Errorf("error creating LFS object directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(objectPath), ".upload-*")
+	if err != nil {
+		return 0, fmt.Errorf("error creating LFS upload file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), content)
+	if err != nil {
+		return 0, err
+	}
+
+	if hex.EncodeToString(hash.Sum(nil)) != oid {
+		return 0, ErrLFSObjectMismatch
+	}
+
+	if err := tmp.Close(); err != nil {
+		return 0, fmt.Errorf("error writing LFS object: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), objectPath); err != nil {
+		return 0, fmt.Errorf("error storing LFS object: %w", err)
+	}
+
+	return size, nil
+}
@@ -0,0 +1,33 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIsValidLFSOID(t *testing.T) {
+	tests := []struct {
+		oid  string
+		want bool
+	}{
+		{"4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393", true},
+		{strings.Repeat("0", 64), true},
+		{strings.Repeat("f", 64), true},
+		{"", false},
+		{strings.Repeat("a", 63), false},
+		{strings.Repeat("a", 65), false},
+		{strings.Repeat("a", 40), false},                   // SHA-1
+		{strings.ToUpper(strings.Repeat("ab", 32)), false}, // Uppercase
+		{strings.Repeat("g", 64), false},                   // Not hex
+		{"../" + strings.Repeat("a", 61), false},           // Path traversal
+		{strings.Repeat("a", 62) + "/a", false},            // Path separator
+		{strings.Repeat("a", 63) + "\x00", false},          // NUL byte
+		{strings.Repeat("a", 62) + "é", false},             // Multi-byte character
+	}
+
+	for _, tt := range tests {
+		if got := IsValidLFSOID(tt.oid); got != tt.want {
+			t.Errorf("IsValidLFSOID(%q) = %v, want %v", tt.oid, got, tt.want)
+		}
+	}
+}
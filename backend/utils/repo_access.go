@@ -1,61 +1,191 @@
 package utils
 
+import (
+	"log"
+
+	"github-clone/config"
+)
+
+// Repository permission levels, ordered from weakest to strongest
+const (
+	PermissionNone  = ""
+	PermissionRead  = "read"
+	PermissionWrite = "write"
+	PermissionAdmin = "admin"
+)
+
+// PermissionLevel returns a comparable rank for a permission name
+func PermissionLevel(permission string) int {
+	switch permission {
+	case PermissionRead:
+		return 1
+	case PermissionWrite:
+		return 2
+	case PermissionAdmin:
+		return 3
+	default:
+		return 0
+	}
+}
+
+// IsValidPermission reports whether a permission can be granted to a user
+func IsValidPermission(permission string) bool {
+	return PermissionLevel(permission) > 0
+}
+
 // RepoAccessChecker interface for repository access permission checks
 type RepoAccessChecker interface {
 	// CanViewRepository checks if a user has permission to view a repository
-	CanViewRepository(repoOwnerID string, isPublic bool, userID string) bool
-	
+	CanViewRepository(repoID, repoOwnerID string, isPublic bool, userID string) bool
+
 	// CanEditRepository checks if a user has permission to edit a repository
-	CanEditRepository(repoOwnerID string, userID string) bool
-	
+	CanEditRepository(repoID, repoOwnerID string, userID string) bool
+
 	// CanCloneRepository checks if a user has permission to clone a repository
-	CanCloneRepository(repoOwnerID string, isPublic bool, userID string) bool
-	
+	CanCloneRepository(repoID, repoOwnerID string, isPublic bool, userID string) bool
+
 	// CanPushToRepository checks if a user has permission to push to a repository
-	CanPushToRepository(repoOwnerID string, userID string) bool
+	CanPushToRepository(repoID, repoOwnerID string, userID string) bool
+
+	// CanAdminRepository checks if a user can manage settings and collaborators of a repository
+	CanAdminRepository(repoID, repoOwnerID string, userID string) bool
 }
 
-// DefaultRepoAccess implements the RepoAccessChecker interface
+// DefaultRepoAccess implements the RepoAccessChecker interface using ownership only
 type DefaultRepoAccess struct{}
 
 // CanViewRepository checks if a user has permission to view a repository
 // Returns true if:
 // 1. The repository is public, or
 // 2. The user is the owner of the repository
-func (ra *DefaultRepoAccess) CanViewRepository(repoOwnerID string, isPublic bool, userID string) bool {
+func (ra *DefaultRepoAccess) CanViewRepository(repoID, repoOwnerID string, isPublic bool, userID string) bool {
 	// Public repositories can be viewed by anyone
 	if isPublic {
 		return true
 	}
-	
+
 	// Private repositories can only be viewed by their owners
 	return repoOwnerID == userID
 }
 
 // CanEditRepository checks if a user has permission to edit a repository
 // Returns true if the user is the owner of the repository
-func (ra *DefaultRepoAccess) CanEditRepository(repoOwnerID string, userID string) bool {
+func (ra *DefaultRepoAccess) CanEditRepository(repoID, repoOwnerID string, userID string) bool {
 	if userID == "" {
 		return false
 	}
-	
+
 	// Only repository owners can edit
 	return repoOwnerID == userID
 }
 
 // CanCloneRepository checks if a user has permission to clone a repository
 // This is the same as viewing permission
-func (ra *DefaultRepoAccess) CanCloneRepository(repoOwnerID string, isPublic bool, userID string) bool {
-	return ra.CanViewRepository(repoOwnerID, isPublic, userID)
+func (ra *DefaultRepoAccess) CanCloneRepository(repoID, repoOwnerID string, isPublic bool, userID string) bool {
+	return ra.CanViewRepository(repoID, repoOwnerID, isPublic, userID)
+}
+
+// CanPushToRepository checks if a user has permission to push to a repository
+// This is the same as edit permission
+func (ra *DefaultRepoAccess) CanPushToRepository(repoID, repoOwnerID string, userID string) bool {
+	return ra.CanEditRepository(repoID, repoOwnerID, userID)
+}
+
+// CanAdminRepository checks if a user can administer a repository
+// This is the same as edit permission
+func (ra *DefaultRepoAccess) CanAdminRepository(repoID, repoOwnerID string, userID string) bool {
+	return ra.CanEditRepository(repoID, repoOwnerID, userID)
+}
+
+// DBRepoAccess implements the RepoAccessChecker interface on top of the
+// repository_collaborators, organization_members and team_repositories tables,
+// so invited users and organization teams get the access they were granted
+type DBRepoAccess struct{}
+
+// Permission returns the effective permission a user holds on a repository
+func (ra *DBRepoAccess) Permission(repoID, repoOwnerID string, isPublic bool, userID string) string {
+	permission := PermissionNone
+	if isPublic {
+		permission = PermissionRead
+	}
+
+	if userID == "" {
+		return permission
+	}
+
+	// Owners always have full control
+	if repoOwnerID == userID {
+		return PermissionAdmin
+	}
+
+	// Collect every grant the user holds: direct collaborator access, organization
+	// membership (owners administer all organization repositories, members can read them)
+	// and access given to any team the user belongs to. The strongest one wins.
+	rows, err := config.DB.Query(`
+		SELECT permission FROM repository_collaborators
+		WHERE repository_id = ? AND user_id = ?
+		UNION ALL
+		SELECT CASE role WHEN 'owner' THEN 'admin' ELSE 'read' END FROM organization_members
+		WHERE organization_id = ? AND user_id = ?
+		UNION ALL
+		SELECT tr.permission FROM team_repositories tr
+		JOIN team_members tm ON tm.team_id = tr.team_id
+		WHERE tr.repository_id = ? AND tm.user_id = ?
+	`, repoID, userID, repoOwnerID, userID, repoID, userID)
+	if err != nil {
+		log.Printf("Error looking up permissions for user %s on repository %s: %v", userID, repoID, err)
+		return permission
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var granted string
+		if err := rows.Scan(&granted); err != nil {
+			log.Printf("Error reading permission for user %s on repository %s: %v", userID, repoID, err)
+			continue
+		}
+		if PermissionLevel(granted) > PermissionLevel(permission) {
+			permission = granted
+		}
+	}
+
+	return permission
+}
+
+// CanViewRepository checks if a user has at least read permission
+func (ra *DBRepoAccess) CanViewRepository(repoID, repoOwnerID string, isPublic bool, userID string) bool {
+	return PermissionLevel(ra.Permission(repoID, repoOwnerID, isPublic, userID)) >= PermissionLevel(PermissionRead)
+}
+
+// CanEditRepository checks if a user has at least write permission
+func (ra *DBRepoAccess) CanEditRepository(repoID, repoOwnerID string, userID string) bool {
+	if userID == "" {
+		return false
+	}
+	return PermissionLevel(ra.Permission(repoID, repoOwnerID, false, userID)) >= PermissionLevel(PermissionWrite)
+}
+
+// CanCloneRepository checks if a user has permission to clone a repository
+// This is the same as viewing permission
+func (ra *DBRepoAccess) CanCloneRepository(repoID, repoOwnerID string, isPublic bool, userID string) bool {
+	return ra.CanViewRepository(repoID, repoOwnerID, isPublic, userID)
 }
 
 // CanPushToRepository checks if a user has permission to push to a repository
 // This is the same as edit permission
-func (ra *DefaultRepoAccess) CanPushToRepository(repoOwnerID string, userID string) bool {
-	return ra.CanEditRepository(repoOwnerID, userID)
+func (ra *DBRepoAccess) CanPushToRepository(repoID, repoOwnerID string, userID string) bool {
+	return ra.CanEditRepository(repoID, repoOwnerID, userID)
+}
+
+// CanAdminRepository checks if a user has admin permission
+func (ra *DBRepoAccess) CanAdminRepository(repoID, repoOwnerID string, userID string) bool {
+	if userID == "" {
+		return false
+	}
+	return ra.Permission(repoID, repoOwnerID, false, userID) == PermissionAdmin
 }
 
-// NewRepoAccess creates a new DefaultRepoAccess instance
-func NewRepoAccess() *DefaultRepoAccess {
-	return &DefaultRepoAccess{}
+// NewRepoAccess creates the access checker used by the HTTP and SSH servers
+func NewRepoAccess() *DBRepoAccess {
+	return &DBRepoAccess{}
 }
@@ -0,0 +1,229 @@
+package utils_test
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github-clone/config"
+	"github-clone/models"
+	"github-clone/utils"
+)
+
+// TestMain runs the tests against a database and repository directory of their own
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "ngh-utils-test-*")
+	if err != nil {
+		log.Fatal(err)
+	}
+	os.Setenv("DB_PATH", filepath.Join(dir, "test.db"))
+	os.Setenv("REPOSITORIES_PATH", filepath.Join(dir, "repositories"))
+	log.SetOutput(io.Discard)
+
+	if err := config.ConnectDB(); err != nil {
+		log.Fatal(err)
+	}
+
+	code := m.Run()
+	config.DB.Close()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func TestDBRepoAccessPermission(t *testing.T) {
+	mustUser := func(name string) *models.User {
+		user, err := models.CreateUser(name, name+"@example.com", "x")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return user
+	}
+	owner := mustUser("accessowner")
+	reader := mustUser("accessreader")
+	writer := mustUser("accesswriter")
+	teamWriter := mustUser("accessteamwriter")
+	orgMember := mustUser("accessorgmember")
+	stranger := mustUser("accessstranger")
+
+	// A private and a public repository of a user, with collaborators
+	private, err := models.CreateRepository(owner.ID, models.RepositoryInput{Name: "private"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	public, err := models.CreateRepository(owner.ID, models.RepositoryInput{Name: "public", IsPublic: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, repo := range []*models.Repository{private, public} {
+		if _, err := models.AddCollaborator(repo.ID, reader.ID, models.CollaboratorInput{Permission: utils.PermissionRead}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := models.AddCollaborator(repo.ID, writer.ID, models.CollaboratorInput{Permission: utils.PermissionWrite}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A private repository of an organization, where a team has write access. The reader is
+	// also a read collaborator, and the strongest grant wins.
+	org, err := models.CreateOrganization(owner.ID, models.OrganizationInput{Name: "accessorg"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := models.SetOrganizationMember(org.ID, orgMember.ID, models.OrganizationMemberInput{Role: "member"}); err != nil {
+		t.Fatal(err)
+	}
+	orgRepo, err := models.CreateRepository(org.ID, models.RepositoryInput{Name: "orgrepo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	team, err := models.CreateTeam(org.ID, models.TeamInput{Name: "writers"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, user := range []*models.User{teamWriter, reader} {
+		if err := models.SetOrganizationMember(org.ID, user.ID, models.OrganizationMemberInput{Role: "member"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := models.AddTeamMember(team.ID, user.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := models.SetTeamRepository(team.ID, orgRepo.ID, models.TeamRepositoryInput{Permission: utils.PermissionWrite}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := models.AddCollaborator(orgRepo.ID, reader.ID, models.CollaboratorInput{Permission: utils.PermissionRead}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		repo   *models.Repository
+		userID string
+		want   string
+	}{
+		{"owner of private", private, owner.ID, utils.PermissionAdmin},
+		{"anonymous on private", private, "", utils.PermissionNone},
+		{"stranger on private", private, stranger.ID, utils.PermissionNone},
+		{"read collaborator on private", private, reader.ID, utils.PermissionRead},
+		{"write collaborator on private", private, writer.ID, utils.PermissionWrite},
+		{"anonymous on public", public, "", utils.PermissionRead},
+		{"stranger on public", public, stranger.ID, utils.PermissionRead},
+		{"write collaborator on public", public, writer.ID, utils.PermissionWrite},
+		{"organization owner", orgRepo, owner.ID, utils.PermissionAdmin},
+		{"organization member", orgRepo, orgMember.ID, utils.PermissionRead},
+		{"team member", orgRepo, teamWriter.ID, utils.PermissionWrite},
+		{"team member and read collaborator", orgRepo, reader.ID, utils.PermissionWrite},
+		{"stranger on organization repository", orgRepo, stranger.ID, utils.PermissionNone},
+	}
+
+	access := utils.NewRepoAccess()
+	for _, tt := range tests {
+		got := access.Permission(tt.repo.ID, tt.repo.OwnerID, tt.repo.IsPublic, tt.userID)
+		if got != tt.want {
+			t.Errorf("%s: Permission = %q, want %q", tt.name, got, tt.want)
+		}
+
+		level := utils.PermissionLevel(tt.want)
+		if access.CanViewRepository(tt.repo.ID, tt.repo.OwnerID, tt.repo.IsPublic, tt.userID) != (level >= 1) {
+			t.Errorf("%s: CanViewRepository does not match %q", tt.name, tt.want)
+		}
+		if access.CanPushToRepository(tt.repo.ID, tt.repo.OwnerID, tt.userID) != (level >= 2) {
+			t.Errorf("%s: CanPushToRepository does not match %q", tt.name, tt.want)
+		}
+		if access.CanAdminRepository(tt.repo.ID, tt.repo.OwnerID, tt.userID) != (level >= 3) {
+			t.Errorf("%s: CanAdminRepository does not match %q", tt.name, tt.want)
+		}
+	}
+}
+
+// TestDeletedTeamPermission checks that the members of a deleted team lose the access the
+// team gave them
+func TestDeletedTeamPermission(t *testing.T) {
+	owner, err := models.CreateUser("deletedteamowner", "deletedteamowner@example.com", "x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	member, err := models.CreateUser("deletedteammember", "deletedteammember@example.com", "x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	org, err := models.CreateOrganization(owner.ID, models.OrganizationInput{Name: "deletedteamorg"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err := models.CreateRepository(org.ID, models.RepositoryInput{Name: "repo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	team, err := models.CreateTeam(org.ID, models.TeamInput{Name: "admins"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := models.AddTeamMember(team.ID, member.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := models.SetTeamRepository(team.ID, repo.ID, models.TeamRepositoryInput{Permission: utils.PermissionAdmin}); err != nil {
+		t.Fatal(err)
+	}
+
+	access := utils.NewRepoAccess()
+	if got := access.Permission(repo.ID, repo.OwnerID, repo.IsPublic, member.ID); got != utils.PermissionAdmin {
+		t.Fatalf("Permission before deleting the team = %q, want %q", got, utils.PermissionAdmin)
+	}
+
+	if err := models.DeleteTeam(team.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got := access.Permission(repo.ID, repo.OwnerID, repo.IsPublic, member.ID); got != utils.PermissionNone {
+		t.Errorf("Permission after deleting the team = %q, want %q", got, utils.PermissionNone)
+	}
+
+	var rows int
+	err = config.DB.QueryRow(
+		"SELECT (SELECT COUNT(*) FROM team_members WHERE team_id = ?) + (SELECT COUNT(*) FROM team_repositories WHERE team_id = ?)",
+		team.ID, team.ID,
+	).Scan(&rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rows != 0 {
+		t.Errorf("%d team_members and team_repositories rows left after deleting the team", rows)
+	}
+}
+
+// TestForeignKeysOnEveryConnection checks that foreign keys are enforced on all the pooled
+// connections, not only the one the database was set up on
+func TestForeignKeysOnEveryConnection(t *testing.T) {
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		conn, err := config.DB.Conn(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+
+		var enabled int
+		if err := conn.QueryRowContext(ctx, "PRAGMA foreign_keys").Scan(&enabled); err != nil {
+			t.Fatal(err)
+		}
+		if enabled != 1 {
+			t.Errorf("connection %d: foreign_keys = %d, want 1", i, enabled)
+		}
+	}
+}
+
+func TestPermissionLevel(t *testing.T) {
+	if !(utils.PermissionLevel(utils.PermissionNone) < utils.PermissionLevel(utils.PermissionRead) &&
+		utils.PermissionLevel(utils.PermissionRead) < utils.PermissionLevel(utils.PermissionWrite) &&
+		utils.PermissionLevel(utils.PermissionWrite) < utils.PermissionLevel(utils.PermissionAdmin)) {
+		t.Error("permission levels are not ordered none < read < write < admin")
+	}
+	for _, p := range []string{"", "owner", "READ"} {
+		if utils.IsValidPermission(p) {
+			t.Errorf("IsValidPermission(%q) = true", p)
+		}
+	}
+}
@@ -1,11 +1,11 @@
 package utils
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"github-clone/config"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -77,7 +77,7 @@ func GetUserRepositoriesFromDB(username string) ([]Repository, error) {
 }
 
 // GetRepositoryCommitCount returns the number of commits in a repository
-func GetRepositoryCommitCount(username, repoName string) (int, error) {
+func GetRepositoryCommitCount(ctx context.Context, username, repoName string) (int, error) {
 	// Get base repository storage path - using "repositories" folder with .git suffix
 	dir, _ := os.Getwd()
 	repoBasePath := filepath.Join(dir, "repositories")
@@ -86,14 +86,13 @@ func GetRepositoryCommitCount(username, repoName string) (int, error) {
 	repoPath := filepath.Join(repoBasePath, username, repoName+".git")
 
 	// Use git rev-list command to count all commits
-	cmd := exec.Command("git", "-C", repoPath, "rev-list", "--count", "HEAD")
-	output, err := cmd.Output()
+	output, err := runGit(ctx, repoPath, "rev-list", "--count", "HEAD")
 	if err != nil {
 		return 0, fmt.Errorf("error counting commits: %v", err)
 	}
 
 	// Parse the output to get the commit count
-	commitCount, err := strconv.Atoi(strings.TrimSpace(string(output)))
+	commitCount, err := strconv.Atoi(strings.TrimSpace(output))
 	if err != nil {
 		return 0, fmt.Errorf("error parsing commit count: %v", err)
 	}
@@ -0,0 +1,61 @@
+package webhook
+
+import (
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// ErrInternalAddress is returned when a webhook would be sent to an address of the server
+// itself or of its private network
+var ErrInternalAddress = errors.New("webhooks cannot be sent to loopback, link-local, private or unspecified addresses")
+
+// allowInternalAddresses reports whether webhooks may be sent to internal addresses, for
+// servers whose receivers run on the same network. Set WEBHOOK_ALLOW_INTERNAL=true to allow it.
+func allowInternalAddresses() bool {
+	return os.Getenv("WEBHOOK_ALLOW_INTERNAL") == "true"
+}
+
+// IsAllowedAddress reports whether webhooks may be sent to an IP address. Webhook URLs are
+// chosen by repository admins, so the server refuses to make requests on their behalf to
+// itself or to the other hosts of its network, whose responses are kept in the delivery history.
+func IsAllowedAddress(ip net.IP) bool {
+	if allowInternalAddresses() {
+		return true
+	}
+	return !ip.IsLoopback() && !ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() && !ip.IsPrivate() && !ip.IsUnspecified()
+}
+
+// IsAllowedHost reports whether a webhook URL may name a host. Only names that are known to be
+// internal and literal addresses are checked here; other names are checked when a delivery
+// connects, since they may resolve to a different address by then.
+func IsAllowedHost(host string) bool {
+	if allowInternalAddresses() {
+		return true
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return false
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return IsAllowedAddress(ip)
+	}
+	return true
+}
+
+// checkDialAddress is the Control function of the dialer used for deliveries. It runs for the
+// address actually connected to, after the host name was resolved, so names resolving to an
+// internal address are refused even if they did not when the webhook was saved.
+func checkDialAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !IsAllowedAddress(ip) {
+		return ErrInternalAddress
+	}
+	return nil
+}
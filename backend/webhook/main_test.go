@@ -0,0 +1,31 @@
+package webhook
+
+import (
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github-clone/config"
+)
+
+// TestMain runs the tests against a database of their own
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "ngh-webhook-test-*")
+	if err != nil {
+		log.Fatal(err)
+	}
+	os.Setenv("DB_PATH", filepath.Join(dir, "test.db"))
+	os.Setenv("REPOSITORIES_PATH", filepath.Join(dir, "repositories"))
+	log.SetOutput(io.Discard)
+
+	if err := config.ConnectDB(); err != nil {
+		log.Fatal(err)
+	}
+
+	code := m.Run()
+	config.DB.Close()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
@@ -0,0 +1,316 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github-clone/models"
+	"github-clone/utils"
+)
+
+// zeroSHA is reported as the old or new commit of a ref that was created or deleted
+const zeroSHA = "0000000000000000000000000000000000000000"
+
+// maxPushCommits is the largest number of commits listed in a push payload
+const maxPushCommits = 20
+
+// User identifies the user who triggered an event. Pushes made with a deploy key
+// carry the key's ID instead of a user.
+type User struct {
+	ID          string `json:"id,omitempty"`
+	Username    string `json:"username,omitempty"`
+	DeployKeyID string `json:"deploy_key_id,omitempty"`
+}
+
+// Repository describes the repository an event happened in
+type Repository struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	FullName string `json:"full_name"`
+	Owner    string `json:"owner"`
+	IsPublic bool   `json:"is_public"`
+	ParentID string `json:"parent_id,omitempty"`
+}
+
+// Commit describes a commit in a push payload
+type Commit struct {
+	SHA       string    `json:"sha"`
+	Message   string    `json:"message"`
+	Author    string    `json:"author"`
+	Email     string    `json:"email"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// PushPayload is sent for every branch or tag updated by a push
+type PushPayload struct {
+	Ref        string     `json:"ref"`
+	Before     string     `json:"before"`
+	After      string     `json:"after"`
+	Created    bool       `json:"created"`
+	Deleted    bool       `json:"deleted"`
+	Forced     bool       `json:"forced"`
+	Commits    []Commit   `json:"commits"`
+	Repository Repository `json:"repository"`
+	Sender     User       `json:"sender"`
+}
+
+// IssuePayload is sent when an issue is opened, closed or reopened
+type IssuePayload struct {
+	Action     string        `json:"action"`
+	Issue      *models.Issue `json:"issue"`
+	Repository Repository    `json:"repository"`
+	Sender     User          `json:"sender"`
+}
+
+// IssueVotePayload is sent when a user votes on an issue or removes their vote
+type IssueVotePayload struct {
+	Action     string        `json:"action"` // "voted" or "removed"
+	Vote       int           `json:"vote"`   // 1 for upvote, -1 for downvote, 0 when removed
+	Issue      *models.Issue `json:"issue"`
+	Repository Repository    `json:"repository"`
+	Sender     User          `json:"sender"`
+}
+
+// RepositoryPayload is sent when a repository is updated or deleted
+type RepositoryPayload struct {
+	Action     string                 `json:"action"` // "updated" or "deleted"
+	Changes    map[string]interface{} `json:"changes,omitempty"`
+	Repository Repository             `json:"repository"`
+	Sender     User                   `json:"sender"`
+}
+
+// PingPayload is sent when a webhook is created
+type PingPayload struct {
+	HookID     string     `json:"hook_id"`
+	Events     []string   `json:"events"`
+	Repository Repository `json:"repository"`
+	Sender     User       `json:"sender"`
+}
+
+// repositoryInfo converts a repository into its payload form
+func repositoryInfo(repo *models.Repository) Repository {
+	info := Repository{
+		ID:       repo.ID,
+		Name:     repo.Name,
+		FullName: repo.Name,
+		IsPublic: repo.IsPublic,
+		ParentID: repo.ParentID,
+	}
+	if repo.Owner != nil {
+		info.Owner = repo.Owner.Username
+		info.FullName = repo.Owner.Username + "/" + repo.Name
+	}
+	return info
+}
+
+// Sign returns the value of the X-Signature header for a payload: the HMAC-SHA256 of the
+// body keyed with the webhook secret, hex encoded and prefixed with "sha256="
+func Sign(secret string, payload []byte) string {
+	if secret == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Dispatch queues an event for every active webhook of the repository subscribed to it
+func Dispatch(repo *models.Repository, event string, payload interface{}) {
+	hooks, err := models.GetRepositoryWebhooks(repo.ID)
+	if err != nil {
+		log.Printf("Failed to load webhooks of repository %s: %v", repo.ID, err)
+		return
+	}
+
+	dispatchTo(hooks, event, payload, false)
+}
+
+// dispatchTo queues an event for the given webhooks. Detached deliveries are not linked to
+// their webhook, for webhooks that no longer exist once the delivery is sent.
+func dispatchTo(hooks []*models.Webhook, event string, payload interface{}, detached bool) {
+	var body []byte
+	var err error
+	queued := 0
+	for _, hook := range hooks {
+		if !hook.Active || !hook.Subscribes(event) {
+			continue
+		}
+
+		// The payload is only encoded when someone listens for it
+		if body == nil {
+			body, err = json.Marshal(payload)
+			if err != nil {
+				log.Printf("Failed to encode %s webhook payload: %v", event, err)
+				return
+			}
+		}
+
+		hookID := hook.ID
+		if detached {
+			hookID = ""
+		}
+		if _, err := models.CreateWebhookDelivery(hookID, event, hook.URL, string(body), Sign(hook.Secret, body), ""); err != nil {
+			log.Printf("Failed to queue %s delivery for webhook %s: %v", event, hook.ID, err)
+			continue
+		}
+		queued++
+	}
+
+	if queued > 0 {
+		wakeWorker()
+	}
+}
+
+// enqueue stores a delivery for a webhook, signed with its current secret
+func enqueue(hook *models.Webhook, event string, body []byte, redeliveryOf string) error {
+	_, err := models.CreateWebhookDelivery(hook.ID, event, hook.URL, string(body), Sign(hook.Secret, body), redeliveryOf)
+	return err
+}
+
+// Ping sends a ping event to a newly created webhook
+func Ping(repo *models.Repository, hook *models.Webhook, sender User) {
+	body, err := json.Marshal(PingPayload{
+		HookID:     hook.ID,
+		Events:     hook.Events,
+		Repository: repositoryInfo(repo),
+		Sender:     sender,
+	})
+	if err != nil {
+		log.Printf("Failed to encode ping payload: %v", err)
+		return
+	}
+
+	if err := enqueue(hook, models.WebhookEventPing, body, ""); err != nil {
+		log.Printf("Failed to queue ping for webhook %s: %v", hook.ID, err)
+		return
+	}
+	wakeWorker()
+}
+
+// Redeliver queues a new delivery with the payload of an earlier one. The request is sent
+// to the webhook's current URL and signed with its current secret.
+func Redeliver(hook *models.Webhook, delivery *models.WebhookDelivery) (*models.WebhookDelivery, error) {
+	body := []byte(delivery.Payload)
+	redelivery, err := models.CreateWebhookDelivery(hook.ID, delivery.Event, hook.URL, delivery.Payload, Sign(hook.Secret, body), delivery.ID)
+	if err != nil {
+		return nil, err
+	}
+	wakeWorker()
+	return redelivery, nil
+}
+
+// Push queues push events for every branch and tag that differs between two snapshots of
+// a repository's refs taken before and after a push
+func Push(repo *models.Repository, repoPath string, pusher User, before, after map[string]string) {
+	refs := []string{}
+	for ref := range before {
+		if after[ref] != before[ref] {
+			refs = append(refs, ref)
+		}
+	}
+	for ref := range after {
+		if _, existed := before[ref]; !existed {
+			refs = append(refs, ref)
+		}
+	}
+	sort.Strings(refs)
+
+	// Commits that were already in the repository before the push are not new
+	oldTips := []string{}
+	for _, sha := range before {
+		oldTips = append(oldTips, sha)
+	}
+
+	// The push has already happened, so its events are built even if the pusher goes away
+	ctx := context.Background()
+
+	for _, ref := range refs {
+		payload := PushPayload{
+			Ref:        ref,
+			Before:     before[ref],
+			After:      after[ref],
+			Commits:    []Commit{},
+			Repository: repositoryInfo(repo),
+			Sender:     pusher,
+		}
+		if payload.Before == "" {
+			payload.Before = zeroSHA
+			payload.Created = true
+		}
+		if payload.After == "" {
+			payload.After = zeroSHA
+			payload.Deleted = true
+		}
+
+		if !payload.Deleted {
+			if !payload.Created && strings.HasPrefix(ref, "refs/heads/") {
+				isAncestor, err := utils.IsAncestor(ctx, repoPath, payload.Before, payload.After)
+				payload.Forced = err == nil && !isAncestor
+			}
+
+			commits, err := utils.GetNewCommits(ctx, repoPath, payload.After, oldTips, maxPushCommits)
+			if err != nil {
+				log.Printf("Failed to list pushed commits of %s: %v", ref, err)
+			}
+			for _, c := range commits {
+				payload.Commits = append(payload.Commits, Commit{
+					SHA:       c.SHA,
+					Message:   c.Message,
+					Author:    c.Author,
+					Email:     c.Email,
+					Timestamp: c.Timestamp,
+				})
+			}
+		}
+
+		Dispatch(repo, models.WebhookEventPush, payload)
+	}
+}
+
+// Issue queues an issues event
+func Issue(repo *models.Repository, sender User, action string, issue *models.Issue) {
+	Dispatch(repo, models.WebhookEventIssues, IssuePayload{
+		Action:     action,
+		Issue:      issue,
+		Repository: repositoryInfo(repo),
+		Sender:     sender,
+	})
+}
+
+// IssueVote queues an issue_vote event
+func IssueVote(repo *models.Repository, sender User, action string, vote int, issue *models.Issue) {
+	Dispatch(repo, models.WebhookEventIssueVote, IssueVotePayload{
+		Action:     action,
+		Vote:       vote,
+		Issue:      issue,
+		Repository: repositoryInfo(repo),
+		Sender:     sender,
+	})
+}
+
+// RepositoryDeleted queues a repository event for a deleted repository. The webhooks
+// must have been loaded before the repository was deleted.
+func RepositoryDeleted(hooks []*models.Webhook, repo *models.Repository, sender User) {
+	dispatchTo(hooks, models.WebhookEventRepository, RepositoryPayload{
+		Action:     "deleted",
+		Repository: repositoryInfo(repo),
+		Sender:     sender,
+	}, true)
+}
+
+// RepositoryEvent queues a repository event
+func RepositoryEvent(repo *models.Repository, sender User, action string, changes map[string]interface{}) {
+	Dispatch(repo, models.WebhookEventRepository, RepositoryPayload{
+		Action:     action,
+		Changes:    changes,
+		Repository: repositoryInfo(repo),
+		Sender:     sender,
+	})
+}
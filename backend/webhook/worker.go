@@ -0,0 +1,190 @@
+package webhook
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github-clone/models"
+)
+
+const (
+	// MaxAttempts is how many times a delivery is tried before it is marked as failed
+	MaxAttempts = 8
+
+	// retryBaseDelay is the wait after the first failed attempt; it doubles with every attempt
+	retryBaseDelay = 15 * time.Second
+
+	// retryMaxDelay caps the wait between attempts
+	retryMaxDelay = time.Hour
+
+	// pollInterval is how often the queue is checked for deliveries that are due for a retry
+	pollInterval = 5 * time.Second
+
+	// requestTimeout limits how long a receiver may take to answer
+	requestTimeout = 10 * time.Second
+
+	// maxResponseBody is how much of a response is kept in the delivery history
+	maxResponseBody = 4096
+)
+
+var (
+	wake      = make(chan struct{}, 1)
+	startOnce sync.Once
+
+	client = &http.Client{
+		Timeout: requestTimeout,
+		// Deliveries connect to receivers directly, never through a proxy, so the dialer
+		// can refuse internal addresses
+		Transport: &http.Transport{
+			DialContext: (&net.Dialer{
+				Timeout: requestTimeout,
+				Control: checkDialAddress,
+			}).DialContext,
+			TLSHandshakeTimeout: requestTimeout,
+			IdleConnTimeout:     90 * time.Second,
+			MaxIdleConns:        10,
+		},
+		// Receivers must answer the configured URL themselves
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+)
+
+// Start runs the delivery worker in the background. Deliveries are stored in the database,
+// so anything still pending when the server stopped is sent after it starts again.
+func Start() {
+	startOnce.Do(func() {
+		go run()
+	})
+}
+
+// wakeWorker makes the worker check the queue without waiting for the next poll
+func wakeWorker() {
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+}
+
+// run delivers due deliveries until the process exits
+func run() {
+	log.Printf("Webhook delivery worker started")
+	for {
+		deliverDue()
+
+		select {
+		case <-wake:
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// deliverDue sends every delivery whose next attempt is due. It stops at the first attempt
+// that cannot be recorded: that delivery is still due, and would otherwise be sent again
+// right away for as long as the database fails.
+func deliverDue() {
+	for {
+		deliveries, err := models.GetDueWebhookDeliveries(time.Now().UTC(), 20)
+		if err != nil {
+			log.Printf("Failed to load webhook deliveries: %v", err)
+			return
+		}
+		if len(deliveries) == 0 {
+			return
+		}
+
+		for _, delivery := range deliveries {
+			if err := attempt(delivery); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// attempt sends a delivery once and records the outcome. Failed deliveries are retried
+// with exponential backoff until MaxAttempts is reached. The error is that of recording
+// the outcome; failing to send is an outcome.
+func attempt(delivery *models.WebhookDelivery) error {
+	started := time.Now().UTC()
+	status, body, err := send(delivery)
+
+	delivery.Attempts++
+	delivery.LastAttemptAt = &started
+	delivery.DurationMs = time.Since(started).Milliseconds()
+	delivery.ResponseStatus = status
+	delivery.ResponseBody = body
+	delivery.Error = ""
+	delivery.NextAttemptAt = nil
+
+	switch {
+	case err == nil && status >= 200 && status < 300:
+		delivery.Status = models.DeliveryDelivered
+	default:
+		if err != nil {
+			delivery.Error = err.Error()
+		} else {
+			delivery.Error = http.StatusText(status)
+		}
+
+		if delivery.Attempts >= MaxAttempts {
+			delivery.Status = models.DeliveryFailed
+		} else {
+			next := started.Add(retryDelay(delivery.Attempts))
+			delivery.NextAttemptAt = &next
+		}
+	}
+
+	if delivery.Status != models.DeliveryDelivered {
+		log.Printf("Webhook delivery %s to %s failed (attempt %d): %s", delivery.ID, delivery.URL, delivery.Attempts, delivery.Error)
+	}
+
+	if err := models.RecordWebhookDeliveryAttempt(delivery); err != nil {
+		log.Printf("Failed to record webhook delivery %s: %v", delivery.ID, err)
+		return err
+	}
+
+	return nil
+}
+
+// retryDelay returns the wait before the next attempt after the given number of attempts
+func retryDelay(attempts int) time.Duration {
+	delay := retryBaseDelay
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= retryMaxDelay {
+			return retryMaxDelay
+		}
+	}
+	return delay
+}
+
+// send posts a delivery's payload and returns the response status and the start of its body
+func send(delivery *models.WebhookDelivery) (int, string, error) {
+	req, err := http.NewRequest(http.MethodPost, delivery.URL, bytes.NewBufferString(delivery.Payload))
+	if err != nil {
+		return 0, "", err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "NotGitHub-Webhook/1.0")
+	req.Header.Set("X-Event", delivery.Event)
+	req.Header.Set("X-Delivery", delivery.ID)
+	if delivery.Signature != "" {
+		req.Header.Set("X-Signature", delivery.Signature)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	return resp.StatusCode, string(body), nil
+}
@@ -0,0 +1,176 @@
+package webhook
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github-clone/config"
+	"github-clone/models"
+)
+
+func TestSign(t *testing.T) {
+	tests := []struct {
+		secret  string
+		payload string
+		want    string
+	}{
+		{"secret", `{"zen":"hi"}`, "sha256=a3fb8cb2d37fc18eec1b036a46a9a8ebd8e210d829b0b02a4be4d03b1d259492"},
+		{"", `{"zen":"hi"}`, ""},
+	}
+
+	for _, tt := range tests {
+		if got := Sign(tt.secret, []byte(tt.payload)); got != tt.want {
+			t.Errorf("Sign(%q, %q) = %q, want %q", tt.secret, tt.payload, got, tt.want)
+		}
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 15 * time.Second},
+		{2, 30 * time.Second},
+		{3, time.Minute},
+		{5, 4 * time.Minute},
+		{8, 32 * time.Minute},
+		{9, time.Hour},
+		{50, time.Hour},
+	}
+
+	for _, tt := range tests {
+		if got := retryDelay(tt.attempts); got != tt.want {
+			t.Errorf("retryDelay(%d) = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestIsAllowedHost(t *testing.T) {
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{"example.com", true},
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"localhost", false},
+		{"LocalHost.", false},
+		{"api.localhost", false},
+		{"127.0.0.1", false},
+		{"127.1.2.3", false},
+		{"::1", false},
+		{"::ffff:127.0.0.1", false},
+		{"0.0.0.0", false},
+		{"::", false},
+		{"10.0.0.5", false},
+		{"172.16.3.4", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsAllowedHost(tt.host); got != tt.want {
+			t.Errorf("IsAllowedHost(%q) = %v, want %v", tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestAllowInternalAddresses(t *testing.T) {
+	t.Setenv("WEBHOOK_ALLOW_INTERNAL", "true")
+	if !IsAllowedHost("127.0.0.1") || !IsAllowedHost("localhost") {
+		t.Error("WEBHOOK_ALLOW_INTERNAL=true should allow internal hosts")
+	}
+}
+
+// TestSendRefusesInternalAddress checks that the address is checked when connecting, so host
+// names resolving to an internal address are refused as well
+func TestSendRefusesInternalAddress(t *testing.T) {
+	called := false
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		w.Write([]byte("internal data"))
+	}))
+	defer receiver.Close()
+
+	urls := []string{receiver.URL, "http://localhost:" + receiver.URL[len("http://127.0.0.1:"):]}
+	for _, url := range urls {
+		status, body, err := send(&models.WebhookDelivery{URL: url, Event: "ping", Payload: "{}"})
+		if !errors.Is(err, ErrInternalAddress) {
+			t.Errorf("send to %s: error %v, want ErrInternalAddress", url, err)
+		}
+		if status != 0 || body != "" {
+			t.Errorf("send to %s: got status %d and body %q", url, status, body)
+		}
+	}
+	if called {
+		t.Error("the internal receiver was reached")
+	}
+
+	t.Setenv("WEBHOOK_ALLOW_INTERNAL", "true")
+	status, body, err := send(&models.WebhookDelivery{URL: receiver.URL, Event: "ping", Payload: "{}"})
+	if err != nil || status != http.StatusOK || body != "internal data" {
+		t.Errorf("send with WEBHOOK_ALLOW_INTERNAL=true: %d %q %v", status, body, err)
+	}
+}
+
+// TestDeliverDueStopsWhenRecordingFails checks that a delivery whose attempt cannot be
+// recorded is not sent again in the same pass, since it is still due
+func TestDeliverDueStopsWhenRecordingFails(t *testing.T) {
+	t.Setenv("WEBHOOK_ALLOW_INTERNAL", "true")
+
+	var requests atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+	}))
+	defer receiver.Close()
+
+	delivery, err := models.CreateWebhookDelivery("", "ping", receiver.URL, "{}", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = config.DB.Exec(`
+		CREATE TRIGGER fail_delivery_updates BEFORE UPDATE ON webhook_deliveries
+		BEGIN SELECT RAISE(ABORT, 'database unavailable'); END
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		deliverDue()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("deliverDue did not return; the receiver got %d requests", requests.Load())
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("the receiver got %d requests, want 1", n)
+	}
+
+	// Once the database recovers, the next pass sends the delivery again and records it
+	if _, err := config.DB.Exec("DROP TRIGGER fail_delivery_updates"); err != nil {
+		t.Fatal(err)
+	}
+	deliverDue()
+	if n := requests.Load(); n != 2 {
+		t.Errorf("the receiver got %d requests after recovering, want 2", n)
+	}
+	got, err := models.GetWebhookDelivery(delivery.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != models.DeliveryDelivered || got.Attempts != 1 {
+		t.Errorf("delivery is %s after %d attempts, want delivered after 1", got.Status, got.Attempts)
+	}
+}